@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf bench' times the hot paths on real documents: parsing, validation
+// and the INDEX rebuild, with the allocations each makes. The rebuild is
+// planned but not written, so benchmarking leaves the files untouched.
+
+// benchPhases are the measured operations, in report order
+var benchPhases = []string{"parse", "validate", "rebuild"}
+
+// benchArgs are the parsed arguments of 'iatf bench' after the path
+type benchArgs struct {
+	iterations int
+	json       bool
+}
+
+// BenchReport is the output of 'iatf bench --json'
+type BenchReport struct {
+	Iterations int           `json:"iterations"`
+	Files      []BenchFile   `json:"files"`
+	Totals     []BenchResult `json:"totals"` // Per phase, summed over the files
+}
+
+// BenchFile is the measurements of one file
+type BenchFile struct {
+	File     string        `json:"file"`
+	Bytes    int64         `json:"bytes"`
+	Lines    int           `json:"lines"`
+	Sections int           `json:"sections"`
+	Phases   []BenchResult `json:"phases"`
+}
+
+// BenchResult is the cost of one operation, averaged over the iterations
+type BenchResult struct {
+	Phase       string `json:"phase"`
+	NsPerOp     int64  `json:"nsPerOp"`
+	AllocsPerOp uint64 `json:"allocsPerOp"`
+	BytesPerOp  uint64 `json:"bytesPerOp"`
+	Error       string `json:"error,omitempty"`
+}
+
+// parseBenchArgs reads --iterations <n> and --json
+func parseBenchArgs(args []string) (benchArgs, error) {
+	parsed := benchArgs{iterations: 10}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			parsed.json = true
+		case "--iterations":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("%s requires a value", args[i])
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return parsed, fmt.Errorf("invalid iteration count %q (expected a positive number)", args[i+1])
+			}
+			parsed.iterations = n
+			i++
+		default:
+			return parsed, fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	return parsed, nil
+}
+
+// measure runs fn iterations times and returns its average time and
+// allocations. The heap is collected first so earlier work is not counted.
+func measure(phase string, iterations int, fn func() error) BenchResult {
+	result := BenchResult{Phase: phase}
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		if err := fn(); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	result.NsPerOp = elapsed.Nanoseconds() / int64(iterations)
+	result.AllocsPerOp = (after.Mallocs - before.Mallocs) / uint64(iterations)
+	result.BytesPerOp = (after.TotalAlloc - before.TotalAlloc) / uint64(iterations)
+	return result
+}
+
+// benchFile measures each phase on the file at path
+func benchFile(path string, iterations int) (BenchFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return BenchFile{}, err
+	}
+	lines, err := readFileLines(path)
+	if err != nil {
+		return BenchFile{}, err
+	}
+	contentStart := iatf.ContentStart(lines)
+	bench := BenchFile{File: path, Bytes: info.Size(), Lines: len(lines)}
+	if contentStart != -1 {
+		bench.Sections = len(iatf.ParseSections(lines, contentStart))
+	}
+
+	bench.Phases = append(bench.Phases, measure("parse", iterations, func() error {
+		lines, err := readFileLines(path)
+		if err != nil {
+			return err
+		}
+		if contentStart := iatf.ContentStart(lines); contentStart != -1 {
+			iatf.ParseSections(lines, contentStart)
+		}
+		return nil
+	}))
+	bench.Phases = append(bench.Phases, measure("validate", iterations, func() error {
+		iatf.Validate(lines, iatf.DefaultOptions())
+		return nil
+	}))
+	bench.Phases = append(bench.Phases, measure("rebuild", iterations, func() error {
+		_, _, _, err := planIndexRebuild(path)
+		return err
+	}))
+	return bench, nil
+}
+
+// formatBytes prints a byte count with a binary unit
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// benchCommand measures the phases on a file or on every .iatf file under
+// a directory, and prints a tab-separated table or JSON
+func benchCommand(path string, args benchArgs) int {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", path)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	files, err := listIATFFiles(path, info)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No .iatf files found in %s\n", path)
+		return 1
+	}
+
+	report := BenchReport{Iterations: args.iterations, Files: []BenchFile{}}
+	totals := map[string]*BenchResult{}
+	for _, phase := range benchPhases {
+		totals[phase] = &BenchResult{Phase: phase}
+	}
+	for _, file := range files {
+		bench, err := benchFile(file, args.iterations)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", file, err)
+			return 1
+		}
+		for _, result := range bench.Phases {
+			total := totals[result.Phase]
+			total.NsPerOp += result.NsPerOp
+			total.AllocsPerOp += result.AllocsPerOp
+			total.BytesPerOp += result.BytesPerOp
+		}
+		report.Files = append(report.Files, bench)
+	}
+	for _, phase := range benchPhases {
+		report.Totals = append(report.Totals, *totals[phase])
+	}
+
+	if args.json {
+		return printJSON(report)
+	}
+	fmt.Printf("@bench: %d file(s), %d iteration(s) each\n", len(report.Files), report.Iterations)
+	for _, bench := range report.Files {
+		fmt.Printf("\n%s (%s, %d lines, %d sections)\n", bench.File, formatBytes(uint64(bench.Bytes)), bench.Lines, bench.Sections)
+		for _, result := range bench.Phases {
+			printBenchResult(result)
+		}
+	}
+	if len(report.Files) > 1 {
+		fmt.Println("\nTotal")
+		for _, result := range report.Totals {
+			printBenchResult(result)
+		}
+	}
+	return 0
+}
+
+// printBenchResult prints a phase as phase, time, allocations and bytes per
+// operation, tab-separated
+func printBenchResult(result BenchResult) {
+	if result.Error != "" {
+		fmt.Printf("  %s\t-\t-\t-\terror: %s\n", result.Phase, result.Error)
+		return
+	}
+	fmt.Printf("  %s\t%s/op\t%d allocs/op\t%s/op\n", result.Phase, time.Duration(result.NsPerOp).Round(time.Microsecond), result.AllocsPerOp, formatBytes(result.BytesPerOp))
+}
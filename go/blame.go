@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf blame' reports, for each section, the last commit that touched a
+// line between its tags, from 'git blame' of the file as it is on disk. It
+// tells whom to ask about a section when its @owner: is missing or stale.
+
+// blameCommit is a commit as 'git blame --porcelain' describes it
+type blameCommit struct {
+	Hash    string
+	Author  string
+	Email   string
+	Time    int64 // Author time, Unix seconds
+	Summary string
+}
+
+// BlameReport is the output of 'iatf blame --json'
+type BlameReport struct {
+	File     string         `json:"file"`
+	Sections []SectionBlame `json:"sections"`
+}
+
+// SectionBlame is the last change to a section
+type SectionBlame struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Owner       string `json:"owner,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Date        string `json:"date,omitempty"` // YYYY-MM-DD
+	Summary     string `json:"summary,omitempty"`
+	Uncommitted bool   `json:"uncommitted,omitempty"` // Some of its lines are not committed
+}
+
+// gitBlame returns the commit of each line (0-indexed) of the file at path.
+// The iatf diff driver is bypassed, as blame must see the lines as stored.
+func gitBlame(path string) ([]*blameCommit, error) {
+	output, err := runGit(filepath.Dir(path), "blame", "--porcelain", "--no-textconv", "--", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	return parseBlamePorcelain(output), nil
+}
+
+// parseBlamePorcelain reads 'git blame --porcelain' output. Each line of the
+// file is a header "<hash> <orig-line> <final-line> [<count>]", the details
+// of the commit the first time it appears, and the line itself after a tab.
+func parseBlamePorcelain(output string) []*blameCommit {
+	commits := map[string]*blameCommit{}
+	lines := []*blameCommit{}
+	var current *blameCommit
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			lines = append(lines, current)
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		if current == nil || len(key) >= 40 && strings.Contains(value, " ") && isHex(key) {
+			if commits[key] == nil {
+				commits[key] = &blameCommit{Hash: key}
+			}
+			current = commits[key]
+			continue
+		}
+		switch key {
+		case "author":
+			current.Author = value
+		case "author-mail":
+			current.Email = strings.Trim(value, "<>")
+		case "author-time":
+			current.Time, _ = strconv.ParseInt(value, 10, 64)
+		case "summary":
+			current.Summary = value
+		}
+	}
+	return lines
+}
+
+// isHex reports whether s is made of lowercase hexadecimal digits
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// blameSections returns the latest commit among the lines of each section,
+// its tags included
+func blameSections(sections []iatf.Section, blamed []*blameCommit) []SectionBlame {
+	results := []SectionBlame{}
+	for _, section := range sections {
+		result := SectionBlame{ID: section.ID, Title: section.Title, Start: section.Start, End: section.End, Owner: section.Owner}
+		end := section.End
+		if end == 0 || end > len(blamed) {
+			end = len(blamed)
+		}
+		var latest *blameCommit
+		for _, commit := range blamed[section.Start-1 : end] {
+			if commit == nil {
+				continue
+			}
+			if strings.Trim(commit.Hash, "0") == "" { // Not committed yet
+				result.Uncommitted = true
+				continue
+			}
+			if latest == nil || commit.Time > latest.Time {
+				latest = commit
+			}
+		}
+		if latest != nil {
+			result.Commit = latest.Hash[:7]
+			result.Author = latest.Author
+			result.Email = latest.Email
+			result.Date = time.Unix(latest.Time, 0).UTC().Format(iatf.DateFormat)
+			result.Summary = latest.Summary
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// blameCommand prints the last commit, author and date of each section of
+// filePath, as a tab-separated table or as JSON
+func blameCommand(filePath string, jsonOutput bool) int {
+	doc, err := loadDocument(filePath)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+	if doc.contentStart == -1 {
+		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
+		return 1
+	}
+
+	blamed, err := gitBlame(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	report := BlameReport{File: filePath, Sections: blameSections(doc.sections, blamed)}
+	if jsonOutput {
+		return printJSON(report)
+	}
+	for _, section := range report.Sections {
+		commit, author, date := "-", "-", "-"
+		if section.Commit != "" {
+			commit, author, date = section.Commit, section.Author, section.Date
+			if section.Uncommitted {
+				commit += "+"
+			}
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\tlines:%d-%d\t%s\n", section.ID, commit, author, date, section.Start, section.End, section.Summary)
+	}
+	return 0
+}
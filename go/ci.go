@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf ci' is the single check a pipeline runs over a documentation tree:
+// every file is validated, its INDEX compared with what 'iatf rebuild'
+// would write, and its warnings collected as lint. The exit code tells
+// which check failed, so a pipeline can treat a stale INDEX differently
+// from a broken document.
+
+// Exit codes of 'iatf ci', the most severe failure winning
+const (
+	ciPassed      = 0 // Every check passed
+	ciInvalid     = 1 // A file has validation errors
+	ciStaleIndex  = 2 // An INDEX is not what 'iatf rebuild' would write
+	ciLintFailed  = 3 // A file has warnings and --strict was given
+	ciCannotCheck = 4 // Bad arguments, or the directory or a report could not be read or written
+)
+
+// formatJSON is the report format of 'iatf ci' besides those of validate
+const formatJSON = "json"
+
+// ciArgs are the parsed arguments of 'iatf ci' after the directory
+type ciArgs struct {
+	includes []string // Only files matching one of these globs; all when empty
+	excludes []string
+	strict   bool   // Warnings fail the run
+	format   string // Format of the report: text, json, sarif or junit
+	output   string // File the report is written to; stdout when empty
+}
+
+// CIReport is the output of 'iatf ci --format json'
+type CIReport struct {
+	Root     string         `json:"root"`
+	Files    []CIFileResult `json:"files"`
+	Summary  CISummary      `json:"summary"`
+	ExitCode int            `json:"exitCode"`
+}
+
+// CIFileResult is the outcome of the checks on one file
+type CIFileResult struct {
+	File       string       `json:"file"`
+	Errors     []ciIssue    `json:"errors"`
+	Warnings   []ciIssue    `json:"warnings"`
+	StaleIndex bool         `json:"staleIndex"`
+	issues     []iatf.Issue // For SARIF and JUnit
+}
+
+// ciIssue is an issue as the JSON report lists it
+type ciIssue struct {
+	Code    string `json:"code"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// CISummary counts the files failing each check
+type CISummary struct {
+	Files        int `json:"files"`
+	Invalid      int `json:"invalid"`
+	StaleIndexes int `json:"staleIndexes"`
+	WithWarnings int `json:"withWarnings"`
+	Unreadable   int `json:"unreadable"`
+	Errors       int `json:"errors"`
+	Warnings     int `json:"warnings"`
+}
+
+// parseCIArgs reads --include, --exclude, --strict, --format and --output
+func parseCIArgs(args []string) (ciArgs, error) {
+	parsed := ciArgs{format: formatText}
+	formatGiven := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--strict":
+			parsed.strict = true
+			continue
+		case "--include", "--exclude", "--format", "--output":
+		default:
+			return parsed, fmt.Errorf("unknown option: %s", args[i])
+		}
+		if i+1 >= len(args) {
+			return parsed, fmt.Errorf("%s requires a value", args[i])
+		}
+		value := args[i+1]
+		switch args[i] {
+		case "--include":
+			parsed.includes = append(parsed.includes, value)
+		case "--exclude":
+			parsed.excludes = append(parsed.excludes, value)
+		case "--format":
+			if value != formatJSON {
+				if _, err := parseFormat(value); err != nil {
+					return parsed, fmt.Errorf("unknown format %q (expected text, json, sarif or junit)", value)
+				}
+			}
+			parsed.format = value
+			formatGiven = true
+		case "--output":
+			parsed.output = value
+		}
+		i++
+	}
+	// A report file is for machines, so it defaults to JSON
+	if parsed.output != "" && !formatGiven {
+		parsed.format = formatJSON
+	}
+	return parsed, nil
+}
+
+// ciFiles returns the .iatf files under root that pass the include and
+// exclude globs, in walk order
+func ciFiles(root string, args ciArgs) []string {
+	files := []string{}
+	walkIATFFiles(root, args.excludes, symlinksFiles, func(path string, info os.FileInfo) {
+		// Includes match like excludes: base name, relative path or directory prefix
+		if len(args.includes) == 0 || isExcludedPath(root, path, args.includes) {
+			files = append(files, path)
+		}
+	})
+	return files
+}
+
+// rebuildFixes are the issues of an INDEX that no longer matches CONTENT,
+// which 'iatf rebuild' resolves by generating it anew
+var rebuildFixes = []string{"E009", "E010", "E012", "E013", "E014", "W001", "W002", "W003", "W004", "W005"}
+
+// checkFileForCI validates filePath and compares its INDEX with a rebuilt
+// one. When the only problems are ones a rebuild fixes, the file fails the
+// INDEX check rather than validation, and they are reported as errors.
+func checkFileForCI(filePath string) (CIFileResult, error) {
+	result := CIFileResult{File: filePath, Errors: []ciIssue{}, Warnings: []ciIssue{}}
+	content, err := readFileWithinLimits(filePath)
+	if err != nil {
+		return result, err
+	}
+
+	issues := iatf.Validate(strings.Split(string(content), "\n"), iatf.DefaultOptions()).Issues()
+	rebuildable := true
+	for _, issue := range issues {
+		if issue.Severity == iatf.SeverityError && !contains(rebuildFixes, issue.Code) {
+			rebuildable = false
+		}
+	}
+	// A file with other errors cannot be rebuilt, and the rebuild would
+	// only repeat them
+	if rebuildable {
+		_, changed, _, err := planIndexRebuild(filePath)
+		result.StaleIndex = err == nil && changed
+	}
+
+	for _, issue := range issues {
+		if result.StaleIndex && contains(rebuildFixes, issue.Code) {
+			issue.Severity = iatf.SeverityError
+			result.issues = append(result.issues, issue)
+			continue
+		}
+		entry := ciIssue{Code: issue.Code, Line: issue.Line, Message: issue.Message}
+		if issue.Severity == iatf.SeverityError {
+			result.Errors = append(result.Errors, entry)
+		} else {
+			result.Warnings = append(result.Warnings, entry)
+		}
+		result.issues = append(result.issues, issue)
+	}
+	if result.StaleIndex && len(result.issues) == len(result.Errors)+len(result.Warnings) {
+		// Validation found nothing a rebuild would change, only the
+		// rebuild did (a summary or word count, say)
+		result.issues = append(result.issues, iatf.Issue{
+			Code:     "W004",
+			Severity: iatf.SeverityError,
+			Message:  fmt.Sprintf("INDEX is out of date (run 'iatf rebuild %s')", filePath),
+		})
+	}
+	return result, nil
+}
+
+// ciExitCode returns the code of the most severe failure. A file that could
+// not be read leaves the run incomplete, which outranks any finding.
+func ciExitCode(summary CISummary, strict bool) int {
+	switch {
+	case summary.Unreadable > 0:
+		return ciCannotCheck
+	case summary.Invalid > 0:
+		return ciInvalid
+	case summary.StaleIndexes > 0:
+		return ciStaleIndex
+	case strict && summary.WithWarnings > 0:
+		return ciLintFailed
+	}
+	return ciPassed
+}
+
+// ciCommand runs every check on the .iatf files under root and reports the
+// results as a summary or in a machine-readable format
+func ciCommand(root string, args ciArgs) int {
+	info, err := os.Stat(root)
+	if err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: Directory not found: %s\n", root)
+		return ciCannotCheck
+	}
+
+	report := CIReport{Root: root, Files: []CIFileResult{}}
+	for _, file := range ciFiles(root, args) {
+		result, err := checkFileForCI(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+			report.Summary.Unreadable++
+			continue
+		}
+		report.Files = append(report.Files, result)
+		report.Summary.Files++
+		report.Summary.Errors += len(result.Errors)
+		report.Summary.Warnings += len(result.Warnings)
+		if len(result.Errors) > 0 {
+			report.Summary.Invalid++
+		}
+		if result.StaleIndex {
+			report.Summary.StaleIndexes++
+		}
+		if len(result.Warnings) > 0 {
+			report.Summary.WithWarnings++
+		}
+	}
+	report.ExitCode = ciExitCode(report.Summary, args.strict)
+
+	w := io.Writer(os.Stdout)
+	if args.output != "" {
+		file, err := os.Create(args.output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ciCannotCheck
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeCIReport(w, args.format, report); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ciCannotCheck
+	}
+	// The summary still goes to the log when the report goes to a file
+	if args.output != "" && args.format != formatText {
+		writeCISummary(os.Stdout, report)
+		fmt.Printf("Report written to %s\n", args.output)
+	}
+	return report.ExitCode
+}
+
+// writeCIReport writes report in format
+func writeCIReport(w io.Writer, format string, report CIReport) error {
+	switch format {
+	case formatText:
+		writeCIText(w, report)
+		return nil
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	results := make([]validationResult, len(report.Files))
+	for i, file := range report.Files {
+		results[i] = validationResult{File: file.File, Issues: file.issues}
+	}
+	return writeValidationReport(w, format, results)
+}
+
+// writeCIText lists the files failing a check, with their issues, then the
+// summary
+func writeCIText(w io.Writer, report CIReport) {
+	fmt.Fprintf(w, "Checking %d .iatf file(s) in %s\n", report.Summary.Files, report.Root)
+	for _, file := range report.Files {
+		if len(file.Errors) == 0 && len(file.Warnings) == 0 && !file.StaleIndex {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s\n", file.File)
+		for _, issue := range file.Errors {
+			fmt.Fprintf(w, "  %s [%s] %s\n", mark(w, "[ERROR]"), issue.Code, issue.Message)
+		}
+		if file.StaleIndex {
+			fmt.Fprintf(w, "  [STALE] INDEX is out of date (run 'iatf rebuild %s')\n", file.File)
+		}
+		for _, issue := range file.Warnings {
+			fmt.Fprintf(w, "  %s [%s] %s\n", mark(w, "[WARN]"), issue.Code, issue.Message)
+		}
+	}
+	fmt.Fprintln(w)
+	writeCISummary(w, report)
+}
+
+// writeCISummary writes the counts and the verdict
+func writeCISummary(w io.Writer, report CIReport) {
+	summary := report.Summary
+	fmt.Fprintf(w, "Summary: %d file(s), %d invalid, %d with a stale INDEX, %d with warnings\n",
+		summary.Files, summary.Invalid, summary.StaleIndexes, summary.WithWarnings)
+	switch report.ExitCode {
+	case ciPassed:
+		fmt.Fprintf(w, "%s All checks passed\n", mark(w, "[OK]"))
+	case ciInvalid:
+		fmt.Fprintf(w, "%s Validation failed (exit %d)\n", mark(w, "[ERROR]"), ciInvalid)
+	case ciStaleIndex:
+		fmt.Fprintf(w, "%s INDEX out of date, run 'iatf rebuild-all %s' (exit %d)\n", mark(w, "[ERROR]"), filepath.Clean(report.Root), ciStaleIndex)
+	case ciLintFailed:
+		fmt.Fprintf(w, "%s Warnings found with --strict (exit %d)\n", mark(w, "[ERROR]"), ciLintFailed)
+	case ciCannotCheck:
+		fmt.Fprintf(w, "%s %d file(s) could not be read (exit %d)\n", mark(w, "[ERROR]"), summary.Unreadable, ciCannotCheck)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// The status markers [OK], [WARN] and [ERROR] are colored when they are
+// written to a console that renders ANSI escapes. Redirected output, dumb
+// terminals, NO_COLOR and Windows consoles that refuse VT processing
+// (legacy conhost) get the plain markers, which are ASCII like the rest of
+// the CLI's own output.
+
+// markerColors are the ANSI colors of the status markers
+var markerColors = map[string]string{
+	"[OK]":    "\x1b[32m",
+	"[WARN]":  "\x1b[33m",
+	"[ERROR]": "\x1b[31m",
+}
+
+// colorStdout and colorStderr are set by initConsole
+var colorStdout, colorStderr bool
+
+// colorAllowed reports whether the environment lets f be colored at all
+func colorAllowed(f *os.File) bool {
+	if _, set := os.LookupEnv("NO_COLOR"); set || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// mark returns marker, colored when w is a console that renders colors
+func mark(w io.Writer, marker string) string {
+	color := w == os.Stdout && colorStdout || w == os.Stderr && colorStderr
+	if !color || markerColors[marker] == "" {
+		return marker
+	}
+	return markerColors[marker] + marker + "\x1b[0m"
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// initConsole prepares the terminal for output. Unix terminals render
+// colors without setup.
+func initConsole() {
+	colorStdout = colorAllowed(os.Stdout)
+	colorStderr = colorAllowed(os.Stderr)
+}
+
+// isTerminal reports whether f is attached to an interactive terminal.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) != 0
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// utf8CodePage is the Windows code page identifier for UTF-8
+const utf8CodePage = 65001
+
+// initConsole switches the console to UTF-8 and enables ANSI escape handling.
+// Older hosts (legacy cmd.exe) reject VT processing; output then stays plain
+// ASCII, without colors.
+func initConsole() {
+	windows.SetConsoleOutputCP(utf8CodePage)
+	windows.SetConsoleCP(utf8CodePage)
+
+	colorStdout = enableVT(os.Stdout) && colorAllowed(os.Stdout)
+	colorStderr = enableVT(os.Stderr) && colorAllowed(os.Stderr)
+}
+
+// enableVT turns on ANSI escape handling for the console f, reporting
+// whether the console accepted it
+func enableVT(f *os.File) bool {
+	handle := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return false
+	}
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
+
+// isTerminal reports whether f is attached to an interactive console.
+// Redirected input (pipes, files, mintty pipes) is not a console.
+func isTerminal(f *os.File) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(f.Fd()), &mode) == nil
+}
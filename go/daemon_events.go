@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Clients can follow the daemon's rebuilds as they happen: a "subscribe"
+// request on the control socket is answered like any other, and the
+// connection then stays open and carries one JSON event per line (the
+// webhook payload) until either side closes it. 'iatf daemon events' prints
+// the stream and 'iatf serve' relays it as Server-Sent Events.
+
+// eventBuffer is how many events a subscriber may fall behind before the
+// daemon drops it; a dropped client has missed changes and must resync
+const eventBuffer = 256
+
+// eventHub fans rebuild events out to the subscribers
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan WebhookPayload]bool
+}
+
+// daemonEvents is the change stream of the running daemon
+var daemonEvents = &eventHub{subscribers: map[chan WebhookPayload]bool{}}
+
+// subscribe returns a channel receiving every event published from now on.
+// It is closed if the subscriber falls eventBuffer events behind.
+func (h *eventHub) subscribe() chan WebhookPayload {
+	events := make(chan WebhookPayload, eventBuffer)
+	h.mu.Lock()
+	h.subscribers[events] = true
+	h.mu.Unlock()
+	return events
+}
+
+// unsubscribe stops delivering to events, unless it was already dropped
+func (h *eventHub) unsubscribe(events chan WebhookPayload) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[events] {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// publish sends event to every subscriber without blocking the rebuild
+func (h *eventHub) publish(event WebhookPayload) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+			delete(h.subscribers, events)
+			close(events)
+			daemonLog(logComponentControl).Warn("Dropped slow event subscriber", "buffered", eventBuffer)
+		}
+	}
+}
+
+// serveEventStream streams events to a subscribed control connection until
+// the client disconnects or is dropped
+func serveEventStream(conn net.Conn) {
+	events := daemonEvents.subscribe()
+	defer daemonEvents.unsubscribe(events)
+
+	encoder := json.NewEncoder(conn)
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if err := encoder.Encode(daemonResponse{OK: true, Message: "Subscribed to rebuild events"}); err != nil {
+		return
+	}
+
+	// The client sends nothing more; a read returns when it hangs up
+	closed := make(chan struct{})
+	go func() {
+		conn.SetReadDeadline(time.Time{})
+		conn.Read(make([]byte, 1))
+		close(closed)
+	}()
+
+	for {
+		select {
+		case event, open := <-events:
+			if !open {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// eventStream is a subscription to the running daemon's change stream
+type eventStream struct {
+	conn    net.Conn
+	decoder *json.Decoder
+}
+
+// subscribeDaemonEvents opens a change stream from the running daemon. It
+// returns errDaemonUnreachable if no daemon is listening.
+func subscribeDaemonEvents() (*eventStream, error) {
+	conn, err := net.DialTimeout("unix", getDaemonSocketPath(), 2*time.Second)
+	if err != nil {
+		return nil, errDaemonUnreachable
+	}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := json.NewEncoder(conn).Encode(daemonRequest{Command: daemonCmdSubscribe}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	var response daemonResponse
+	if err := decoder.Decode(&response); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("no reply from daemon: %w", err)
+	}
+	if !response.OK {
+		// Daemons from before the change stream reject the command
+		conn.Close()
+		return nil, fmt.Errorf("daemon does not support event subscriptions: %s", response.Error)
+	}
+	conn.SetDeadline(time.Time{})
+	return &eventStream{conn: conn, decoder: decoder}, nil
+}
+
+// next waits for the next event. It fails once the daemon stops, drops the
+// subscriber for falling behind, or the stream is closed.
+func (s *eventStream) next() (WebhookPayload, error) {
+	var event WebhookPayload
+	if err := s.decoder.Decode(&event); err != nil {
+		return event, fmt.Errorf("event stream ended: %w", err)
+	}
+	return event, nil
+}
+
+// Close ends the subscription
+func (s *eventStream) Close() error {
+	return s.conn.Close()
+}
+
+// daemonEventsCommand prints the daemon's rebuild events, one JSON object
+// per line, until interrupted
+func daemonEventsCommand() int {
+	stream, err := subscribeDaemonEvents()
+	if errors.Is(err, errDaemonUnreachable) {
+		fmt.Fprintln(os.Stderr, "Error: Daemon not running (start it with 'iatf daemon start')")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer stream.Close()
+
+	encoder := json.NewEncoder(os.Stdout)
+	for {
+		event, err := stream.next()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if err := encoder.Encode(event); err != nil {
+			return 1
+		}
+	}
+}
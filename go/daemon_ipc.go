@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The daemon listens on a Unix domain socket (~/.iatf/daemon.sock; AF_UNIX is
+// also supported on Windows 10 and later) for control requests. Each
+// connection carries one JSON request and one JSON response, except for
+// subscriptions to the change stream (see daemon_events.go).
+
+// Control socket commands
+const (
+	daemonCmdStatus  = "status"
+	daemonCmdReload  = "reload"
+	daemonCmdPause   = "pause"
+	daemonCmdResume  = "resume"
+	daemonCmdRebuild = "rebuild"
+	daemonCmdAddPath = "add-path"
+	daemonCmdStop    = "stop"
+	// Keeps the connection open for the change stream
+	daemonCmdSubscribe = "subscribe"
+)
+
+// daemonRequest is a command sent to the daemon over the control socket
+type daemonRequest struct {
+	Command string   `json:"command"`
+	Paths   []string `json:"paths,omitempty"` // absolute paths
+}
+
+// daemonResponse is the daemon's reply to a daemonRequest
+type daemonResponse struct {
+	OK      bool                `json:"ok"`
+	Error   string              `json:"error,omitempty"`
+	Message string              `json:"message,omitempty"`
+	Status  *DaemonStatusReport `json:"status,omitempty"`
+}
+
+// daemonControl is a request received on the control socket, handed to the
+// daemon's watch loop together with the channel for its reply
+type daemonControl struct {
+	request daemonRequest
+	reply   chan daemonResponse
+}
+
+// errDaemonUnreachable is returned when no daemon is listening on the control socket
+var errDaemonUnreachable = errors.New("daemon control socket unavailable")
+
+func getDaemonSocketPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".iatf", "daemon.sock")
+}
+
+// listenDaemonControl opens the control socket and returns the channel on
+// which incoming requests are delivered. A socket file left behind by a
+// crashed daemon is replaced.
+func listenDaemonControl() (net.Listener, <-chan daemonControl, error) {
+	socketPath := getDaemonSocketPath()
+	os.MkdirAll(filepath.Dir(socketPath), 0755)
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("another daemon is listening on %s", socketPath)
+	}
+	os.Remove(socketPath)
+
+	listener, err := listenControlSocket(socketPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	controls := make(chan daemonControl)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			go serveDaemonConn(conn, controls)
+		}
+	}()
+	return listener, controls, nil
+}
+
+// serveDaemonConn reads one request from conn, passes it to the watch loop
+// and writes back the reply
+func serveDaemonConn(conn net.Conn, controls chan<- daemonControl) {
+	defer conn.Close()
+
+	var request daemonRequest
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		json.NewEncoder(conn).Encode(daemonResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	if request.Command == daemonCmdSubscribe {
+		serveEventStream(conn)
+		return
+	}
+
+	reply := make(chan daemonResponse, 1)
+	controls <- daemonControl{request: request, reply: reply}
+	response := <-reply
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	json.NewEncoder(conn).Encode(response)
+}
+
+// sendDaemonRequest sends a request to the running daemon and waits for its
+// reply. It returns errDaemonUnreachable if no daemon is listening, so callers
+// can fall back to PID files and signals for daemons from older versions.
+func sendDaemonRequest(request daemonRequest) (daemonResponse, error) {
+	conn, err := net.DialTimeout("unix", getDaemonSocketPath(), 2*time.Second)
+	if err != nil {
+		return daemonResponse{}, errDaemonUnreachable
+	}
+	defer conn.Close()
+
+	// Rebuilds and rescans run before the reply is sent, so allow for large
+	// trees; other requests are answered right away unless the daemon is hung
+	timeout := 10 * time.Second
+	switch request.Command {
+	case daemonCmdRebuild, daemonCmdReload, daemonCmdAddPath:
+		timeout = 5 * time.Minute
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return daemonResponse{}, err
+	}
+	var response daemonResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return daemonResponse{}, fmt.Errorf("no reply from daemon: %w", err)
+	}
+	return response, nil
+}
+
+// absPaths resolves command-line paths to absolute paths as the watch state
+// keys them, with symlinks resolved
+func absPaths(paths []string) ([]string, error) {
+	result := make([]string, 0, len(paths))
+	for _, p := range paths {
+		absPath, err := resolveWatchPath(p)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, absPath)
+	}
+	return result, nil
+}
+
+// runDaemonRequest sends a request to the daemon and prints its reply. ok is
+// false if the daemon could not be reached, in which case nothing is printed.
+func runDaemonRequest(request daemonRequest) (exitCode int, ok bool) {
+	response, err := sendDaemonRequest(request)
+	if errors.Is(err, errDaemonUnreachable) {
+		return 1, false
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1, true
+	}
+	if response.Message != "" {
+		fmt.Println(response.Message)
+	}
+	if !response.OK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", response.Error)
+		return 1, true
+	}
+	return 0, true
+}
+
+// daemonReloadCommand asks the daemon to re-read daemon.json
+func daemonReloadCommand() int {
+	if isRunning, _ := checkDaemonRunning(); !isRunning {
+		fmt.Println("Daemon not running")
+		return 1
+	}
+	code, ok := runDaemonRequest(daemonRequest{Command: daemonCmdReload})
+	if !ok {
+		fmt.Println("Daemon is not listening for control requests; it picks up daemon.json changes on its own")
+		return 1
+	}
+	return code
+}
+
+// daemonAddPathCommand adds watch paths to daemon.json, through the running
+// daemon when there is one so they are watched immediately
+func daemonAddPathCommand(paths []string) int {
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: Missing path argument")
+		fmt.Fprintln(os.Stderr, "Usage: iatf daemon add-path <dir>...")
+		return 1
+	}
+	targets, err := absPaths(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, target := range targets {
+		if _, err := os.Stat(target); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Path not found: %s\n", target)
+			return 1
+		}
+	}
+
+	if code, ok := runDaemonRequest(daemonRequest{Command: daemonCmdAddPath, Paths: targets}); ok {
+		return code
+	}
+
+	config := loadDaemonConfig()
+	added := addDaemonWatchPaths(&config, targets)
+	if len(added) == 0 {
+		fmt.Println("Paths are already being watched by the daemon")
+		return 0
+	}
+	if err := saveDaemonConfig(config); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving daemon config: %v\n", err)
+		return 1
+	}
+	for _, p := range added {
+		fmt.Printf("Added watch path: %s\n", p)
+	}
+	return 0
+}
+
+// addDaemonWatchPaths appends the paths not yet configured and returns them
+func addDaemonWatchPaths(config *DaemonConfig, paths []string) []string {
+	existing, _ := absPaths(config.WatchPaths)
+	added := []string{}
+	for _, p := range paths {
+		if !contains(existing, p) && !contains(added, p) {
+			added = append(added, p)
+		}
+	}
+	config.WatchPaths = append(config.WatchPaths, added...)
+	return added
+}
+
+// saveDaemonConfig writes daemon.json
+func saveDaemonConfig(config DaemonConfig) error {
+	configPath := getDaemonConfigPath()
+	os.MkdirAll(filepath.Dir(configPath), 0755)
+	data, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configPath, append(data, '\n'), 0644)
+}
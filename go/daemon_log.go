@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Daemon log components, attached to every record as the "component" field
+const (
+	logComponentDaemon    = "daemon"    // lifecycle, configuration, log rotation
+	logComponentWatcher   = "watcher"   // file discovery and change detection
+	logComponentRebuilder = "rebuilder" // validation and INDEX rebuilds
+	logComponentScheduler = "scheduler" // rebuild queue and bursts
+	logComponentControl   = "control"   // control socket and metrics endpoint
+	logComponentWebhook   = "webhook"
+	logComponentNotify    = "notify"
+)
+
+// Daemon log formats (log_format in daemon.json)
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// daemonLogLevel is the minimum level written to daemon.log. It is shared by
+// every handler so a config reload can change it in place.
+var daemonLogLevel = new(slog.LevelVar)
+
+// parseLogLevel parses a log_level value
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log_level %q (expected debug, info, warn or error)", value)
+	}
+	return level, nil
+}
+
+// logLevel returns the configured log level; --debug always logs everything
+func (c DaemonConfig) logLevel(debug bool) (slog.Level, error) {
+	if debug {
+		return slog.LevelDebug, nil
+	}
+	if c.LogLevel == "" {
+		return slog.LevelInfo, nil
+	}
+	return parseLogLevel(c.LogLevel)
+}
+
+// setupDaemonLogging makes the default slog logger write daemon records to w
+// in the configured format and level
+func setupDaemonLogging(w io.Writer, config DaemonConfig, debug bool) error {
+	options := &slog.HandlerOptions{Level: daemonLogLevel}
+	var handler slog.Handler
+	switch strings.ToLower(config.LogFormat) {
+	case "", logFormatText:
+		handler = slog.NewTextHandler(w, options)
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		handler = slog.NewTextHandler(w, options)
+		slog.SetDefault(slog.New(handler))
+		return fmt.Errorf("invalid log_format %q (expected text or json)", config.LogFormat)
+	}
+	slog.SetDefault(slog.New(handler))
+	return applyDaemonLogLevel(config, debug)
+}
+
+// applyDaemonLogLevel updates the log level after daemon.json changes
+func applyDaemonLogLevel(config DaemonConfig, debug bool) error {
+	level, err := config.logLevel(debug)
+	daemonLogLevel.Set(level)
+	return err
+}
+
+// daemonLog returns the daemon logger for a component
+func daemonLog(component string) *slog.Logger {
+	return slog.Default().With("component", component)
+}
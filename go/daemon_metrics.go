@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rebuildDurationBuckets are the upper bounds (seconds) of the rebuild
+// latency histogram
+var rebuildDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// daemonHealthTimeout is how long the watch loop may go without a scan before
+// /healthz reports the daemon as unhealthy
+const daemonHealthTimeout = 10 * time.Second
+
+// daemonMetrics accumulates counters for the metrics endpoint. It is guarded
+// by the owning daemonRuntime's mutex.
+type daemonMetrics struct {
+	started          time.Time
+	lastHeartbeat    time.Time
+	watchPaths       int
+	rebuilds         map[string]int64
+	validationErrors int64
+	durationBuckets  []int64
+	durationCount    int64
+	durationSum      float64
+}
+
+func newDaemonMetrics() daemonMetrics {
+	now := time.Now()
+	return daemonMetrics{
+		started:         now,
+		lastHeartbeat:   now,
+		rebuilds:        make(map[string]int64),
+		durationBuckets: make([]int64, len(rebuildDurationBuckets)),
+	}
+}
+
+// observe counts a rebuild outcome
+func (m *daemonMetrics) observe(result DaemonFileState) {
+	m.rebuilds[result.Result]++
+	m.validationErrors += int64(result.ErrorCount)
+
+	seconds := result.DurationMS / 1000
+	m.durationCount++
+	m.durationSum += seconds
+	for i, bound := range rebuildDurationBuckets {
+		if seconds <= bound {
+			m.durationBuckets[i]++
+		}
+	}
+}
+
+// heartbeat records that the watch loop completed a scan
+func (r *daemonRuntime) heartbeat() {
+	r.mu.Lock()
+	r.metrics.lastHeartbeat = time.Now()
+	r.mu.Unlock()
+}
+
+// setWatchPaths records the number of configured watch paths
+func (r *daemonRuntime) setWatchPaths(n int) {
+	r.mu.Lock()
+	r.metrics.watchPaths = n
+	r.mu.Unlock()
+}
+
+// writeMetrics renders the metrics in the Prometheus text exposition format
+func (r *daemonRuntime) writeMetrics(w *strings.Builder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := &r.metrics
+
+	failing := 0
+	for _, file := range r.state.Files {
+		if file.Error != "" {
+			failing++
+		}
+	}
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("iatf_daemon_up", "gauge", "Whether the daemon is running.")
+	fmt.Fprintln(w, "iatf_daemon_up 1")
+	metric("iatf_daemon_uptime_seconds", "gauge", "Seconds since the daemon started.")
+	fmt.Fprintf(w, "iatf_daemon_uptime_seconds %d\n", int64(time.Since(m.started).Seconds()))
+	metric("iatf_daemon_watch_paths", "gauge", "Configured watch paths.")
+	fmt.Fprintf(w, "iatf_daemon_watch_paths %d\n", m.watchPaths)
+	metric("iatf_daemon_files_watched", "gauge", "Tracked .iatf files.")
+	fmt.Fprintf(w, "iatf_daemon_files_watched %d\n", r.state.Tracked)
+	metric("iatf_daemon_files_skipped", "gauge", "Files not tracked because of max_tracked_files.")
+	fmt.Fprintf(w, "iatf_daemon_files_skipped %d\n", r.state.Skipped)
+	metric("iatf_daemon_files_failing", "gauge", "Tracked files whose last rebuild failed.")
+	fmt.Fprintf(w, "iatf_daemon_files_failing %d\n", failing)
+
+	metric("iatf_daemon_rebuilds_total", "counter", "Rebuild attempts by result.")
+	results := []string{daemonResultRebuilt, daemonResultUpToDate, daemonResultIndexStale, daemonResultValidationFailed, daemonResultRebuildFailed}
+	for result := range m.rebuilds {
+		if !contains(results, result) {
+			results = append(results, result)
+		}
+	}
+	sort.Strings(results)
+	for _, result := range results {
+		fmt.Fprintf(w, "iatf_daemon_rebuilds_total{result=%q} %d\n", result, m.rebuilds[result])
+	}
+
+	metric("iatf_daemon_validation_errors_total", "counter", "Validation errors reported by rebuild attempts.")
+	fmt.Fprintf(w, "iatf_daemon_validation_errors_total %d\n", m.validationErrors)
+
+	metric("iatf_daemon_rebuild_duration_seconds", "histogram", "Time spent validating and rebuilding a file.")
+	for i, bound := range rebuildDurationBuckets {
+		fmt.Fprintf(w, "iatf_daemon_rebuild_duration_seconds_bucket{le=\"%g\"} %d\n", bound, m.durationBuckets[i])
+	}
+	fmt.Fprintf(w, "iatf_daemon_rebuild_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.durationCount)
+	fmt.Fprintf(w, "iatf_daemon_rebuild_duration_seconds_sum %g\n", m.durationSum)
+	fmt.Fprintf(w, "iatf_daemon_rebuild_duration_seconds_count %d\n", m.durationCount)
+}
+
+// serveDaemonMetrics starts the /healthz and /metrics endpoint on addr and
+// returns the address it is listening on. An address without a host (":9464")
+// binds to localhost only.
+func serveDaemonMetrics(addr string, r *daemonRuntime) (string, error) {
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		stalled := time.Since(r.metrics.lastHeartbeat)
+		r.mu.Unlock()
+		if stalled > daemonHealthTimeout {
+			http.Error(w, fmt.Sprintf("watch loop stalled for %s\n", stalled.Round(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		var body strings.Builder
+		r.writeMetrics(&body)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		fmt.Fprint(w, body.String())
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go server.Serve(listener)
+	return listener.Addr().String(), nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default daemon rebuild limits
+const (
+	defaultMaxConcurrentRebuilds = 2
+	defaultBurstThreshold        = 20
+	defaultBurstWindow           = 2 * time.Second
+)
+
+// rebuildScheduler runs debounced rebuilds (the daemon's, and those of watch
+// and watch-dir) on a bounded number of workers, never rebuilding a file
+// twice at once. When a storm of changes arrives (a git checkout touching
+// hundreds of files), it holds the whole batch until changes stop arriving
+// for the burst window and then works through it, instead of starting
+// hundreds of rebuilds at once.
+type rebuildScheduler struct {
+	mu             sync.Mutex
+	pending        map[string]bool // ready to rebuild, not started yet
+	running        map[string]bool
+	rerun          map[string]bool // changed again while its rebuild was running
+	lastEnqueue    time.Time
+	inBurst        bool
+	draining       bool // shutting down: skip burst coalescing
+	maxConcurrent  int
+	burstThreshold int
+	burstWindow    time.Duration
+	process        func(path string)
+	onIdle         func() // called when a rebuild finishes with nothing left queued
+	log            *slog.Logger
+	wake           chan struct{}
+}
+
+func newRebuildScheduler(process func(path string)) *rebuildScheduler {
+	return &rebuildScheduler{
+		pending:        make(map[string]bool),
+		running:        make(map[string]bool),
+		rerun:          make(map[string]bool),
+		maxConcurrent:  defaultMaxConcurrentRebuilds,
+		burstThreshold: defaultBurstThreshold,
+		burstWindow:    defaultBurstWindow,
+		process:        process,
+		log:            daemonLog(logComponentScheduler),
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// watchSchedulerLog returns the logger of a watch's rebuild queue: the
+// burst notices are shown with --debug only, like the rest of its output
+func watchSchedulerLog(debug bool) *slog.Logger {
+	if !debug {
+		return slog.New(slog.DiscardHandler)
+	}
+	return slog.New(slog.NewTextHandler(os.Stdout, nil))
+}
+
+// configure applies the rate limiting settings from daemon.json
+func (s *rebuildScheduler) configure(config DaemonConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxConcurrent = defaultMaxConcurrentRebuilds
+	if config.MaxConcurrentRebuilds > 0 {
+		s.maxConcurrent = config.MaxConcurrentRebuilds
+	}
+	s.burstThreshold = defaultBurstThreshold
+	if config.BurstThreshold > 0 {
+		s.burstThreshold = config.BurstThreshold
+	}
+	s.burstWindow = defaultBurstWindow
+	if config.BurstWindowMS > 0 {
+		s.burstWindow = time.Duration(config.BurstWindowMS) * time.Millisecond
+	}
+}
+
+// enqueue schedules a rebuild of path once its debounce has elapsed
+func (s *rebuildScheduler) enqueue(path string) {
+	s.mu.Lock()
+	if s.running[path] {
+		s.rerun[path] = true
+	} else {
+		s.pending[path] = true
+	}
+	s.lastEnqueue = time.Now()
+	s.mu.Unlock()
+	s.notify()
+}
+
+// drop discards queued rebuilds for which match returns true (paused or
+// deleted files, or files a kick is about to rebuild directly)
+func (s *rebuildScheduler) drop(match func(path string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path := range s.pending {
+		if match(path) {
+			delete(s.pending, path)
+		}
+	}
+	for path := range s.rerun {
+		if match(path) {
+			delete(s.rerun, path)
+		}
+	}
+}
+
+func (s *rebuildScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run dispatches queued rebuilds until stop is closed
+func (s *rebuildScheduler) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+		s.dispatch()
+	}
+}
+
+// dispatch starts queued rebuilds up to the concurrency limit, unless a burst
+// of changes is still arriving
+func (s *rebuildScheduler) dispatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return
+	}
+
+	if !s.draining && len(s.pending)+len(s.running) >= s.burstThreshold && time.Since(s.lastEnqueue) < s.burstWindow {
+		if !s.inBurst {
+			s.inBurst = true
+			s.log.Info("Change burst, waiting for changes to settle", "queued", len(s.pending))
+		}
+		return
+	}
+	if s.inBurst {
+		s.inBurst = false
+		s.log.Info("Processing queued files", "queued", len(s.pending), "concurrency", s.maxConcurrent)
+	}
+
+	ready := make([]string, 0, len(s.pending))
+	for path := range s.pending {
+		ready = append(ready, path)
+	}
+	sort.Strings(ready)
+	for _, path := range ready {
+		if len(s.running) >= s.maxConcurrent {
+			return
+		}
+		delete(s.pending, path)
+		s.running[path] = true
+		go s.work(path)
+	}
+}
+
+// work rebuilds one file and requeues it if it changed again meanwhile
+func (s *rebuildScheduler) work(path string) {
+	s.process(path)
+
+	s.mu.Lock()
+	delete(s.running, path)
+	if s.rerun[path] {
+		delete(s.rerun, path)
+		s.pending[path] = true
+	}
+	idle := len(s.pending) == 0 && len(s.running) == 0
+	s.mu.Unlock()
+	s.notify()
+	if idle && s.onIdle != nil {
+		s.onIdle()
+	}
+}
+
+// idle reports whether no rebuild is queued or running
+func (s *rebuildScheduler) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending) == 0 && len(s.running) == 0 && len(s.rerun) == 0
+}
+
+// drain queues extra, then processes everything outstanding with the usual
+// concurrency limit but without burst coalescing, until the queue is empty or
+// the deadline passes. It returns the files that were not rebuilt.
+func (s *rebuildScheduler) drain(extra []string, deadline time.Time) []string {
+	s.mu.Lock()
+	s.draining = true
+	for _, path := range extra {
+		if s.running[path] {
+			s.rerun[path] = true
+		} else {
+			s.pending[path] = true
+		}
+	}
+	s.mu.Unlock()
+
+	for time.Now().Before(deadline) {
+		s.dispatch()
+		s.mu.Lock()
+		idle := len(s.pending) == 0 && len(s.running) == 0 && len(s.rerun) == 0
+		s.mu.Unlock()
+		if idle {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	left := []string{}
+	for _, set := range []map[string]bool{s.pending, s.running, s.rerun} {
+		for path := range set {
+			if !contains(left, path) {
+				left = append(left, path)
+			}
+		}
+	}
+	sort.Strings(left)
+	return left
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -19,6 +20,15 @@ func daemonSysProcAttr() *syscall.SysProcAttr {
 	}
 }
 
+// listenControlSocket listens on the Unix socket at path. It is created
+// under a umask that leaves other users no access, so it is never open to
+// them, not even until a chmod.
+func listenControlSocket(path string) (net.Listener, error) {
+	previous := syscall.Umask(0077)
+	defer syscall.Umask(previous)
+	return net.Listen("unix", path)
+}
+
 // isServiceInstalled checks if the daemon is installed as an OS service
 func isServiceInstalled() (bool, string) {
 	if runtime.GOOS == "darwin" {
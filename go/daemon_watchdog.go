@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// Watchdog limits ("watchdog": true in daemon.json)
+const (
+	watchdogMaxRestarts    = 5                // crashes tolerated within watchdogRestartWindow
+	watchdogRestartWindow  = 10 * time.Minute // before the daemon gives up and exits
+	watchdogMaxBackoff     = time.Minute      // longest wait before restarting the watch loop
+	watchdogStallTimeout   = 5 * time.Minute  // watch loop silence after which the daemon exits
+	watchdogCheckInterval  = 30 * time.Second
+	watchdogExitCodeStall  = 3
+	watchdogExitCodeCrashy = 4
+)
+
+// superviseWatchLoop runs the daemon watch loop under the watchdog. A panic in
+// the loop is logged with its stack and the loop is restarted (re-reading
+// daemon.json) after a growing backoff. If the loop keeps crashing, or stops
+// scanning without crashing, the daemon exits with an error so the service
+// manager (systemd, launchd) can restart the whole process.
+func superviseWatchLoop(state *daemonRuntime, run func(config DaemonConfig)) int {
+	log := daemonLog(logComponentDaemon)
+	go watchForStalls(state)
+
+	config := loadDaemonConfig()
+	crashes := []time.Time{}
+	for {
+		if !runRecovered(func() { run(config) }) {
+			return 0
+		}
+
+		now := time.Now()
+		recent := crashes[:0]
+		for _, crashed := range crashes {
+			if now.Sub(crashed) < watchdogRestartWindow {
+				recent = append(recent, crashed)
+			}
+		}
+		crashes = append(recent, now)
+		if len(crashes) > watchdogMaxRestarts {
+			log.Error("Watch loop keeps crashing, exiting", "crashes", len(crashes), "window", watchdogRestartWindow.String())
+			return watchdogExitCodeCrashy
+		}
+
+		backoff := time.Second << (len(crashes) - 1)
+		if backoff > watchdogMaxBackoff {
+			backoff = watchdogMaxBackoff
+		}
+		log.Warn("Restarting watch loop", "attempt", len(crashes), "backoff", backoff.String())
+		time.Sleep(backoff)
+		config = loadDaemonConfig()
+	}
+}
+
+// runRecovered calls fn and reports whether it panicked
+func runRecovered(fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			daemonLog(logComponentDaemon).Error("Watch loop crashed", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
+
+// recoverRebuild turns a panic while rebuilding path into a rebuild-failed
+// result, so one bad file cannot take the daemon down. It must be deferred.
+func recoverRebuild(path string, result *DaemonFileState) {
+	if r := recover(); r != nil {
+		daemonLog(logComponentRebuilder).Error("Rebuild crashed", "file", path, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+		*result = DaemonFileState{
+			LastRebuild: time.Now().Format(time.RFC3339),
+			Result:      daemonResultRebuildFailed,
+			Error:       fmt.Sprintf("internal error: %v", r),
+		}
+	}
+}
+
+// watchForStalls exits the daemon when the watch loop has not completed a
+// scan for watchdogStallTimeout. A goroutine that is stuck (rather than
+// crashed) cannot be restarted in place.
+func watchForStalls(state *daemonRuntime) {
+	for range time.Tick(watchdogCheckInterval) {
+		state.mu.Lock()
+		stalled := time.Since(state.metrics.lastHeartbeat)
+		state.mu.Unlock()
+		if stalled > watchdogStallTimeout {
+			daemonLog(logComponentDaemon).Error("Watch loop stalled, exiting", "stalled", stalled.Round(time.Second).String())
+			os.Remove(getDaemonSocketPath())
+			os.Exit(watchdogExitCodeStall)
+		}
+	}
+}
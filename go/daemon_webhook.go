@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+)
+
+// webhookTimeout bounds each webhook delivery so a slow receiver cannot pile
+// up goroutines in the daemon
+const webhookTimeout = 10 * time.Second
+
+// daemonWebhook delivers rebuild results to the URL configured in daemon.json
+type daemonWebhook struct {
+	URL    string
+	Secret string
+}
+
+// WebhookPayload is the JSON body POSTed to the webhook after a rebuild
+type WebhookPayload struct {
+	Event           string          `json:"event"` // always "rebuild"
+	File            string          `json:"file"`
+	Success         bool            `json:"success"`
+	Result          string          `json:"result"` // rebuilt, validation-failed, rebuild-failed
+	Error           string          `json:"error,omitempty"`
+	SectionsChanged *SectionChanges `json:"sections_changed,omitempty"`
+	Timestamp       string          `json:"timestamp"`
+	DurationMS      float64         `json:"duration_ms"`
+	DaemonPID       int             `json:"daemon_pid"`
+}
+
+// rebuildEvent describes the outcome of a rebuild for webhooks and the
+// change stream (see daemon_events.go)
+func rebuildEvent(path string, result DaemonFileState) WebhookPayload {
+	return WebhookPayload{
+		Event:           "rebuild",
+		File:            path,
+		Success:         result.Error == "",
+		Result:          result.Result,
+		Error:           result.Error,
+		SectionsChanged: result.Sections,
+		Timestamp:       result.LastRebuild,
+		DurationMS:      result.DurationMS,
+		DaemonPID:       os.Getpid(),
+	}
+}
+
+// post sends the outcome of a rebuild. Failures are logged, not retried.
+func (w *daemonWebhook) post(path string, result DaemonFileState) {
+	body, err := json.Marshal(rebuildEvent(path, result))
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		daemonLog(logComponentWebhook).Error("Webhook failed", "file", path, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "iatf-daemon/"+Version)
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set("X-IATF-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		daemonLog(logComponentWebhook).Error("Webhook failed", "file", path, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		daemonLog(logComponentWebhook).Warn("Webhook rejected delivery", "file", path, "status", resp.Status)
+	}
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"strings"
@@ -19,6 +20,12 @@ func daemonSysProcAttr() *syscall.SysProcAttr {
 	}
 }
 
+// listenControlSocket listens on the Unix socket at path. The socket file
+// inherits the ACL of the user's profile, which other users cannot open.
+func listenControlSocket(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
+
 const taskName = "IATF Daemon"
 
 // isServiceInstalled checks if the daemon is installed as a Windows scheduled task
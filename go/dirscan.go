@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The polling watchers (watch-dir and the daemon) rescan their trees four
+// times a second. A directory's mtime only changes when entries are added,
+// removed or renamed in it, so while it is unchanged the listing from the
+// previous scan is reused: the .iatf files in it are still stat'ed for
+// edits, but the directory itself is not read again. Excluded entries are
+// dropped when a directory is listed, so excluded trees cost nothing.
+
+// listingSlack is how long after its mtime a directory must have been
+// listed for the listing to be reused. A change within the same mtime tick
+// (up to 2s on FAT) leaves the mtime as it was.
+const listingSlack = 2 * time.Second
+
+// dirEntryKind is what a listed entry is, as far as scanning cares
+type dirEntryKind int
+
+const (
+	entryDir     dirEntryKind = iota // Subdirectory, scanned in turn
+	entryFile                        // .iatf file
+	entrySymlink                     // Resolved on every scan, as its target can change
+)
+
+// dirEntry is an entry of a listed directory that was not excluded
+type dirEntry struct {
+	name string
+	kind dirEntryKind
+}
+
+// dirListing is a directory as it was last read
+type dirListing struct {
+	modTime time.Time
+	listed  time.Time
+	entries []dirEntry // In name order, as filepath.WalkDir visits them
+}
+
+// dirScanner walks trees as walkIATFFiles does, reusing the listings of
+// the directories unchanged since its previous walk of the same root
+type dirScanner struct {
+	excludes []string
+	symlinks string
+	roots    map[string]map[string]*dirListing // Root, then directory as reported
+}
+
+func newDirScanner() *dirScanner {
+	return &dirScanner{roots: make(map[string]map[string]*dirListing)}
+}
+
+// walk calls fn for every .iatf file under root. Listings only hold for the
+// excludes and symlink policy they were made with, so changing either (a
+// daemon.json reload) starts over.
+func (s *dirScanner) walk(root string, excludes []string, symlinks string, fn func(path string, info os.FileInfo)) {
+	if symlinks != s.symlinks || !slices.Equal(excludes, s.excludes) {
+		s.excludes = append([]string{}, excludes...)
+		s.symlinks = symlinks
+		s.roots = make(map[string]map[string]*dirListing)
+	}
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		if strings.HasSuffix(root, ".iatf") {
+			fn(root, info)
+		}
+		return
+	}
+
+	previous := s.roots[root]
+	current := make(map[string]*dirListing) // Directories gone since are forgotten
+	visited := make(map[string]bool)
+
+	var walkDir func(dir string, real string)
+	// walkTree scans the directory a path resolves to, unless it was
+	// already scanned through another path
+	walkTree := func(dir string) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil || visited[real] {
+			return
+		}
+		visited[real] = true
+		walkDir(dir, real)
+	}
+	walkDir = func(dir string, real string) {
+		listing := s.list(previous[dir], root, dir, real)
+		if listing == nil {
+			return
+		}
+		current[dir] = listing
+		for _, entry := range listing.entries {
+			p := filepath.Join(dir, entry.name)
+			switch entry.kind {
+			case entryDir:
+				// Mark real directories too, so links back into the tree
+				// are recognised as already visited
+				if symlinks == symlinksFollow {
+					if resolved, err := filepath.EvalSymlinks(p); err == nil {
+						if visited[resolved] {
+							continue
+						}
+						visited[resolved] = true
+					}
+				}
+				walkDir(p, filepath.Join(real, entry.name))
+			case entrySymlink:
+				info, err := os.Stat(p)
+				if err != nil {
+					continue
+				}
+				if info.IsDir() {
+					if symlinks == symlinksFollow {
+						walkTree(p)
+					}
+					continue
+				}
+				if strings.HasSuffix(p, ".iatf") {
+					fn(p, info)
+				}
+			case entryFile:
+				if info, err := os.Stat(p); err == nil {
+					fn(p, info)
+				}
+			}
+		}
+	}
+	walkTree(root)
+	s.roots[root] = current
+}
+
+// list returns the entries of dir, whose real path is real, reusing cached
+// when the directory has not changed since it was made
+func (s *dirScanner) list(cached *dirListing, root string, dir string, real string) *dirListing {
+	info, err := os.Stat(real)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	if cached != nil && cached.modTime.Equal(info.ModTime()) && cached.listed.Sub(cached.modTime) > listingSlack {
+		return cached
+	}
+
+	listed := time.Now()
+	entries, err := os.ReadDir(real)
+	if err != nil {
+		return nil
+	}
+	listing := &dirListing{modTime: info.ModTime(), listed: listed}
+	for _, entry := range entries {
+		if isExcludedPath(root, filepath.Join(dir, entry.Name()), s.excludes) {
+			continue
+		}
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			if s.symlinks != symlinksIgnore {
+				listing.entries = append(listing.entries, dirEntry{name: entry.Name(), kind: entrySymlink})
+			}
+		case entry.IsDir():
+			listing.entries = append(listing.entries, dirEntry{name: entry.Name(), kind: entryDir})
+		case strings.HasSuffix(entry.Name(), ".iatf"):
+			listing.entries = append(listing.entries, dirEntry{name: entry.Name(), kind: entryFile})
+		}
+	}
+	return listing
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// issueDoc documents a validation error or warning for 'iatf explain'
+type issueDoc struct {
+	Code        string
+	Title       string
+	Pattern     *regexp.Regexp // Matches the message printed by validate
+	Explanation string
+	Causes      []string
+	Example     string
+}
+
+// issueDocs lists every structured validation code. Codes are stable: add new
+// entries at the end of their group and never renumber existing ones.
+var issueDocs = []issueDoc{
+	{
+		Code:        "E001",
+		Title:       "Missing format declaration",
+		Pattern:     regexp.MustCompile(`^Missing format declaration`),
+		Explanation: "The first line of every IATF file must be exactly ':::IATF'. Tools use it to recognize the format before parsing anything else.",
+		Causes: []string{
+			"The file was created from a Markdown template without the header",
+			"Blank lines or a comment were inserted above the declaration",
+			"The editor saved a byte-order mark or other invisible characters first",
+		},
+		Example: ":::IATF\n@title: My Document\n\n===CONTENT===\n...",
+	},
+	{
+		Code:        "E002",
+		Title:       "Missing CONTENT section",
+		Pattern:     regexp.MustCompile(`^Missing CONTENT section`),
+		Explanation: "All sections live below a '===CONTENT===' marker. Without it there is nothing to index or read.",
+		Causes: []string{
+			"The marker was deleted or misspelled (it needs exactly three '=' on each side)",
+			"Sections were written directly after the header",
+		},
+		Example: ":::IATF\n@title: My Document\n\n===CONTENT===\n\n{#intro}\n# Introduction\n{/intro}",
+	},
+	{
+		Code:        "E003",
+		Title:       "Multiple INDEX sections",
+		Pattern:     regexp.MustCompile(`^Multiple INDEX sections`),
+		Explanation: "A file may contain only one '===INDEX===' block. A second one usually means two files or two versions of the INDEX were merged.",
+		Causes: []string{
+			"Copy-pasting content from another IATF file including its INDEX",
+			"A merge that kept both sides of a conflicting INDEX",
+		},
+		Example: "Run 'iatf recover <file>' to discard every INDEX block and regenerate a single one from CONTENT.",
+	},
+	{
+		Code:        "E004",
+		Title:       "Multiple CONTENT sections",
+		Pattern:     regexp.MustCompile(`^Multiple CONTENT sections`),
+		Explanation: "A file may contain only one '===CONTENT===' marker; everything after it is content.",
+		Causes: []string{
+			"Two IATF files were concatenated",
+			"The marker was pasted into a section as an example outside a code fence",
+		},
+		Example: "Keep the first '===CONTENT===' line and remove the others (wrap examples in ``` fences).",
+	},
+	{
+		Code:        "E005",
+		Title:       "INDEX appears after CONTENT",
+		Pattern:     regexp.MustCompile(`^INDEX section appears after CONTENT`),
+		Explanation: "The INDEX must sit between the header and '===CONTENT===' so agents can read it without scanning the whole file.",
+		Causes: []string{
+			"The INDEX was moved manually",
+			"An INDEX example was pasted into a section outside a code fence",
+		},
+		Example: "Remove the misplaced INDEX and run 'iatf rebuild <file>'.",
+	},
+	{
+		Code:        "E006",
+		Title:       "Closing tag without matching opening",
+		Pattern:     regexp.MustCompile(`^(Closing tag without matching opening|Invalid section nesting: closing tag)`),
+		Explanation: "Every '{/id}' must close the most recently opened section. A closing tag that doesn't match the innermost open section breaks the section tree.",
+		Causes: []string{
+			"A typo in the closing ID",
+			"Sections closed in the wrong order (overlapping instead of nested)",
+			"The opening tag was deleted but the closing tag kept",
+		},
+		Example: "{#parent}\n{#child}\n...\n{/child}\n{/parent}",
+	},
+	{
+		Code:        "E007",
+		Title:       "Unclosed section",
+		Pattern:     regexp.MustCompile(`^(Unclosed section|Invalid section nesting: unclosed section)`),
+		Explanation: "A section was opened with '{#id}' but the file ended before a matching '{/id}'.",
+		Causes: []string{
+			"The closing tag was forgotten when adding a new section",
+			"The closing tag has a typo, so it closes a different ID",
+		},
+		Example: "{#setup}\n# Setup\n...\n{/setup}",
+	},
+	{
+		Code:        "E008",
+		Title:       "Content outside section block",
+		Pattern:     regexp.MustCompile(`^Content outside section block`),
+		Explanation: "Every non-blank line below '===CONTENT===' must belong to a section, otherwise it is invisible to the INDEX and to 'iatf read'.",
+		Causes: []string{
+			"Text added after a section's closing tag",
+			"A Markdown heading written without wrapping it in a section",
+		},
+		Example: "Wrap the stray text in a section:\n{#notes}\n# Notes\nstray text\n{/notes}",
+	},
+	{
+		Code:        "E009",
+		Title:       "Duplicate INDEX section ID",
+		Pattern:     regexp.MustCompile(`^Duplicate INDEX section ID`),
+		Explanation: "The INDEX lists the same section ID twice, so line ranges can no longer be trusted.",
+		Causes: []string{
+			"The INDEX was edited by hand",
+			"A merge kept entries from both branches",
+		},
+		Example: "Run 'iatf rebuild <file>' to regenerate the INDEX from CONTENT.",
+	},
+	{
+		Code:        "E010",
+		Title:       "Invalid INDEX line range",
+		Pattern:     regexp.MustCompile(`^Invalid line range for INDEX section`),
+		Explanation: "An INDEX entry has a 'lines:a-b' range that is empty, reversed, or beyond the end of the file.",
+		Causes: []string{
+			"The file was truncated after the last rebuild",
+			"The INDEX was edited by hand",
+		},
+		Example: "Run 'iatf rebuild <file>' to recompute all line ranges.",
+	},
+	{
+		Code:        "E011",
+		Title:       "Section nesting too deep",
+		Pattern:     regexp.MustCompile(`^Section nesting exceeds`),
+		Explanation: "Sections may be nested at most two levels deep (a section and its subsections). Deeper trees make the INDEX hard for agents to navigate.",
+		Causes: []string{
+			"A subsection contains its own subsections",
+		},
+		Example: "Flatten the third level into sibling subsections:\n{#api}\n{#api-auth}\n...\n{/api-auth}\n{#api-tokens}\n...\n{/api-tokens}\n{/api}",
+	},
+	{
+		Code:        "E012",
+		Title:       "INDEX entry without CONTENT section",
+		Pattern:     regexp.MustCompile(`^INDEX references missing CONTENT section`),
+		Explanation: "The INDEX lists a section that no longer exists in CONTENT, so agents would try to read something that isn't there.",
+		Causes: []string{
+			"A section was deleted or renamed without rebuilding",
+		},
+		Example: "Run 'iatf rebuild <file>' after deleting or renaming sections.",
+	},
+	{
+		Code:        "E013",
+		Title:       "CONTENT section missing from INDEX",
+		Pattern:     regexp.MustCompile(`^CONTENT section missing from INDEX`),
+		Explanation: "A section exists in CONTENT but not in the INDEX, so agents navigating by INDEX will never find it.",
+		Causes: []string{
+			"A section was added without rebuilding",
+		},
+		Example: "Run 'iatf rebuild <file>' (or keep 'iatf watch' running while editing).",
+	},
+	{
+		Code:        "E014",
+		Title:       "INDEX line range mismatch",
+		Pattern:     regexp.MustCompile(`^INDEX line range mismatch`),
+		Explanation: "The INDEX range for a section no longer matches where the section actually starts and ends, so range-based reads return the wrong lines.",
+		Causes: []string{
+			"Lines were added or removed above the section after the last rebuild",
+		},
+		Example: "Run 'iatf rebuild <file>' to recompute all line ranges.",
+	},
+	{
+		Code:        "E015",
+		Title:       "Duplicate section ID",
+		Pattern:     regexp.MustCompile(`^Duplicate section ID`),
+		Explanation: "Section IDs must be unique within a file; references and 'iatf read' resolve IDs to exactly one section.",
+		Causes: []string{
+			"A section was copy-pasted as a template and the ID not changed",
+		},
+		Example: "Rename one of the sections (both '{#id}' and '{/id}') and update references to it.",
+	},
+	{
+		Code:        "E016",
+		Title:       "Reference to missing section",
+		Pattern:     regexp.MustCompile(`^Reference \{@[^}]*\} at line \d+: target section does not exist`),
+		Explanation: "A '{@id}' reference points to a section ID that doesn't exist in this file.",
+		Causes: []string{
+			"The target section was renamed or deleted",
+			"A typo in the referenced ID",
+			"The reference is an example that should be inside a code fence",
+		},
+		Example: "See {@existing-section-id} for details.",
+	},
+	{
+		Code:        "E017",
+		Title:       "Self-reference",
+		Pattern:     regexp.MustCompile(`^Reference \{@[^}]*\} at line \d+: self-reference`),
+		Explanation: "A section references itself. Self-references add no navigation value and create trivial cycles in 'iatf graph'.",
+		Causes: []string{
+			"Text moved between sections kept its reference",
+		},
+		Example: "Remove the reference or point it at a related section.",
+	},
+	{
+		Code:        "E018",
+		Title:       "Alias conflict",
+		Pattern:     regexp.MustCompile(`^(Invalid alias for section|Alias \S+ of section \S+ conflicts)`),
+		Explanation: "An '@aliases:' entry cannot resolve: it is not a valid section ID, is the ID of another section, or is also an alias of another section. References to it are not redirected.",
+		Causes: []string{
+			"A new section was given the old ID that is still listed as an alias",
+			"Two sections renamed from the same ID both list it",
+		},
+		Example: "Before: {#auth}\n@aliases: login\n...\n{#login}\nAfter:  Remove 'login' from @aliases: or rename the {#login} section",
+	},
+	{
+		Code:        "E019",
+		Title:       "Misplaced anchor",
+		Pattern:     regexp.MustCompile(`^Anchor \{#[^}]+\} at line \d+ is (outside section|defined more than once)`),
+		Explanation: "An anchor marker '{#section-id:name}' must be inside the section it names, and each name can be used once per section. Otherwise '{@section-id:name}' cannot tell which region it refers to.",
+		Causes: []string{
+			"The anchor was copied along with text into another section",
+			"The section was renamed but its anchors were not",
+			"Two regions of the same section were given the same name",
+		},
+		Example: "Before: {#setup}\n{#install:linux}\nAfter:  {#setup}\n{#setup:linux}",
+	},
+	{
+		Code:        "E020",
+		Title:       "Reference to missing anchor",
+		Pattern:     regexp.MustCompile(`^Reference \{@[^}]+\} at line \d+: target anchor does not exist`),
+		Explanation: "A '{@section-id:name}' reference points to an anchor that is not defined inside that section (or the section does not exist).",
+		Causes: []string{
+			"A typo in the section ID or anchor name",
+			"The anchor marker was removed or renamed",
+		},
+		Example: "Add '{#section-id:name}' where the region starts, or fix the reference.",
+	},
+	{
+		Code:        "E021",
+		Title:       "Section ID not unique in workspace",
+		Pattern:     regexp.MustCompile(`^Section ID not unique in workspace`),
+		Explanation: "A section has the same ID as a section in another .iatf file of the project. Only checked when asked for, with 'iatf validate --workspace <dir>' or the language server's workspaceUniqueIds setting, for projects that want every ID to name one section.",
+		Causes: []string{
+			"A section was copied from another file",
+			"Two files use a generic ID such as 'overview' or 'setup'",
+		},
+		Example: "Before: {#overview} (in api.iatf and cli.iatf)\nAfter:  {#api-overview} and {#cli-overview}",
+	},
+	{
+		Code:        "E022",
+		Title:       "Unresolved title reference",
+		Pattern:     regexp.MustCompile(`^Reference \{@"[^"]*"\} at line \d+: (no section has this title|title is ambiguous)`),
+		Explanation: "A '{@\"Section Title\"}' reference must match the title of exactly one section, character for character, so 'iatf rebuild' can turn it into '{@section-id}'.",
+		Causes: []string{
+			"The title has a typo or different capitalization",
+			"The section was retitled",
+			"Several sections share the title (use '{@section-id}' for those)",
+		},
+		Example: "Before: See {@\"Auth setup\"}.\nAfter:  See {@\"Authentication Setup\"}. (or See {@auth-setup}.)",
+	},
+	{
+		Code:        "E023",
+		Title:       "Merge conflict",
+		Pattern:     regexp.MustCompile(`^Merge conflict`),
+		Explanation: "The file still has the '<<<<<<<', '=======' and '>>>>>>>' markers git leaves where a merge could not combine both sides. A conflict in the INDEX does not need merging by hand: 'iatf resolve' drops the INDEX and regenerates it once the rest of the file has no conflicts.",
+		Causes: []string{
+			"Two branches edited the same lines of a section",
+			"Both branches rebuilt the INDEX, so their line ranges and hashes conflict",
+			"The conflict was committed before it was resolved",
+		},
+		Example: "Fix the conflicts in CONTENT by hand, keeping the lines you want and deleting the markers, then run 'iatf resolve <file>'.",
+	},
+	{
+		Code:        "E024",
+		Title:       "Unsupported encoding",
+		Pattern:     regexp.MustCompile(`^Unsupported encoding`),
+		Explanation: "IATF files must be UTF-8. A UTF-16 file has a zero byte beside every ASCII character, so not even the ':::IATF' declaration can be read. A UTF-8 file starting with a byte order mark is fine: the mark is ignored when reading and kept when the INDEX is rebuilt.",
+		Causes: []string{
+			"The file was saved as \"Unicode\" or \"UTF-16 LE\" in a Windows editor",
+			"The file was written by PowerShell 5's '>' or Out-File, which default to UTF-16",
+		},
+		Example: "Re-save the file as UTF-8 (\"UTF-8\" or \"UTF-8 with BOM\" in the editor's encoding menu), or convert it: iconv -f UTF-16 -t UTF-8 doc.iatf > doc-utf8.iatf",
+	},
+	{
+		Code:        "W001",
+		Title:       "No INDEX section",
+		Pattern:     regexp.MustCompile(`^No INDEX section`),
+		Explanation: "The file has no INDEX yet. It is still readable, but agents lose the cheap overview the INDEX provides.",
+		Causes: []string{
+			"The file was written by hand and never rebuilt",
+		},
+		Example: "Run 'iatf rebuild <file>'.",
+	},
+	{
+		Code:        "W002",
+		Title:       "Invalid Content-Hash format",
+		Pattern:     regexp.MustCompile(`^Invalid Content-Hash format`),
+		Explanation: "The INDEX Content-Hash comment could not be parsed, so staleness cannot be checked.",
+		Causes: []string{
+			"The comment was edited by hand",
+		},
+		Example: "<!-- Content-Hash: sha256:1a2b3c4 -->",
+	},
+	{
+		Code:        "W003",
+		Title:       "Unsupported Content-Hash algorithm",
+		Pattern:     regexp.MustCompile(`^Unsupported Content-Hash algorithm`),
+		Explanation: "Only sha256 content hashes are supported.",
+		Causes: []string{
+			"The INDEX was produced by another tool",
+		},
+		Example: "Run 'iatf rebuild <file>' to write a sha256 hash.",
+	},
+	{
+		Code:        "W004",
+		Title:       "Stale INDEX",
+		Pattern:     regexp.MustCompile(`^INDEX Content-Hash does not match`),
+		Explanation: "CONTENT changed since the INDEX was generated, so summaries, word counts, and line ranges may be outdated.",
+		Causes: []string{
+			"The file was edited without rebuilding",
+		},
+		Example: "Run 'iatf rebuild <file>' (or keep 'iatf watch' running while editing).",
+	},
+	{
+		Code:        "W005",
+		Title:       "INDEX missing Content-Hash",
+		Pattern:     regexp.MustCompile(`^INDEX missing Content-Hash`),
+		Explanation: "The INDEX has no Content-Hash comment, so 'iatf validate' cannot tell whether it is stale.",
+		Causes: []string{
+			"The INDEX was generated by an older version",
+		},
+		Example: "Run 'iatf rebuild <file>'.",
+	},
+	{
+		Code:        "W006",
+		Title:       "No sections",
+		Pattern:     regexp.MustCompile(`^No sections found`),
+		Explanation: "CONTENT contains no '{#id}' sections, so there is nothing for agents to navigate.",
+		Causes: []string{
+			"A new file that hasn't been filled in yet",
+		},
+		Example: "{#intro}\n@summary: What this document covers\n# Introduction\n...\n{/intro}",
+	},
+	{
+		Code:        "W007",
+		Title:       "Unknown section status",
+		Pattern:     regexp.MustCompile(`^Unknown status for section`),
+		Explanation: "A section's '@status:' is not one of draft, stable or deprecated, so tools cannot tell whether to include it.",
+		Causes: []string{
+			"A typo such as 'stabel' or 'depreciated'",
+			"A status from another workflow, such as 'review' or 'wip'",
+		},
+		Example: "{#old-auth}\n@status: deprecated\n# Legacy Authentication\n...\n{/old-auth}",
+	},
+	{
+		Code:        "W008",
+		Title:       "Reference to deprecated section",
+		Pattern:     regexp.MustCompile(`^Reference \{@[^}]+\} at line \d+: target section is deprecated`),
+		Explanation: "A section that is not deprecated references a section marked '@status: deprecated'. Agents following the reference land on outdated guidance.",
+		Causes: []string{
+			"The target was deprecated after the reference was written",
+			"The replacement section exists but the reference was not updated",
+		},
+		Example: "Before: See {@old-auth} for login.\nAfter:  See {@auth} for login.",
+	},
+	{
+		Code:        "W009",
+		Title:       "Invalid review date",
+		Pattern:     regexp.MustCompile(`^Invalid review date for section`),
+		Explanation: "A section's '@review-by:' is not a YYYY-MM-DD date, so 'iatf outdated' falls back to its Modified date.",
+		Causes: []string{
+			"A date in another format, such as '12/01/2026' or '2026-12'",
+			"A description instead of a date, such as 'next quarter'",
+		},
+		Example: "Before: @review-by: Dec 2026\nAfter:  @review-by: 2026-12-01",
+	},
+	{
+		Code:        "W010",
+		Title:       "Unknown header field",
+		Pattern:     regexp.MustCompile(`^Unknown header field`),
+		Explanation: "The header only supports @title, @purpose, @description, @version and @updated. Other fields are ignored by tools.",
+		Causes: []string{
+			"A typo such as '@titel' or '@descripton'",
+			"Custom metadata such as '@author'",
+		},
+		Example: "Before: @titel: API Reference\nAfter:  @title: API Reference",
+	},
+	{
+		Code:        "W011",
+		Title:       "Invalid header date",
+		Pattern:     regexp.MustCompile(`^Invalid header date`),
+		Explanation: "The header's '@updated:' is not a YYYY-MM-DD date.",
+		Causes: []string{
+			"A date in another format, such as '10/17/2026'",
+		},
+		Example: "Before: @updated: Oct 17, 2026\nAfter:  @updated: 2026-10-17",
+	},
+	{
+		Code:        "W012",
+		Title:       "Reference through alias",
+		Pattern:     regexp.MustCompile(`^Reference \{@[^}]+\} at line \d+: \S+ is an alias of`),
+		Explanation: "A reference uses a former ID listed in a section's '@aliases:'. It still resolves, but should be updated so the alias can eventually be removed.",
+		Causes: []string{
+			"The section was renamed and older references were not updated",
+		},
+		Example: "Before: See {@login} for details.\nAfter:  See {@auth} for details.",
+	},
+	{
+		Code:        "W013",
+		Title:       "Invalid header setting",
+		Pattern:     regexp.MustCompile(`^Invalid header setting`),
+		Explanation: "A header field that changes how 'iatf rebuild' writes the INDEX has a value it does not understand, so the default is used: '@summary-width:' takes a number of columns (default 100), '@hashes:' takes 'short' (default) or 'full' and '@word-count:' takes 'unicode' (default) or 'spaces' and '@title-refs:' takes 'rewrite' (default) or 'keep'.",
+		Causes: []string{
+			"A unit or word as the summary width, such as '80ch' or 'none' (use 0 to turn wrapping off)",
+			"A hash length other than 'short' or 'full', such as 'sha256'",
+			"A word count method other than 'unicode' or 'spaces'",
+		},
+		Example: "Before: @summary-width: none\nAfter:  @summary-width: 0",
+	},
+	{
+		Code:        "W014",
+		Title:       "Section hash mismatch",
+		Pattern:     regexp.MustCompile(`^Section hash (mismatch|is not full-length)`),
+		Explanation: "The Hash: of an INDEX entry does not match the CONTENT of its section, or is a short hash in a document with '@hashes: full'. 'iatf validate' checks section hashes of documents with '@hashes: full'; 'iatf verify' checks every document.",
+		Causes: []string{
+			"The section was edited and the INDEX not rebuilt",
+			"The CONTENT was changed by something other than its authors",
+			"'@hashes: full' was added to the header and the INDEX not rebuilt",
+		},
+		Example: "Review the change to the section, then run 'iatf rebuild' to record its new hash.",
+	},
+	{
+		Code:        "W015",
+		Title:       "Unknown section visibility",
+		Pattern:     regexp.MustCompile(`^Unknown visibility for section`),
+		Explanation: "A section's '@visibility:' is not public or private. The section is treated as public, so 'iatf read' and the servers hand it out.",
+		Causes: []string{
+			"A typo such as 'privat'",
+			"A value from another system, such as 'internal' or 'hidden' (use '@audience:' for audiences)",
+		},
+		Example: "{#credentials}\n@visibility: private\n# Staging Credentials\n...\n{/credentials}",
+	},
+}
+
+// issueCode returns the structured code for a validation message, or "" if unknown
+func issueCode(message string) string {
+	for _, doc := range issueDocs {
+		if doc.Pattern.MatchString(message) {
+			return doc.Code
+		}
+	}
+	return ""
+}
+
+// formatIssue prefixes a validation message with its code when one is known
+func formatIssue(message string) string {
+	if code := issueCode(message); code != "" {
+		return fmt.Sprintf("[%s] %s", code, message)
+	}
+	return message
+}
+
+// findIssueDoc looks up a code case-insensitively
+func findIssueDoc(code string) (issueDoc, bool) {
+	code = strings.ToUpper(strings.Trim(strings.TrimSpace(code), "[]"))
+	for _, doc := range issueDocs {
+		if doc.Code == code {
+			return doc, true
+		}
+	}
+	return issueDoc{}, false
+}
+
+// renderIssueDoc formats the full explanation for a code
+func renderIssueDoc(doc issueDoc) string {
+	var b strings.Builder
+	severity := "error"
+	if strings.HasPrefix(doc.Code, "W") {
+		severity = "warning"
+	}
+	fmt.Fprintf(&b, "%s: %s (%s)\n\n", doc.Code, doc.Title, severity)
+	fmt.Fprintf(&b, "%s\n", doc.Explanation)
+	if len(doc.Causes) > 0 {
+		b.WriteString("\nCommon causes:\n")
+		for _, cause := range doc.Causes {
+			fmt.Fprintf(&b, "  - %s\n", cause)
+		}
+	}
+	if doc.Example != "" {
+		b.WriteString("\nHow to fix:\n")
+		for _, line := range strings.Split(doc.Example, "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	return b.String()
+}
+
+func explainCommand(code string) int {
+	if code == "--list" {
+		for _, doc := range issueDocs {
+			fmt.Printf("%s  %s\n", doc.Code, doc.Title)
+		}
+		return 0
+	}
+
+	doc, found := findIssueDoc(code)
+	if !found {
+		fmt.Fprintf(os.Stderr, "Error: Unknown code: %s\n", code)
+		fmt.Fprintln(os.Stderr, "Run 'iatf explain --list' to see all codes")
+		return 1
+	}
+
+	fmt.Print(renderIssueDoc(doc))
+	return 0
+}
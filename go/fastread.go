@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// Reading a section by ID needs only the lines of that section, and the
+// INDEX records where they are. The file is streamed: the header and INDEX
+// are kept, CONTENT is only hashed, except for the section's lines and the
+// tag lines of the sections enclosing it. If the INDEX's Content-Hash then
+// matches, its ranges were current and readCommand prints the section
+// without parsing the rest of CONTENT. Anything unexpected (no INDEX, a
+// stale one, an alias, tags not where the INDEX puts them) falls back to
+// reading and parsing the whole document.
+
+// indexRangePattern matches an INDEX entry: its level, ID and line range
+var indexRangePattern = regexp.MustCompile(`^(#{1,6})\s+.*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|\s*lines:(\d+)-(\d+)`)
+
+// errNotIndexed stops a stream once it is clear the INDEX cannot be used
+var errNotIndexed = errors.New("not in the INDEX")
+
+// indexRange is the position of a section as its INDEX entry records it
+type indexRange struct {
+	id    string
+	level int
+	start int // 1-indexed, like Section.Start and Section.End
+	end   int
+}
+
+// indexRanges returns the INDEX entries in lines, up to the 0-indexed
+// ===CONTENT=== marker
+func indexRanges(lines []string, contentMarker int) []indexRange {
+	ranges := []indexRange{}
+	for _, line := range lines[:contentMarker] {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "#") {
+			continue // Summaries, tags and other details of an entry
+		}
+		match := indexRangePattern.FindStringSubmatch(trimmed)
+		if match == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(match[3])
+		end, _ := strconv.Atoi(match[4])
+		ranges = append(ranges, indexRange{id: match[2], level: len(match[1]), start: start, end: end})
+	}
+	return ranges
+}
+
+// locateIndexEntry returns the INDEX entry of id and the entries enclosing
+// it, outermost first
+func locateIndexEntry(head []string, contentMarker int, id string) (indexRange, []indexRange, bool) {
+	stack := []indexRange{}
+	for _, r := range indexRanges(head, contentMarker) {
+		for len(stack) >= r.level {
+			stack = stack[:len(stack)-1]
+		}
+		if r.id == id {
+			for _, enclosing := range append(stack, r) {
+				if enclosing.start <= contentMarker+1 || enclosing.end < enclosing.start {
+					return indexRange{}, nil, false
+				}
+			}
+			return r, stack, true
+		}
+		stack = append(stack, r)
+	}
+	return indexRange{}, nil, false
+}
+
+// isSectionHeaderLine reports whether line continues the tag of a section:
+// a metadata line or an indented @summary: continuation
+func isSectionHeaderLine(line string) bool {
+	return strings.HasPrefix(line, "@") ||
+		(strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && strings.TrimSpace(line) != ""
+}
+
+// hasTags reports whether opening and closing are the tags of section id
+func hasTags(opening string, closing string, id string) bool {
+	openMatch := iatf.SectionOpenPattern.FindStringSubmatch(opening)
+	closeMatch := iatf.SectionClosePattern.FindStringSubmatch(closing)
+	return openMatch != nil && openMatch[1] == id && closeMatch != nil && closeMatch[1] == id
+}
+
+// readIndexedSection streams the file at path and returns section id with
+// the sections readCommand filters by: those enclosing it, parsed from their
+// tag and metadata lines only, itself and those nested in it. Their line
+// numbers count from the section's tag, which is line 1 of window. ok is
+// false when the INDEX cannot be trusted to locate the section.
+func readIndexedSection(path string, id string) (target Section, sections []Section, window []string, ok bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Section{}, nil, nil, false
+	}
+	defer file.Close()
+
+	head := []string{}
+	contentStart := -1 // 0-indexed first line of CONTENT
+	var entry indexRange
+	var enclosing []indexRange
+	headers := [][]string{} // Tag and metadata lines of each enclosing section
+	closings := []string{}  // Line at the end of each enclosing section
+	hash := sha256.New()
+
+	err = iatf.ScanLines(file, func(i int, line string) error {
+		if contentStart == -1 {
+			head = append(head, line)
+			if strings.TrimSpace(line) != "===CONTENT===" {
+				return nil
+			}
+			contentStart = i + 1
+			var found bool
+			if entry, enclosing, found = locateIndexEntry(head, i, id); !found {
+				return errNotIndexed
+			}
+			headers = make([][]string, len(enclosing))
+			closings = make([]string, len(enclosing))
+			return nil
+		}
+
+		if i > contentStart {
+			io.WriteString(hash, "\n")
+		}
+		io.WriteString(hash, line)
+
+		n := i + 1
+		for k, r := range enclosing {
+			switch {
+			case n == r.start:
+				headers[k] = []string{line}
+			case n == r.end:
+				closings[k] = line
+			case n < r.end && len(headers[k]) == n-r.start && isSectionHeaderLine(line):
+				headers[k] = append(headers[k], line)
+			}
+		}
+		if n >= entry.start && n <= entry.end {
+			window = append(window, line)
+		}
+		return nil
+	})
+	if err != nil || contentStart == -1 {
+		return Section{}, nil, nil, false
+	}
+
+	stored := iatf.ContentHash(head)
+	if stored == "" || !iatf.HashMatches(stored, hex.EncodeToString(hash.Sum(nil))) {
+		return Section{}, nil, nil, false
+	}
+	if len(window) != entry.end-entry.start+1 || !hasTags(window[0], window[len(window)-1], id) {
+		return Section{}, nil, nil, false
+	}
+
+	for k, r := range enclosing {
+		if len(headers[k]) == 0 || !hasTags(headers[k][0], closings[k], r.id) {
+			return Section{}, nil, nil, false
+		}
+		parsed := iatf.ParseSections(headers[k], 0)
+		section := parsed[0]
+		section.Start = r.start - entry.start + 1
+		section.End = r.end - entry.start + 1
+		section.Level = r.level
+		section.ContentLines = nil
+		sections = append(sections, section)
+	}
+
+	nested := iatf.ParseSections(window, 0)
+	if len(nested) == 0 || nested[0].End != len(window) {
+		return Section{}, nil, nil, false
+	}
+	for i := range nested {
+		nested[i].Level += entry.level - 1
+	}
+	return nested[0], append(sections, nested...), window, true
+}
+
+// readFileLines returns the lines of the file at path, read line by line so
+// its content is not held twice
+func readFileLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	limits := activeLimits.Load()
+	if info, err := file.Stat(); err == nil {
+		if err := limits.checkSize(path, info.Size()); err != nil {
+			return nil, err
+		}
+	}
+	lines := []string{}
+	err = iatf.ScanLines(file, func(i int, line string) error {
+		if limits.maxLines > 0 && i >= limits.maxLines {
+			return limits.tooManyLines(path)
+		}
+		lines = append(lines, line)
+		return nil
+	})
+	if err == nil && iatf.IsUTF16(lines[0]) {
+		// The lines are still returned, for validation to report
+		return lines, fmt.Errorf("%s: %w", path, iatf.ErrUTF16)
+	}
+	return lines, err
+}
+
+// streamIndexLines returns the INDEX of the file at path as loadIndexLines
+// does, keeping no line of CONTENT: those are only checked for nesting and
+// scanned for private sections, whose IDs are returned. found is false when
+// the file has no INDEX, so it has to be generated from CONTENT in memory.
+func streamIndexLines(path string) (indexLines []string, private map[string]bool, found bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer file.Close()
+
+	head := []string{}
+	indexStart, contentStart := -1, -1
+	checker := iatf.NestingChecker{}
+	privacy := privateScanner{private: map[string]bool{}}
+	err = iatf.ScanLines(file, func(i int, line string) error {
+		if contentStart != -1 {
+			privacy.line(line)
+			return checker.Line(i+1, line)
+		}
+		if i == 0 && iatf.IsUTF16(line) {
+			return fmt.Errorf("%s: %w", path, iatf.ErrUTF16)
+		}
+		head = append(head, line)
+		switch strings.TrimSpace(line) {
+		case "===INDEX===":
+			indexStart = i
+		case "===CONTENT===":
+			contentStart = i + 1
+			if indexStart == -1 {
+				return errNotIndexed
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = checker.Err()
+	}
+
+	var nesting *iatf.NestingError
+	switch {
+	case errors.Is(err, errNotIndexed):
+		return nil, nil, false, nil
+	case errors.As(err, &nesting):
+		return nil, nil, true, fmt.Errorf("invalid section nesting: %w", err)
+	case err != nil:
+		return nil, nil, true, err
+	case contentStart == -1:
+		return nil, nil, true, fmt.Errorf("no ===CONTENT=== section found")
+	}
+	return head[indexStart+1 : contentStart-1], privacy.private, true, nil
+}
+
+// contentHashCurrent reports whether the Content-Hash in the INDEX of the
+// file at path matches its CONTENT, streaming the file to hash it
+func contentHashCurrent(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	head := []string{}
+	contentStart := -1
+	hash := sha256.New()
+	err = iatf.ScanLines(file, func(i int, line string) error {
+		if contentStart == -1 {
+			head = append(head, line)
+			if strings.TrimSpace(line) == "===CONTENT===" {
+				contentStart = i + 1
+			}
+			return nil
+		}
+		if i > contentStart {
+			io.WriteString(hash, "\n")
+		}
+		io.WriteString(hash, line)
+		return nil
+	})
+	if err != nil || contentStart == -1 {
+		return false, err
+	}
+	stored := iatf.ContentHash(head)
+	return stored != "" && iatf.HashMatches(stored, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// privateScanner finds, one line of CONTENT at a time, the sections that
+// privateSections would: those marked @visibility: private among the
+// metadata lines after their open tag, and the sections nested in them
+type privateScanner struct {
+	open    []scannedSection // Innermost last
+	private map[string]bool
+}
+
+type scannedSection struct {
+	id      string
+	header  bool // Still in its metadata lines
+	summary bool // Indented lines continue its @summary:
+}
+
+func (p *privateScanner) line(line string) {
+	if match := iatf.SectionOpenPattern.FindStringSubmatch(line); match != nil {
+		if len(p.open) > 0 && p.private[p.open[len(p.open)-1].id] {
+			p.private[match[1]] = true
+		}
+		p.open = append(p.open, scannedSection{id: match[1], header: true})
+		return
+	}
+	last := len(p.open) - 1
+	if last >= 0 && p.open[last].header {
+		section := &p.open[last]
+		if strings.HasPrefix(line, "@") {
+			section.summary = strings.HasPrefix(line, "@summary:")
+			if strings.HasPrefix(line, "@visibility:") && strings.ToLower(strings.TrimSpace(line[len("@visibility:"):])) == iatf.VisibilityPrivate {
+				p.private[section.id] = true
+			}
+			return
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && strings.TrimSpace(line) != "" && section.summary {
+			return
+		}
+		section.header, section.summary = false, false
+	}
+	if match := iatf.SectionClosePattern.FindStringSubmatch(line); match != nil && last >= 0 && p.open[last].id == match[1] {
+		p.open = p.open[:last]
+	}
+}
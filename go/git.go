@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// Git integration. 'iatf git textconv' turns a document into a text that
+// diffs well: the INDEX, which rebuilds rewrite wholesale, is left out, and
+// each run of lines is preceded by a marker naming the section it belongs
+// to, so 'git diff' shows which section changed instead of line ranges.
+// 'iatf git setup' registers it as the diff driver for *.iatf files.
+
+// gitDiffDriver is the name of the diff driver in git config and .gitattributes
+const gitDiffDriver = "iatf"
+
+// gitAttributesLine assigns the diff driver to .iatf files
+const gitAttributesLine = "*.iatf diff=" + gitDiffDriver
+
+// sectionMarkerPrefix starts the marker lines of the textconv output. The
+// driver's xfuncname matches them, so hunk headers name the section.
+const sectionMarkerPrefix = "@@@ section "
+
+// runGit runs git with args in dir and returns its trimmed standard output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// textconvLines returns the diff representation of a document: its header,
+// then the lines of each section under a marker with its path of IDs and
+// its title. Blank lines between sections are dropped, and a section that
+// goes on after a nested one gets its marker again. Documents whose
+// sections cannot be parsed are returned without their INDEX only.
+func textconvLines(lines []string) []string {
+	headerEnd := iatf.HeaderEnd(lines)
+	output := trimTrailingBlank(append([]string{}, lines[:headerEnd]...))
+
+	contentStart := iatf.ContentStart(lines)
+	if contentStart == -1 {
+		return append(output, lines[headerEnd:]...)
+	}
+	if iatf.ValidateNesting(lines, contentStart) != nil {
+		return append(append(output, "===CONTENT==="), lines[contentStart:]...)
+	}
+
+	sections := iatf.ParseSections(lines, contentStart)
+	byStart := map[int]iatf.Section{}
+	closes := map[int]bool{}
+	for _, section := range sections {
+		byStart[section.Start] = section
+		closes[section.End] = true
+	}
+
+	type openSection struct {
+		path  string
+		title string
+	}
+	stack := []openSection{}
+	addMarker := func(section openSection, continued bool) {
+		line := sectionMarkerPrefix + section.path + ": " + section.title
+		if continued {
+			line += " (continued)"
+		}
+		output = append(trimTrailingBlank(output), "", line)
+	}
+	resumed := false // A nested section just closed; the next lines need a marker
+	for i := contentStart; i < len(lines); i++ {
+		line := lines[i]
+		if section, found := byStart[i+1]; found {
+			path := section.ID
+			if len(stack) > 0 {
+				path = stack[len(stack)-1].path + "/" + section.ID
+			}
+			stack = append(stack, openSection{path: path, title: section.Title})
+			addMarker(stack[len(stack)-1], false)
+			resumed = false
+			continue
+		}
+		if len(stack) > 0 && closes[i+1] {
+			stack = stack[:len(stack)-1]
+			resumed = len(stack) > 0
+			continue
+		}
+		if strings.TrimSpace(line) == "" && (len(stack) == 0 || resumed) {
+			continue
+		}
+		if resumed {
+			addMarker(stack[len(stack)-1], true)
+			resumed = false
+		}
+		output = append(output, line)
+	}
+	return trimTrailingBlank(output)
+}
+
+// trimTrailingBlank drops the blank lines at the end of lines
+func trimTrailingBlank(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// gitTextconvCommand prints the diff representation of filePath
+func gitTextconvCommand(filePath string) int {
+	content, err := readDocument(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	for _, line := range textconvLines(lines) {
+		fmt.Println(line)
+	}
+	return 0
+}
+
+// gitSetupCommand registers 'iatf git textconv' as the diff driver of .iatf
+// files, in the repository containing dir or, with global, for the user
+func gitSetupCommand(dir string, global bool) int {
+	execPath, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Could not locate the iatf executable: %v\n", err)
+		return 1
+	}
+
+	scope := "--local"
+	attributesPath := ""
+	if global {
+		scope = "--global"
+		attributesPath, err = globalAttributesPath(dir)
+	} else {
+		var top string
+		top, err = runGit(dir, "rev-parse", "--show-toplevel")
+		attributesPath = filepath.Join(top, ".gitattributes")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	settings := [][2]string{
+		{"diff." + gitDiffDriver + ".textconv", fmt.Sprintf("%q git textconv", execPath)},
+		{"diff." + gitDiffDriver + ".xfuncname", "^" + sectionMarkerPrefix + ".*$"},
+	}
+	for _, setting := range settings {
+		if _, err := runGit(dir, "config", scope, setting[0], setting[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	added, err := addAttributesLine(attributesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating %s: %v\n", attributesPath, err)
+		return 1
+	}
+	fmt.Printf("%s Configured the %s diff driver (%s git config)\n", mark(os.Stdout, "[OK]"), gitDiffDriver, strings.TrimPrefix(scope, "--"))
+	if added {
+		fmt.Printf("%s Added '%s' to %s\n", mark(os.Stdout, "[OK]"), gitAttributesLine, attributesPath)
+	} else {
+		fmt.Printf("%s already assigns the driver\n", attributesPath)
+	}
+	return 0
+}
+
+// globalAttributesPath returns the user's attributes file: core.attributesFile,
+// or git's default under the XDG config directory
+func globalAttributesPath(dir string) (string, error) {
+	if path, err := runGit(dir, "config", "--global", "--path", "core.attributesFile"); err == nil && path != "" {
+		return path, nil
+	}
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return filepath.Join(config, "git", "attributes"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "git", "attributes"), nil
+}
+
+// addAttributesLine appends gitAttributesLine to the attributes file at
+// path unless it is already there; added reports whether it was appended
+func addAttributesLine(path string) (added bool, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.Join(strings.Fields(line), " ") == gitAttributesLine {
+			return false, nil
+		}
+	}
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	content = append(content, gitAttributesLine+"\n"...)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path, content, 0644)
+}
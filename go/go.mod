@@ -4,8 +4,4 @@ go 1.24.0
 
 // No external dependencies required
 
-require golang.org/x/sys v0.40.0 // indirect
-
-
-
-
+require golang.org/x/sys v0.40.0
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf history' shows how one section evolved: it walks the commits that
+// changed the file (following renames), finds the section by ID in each
+// revision, and diffs its lines against the previous revision. Sections
+// are located anew in every revision, so they can move around the file
+// without the history losing track; former IDs in the section's @aliases:
+// are followed too.
+
+// diffContext is the number of unchanged lines shown around a change
+const diffContext = 3
+
+// maxDiffCells bounds the table of the line diff; larger sections are shown
+// as replaced wholesale
+const maxDiffCells = 4_000_000
+
+// historyArgs are the parsed arguments of 'iatf history' after the file and ID
+type historyArgs struct {
+	limit int // At most this many changes, newest first; 0 for all
+	json  bool
+}
+
+// gitCommit is a commit of the file's log
+type gitCommit struct {
+	Hash    string
+	Author  string
+	Date    string // YYYY-MM-DD
+	Subject string
+	path    string // Path of the file in the commit, relative to the repository
+}
+
+// SectionHistory is the output of 'iatf history --json'
+type SectionHistory struct {
+	File    string          `json:"file"`
+	ID      string          `json:"id"`
+	Changes []SectionChange `json:"changes"`
+}
+
+// SectionChange is a commit that changed a section
+type SectionChange struct {
+	Commit  string `json:"commit"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+	Change  string `json:"change"`        // added, modified or removed
+	ID      string `json:"id"`            // The section's ID in that commit
+	Was     string `json:"was,omitempty"` // Its ID in the commit before, if different
+	Start   int    `json:"start"`         // Its lines in that commit, 0 when removed
+	End     int    `json:"end"`
+	Diff    string `json:"diff"` // Unified diff of the section's lines
+}
+
+// sectionVersion is a section as one revision of the file has it
+type sectionVersion struct {
+	id    string
+	start int
+	end   int
+	lines []string // nil when the revision has no such section
+}
+
+// parseHistoryArgs reads --limit <n> and --json
+func parseHistoryArgs(args []string) (historyArgs, error) {
+	parsed := historyArgs{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			parsed.json = true
+		case "--limit":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("--limit requires a value")
+			}
+			limit, err := strconv.Atoi(args[i+1])
+			if err != nil || limit <= 0 {
+				return parsed, fmt.Errorf("invalid limit %q (expected a positive number)", args[i+1])
+			}
+			parsed.limit = limit
+			i++
+		default:
+			return parsed, fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	return parsed, nil
+}
+
+// gitFileLog returns the commits that changed the file at path, newest
+// first, following renames
+func gitFileLog(path string) ([]gitCommit, error) {
+	output, err := runGit(filepath.Dir(path), "log", "--follow", "--name-only", "--date=short",
+		"--format=%x00%H%x09%an%x09%ad%x09%s", "--", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	commits := []gitCommit{}
+	for _, entry := range strings.Split(output, "\x00") {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		fields := strings.SplitN(lines[0], "\t", 4)
+		if len(fields) < 4 || len(lines) < 2 {
+			continue // Merges list no file
+		}
+		commits = append(commits, gitCommit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Date:    fields[2],
+			Subject: fields[3],
+			path:    strings.TrimSpace(lines[len(lines)-1]),
+		})
+	}
+	return commits, nil
+}
+
+// findSectionVersion returns the section with any of ids in a revision of
+// the file, or a version without lines when it has none
+func findSectionVersion(content string, ids []string) sectionVersion {
+	lines := strings.Split(content, "\n")
+	contentStart := iatf.ContentStart(lines)
+	if contentStart == -1 {
+		return sectionVersion{}
+	}
+	for _, section := range iatf.ParseSections(lines, contentStart) {
+		if !contains(ids, section.ID) {
+			continue
+		}
+		end := section.End
+		if end == 0 {
+			end = len(lines)
+		}
+		return sectionVersion{id: section.ID, start: section.Start, end: end, lines: lines[section.Start-1 : end]}
+	}
+	return sectionVersion{}
+}
+
+// historyCommand prints the commits that changed a section, newest first,
+// each with the diff of the section's lines
+func historyCommand(filePath string, sectionID string, args historyArgs) int {
+	doc, err := loadDocument(filePath)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+	if doc.contentStart == -1 {
+		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
+		return 1
+	}
+	ids := []string{sectionID}
+	if section, _, found := iatf.ResolveSectionID(doc.sections, sectionID); found {
+		ids = append([]string{section.ID}, section.Aliases...)
+	}
+
+	commits, err := gitFileLog(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	top, err := runGit(filepath.Dir(filePath), "rev-parse", "--show-toplevel")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	versions := make([]sectionVersion, len(commits))
+	for i, commit := range commits {
+		content, err := runGit(top, "show", "--no-textconv", commit.Hash+":"+commit.path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", commit.Hash[:7], err)
+			continue
+		}
+		versions[i] = findSectionVersion(content, ids)
+	}
+
+	history := SectionHistory{File: filePath, ID: ids[0], Changes: []SectionChange{}}
+	for i, commit := range commits {
+		if args.limit > 0 && len(history.Changes) >= args.limit {
+			break
+		}
+		previous := sectionVersion{}
+		if i+1 < len(versions) {
+			previous = versions[i+1]
+		}
+		current := versions[i]
+		change := SectionChange{Commit: commit.Hash[:7], Author: commit.Author, Date: commit.Date, Subject: commit.Subject}
+		switch {
+		case current.lines == nil && previous.lines == nil:
+			continue
+		case current.lines == nil:
+			change.Change, change.ID = "removed", previous.id
+		case previous.lines == nil:
+			change.Change, change.ID, change.Start, change.End = "added", current.id, current.start, current.end
+		case previous.id == current.id && strings.Join(previous.lines, "\n") == strings.Join(current.lines, "\n"):
+			continue
+		default:
+			change.Change, change.ID, change.Start, change.End = "modified", current.id, current.start, current.end
+			if previous.id != current.id {
+				change.Was = previous.id
+			}
+		}
+		diff := unifiedDiff(previous.lines, current.lines, previous.start, current.start)
+		change.Diff = strings.Join(diff, "\n")
+		history.Changes = append(history.Changes, change)
+	}
+
+	if args.json {
+		return printJSON(history)
+	}
+	if len(history.Changes) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No committed changes to section %s in %s\n", sectionID, filePath)
+		return 1
+	}
+	fmt.Printf("@history: %s#%s (%d change(s))\n", filepath.Base(filePath), ids[0], len(history.Changes))
+	for _, change := range history.Changes {
+		fmt.Printf("\ncommit %s  %s  %s  %s\n", change.Commit, change.Date, change.Author, change.Subject)
+		line := fmt.Sprintf("Section %s %s", change.ID, change.Change)
+		if change.Change != "removed" {
+			line += fmt.Sprintf(", lines %d-%d", change.Start, change.End)
+		}
+		if change.Was != "" {
+			line += " (was " + change.Was + ")"
+		} else if change.ID != history.ID {
+			line += " (now " + history.ID + ")"
+		}
+		fmt.Println(line)
+		fmt.Println(change.Diff)
+	}
+	return 0
+}
+
+// unifiedDiff returns the hunks turning a into b, with line numbers counted
+// from aStart and bStart (1-indexed lines of the file the slices came from)
+func unifiedDiff(a []string, b []string, aStart int, bStart int) []string {
+	// ops holds ' ', '-' or '+' for each line of the edit script
+	ops := []byte{}
+	if len(a)*len(b) > maxDiffCells {
+		ops = append(ops, []byte(strings.Repeat("-", len(a))+strings.Repeat("+", len(b)))...)
+	} else {
+		// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+		common := make([][]int, len(a)+1)
+		for i := range common {
+			common[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					common[i][j] = common[i+1][j+1] + 1
+				} else {
+					common[i][j] = max(common[i+1][j], common[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				ops = append(ops, ' ')
+				i++
+				j++
+			case i < len(a) && (j == len(b) || common[i+1][j] >= common[i][j+1]):
+				ops = append(ops, '-')
+				i++
+			default:
+				ops = append(ops, '+')
+				j++
+			}
+		}
+	}
+
+	hunks := []string{}
+	for start := 0; start < len(ops); {
+		// Find the next change and extend the hunk while changes are close
+		first := start
+		for first < len(ops) && ops[first] == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		from := max(first-diffContext, start)
+		to := first
+		for k := first; k < len(ops); k++ {
+			if ops[k] != ' ' {
+				to = k + 1
+			} else if k-to >= 2*diffContext {
+				break
+			}
+		}
+		to = min(to+diffContext, len(ops))
+
+		// Line numbers at the start of the hunk
+		aLine, bLine := aStart, bStart
+		for _, op := range ops[:from] {
+			if op != '+' {
+				aLine++
+			}
+			if op != '-' {
+				bLine++
+			}
+		}
+		body := []string{}
+		aCount, bCount := 0, 0
+		ai, bi := aLine-aStart, bLine-bStart
+		for _, op := range ops[from:to] {
+			switch op {
+			case ' ':
+				body = append(body, " "+a[ai])
+				ai++
+				bi++
+				aCount++
+				bCount++
+			case '-':
+				body = append(body, "-"+a[ai])
+				ai++
+				aCount++
+			case '+':
+				body = append(body, "+"+b[bi])
+				bi++
+				bCount++
+			}
+		}
+		// An empty side names the line before the hunk
+		if aCount == 0 && aLine > 0 {
+			aLine--
+		}
+		if bCount == 0 && bLine > 0 {
+			bLine--
+		}
+		hunks = append(hunks, fmt.Sprintf("@@ -%d,%d +%d,%d @@", aLine, aCount, bLine, bCount))
+		hunks = append(hunks, body...)
+		start = to
+	}
+	return hunks
+}
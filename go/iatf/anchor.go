@@ -0,0 +1,101 @@
+package iatf
+
+import (
+	"regexp"
+)
+
+// Anchors mark regions of long sections: a {#section-id:name} line inside the
+// section starts one, and {@section-id:name} refers to it.
+var (
+	AnchorPattern          = regexp.MustCompile(`^\{#([a-zA-Z][a-zA-Z0-9_-]*):([a-zA-Z][a-zA-Z0-9_-]*)\}\s*$`)
+	AnchorReferencePattern = regexp.MustCompile(`\{@([a-zA-Z][a-zA-Z0-9_-]*):([a-zA-Z][a-zA-Z0-9_-]*)\}`)
+)
+
+// Anchor is a {#section-id:name} marker. Its region runs from the marker to
+// the line before the section's next anchor, or to the end of the section.
+type Anchor struct {
+	Section string
+	Name    string
+	Line    int  // 1-indexed line of the marker
+	End     int  // 1-indexed last line of the region
+	Inside  bool // The marker is inside the section it names
+}
+
+// AnchorReference is a {@section-id:name} reference
+type AnchorReference struct {
+	Section           string
+	Anchor            string
+	LineNum           int    // 1-indexed
+	ContainingSection string // Innermost section of the reference, "" outside all
+}
+
+// ParseAnchors returns the anchor markers of CONTENT in line order, skipping
+// code fences. End is only set for markers inside their section.
+func ParseAnchors(lines []string, contentStart int, sections []Section) []Anchor {
+	anchors := []Anchor{}
+	if contentStart < 0 {
+		return anchors
+	}
+
+	fence := CodeFence{}
+	for i := contentStart; i < len(lines); i++ {
+		if fence.Line(lines[i]) {
+			continue
+		}
+		match := AnchorPattern.FindStringSubmatch(lines[i])
+		if match == nil {
+			continue
+		}
+		anchor := Anchor{Section: match[1], Name: match[2], Line: i + 1}
+		for _, section := range sections {
+			if section.ID == anchor.Section && anchor.Line > section.Start && (section.End == 0 || anchor.Line < section.End) {
+				anchor.Inside = true
+				anchor.End = section.End - 1
+				if section.End == 0 {
+					anchor.End = len(lines)
+				}
+			}
+		}
+		anchors = append(anchors, anchor)
+	}
+
+	// A region stops where the next anchor of the same section starts
+	for i := range anchors {
+		for j := i + 1; j < len(anchors); j++ {
+			if anchors[i].Inside && anchors[j].Inside && anchors[j].Section == anchors[i].Section {
+				anchors[i].End = anchors[j].Line - 1
+				break
+			}
+		}
+	}
+	return anchors
+}
+
+// FindAnchor returns the anchor name of section id, resolving aliases of id
+func FindAnchor(lines []string, contentStart int, sections []Section, id string, name string) (Anchor, bool) {
+	section, _, found := ResolveSectionID(sections, id)
+	if !found {
+		return Anchor{}, false
+	}
+	for _, anchor := range ParseAnchors(lines, contentStart, sections) {
+		if anchor.Inside && anchor.Section == section.ID && anchor.Name == name {
+			return anchor, true
+		}
+	}
+	return Anchor{}, false
+}
+
+// ExtractAnchorReferences returns the {@section-id:name} references of
+// CONTENT in line order, skipping code fences and tag lines
+func ExtractAnchorReferences(lines []string, contentStart int) []AnchorReference {
+	refs := []AnchorReference{}
+	scanReferences(lines, contentStart, AnchorReferencePattern, func(match []string, loc ReferenceLocation) {
+		refs = append(refs, AnchorReference{
+			Section:           match[1],
+			Anchor:            match[2],
+			LineNum:           loc.LineNum,
+			ContainingSection: loc.ContainingSection,
+		})
+	})
+	return refs
+}
@@ -0,0 +1,73 @@
+package iatf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conflict is a block of merge conflict markers left in a file by git:
+// "<<<<<<<", the lines of one side, "=======", the lines of the other and
+// ">>>>>>>", with the common ancestor after "|||||||" in diff3 style
+type Conflict struct {
+	Start int // 1-indexed line of the first marker
+	End   int // 1-indexed line of ">>>>>>>", 0 when it is missing
+}
+
+// isConflictMarker reports whether line is a marker starting with seven
+// times char, alone or followed by a space and a label
+func isConflictMarker(line string, char byte) bool {
+	marker := strings.Repeat(string(char), 7)
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
+
+// FindConflicts returns the conflict blocks of a file, in line order. A
+// ">>>>>>>" without an opening marker is a conflict of its own; a lone
+// "=======" is not, as Markdown uses it to underline headings.
+func FindConflicts(lines []string) []Conflict {
+	conflicts := []Conflict{}
+	open := false
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case isConflictMarker(line, '<'):
+			if !open {
+				conflicts = append(conflicts, Conflict{Start: i + 1})
+				open = true
+			}
+		case isConflictMarker(line, '>'):
+			if open {
+				conflicts[len(conflicts)-1].End = i + 1
+				open = false
+			} else {
+				conflicts = append(conflicts, Conflict{Start: i + 1, End: i + 1})
+			}
+		}
+	}
+	return conflicts
+}
+
+// InIndex reports whether the conflict lies between the ===INDEX=== and
+// ===CONTENT=== markers, given their 0-indexed lines (-1 when missing).
+// The INDEX can be regenerated rather than merged by hand.
+func (c Conflict) InIndex(indexStart int, contentMarker int) bool {
+	return indexStart != -1 && c.End != 0 && c.Start > indexStart+1 && (contentMarker == -1 || c.End <= contentMarker)
+}
+
+// conflictIssues reports each conflict block, given the 0-indexed lines of
+// the INDEX and CONTENT markers
+func conflictIssues(lines []string, conflicts []Conflict, indexStart int, contentMarker int) []Issue {
+	issues := []Issue{}
+	for _, conflict := range conflicts {
+		var message string
+		switch {
+		case conflict.End == 0:
+			message = fmt.Sprintf("Merge conflict at line %d (no closing >>>>>>> marker)", conflict.Start)
+		case conflict.InIndex(indexStart, contentMarker):
+			message = fmt.Sprintf("Merge conflict in INDEX at lines %d-%d (run 'iatf resolve' to regenerate it)", conflict.Start, conflict.End)
+		default:
+			message = fmt.Sprintf("Merge conflict at lines %d-%d", conflict.Start, conflict.End)
+		}
+		issues = append(issues, lineIssue("E023", SeverityError, lines, conflict.Start, message))
+	}
+	return issues
+}
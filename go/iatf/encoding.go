@@ -0,0 +1,54 @@
+package iatf
+
+import (
+	"errors"
+	"strings"
+)
+
+// IATF files are UTF-8. Windows editors may start a UTF-8 file with a byte
+// order mark, which would otherwise hide the :::IATF declaration; it is
+// dropped when a file is read and written back when it is rewritten, so
+// the editor's choice survives a rebuild. UTF-16 files, which the same
+// editors save as "Unicode", cannot be read at all and are reported.
+
+// BOM is the UTF-8 byte order mark
+const BOM = "\uFEFF"
+
+// ErrUTF16 is the error for a file encoded as UTF-16
+var ErrUTF16 = errors.New("file is UTF-16 encoded; IATF files must be UTF-8 (save it as UTF-8 and try again)")
+
+// IsUTF16 reports whether content, or its first line, is UTF-16: it starts
+// with a UTF-16 byte order mark, or its first character has a zero byte
+// as UTF-16 ASCII does
+func IsUTF16(content string) bool {
+	if strings.HasPrefix(content, "\xff\xfe") || strings.HasPrefix(content, "\xfe\xff") {
+		return true
+	}
+	return len(content) >= 2 && (content[0] == 0) != (content[1] == 0)
+}
+
+// StripBOM returns content without its UTF-8 byte order mark and whether
+// it had one
+func StripBOM(content string) (string, bool) {
+	if strings.HasPrefix(content, BOM) {
+		return content[len(BOM):], true
+	}
+	return content, false
+}
+
+// Decode returns the text of a file's content without its byte order mark,
+// and whether it had one. UTF-16 content is ErrUTF16.
+func Decode(content []byte) (text string, bom bool, err error) {
+	if IsUTF16(string(content)) {
+		return "", false, ErrUTF16
+	}
+	text, bom = StripBOM(string(content))
+	return text, bom, nil
+}
+
+// IsDeclaration reports whether line, the first line of a document, is the
+// :::IATF declaration, with or without a byte order mark
+func IsDeclaration(line string) bool {
+	line, _ = StripBOM(line)
+	return strings.TrimSpace(line) == ":::IATF"
+}
@@ -0,0 +1,55 @@
+package iatf
+
+import (
+	"strings"
+)
+
+// CodeFence tracks fenced code blocks line by line, following CommonMark: a
+// fence is a run of at least three backticks or tildes, indented or not (as
+// in list items), optionally followed by an info string such as a language.
+// The block closes at a fence of the same character, at least as long and
+// without an info string.
+type CodeFence struct {
+	char   byte // '`' or '~' while a block is open, 0 otherwise
+	length int
+}
+
+// Open reports whether a fenced code block is open
+func (f *CodeFence) Open() bool {
+	return f.char != 0
+}
+
+// Line reads the next line and reports whether it belongs to a fenced code
+// block, the opening and closing fences included
+func (f *CodeFence) Line(line string) bool {
+	char, length, info := parseFence(line)
+	if f.char == 0 {
+		if char == 0 {
+			return false
+		}
+		f.char, f.length = char, length
+		return true
+	}
+	if char == f.char && length >= f.length && info == "" {
+		f.char, f.length = 0, 0
+	}
+	return true
+}
+
+// parseFence returns the fence character, run length and info string of a
+// fence line, or a zero char when line is not a fence
+func parseFence(line string) (char byte, length int, info string) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return 0, 0, ""
+	}
+	for length < len(trimmed) && trimmed[length] == trimmed[0] {
+		length++
+	}
+	info = strings.TrimSpace(trimmed[length:])
+	// ```go``` is inline code, not a fence
+	if length < 3 || (trimmed[0] == '`' && strings.Contains(info, "`")) {
+		return 0, 0, ""
+	}
+	return trimmed[0], length, info
+}
@@ -0,0 +1,111 @@
+package iatf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Values of the @hashes: header field
+const (
+	HashesShort = "short" // 7 hex characters, Git-style (default)
+	HashesFull  = "full"  // The whole sha256, for tamper-evident documents
+)
+
+// ShortHashLength is the length of the default section and Content-Hash hashes
+const ShortHashLength = 7
+
+var indexEntryIDPattern = regexp.MustCompile(`^#{1,6}\s+.*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|`)
+
+// Digest returns the full sha256 hex digest of lines joined with newlines,
+// as used for section hashes and the Content-Hash
+func Digest(lines []string) string {
+	// Hashed line by line rather than joined, so hashing all of CONTENT
+	// does not copy it
+	hash := sha256.New()
+	for i, line := range lines {
+		if i > 0 {
+			io.WriteString(hash, "\n")
+		}
+		io.WriteString(hash, line)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// FullHashes reports whether the header asks for full-length hashes
+func (h Header) FullHashes() bool {
+	return strings.EqualFold(strings.TrimSpace(h.Hashes), HashesFull)
+}
+
+// Hash shortens digest to the length the header asks for
+func (h Header) Hash(digest string) string {
+	if h.FullHashes() {
+		return digest
+	}
+	return digest[:ShortHashLength]
+}
+
+// HashMatches reports whether a stored hash, short or full, is digest or
+// its Git-style prefix
+func HashMatches(stored string, digest string) bool {
+	if len(stored) != ShortHashLength && len(stored) != len(digest) {
+		return false
+	}
+	return strings.HasPrefix(digest, stored)
+}
+
+// IndexHash is the Hash: line of an INDEX entry
+type IndexHash struct {
+	Value string
+	Line  int // 1-indexed
+}
+
+// IndexHashes returns the Hash: values of the INDEX entries by section ID
+func IndexHashes(lines []string) map[string]IndexHash {
+	hashes := map[string]IndexHash{}
+	contentStart := ContentStart(lines)
+	if contentStart < 0 {
+		return hashes
+	}
+	inIndex := false
+	currentID := ""
+	for i, line := range lines[:contentStart-1] {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "===INDEX===":
+			inIndex = true
+		case !inIndex:
+		case trimmed == "":
+			currentID = ""
+		case indexEntryIDPattern.MatchString(trimmed):
+			currentID = indexEntryIDPattern.FindStringSubmatch(trimmed)[1]
+		case currentID != "" && strings.HasPrefix(trimmed, "Hash:"):
+			hashes[currentID] = IndexHash{Value: strings.TrimSpace(strings.TrimPrefix(trimmed, "Hash:")), Line: i + 1}
+		}
+	}
+	return hashes
+}
+
+// ContentHash returns the sha256 value of the INDEX's Content-Hash comment,
+// or "" when the INDEX has none or it names another algorithm
+func ContentHash(lines []string) string {
+	inIndex := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "===CONTENT===":
+			return ""
+		case trimmed == "===INDEX===":
+			inIndex = true
+		case inIndex && strings.HasPrefix(trimmed, "<!-- Content-Hash:"):
+			matches := contentHashPattern.FindStringSubmatch(trimmed)
+			if matches == nil || matches[1] != "sha256" {
+				return ""
+			}
+			return matches[2]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package iatf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultSummaryWidth is the column INDEX summaries wrap at when the header
+// has no valid @summary-width:
+const DefaultSummaryWidth = 100
+
+// Header is the document metadata between :::IATF and the INDEX or CONTENT
+type Header struct {
+	Title        string
+	Purpose      string
+	Description  string
+	Version      string
+	Updated      string // DateFormat date
+	SummaryWidth string // @summary-width:, see WrapWidth
+	Hashes       string // @hashes:, HashesShort or HashesFull
+	WordCount    string // @word-count:, WordCountUnicode or WordCountSpaces
+	TitleRefs    string // @title-refs:, TitleRefsRewrite or TitleRefsKeep
+}
+
+// HeaderFields lists the reserved header fields, without the @
+var HeaderFields = []string{"title", "purpose", "description", "version", "updated", "summary-width", "hashes", "word-count", "title-refs"}
+
+// HeaderField is a "@key: value" line of the header
+type HeaderField struct {
+	Key   string
+	Value string
+	Line  int // 1-indexed
+}
+
+// HeaderEnd returns the index of the first ===INDEX=== or ===CONTENT===
+// marker, or len(lines) when there is none
+func HeaderEnd(lines []string) int {
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed == "===INDEX===" || trimmed == "===CONTENT===" {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// ParseHeaderFields returns the @key: lines of the header in order, reserved
+// or not. Documents without a :::IATF declaration have no header.
+func ParseHeaderFields(lines []string) []HeaderField {
+	fields := []HeaderField{}
+	if len(lines) == 0 || !IsDeclaration(lines[0]) {
+		return fields
+	}
+	for i := 1; i < HeaderEnd(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		colon := strings.Index(line, ":")
+		if !strings.HasPrefix(line, "@") || colon < 2 {
+			continue
+		}
+		fields = append(fields, HeaderField{
+			Key:   line[1:colon],
+			Value: strings.TrimSpace(line[colon+1:]),
+			Line:  i + 1,
+		})
+	}
+	return fields
+}
+
+// ParseHeader returns the reserved header fields of a document; when a field
+// is repeated the first value wins
+func ParseHeader(lines []string) Header {
+	header := Header{}
+	values := map[string]*string{
+		"title":         &header.Title,
+		"purpose":       &header.Purpose,
+		"description":   &header.Description,
+		"version":       &header.Version,
+		"updated":       &header.Updated,
+		"summary-width": &header.SummaryWidth,
+		"hashes":        &header.Hashes,
+		"word-count":    &header.WordCount,
+		"title-refs":    &header.TitleRefs,
+	}
+	for _, field := range ParseHeaderFields(lines) {
+		if value, reserved := values[field.Key]; reserved && *value == "" {
+			*value = field.Value
+		}
+	}
+	return header
+}
+
+// ParseSummaryWidth parses an @summary-width: value: a number of columns, or
+// 0 to keep each summary on one line
+func ParseSummaryWidth(value string) (int, bool) {
+	width, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || width < 0 {
+		return 0, false
+	}
+	return width, true
+}
+
+// WrapWidth returns the column INDEX summary lines wrap at, 0 for none
+func (h Header) WrapWidth() int {
+	if width, ok := ParseSummaryWidth(h.SummaryWidth); ok {
+		return width
+	}
+	return DefaultSummaryWidth
+}
@@ -0,0 +1,536 @@
+// Package iatf parses and validates IATF documents. It is shared by the iatf
+// CLI and the language server so both report the same sections, references
+// and validation issues.
+package iatf
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pre-compiled regex patterns for section parsing. Tags are only recognized
+// at the start of a line; references anywhere in it unless escaped with a
+// backslash (\{@id}) or inside an inline code span. A line starting with
+// \{#id} is not a tag either.
+var (
+	SectionOpenPattern  = regexp.MustCompile(`^\{#([a-zA-Z][a-zA-Z0-9_-]*)\}`)
+	SectionClosePattern = regexp.MustCompile(`^\{/([a-zA-Z][a-zA-Z0-9_-]*)\}`)
+	ReferencePattern    = regexp.MustCompile(`\{@([a-zA-Z][a-zA-Z0-9_-]*)\}`)
+	idPattern           = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+)
+
+// Section is a {#id}...{/id} block of CONTENT
+type Section struct {
+	ID           string
+	Title        string
+	Start        int // 1-indexed line of the open tag
+	End          int // 1-indexed line of the close tag, 0 if unclosed
+	Level        int
+	Summary      string
+	Tags         []string // From @tags:, in order of appearance
+	Status       string   // From @status:, lowercased; "" when not set
+	Owner        string   // From @owner:, the person or team maintaining it
+	ReviewBy     string   // From @review-by:, a DateFormat date
+	Aliases      []string // From @aliases:, former IDs that still resolve to it
+	Anchors      []string // Names of its {#id:name} anchors, in order
+	Audiences    []string // From @audience:, empty when the section is for everyone
+	Visibility   string   // From @visibility:, lowercased; "" when public
+	Created      string
+	Modified     string
+	XHash        string
+	WordCount    int
+	ContentLines []string // Actual content (excluding metadata)
+}
+
+// ContentStart returns the index of the first line after ===CONTENT===, or -1
+func ContentStart(lines []string) int {
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "===CONTENT===" {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// NestingError is a tag that breaks section nesting
+type NestingError struct {
+	Line    int // 1-indexed
+	Message string
+}
+
+func (e *NestingError) Error() string {
+	return e.Message
+}
+
+// ValidateNesting checks that the sections of CONTENT are closed in order.
+// The returned error is a *NestingError.
+func ValidateNesting(lines []string, contentStart int) error {
+	checker := NestingChecker{}
+	for i, line := range lines[contentStart:] {
+		if err := checker.Line(contentStart+i+1, line); err != nil {
+			return err
+		}
+	}
+	return checker.Err()
+}
+
+// IsEscaped reports whether the character at index of line is escaped by
+// an odd number of backslashes, as the { of \{@id} is
+func IsEscaped(line string, index int) bool {
+	backslashes := 0
+	for i := index - 1; i >= 0 && line[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
+
+// CodeSpans returns the [start, end) byte ranges of the inline code spans
+// of line: a run of backticks up to the next run of the same length. A run
+// without a closing one is literal text.
+func CodeSpans(line string) [][2]int {
+	spans := [][2]int{}
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] == '`' {
+			i++
+		}
+		run := i - start
+		for j := i; j < len(line); {
+			if line[j] != '`' {
+				j++
+				continue
+			}
+			closeStart := j
+			for j < len(line) && line[j] == '`' {
+				j++
+			}
+			if j-closeStart == run {
+				spans = append(spans, [2]int{start, j})
+				i = j
+				break
+			}
+		}
+	}
+	return spans
+}
+
+// InCodeSpan reports whether the byte at index of line is inside an inline
+// code span
+func InCodeSpan(line string, index int) bool {
+	return inSpans(CodeSpans(line), index)
+}
+
+// FindReferenceMatches returns the submatch indexes of pattern in line like
+// FindAllStringSubmatchIndex, leaving out matches escaped with a backslash
+// or inside inline code spans
+func FindReferenceMatches(pattern *regexp.Regexp, line string) [][]int {
+	matches := [][]int{}
+	spans := CodeSpans(line)
+	for _, match := range pattern.FindAllStringSubmatchIndex(line, -1) {
+		if IsEscaped(line, match[0]) || inSpans(spans, match[0]) {
+			continue
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+func inSpans(spans [][2]int, index int) bool {
+	for _, span := range spans {
+		if index >= span[0] && index < span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// ReferenceLocation stores information about where a reference was found
+type ReferenceLocation struct {
+	LineNum           int
+	ContainingSection string
+}
+
+// ExtractReferences extracts all {@section-id} references from content, ignoring code blocks and spans.
+// Returns a map of section_id -> list of ReferenceLocation where it's referenced.
+func ExtractReferences(lines []string, contentStart int) map[string][]ReferenceLocation {
+	references := make(map[string][]ReferenceLocation)
+	scanReferences(lines, contentStart, ReferencePattern, func(match []string, loc ReferenceLocation) {
+		references[match[1]] = append(references[match[1]], loc)
+	})
+	return references
+}
+
+// scanReferences calls found, in line order, for each match of pattern in
+// CONTENT outside code (fenced blocks and inline spans), tag lines and escapes
+func scanReferences(lines []string, contentStart int, pattern *regexp.Regexp, found func(match []string, loc ReferenceLocation)) {
+	openSections := []string{}
+	fence := CodeFence{}
+
+	for i := contentStart; i < len(lines); i++ {
+		line := lines[i]
+		lineNum := i + 1
+
+		if fence.Line(line) {
+			continue
+		}
+
+		if match := SectionOpenPattern.FindStringSubmatch(line); match != nil {
+			openSections = append(openSections, match[1])
+			continue
+		}
+		if match := SectionClosePattern.FindStringSubmatch(line); match != nil {
+			if len(openSections) > 0 && openSections[len(openSections)-1] == match[1] {
+				openSections = openSections[:len(openSections)-1]
+			} else {
+				openSections = []string{}
+			}
+			continue
+		}
+
+		for _, loc := range FindReferenceMatches(pattern, line) {
+			match := make([]string, len(loc)/2)
+			for j := range match {
+				if loc[2*j] >= 0 {
+					match[j] = line[loc[2*j]:loc[2*j+1]]
+				}
+			}
+			containingSection := ""
+			if len(openSections) > 0 {
+				containingSection = openSections[len(openSections)-1]
+			}
+			found(match, ReferenceLocation{
+				LineNum:           lineNum,
+				ContainingSection: containingSection,
+			})
+		}
+	}
+}
+
+// ValidateReferences validates that all references point to existing sections and no self-references exist.
+// Returns a list of error messages (empty if valid).
+func ValidateReferences(lines []string, contentStart int, sections []Section) []string {
+	errors := []string{}
+	for _, issue := range referenceIssues(lines, contentStart, sections) {
+		errors = append(errors, issue.Message)
+	}
+	return errors
+}
+
+// referenceIssues reports dangling references and self-references in line order
+func referenceIssues(lines []string, contentStart int, sections []Section) []Issue {
+	issues := []Issue{}
+
+	// Build set of valid section IDs; references to aliases are reported by aliasIssues
+	validIDs := make(map[string]bool)
+	for _, section := range sections {
+		validIDs[section.ID] = true
+	}
+	aliases := AliasTargets(sections)
+
+	// Extract references
+	references := ExtractReferences(lines, contentStart)
+
+	type referenceInstance struct {
+		Target            string
+		LineNum           int
+		ContainingSection string
+	}
+
+	orderedRefs := []referenceInstance{}
+	for target, locations := range references {
+		for _, loc := range locations {
+			orderedRefs = append(orderedRefs, referenceInstance{
+				Target:            target,
+				LineNum:           loc.LineNum,
+				ContainingSection: loc.ContainingSection,
+			})
+		}
+	}
+
+	sort.Slice(orderedRefs, func(i, j int) bool {
+		if orderedRefs[i].LineNum != orderedRefs[j].LineNum {
+			return orderedRefs[i].LineNum < orderedRefs[j].LineNum
+		}
+		if orderedRefs[i].Target != orderedRefs[j].Target {
+			return orderedRefs[i].Target < orderedRefs[j].Target
+		}
+		return orderedRefs[i].ContainingSection < orderedRefs[j].ContainingSection
+	})
+
+	// Validate each reference in deterministic order
+	for _, ref := range orderedRefs {
+		target := ref.Target
+		if canonical, isAlias := aliases[target]; isAlias {
+			target = canonical
+		}
+		if !validIDs[target] {
+			issues = append(issues, referenceIssue("E016", ref.Target, lines[ref.LineNum-1], ref.LineNum,
+				fmt.Sprintf("Reference {@%s} at line %d: target section does not exist", ref.Target, ref.LineNum)))
+		} else if target == ref.ContainingSection {
+			issues = append(issues, referenceIssue("E017", ref.Target, lines[ref.LineNum-1], ref.LineNum,
+				fmt.Sprintf("Reference {@%s} at line %d: self-reference not allowed", ref.Target, ref.LineNum)))
+		}
+	}
+
+	issues = append(issues, titleReferenceIssues(lines, contentStart, sections)...)
+
+	// Anchor references may point into their own section
+	for _, ref := range ExtractAnchorReferences(lines, contentStart) {
+		if _, found := FindAnchor(lines, contentStart, sections, ref.Section, ref.Anchor); !found {
+			issues = append(issues, referenceIssue("E020", ref.Section+":"+ref.Anchor, lines[ref.LineNum-1], ref.LineNum,
+				fmt.Sprintf("Reference {@%s:%s} at line %d: target anchor does not exist", ref.Section, ref.Anchor, ref.LineNum)))
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+
+	return issues
+}
+
+// AliasTargets maps each alias to the ID of its section. Aliases that are
+// section IDs themselves, claimed by several sections or not valid IDs are
+// left out (see aliasIssues).
+func AliasTargets(sections []Section) map[string]string {
+	ids := map[string]bool{}
+	for _, section := range sections {
+		ids[section.ID] = true
+	}
+	targets := map[string]string{}
+	claimed := map[string]int{}
+	for _, section := range sections {
+		for _, alias := range section.Aliases {
+			claimed[alias]++
+			if !ids[alias] && IsValidID(alias) {
+				targets[alias] = section.ID
+			}
+		}
+	}
+	for alias, count := range claimed {
+		if count > 1 {
+			delete(targets, alias)
+		}
+	}
+	return targets
+}
+
+// ResolveSectionID returns the section with id, or the section id is an alias
+// of; alias reports whether it was found through an alias
+func ResolveSectionID(sections []Section, id string) (section Section, alias bool, found bool) {
+	for _, section := range sections {
+		if section.ID == id {
+			return section, false, true
+		}
+	}
+	if canonical, isAlias := AliasTargets(sections)[id]; isAlias {
+		for _, section := range sections {
+			if section.ID == canonical {
+				return section, true, true
+			}
+		}
+	}
+	return Section{}, false, false
+}
+
+// IsValidID reports whether id can be used as a section ID
+func IsValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// FindDuplicateSectionIDs returns each section ID that is used more than once
+func FindDuplicateSectionIDs(sections []Section) []string {
+	seen := make(map[string]int)
+	duplicates := []string{}
+	for _, section := range sections {
+		seen[section.ID]++
+		if seen[section.ID] == 2 {
+			duplicates = append(duplicates, section.ID)
+		}
+	}
+	return duplicates
+}
+
+// Section statuses allowed in @status:
+const (
+	StatusDraft      = "draft"
+	StatusStable     = "stable"
+	StatusDeprecated = "deprecated"
+)
+
+// Section visibilities allowed in @visibility:
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// Visibilities lists the allowed @visibility: values
+var Visibilities = []string{VisibilityPublic, VisibilityPrivate}
+
+// DateFormat is the layout of @created:, @review-by: and the INDEX dates
+const DateFormat = "2006-01-02"
+
+// Statuses lists the allowed @status: values
+var Statuses = []string{StatusDraft, StatusStable, StatusDeprecated}
+
+// ParseTags splits a comma-separated @tags: value, dropping empty and
+// repeated (case-insensitively) tags
+func ParseTags(value string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// HasTag reports whether the section has any of tags, ignoring case
+func (s Section) HasTag(tags ...string) bool {
+	for _, own := range s.Tags {
+		for _, tag := range tags {
+			if strings.EqualFold(own, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ForAudience reports whether the section is meant for audience: it has no
+// @audience:, or lists audience (ignoring case)
+func (s Section) ForAudience(audience string) bool {
+	if len(s.Audiences) == 0 {
+		return true
+	}
+	for _, own := range s.Audiences {
+		if strings.EqualFold(own, audience) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivate reports whether the section is marked @visibility: private
+func (s Section) IsPrivate() bool {
+	return s.Visibility == VisibilityPrivate
+}
+
+// HasOwner reports whether the section is owned by any of owners, ignoring
+// case
+func (s Section) HasOwner(owners ...string) bool {
+	for _, owner := range owners {
+		if s.Owner != "" && strings.EqualFold(s.Owner, strings.TrimSpace(owner)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSections parses the sections of CONTENT with their titles, summaries
+// and content lines
+func ParseSections(lines []string, contentStart int) []Section {
+	sections := []Section{}
+	stack := []int{}
+	inHeader := []bool{}
+	summaryContinuation := []bool{}
+	fence := CodeFence{}
+
+	for i := contentStart; i < len(lines); i++ {
+		line := lines[i]
+
+		if match := SectionOpenPattern.FindStringSubmatch(line); match != nil {
+			section := Section{
+				ID:    match[1],
+				Title: match[1],
+				Start: i + 1, // 1-indexed
+				Level: len(stack) + 1,
+			}
+			sections = append(sections, section)
+			stack = append(stack, len(sections)-1)
+			inHeader = append(inHeader, true)
+			summaryContinuation = append(summaryContinuation, false)
+			continue
+		}
+
+		if len(stack) > 0 && inHeader[len(inHeader)-1] {
+			if strings.HasPrefix(line, "@") {
+				if strings.HasPrefix(line, "@summary:") {
+					sections[stack[len(stack)-1]].Summary = strings.TrimSpace(line[9:])
+					summaryContinuation[len(summaryContinuation)-1] = true
+				} else if strings.HasPrefix(line, "@tags:") {
+					sections[stack[len(stack)-1]].Tags = ParseTags(line[6:])
+					summaryContinuation[len(summaryContinuation)-1] = false
+				} else if strings.HasPrefix(line, "@status:") {
+					sections[stack[len(stack)-1]].Status = strings.ToLower(strings.TrimSpace(line[8:]))
+					summaryContinuation[len(summaryContinuation)-1] = false
+				} else if strings.HasPrefix(line, "@owner:") {
+					sections[stack[len(stack)-1]].Owner = strings.TrimSpace(line[7:])
+					summaryContinuation[len(summaryContinuation)-1] = false
+				} else if strings.HasPrefix(line, "@review-by:") {
+					sections[stack[len(stack)-1]].ReviewBy = strings.TrimSpace(line[11:])
+					summaryContinuation[len(summaryContinuation)-1] = false
+				} else if strings.HasPrefix(line, "@audience:") {
+					sections[stack[len(stack)-1]].Audiences = ParseTags(line[10:])
+					summaryContinuation[len(summaryContinuation)-1] = false
+				} else if strings.HasPrefix(line, "@visibility:") {
+					sections[stack[len(stack)-1]].Visibility = strings.ToLower(strings.TrimSpace(line[12:]))
+					summaryContinuation[len(summaryContinuation)-1] = false
+				} else if strings.HasPrefix(line, "@aliases:") {
+					sections[stack[len(stack)-1]].Aliases = ParseTags(line[9:])
+					summaryContinuation[len(summaryContinuation)-1] = false
+				} else if strings.HasPrefix(line, "@created:") {
+					// @created is stored in INDEX, not CONTENT
+					summaryContinuation[len(summaryContinuation)-1] = false
+				}
+				continue
+			}
+			// Indented lines continue @summary: up to the first blank line
+			if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && strings.TrimSpace(line) != "" && summaryContinuation[len(summaryContinuation)-1] {
+				sections[stack[len(stack)-1]].Summary = fmt.Sprintf(
+					"%s %s",
+					sections[stack[len(stack)-1]].Summary,
+					strings.TrimSpace(line),
+				)
+				continue
+			}
+			inHeader[len(inHeader)-1] = false
+			summaryContinuation[len(summaryContinuation)-1] = false
+		}
+
+		if match := SectionClosePattern.FindStringSubmatch(line); match != nil {
+			if len(stack) > 0 && sections[stack[len(stack)-1]].ID == match[1] {
+				idx := stack[len(stack)-1]
+				sections[idx].End = i + 1 // 1-indexed
+				stack = stack[:len(stack)-1]
+				inHeader = inHeader[:len(inHeader)-1]
+				summaryContinuation = summaryContinuation[:len(summaryContinuation)-1]
+			}
+			continue
+		}
+
+		if match := AnchorPattern.FindStringSubmatch(line); !fence.Line(line) && match != nil {
+			for _, idx := range stack {
+				if sections[idx].ID == match[1] && !contains(sections[idx].Anchors, match[2]) {
+					sections[idx].Anchors = append(sections[idx].Anchors, match[2])
+				}
+			}
+		}
+
+		if len(stack) > 0 && !inHeader[len(inHeader)-1] {
+			if strings.HasPrefix(line, "#") && !strings.HasPrefix(sections[stack[len(stack)-1]].Title, "#") {
+				sections[stack[len(stack)-1]].Title = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			}
+			sections[stack[len(stack)-1]].ContentLines = append(sections[stack[len(stack)-1]].ContentLines, line)
+		}
+	}
+
+	return sections
+}
@@ -0,0 +1,104 @@
+package iatf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Large knowledge bases are read line by line rather than slurped and
+// split, which holds the file's bytes and a string copy of them at once.
+// ScanLines hands lines over one at a time, so callers keep only what they
+// need; ReadLines keeps all of them, each once.
+
+// scanChunkSize is how much ScanLines reads at a time. Lines are cut out
+// of the chunk rather than copied, so a line kept by the caller keeps its
+// chunk in memory; longer lines still work.
+const scanChunkSize = 64 * 1024
+
+// ScanLines calls fn with each line of r, 0-indexed and without its "\n".
+// Lines are split as strings.Split(content, "\n") splits them: a trailing
+// newline yields a final empty line. A byte order mark starting r is
+// dropped. It stops at the first error of fn.
+func ScanLines(r io.Reader, fn func(i int, line string) error) error {
+	buf := make([]byte, scanChunkSize)
+	pending := "" // Start of a line continued in the next chunk
+	i := 0
+	first := true
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := pending + string(buf[:n])
+			if first {
+				chunk, _ = StripBOM(chunk)
+				first = false
+			}
+			for {
+				end := strings.IndexByte(chunk, '\n')
+				if end < 0 {
+					break
+				}
+				if err := fn(i, chunk[:end]); err != nil {
+					return err
+				}
+				i++
+				chunk = chunk[end+1:]
+			}
+			pending = chunk
+		}
+		if err == io.EOF {
+			return fn(i, pending)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReadLines returns the lines of r as ScanLines splits them
+func ReadLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	err := ScanLines(r, func(i int, line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	return lines, err
+}
+
+// NestingChecker is ValidateNesting fed one line of CONTENT at a time
+type NestingChecker struct {
+	open      []string // IDs of the open sections, innermost last
+	openLines []int
+	err       error
+}
+
+// Line checks line, the 1-indexed line n of the file, and reports the
+// first nesting error found so far
+func (c *NestingChecker) Line(n int, line string) error {
+	if c.err != nil {
+		return c.err
+	}
+	if match := SectionOpenPattern.FindStringSubmatch(line); match != nil {
+		c.open = append(c.open, match[1])
+		c.openLines = append(c.openLines, n)
+	} else if match := SectionClosePattern.FindStringSubmatch(line); match != nil {
+		id := match[1]
+		if len(c.open) > 0 && c.open[len(c.open)-1] == id {
+			c.open = c.open[:len(c.open)-1]
+			c.openLines = c.openLines[:len(c.openLines)-1]
+		} else {
+			c.err = &NestingError{Line: n, Message: fmt.Sprintf("closing tag without matching opening: %s", id)}
+		}
+	}
+	return c.err
+}
+
+// Err returns the first nesting error, or the innermost unclosed section
+// once every line was checked
+func (c *NestingChecker) Err() error {
+	if c.err == nil && len(c.open) > 0 {
+		last := len(c.open) - 1
+		return &NestingError{Line: c.openLines[last], Message: fmt.Sprintf("unclosed section: %s", c.open[last])}
+	}
+	return c.err
+}
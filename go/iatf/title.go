@@ -0,0 +1,107 @@
+package iatf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TitleReferencePattern matches {@"Exact Title"}, a reference to the section
+// with that heading. iatf rebuild rewrites it to {@id} unless the header has
+// @title-refs: keep.
+var TitleReferencePattern = regexp.MustCompile(`\{@"([^"{}]+)"\}`)
+
+// Values of the @title-refs: header field
+const (
+	TitleRefsRewrite = "rewrite" // Rebuild replaces {@"Title"} with {@id} (default)
+	TitleRefsKeep    = "keep"    // Rebuild leaves {@"Title"} as written
+)
+
+// KeepTitleReferences reports whether the header asks rebuild to leave
+// {@"Title"} references as written
+func (h Header) KeepTitleReferences() bool {
+	return strings.EqualFold(strings.TrimSpace(h.TitleRefs), TitleRefsKeep)
+}
+
+// TitleReference is a {@"Title"} reference
+type TitleReference struct {
+	Title             string
+	LineNum           int    // 1-indexed
+	ContainingSection string // Innermost section of the reference, "" outside all
+}
+
+// ExtractTitleReferences returns the {@"Title"} references of CONTENT in
+// line order, skipping code fences and tag lines
+func ExtractTitleReferences(lines []string, contentStart int) []TitleReference {
+	refs := []TitleReference{}
+	scanReferences(lines, contentStart, TitleReferencePattern, func(match []string, loc ReferenceLocation) {
+		refs = append(refs, TitleReference{
+			Title:             match[1],
+			LineNum:           loc.LineNum,
+			ContainingSection: loc.ContainingSection,
+		})
+	})
+	return refs
+}
+
+// ResolveTitle returns the IDs of the sections whose title is exactly title
+func ResolveTitle(sections []Section, title string) []string {
+	ids := []string{}
+	for _, section := range sections {
+		if section.Title == title {
+			ids = append(ids, section.ID)
+		}
+	}
+	return ids
+}
+
+// titleReferenceIssues reports {@"Title"} references that match no section
+// title or several, and those that point to their own section
+func titleReferenceIssues(lines []string, contentStart int, sections []Section) []Issue {
+	issues := []Issue{}
+	for _, ref := range ExtractTitleReferences(lines, contentStart) {
+		target := `"` + ref.Title + `"`
+		ids := ResolveTitle(sections, ref.Title)
+		switch {
+		case len(ids) == 0:
+			issues = append(issues, referenceIssue("E022", target, lines[ref.LineNum-1], ref.LineNum,
+				fmt.Sprintf("Reference {@%s} at line %d: no section has this title", target, ref.LineNum)))
+		case len(ids) > 1:
+			issues = append(issues, referenceIssue("E022", target, lines[ref.LineNum-1], ref.LineNum,
+				fmt.Sprintf("Reference {@%s} at line %d: title is ambiguous (sections %s)", target, ref.LineNum, strings.Join(ids, ", "))))
+		case ids[0] == ref.ContainingSection:
+			issues = append(issues, referenceIssue("E017", target, lines[ref.LineNum-1], ref.LineNum,
+				fmt.Sprintf("Reference {@%s} at line %d: self-reference not allowed", target, ref.LineNum)))
+		}
+	}
+	return issues
+}
+
+// RewriteTitleReferences replaces each {@"Title"} reference of CONTENT that
+// matches exactly one section title with {@id}, leaving code, escapes and
+// unresolved titles alone. It returns the new lines and the number of
+// references rewritten; lines keep their count, so section positions hold.
+func RewriteTitleReferences(lines []string, contentStart int, sections []Section) ([]string, int) {
+	rewritten := append([]string{}, lines...)
+	count := 0
+	fence := CodeFence{}
+	for i := contentStart; i < len(rewritten); i++ {
+		line := rewritten[i]
+		if fence.Line(line) || SectionOpenPattern.MatchString(line) || SectionClosePattern.MatchString(line) {
+			continue
+		}
+		matches := FindReferenceMatches(TitleReferencePattern, line)
+		// Replace from the end so earlier offsets stay valid
+		for j := len(matches) - 1; j >= 0; j-- {
+			match := matches[j]
+			ids := ResolveTitle(sections, line[match[2]:match[3]])
+			if len(ids) != 1 {
+				continue
+			}
+			line = line[:match[0]] + "{@" + ids[0] + "}" + line[match[1]:]
+			count++
+		}
+		rewritten[i] = line
+	}
+	return rewritten, count
+}
@@ -0,0 +1,637 @@
+package iatf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	contentHashPattern = regexp.MustCompile(`^<!-- Content-Hash:\s*([a-z0-9]+):([a-f0-9]+)\s*-->$`)
+	indexRangePattern  = regexp.MustCompile(`^#{1,6}\s+.*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|\s*lines:(\d+)-(\d+)[^}]*\}$`)
+)
+
+// Severity of a validation issue
+type Severity int
+
+const (
+	SeverityError Severity = iota + 1
+	SeverityWarning
+)
+
+// Issue is a validation error or warning
+type Issue struct {
+	Code     string // As listed by 'iatf explain --list'
+	Severity Severity
+	Message  string
+	Line     int // 1-indexed, 0 when the issue is about the whole file
+	StartCol int // Byte columns of the offending text on Line
+	EndCol   int
+}
+
+// Report is the result of validating a document
+type Report struct {
+	Errors   []Issue
+	Warnings []Issue
+
+	HasFormat       bool // :::IATF declaration on the first line
+	HasIndex        bool
+	HasContent      bool
+	Closed          bool // Every section tag is matched
+	SectionCount    int  // Distinct section IDs
+	ReferencesValid bool // References were checked and all resolve
+}
+
+// Issues returns the errors followed by the warnings
+func (r Report) Issues() []Issue {
+	return append(append([]Issue{}, r.Errors...), r.Warnings...)
+}
+
+// Options configures validation
+type Options struct {
+	MaxNestingDepth int
+}
+
+// DefaultOptions returns the rules of 'iatf validate'
+func DefaultOptions() Options {
+	return Options{MaxNestingDepth: 2}
+}
+
+// Validate checks the structure, INDEX, sections and references of a document
+func Validate(lines []string, options Options) Report {
+	report := Report{}
+	addError := func(code string, line int, message string) {
+		report.Errors = append(report.Errors, lineIssue(code, SeverityError, lines, line, message))
+	}
+	addWarning := func(code string, line int, message string) {
+		report.Warnings = append(report.Warnings, lineIssue(code, SeverityWarning, lines, line, message))
+	}
+
+	if IsUTF16(lines[0]) {
+		// Nothing else can be read
+		addError("E024", 0, "Unsupported encoding: "+ErrUTF16.Error())
+		return report
+	}
+	if !IsDeclaration(lines[0]) {
+		addError("E001", 1, "Missing format declaration (:::IATF)")
+	} else {
+		report.HasFormat = true
+	}
+	if report.HasFormat {
+		report.Warnings = append(report.Warnings, headerIssues(lines)...)
+	}
+	indexPositions := []int{}
+	contentPositions := []int{}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "===INDEX===" {
+			indexPositions = append(indexPositions, i)
+		} else if strings.TrimSpace(line) == "===CONTENT===" {
+			contentPositions = append(contentPositions, i)
+		}
+	}
+	report.HasIndex = len(indexPositions) > 0
+	report.HasContent = len(contentPositions) > 0
+
+	if !report.HasIndex {
+		addWarning("W001", 0, "No INDEX section (Run 'iatf rebuild' to create)")
+	}
+	if !report.HasContent {
+		addError("E002", 0, "Missing CONTENT section")
+	}
+
+	if len(indexPositions) > 1 {
+		addError("E003", indexPositions[1]+1, "Multiple INDEX sections found")
+	}
+	if len(contentPositions) > 1 {
+		addError("E004", contentPositions[1]+1, "Multiple CONTENT sections found")
+	}
+	if report.HasIndex && report.HasContent && indexPositions[0] > contentPositions[0] {
+		addError("E005", indexPositions[0]+1, "INDEX section appears after CONTENT")
+	}
+
+	// A conflicted INDEX is reported once rather than entry by entry
+	indexConflicted := false
+	if conflicts := FindConflicts(lines); len(conflicts) > 0 {
+		indexMarker, contentMarker := -1, -1
+		if report.HasIndex {
+			indexMarker = indexPositions[0]
+		}
+		if report.HasContent {
+			contentMarker = contentPositions[0]
+		}
+		for _, conflict := range conflicts {
+			indexConflicted = indexConflicted || conflict.InIndex(indexMarker, contentMarker)
+		}
+		report.Errors = append(report.Errors, conflictIssues(lines, conflicts, indexMarker, contentMarker)...)
+	}
+
+	indexStart := -1
+	contentStart := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "===INDEX===" {
+			indexStart = i
+		} else if strings.TrimSpace(line) == "===CONTENT===" {
+			contentStart = i + 1
+			break
+		}
+	}
+
+	if contentStart != -1 {
+		var nestingErr *NestingError
+		if err := ValidateNesting(lines, contentStart); errors.As(err, &nestingErr) {
+			code := "E006"
+			if strings.HasPrefix(nestingErr.Message, "unclosed") {
+				code = "E007"
+			}
+			addError(code, nestingErr.Line, fmt.Sprintf("Invalid section nesting: %v", nestingErr))
+		}
+	}
+
+	if report.HasIndex && !indexConflicted {
+		validateContentHash(lines, indexStart, contentStart, addWarning)
+	}
+
+	openSections := []string{}
+	openLines := []int{}
+	invalidNesting := false
+	for i, line := range lines {
+		if match := SectionOpenPattern.FindStringSubmatch(line); match != nil {
+			openSections = append(openSections, match[1])
+			openLines = append(openLines, i+1)
+		} else if match := SectionClosePattern.FindStringSubmatch(line); match != nil {
+			id := match[1]
+			if len(openSections) > 0 && openSections[len(openSections)-1] == id {
+				openSections = openSections[:len(openSections)-1]
+				openLines = openLines[:len(openLines)-1]
+			} else {
+				addError("E006", i+1, fmt.Sprintf("Closing tag without matching opening: %s", id))
+				invalidNesting = true
+			}
+		}
+	}
+	if len(openSections) > 0 {
+		for i, id := range openSections {
+			addError("E007", openLines[i], fmt.Sprintf("Unclosed section: %s", id))
+		}
+		invalidNesting = true
+	}
+	report.Closed = !invalidNesting
+
+	if !invalidNesting && contentStart != -1 {
+		contentOpen := []string{}
+		for i := contentStart; i < len(lines); i++ {
+			line := lines[i]
+			if match := SectionOpenPattern.FindStringSubmatch(line); match != nil {
+				contentOpen = append(contentOpen, match[1])
+				continue
+			}
+			if match := SectionClosePattern.FindStringSubmatch(line); match != nil {
+				if len(contentOpen) > 0 && contentOpen[len(contentOpen)-1] == match[1] {
+					contentOpen = contentOpen[:len(contentOpen)-1]
+				}
+				continue
+			}
+			if len(contentOpen) == 0 && strings.TrimSpace(line) != "" {
+				addError("E008", i+1, fmt.Sprintf("Content outside section block at line %d", i+1))
+				break
+			}
+		}
+	}
+
+	if !invalidNesting && !indexConflicted && report.HasIndex && contentStart != -1 && indexStart != -1 {
+		report.Errors = append(report.Errors, indexIssues(lines, indexStart, contentStart, options)...)
+	}
+
+	sectionIDs := make(map[string]bool)
+	for i, line := range lines {
+		if match := SectionOpenPattern.FindStringSubmatch(line); match != nil {
+			id := match[1]
+			if sectionIDs[id] {
+				addError("E015", i+1, fmt.Sprintf("Duplicate section ID: %s", id))
+			}
+			sectionIDs[id] = true
+		}
+	}
+	report.SectionCount = len(sectionIDs)
+	if report.SectionCount == 0 {
+		addWarning("W006", 0, "No sections found in CONTENT")
+	}
+
+	if !invalidNesting && contentStart != -1 {
+		sections := ParseSections(lines, contentStart)
+		refIssues := referenceIssues(lines, contentStart, sections)
+		report.Errors = append(report.Errors, refIssues...)
+		report.ReferencesValid = len(refIssues) == 0
+		report.Errors = append(report.Errors, anchorIssues(lines, contentStart, sections)...)
+		aliasErrors, aliasWarnings := aliasIssues(lines, contentStart, sections)
+		report.Errors = append(report.Errors, aliasErrors...)
+		report.Warnings = append(report.Warnings, aliasWarnings...)
+		report.Warnings = append(report.Warnings, statusIssues(lines, contentStart, sections)...)
+		report.Warnings = append(report.Warnings, reviewByIssues(lines, sections)...)
+		report.Warnings = append(report.Warnings, visibilityIssues(lines, sections)...)
+		if report.HasIndex && !indexConflicted && ParseHeader(lines).FullHashes() {
+			report.Warnings = append(report.Warnings, SectionHashIssues(lines, sections)...)
+		}
+	}
+
+	return report
+}
+
+// headerIssues reports header fields that are not reserved, @updated:
+// values that are not dates and invalid @summary-width:, @hashes:,
+// @word-count: and @title-refs: settings
+func headerIssues(lines []string) []Issue {
+	issues := []Issue{}
+	for _, field := range ParseHeaderFields(lines) {
+		if !contains(HeaderFields, field.Key) {
+			issues = append(issues, lineIssue("W010", SeverityWarning, lines, field.Line,
+				fmt.Sprintf("Unknown header field: @%s (expected @%s)", field.Key, strings.Join(HeaderFields, ", @"))))
+			continue
+		}
+		if field.Key == "updated" {
+			if _, err := time.Parse(DateFormat, field.Value); err != nil {
+				issues = append(issues, lineIssue("W011", SeverityWarning, lines, field.Line,
+					fmt.Sprintf("Invalid header date: @updated: %s (expected YYYY-MM-DD)", field.Value)))
+			}
+		}
+		if field.Key == "summary-width" {
+			if _, ok := ParseSummaryWidth(field.Value); !ok {
+				issues = append(issues, lineIssue("W013", SeverityWarning, lines, field.Line,
+					fmt.Sprintf("Invalid header setting: @summary-width: %s (expected a number of columns, 0 for no wrapping)", field.Value)))
+			}
+		}
+		if field.Key == "hashes" && !strings.EqualFold(field.Value, HashesShort) && !strings.EqualFold(field.Value, HashesFull) {
+			issues = append(issues, lineIssue("W013", SeverityWarning, lines, field.Line,
+				fmt.Sprintf("Invalid header setting: @hashes: %s (expected %s or %s)", field.Value, HashesShort, HashesFull)))
+		}
+		if field.Key == "word-count" && !strings.EqualFold(field.Value, WordCountUnicode) && !strings.EqualFold(field.Value, WordCountSpaces) {
+			issues = append(issues, lineIssue("W013", SeverityWarning, lines, field.Line,
+				fmt.Sprintf("Invalid header setting: @word-count: %s (expected %s or %s)", field.Value, WordCountUnicode, WordCountSpaces)))
+		}
+		if field.Key == "title-refs" && !strings.EqualFold(field.Value, TitleRefsRewrite) && !strings.EqualFold(field.Value, TitleRefsKeep) {
+			issues = append(issues, lineIssue("W013", SeverityWarning, lines, field.Line,
+				fmt.Sprintf("Invalid header setting: @title-refs: %s (expected %s or %s)", field.Value, TitleRefsRewrite, TitleRefsKeep)))
+		}
+	}
+	return issues
+}
+
+// WorkspaceIDIssues reports the sections whose ID is also the ID of a
+// section in another file of the workspace. others maps each other file, as
+// it should be shown, to its section IDs.
+func WorkspaceIDIssues(lines []string, sections []Section, others map[string][]string) []Issue {
+	files := make([]string, 0, len(others))
+	for file := range others {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	issues := []Issue{}
+	for _, section := range sections {
+		defined := []string{}
+		for _, file := range files {
+			if contains(others[file], section.ID) {
+				defined = append(defined, file)
+			}
+		}
+		if len(defined) > 0 {
+			issues = append(issues, spanIssue("E021", section.Start, 0, len("{#"+section.ID+"}"),
+				fmt.Sprintf("Section ID not unique in workspace: {#%s} is also defined in %s", section.ID, strings.Join(defined, ", "))))
+		}
+	}
+	return issues
+}
+
+// SectionHashIssues compares the Hash: line of each INDEX entry with the
+// CONTENT of its section. Under @hashes: full, short hashes are reported
+// as well.
+func SectionHashIssues(lines []string, sections []Section) []Issue {
+	issues := []Issue{}
+	full := ParseHeader(lines).FullHashes()
+	hashes := IndexHashes(lines)
+	for _, section := range sections {
+		stored, found := hashes[section.ID]
+		if !found {
+			continue
+		}
+		digest := Digest(section.ContentLines)
+		if !HashMatches(stored.Value, digest) {
+			issues = append(issues, lineIssue("W014", SeverityWarning, lines, stored.Line,
+				fmt.Sprintf("Section hash mismatch: {#%s} (CONTENT changed since the INDEX was built)", section.ID)))
+		} else if full && len(stored.Value) != len(digest) {
+			issues = append(issues, lineIssue("W014", SeverityWarning, lines, stored.Line,
+				fmt.Sprintf("Section hash is not full-length: {#%s} (Run 'iatf rebuild')", section.ID)))
+		}
+	}
+	return issues
+}
+
+// anchorIssues reports anchor markers outside the section they name and
+// anchors defined twice in a section
+func anchorIssues(lines []string, contentStart int, sections []Section) []Issue {
+	issues := []Issue{}
+	seen := map[string]bool{}
+	for _, anchor := range ParseAnchors(lines, contentStart, sections) {
+		key := anchor.Section + ":" + anchor.Name
+		switch {
+		case !anchor.Inside:
+			issues = append(issues, lineIssue("E019", SeverityError, lines, anchor.Line,
+				fmt.Sprintf("Anchor {#%s} at line %d is outside section %s", key, anchor.Line, anchor.Section)))
+		case seen[key]:
+			issues = append(issues, lineIssue("E019", SeverityError, lines, anchor.Line,
+				fmt.Sprintf("Anchor {#%s} at line %d is defined more than once", key, anchor.Line)))
+		default:
+			seen[key] = true
+		}
+	}
+	return issues
+}
+
+// aliasIssues reports aliases that cannot resolve (errors) and references
+// made through an alias instead of the canonical ID (warnings)
+func aliasIssues(lines []string, contentStart int, sections []Section) ([]Issue, []Issue) {
+	errs := []Issue{}
+	ids := map[string]bool{}
+	for _, section := range sections {
+		ids[section.ID] = true
+	}
+	owner := map[string]string{}
+	for _, section := range sections {
+		line := metadataLine(lines, section, "@aliases:")
+		for _, alias := range section.Aliases {
+			var message string
+			switch {
+			case !IsValidID(alias):
+				message = fmt.Sprintf("Invalid alias for section %s: %s (not a valid section ID)", section.ID, alias)
+			case ids[alias]:
+				message = fmt.Sprintf("Alias %s of section %s conflicts with section %s", alias, section.ID, alias)
+			case owner[alias] != "":
+				message = fmt.Sprintf("Alias %s of section %s conflicts with an alias of section %s", alias, section.ID, owner[alias])
+			default:
+				owner[alias] = section.ID
+				continue
+			}
+			errs = append(errs, lineIssue("E018", SeverityError, lines, line, message))
+		}
+	}
+
+	warnings := []Issue{}
+	targets := AliasTargets(sections)
+	for alias, locations := range ExtractReferences(lines, contentStart) {
+		canonical, isAlias := targets[alias]
+		if !isAlias {
+			continue
+		}
+		for _, loc := range locations {
+			issue := referenceIssue("W012", alias, lines[loc.LineNum-1], loc.LineNum,
+				fmt.Sprintf("Reference {@%s} at line %d: %s is an alias of %s", alias, loc.LineNum, alias, canonical))
+			issue.Severity = SeverityWarning
+			warnings = append(warnings, issue)
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Line != warnings[j].Line {
+			return warnings[i].Line < warnings[j].Line
+		}
+		return warnings[i].StartCol < warnings[j].StartCol
+	})
+	return errs, warnings
+}
+
+// statusIssues reports unknown @status: values and references from sections
+// that are not deprecated to deprecated ones, in line order
+func statusIssues(lines []string, contentStart int, sections []Section) []Issue {
+	issues := []Issue{}
+	status := map[string]string{}
+	for alias, canonical := range AliasTargets(sections) {
+		for _, section := range sections {
+			if section.ID == canonical {
+				status[alias] = section.Status
+			}
+		}
+	}
+	for _, section := range sections {
+		status[section.ID] = section.Status
+		if section.Status == "" || contains(Statuses, section.Status) {
+			continue
+		}
+		issues = append(issues, lineIssue("W007", SeverityWarning, lines, metadataLine(lines, section, "@status:"),
+			fmt.Sprintf("Unknown status for section %s: %s (expected draft, stable or deprecated)", section.ID, section.Status)))
+	}
+
+	deprecated := []Issue{}
+	for target, locations := range ExtractReferences(lines, contentStart) {
+		if status[target] != StatusDeprecated {
+			continue
+		}
+		for _, loc := range locations {
+			if loc.ContainingSection != "" && status[loc.ContainingSection] == StatusDeprecated {
+				continue
+			}
+			issue := referenceIssue("W008", target, lines[loc.LineNum-1], loc.LineNum,
+				fmt.Sprintf("Reference {@%s} at line %d: target section is deprecated", target, loc.LineNum))
+			issue.Severity = SeverityWarning
+			deprecated = append(deprecated, issue)
+		}
+	}
+	sort.Slice(deprecated, func(i, j int) bool {
+		if deprecated[i].Line != deprecated[j].Line {
+			return deprecated[i].Line < deprecated[j].Line
+		}
+		return deprecated[i].StartCol < deprecated[j].StartCol
+	})
+
+	return append(issues, deprecated...)
+}
+
+// reviewByIssues reports @review-by: values that are not YYYY-MM-DD dates
+func reviewByIssues(lines []string, sections []Section) []Issue {
+	issues := []Issue{}
+	for _, section := range sections {
+		if section.ReviewBy == "" {
+			continue
+		}
+		if _, err := time.Parse(DateFormat, section.ReviewBy); err == nil {
+			continue
+		}
+		issues = append(issues, lineIssue("W009", SeverityWarning, lines, metadataLine(lines, section, "@review-by:"),
+			fmt.Sprintf("Invalid review date for section %s: %s (expected YYYY-MM-DD)", section.ID, section.ReviewBy)))
+	}
+	return issues
+}
+
+// visibilityIssues reports unknown @visibility: values
+func visibilityIssues(lines []string, sections []Section) []Issue {
+	issues := []Issue{}
+	for _, section := range sections {
+		if section.Visibility == "" || contains(Visibilities, section.Visibility) {
+			continue
+		}
+		issues = append(issues, lineIssue("W015", SeverityWarning, lines, metadataLine(lines, section, "@visibility:"),
+			fmt.Sprintf("Unknown visibility for section %s: %s (expected public or private)", section.ID, section.Visibility)))
+	}
+	return issues
+}
+
+// metadataLine returns the 1-indexed line of the section's annotation with
+// prefix, or the line of its opening tag when there is none
+func metadataLine(lines []string, section Section, prefix string) int {
+	line := section.Start
+	for i := section.Start; i < len(lines) && strings.HasPrefix(lines[i], "@"); i++ {
+		if strings.HasPrefix(lines[i], prefix) {
+			line = i + 1
+		}
+	}
+	return line
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateContentHash compares the INDEX Content-Hash with CONTENT
+func validateContentHash(lines []string, indexStart int, contentStart int, addWarning func(code string, line int, message string)) {
+	hashLine := -1
+	if indexStart != -1 && contentStart != -1 {
+		for i := indexStart; i < contentStart; i++ {
+			if strings.HasPrefix(lines[i], "<!-- Content-Hash:") {
+				hashLine = i
+				break
+			}
+		}
+	}
+	if hashLine == -1 || contentStart == -1 {
+		addWarning("W005", indexStart+1, "INDEX missing Content-Hash (Run 'iatf rebuild' to add)")
+		return
+	}
+
+	matches := contentHashPattern.FindStringSubmatch(strings.TrimSpace(lines[hashLine]))
+	if matches == nil {
+		addWarning("W002", hashLine+1, "Invalid Content-Hash format in INDEX")
+		return
+	}
+	algo := matches[1]
+	expectedHash := matches[2]
+	if algo != "sha256" {
+		addWarning("W003", hashLine+1, fmt.Sprintf("Unsupported Content-Hash algorithm: %s", algo))
+		return
+	}
+
+	actualHash := Digest(lines[contentStart:])
+	hashMatches := false
+	if len(expectedHash) == 7 {
+		hashMatches = strings.HasPrefix(actualHash, expectedHash)
+	} else {
+		hashMatches = actualHash == expectedHash
+	}
+	if !hashMatches {
+		addWarning("W004", hashLine+1, "INDEX Content-Hash does not match CONTENT (index may be stale)")
+	}
+}
+
+// indexIssues compares the INDEX entries with the sections of CONTENT
+func indexIssues(lines []string, indexStart int, contentStart int, options Options) []Issue {
+	issues := []Issue{}
+
+	type indexEntry struct {
+		line     int // 1-indexed
+		startCol int // Columns of "lines:a-b"
+		endCol   int
+		lines    [2]int
+	}
+	indexRanges := map[string]indexEntry{}
+	indexOrder := []string{}
+	for i := indexStart + 1; i < contentStart; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		match := indexRangePattern.FindStringSubmatchIndex(trimmed)
+		if match == nil {
+			continue
+		}
+		id := trimmed[match[2]:match[3]]
+		if _, exists := indexRanges[id]; exists {
+			issues = append(issues, lineIssue("E009", SeverityError, lines, i+1, fmt.Sprintf("Duplicate INDEX section ID: %s", id)))
+			continue
+		}
+		startNum, _ := strconv.Atoi(trimmed[match[4]:match[5]])
+		endNum, _ := strconv.Atoi(trimmed[match[6]:match[7]])
+		indent := strings.Index(lines[i], trimmed)
+		entry := indexEntry{
+			line:     i + 1,
+			startCol: indent + match[4] - len("lines:"),
+			endCol:   indent + match[7],
+			lines:    [2]int{startNum, endNum},
+		}
+		if startNum < 1 || endNum < startNum || endNum > len(lines) {
+			issues = append(issues, spanIssue("E010", entry.line, entry.startCol, entry.endCol, fmt.Sprintf("Invalid line range for INDEX section: %s", id)))
+		}
+		indexRanges[id] = entry
+		indexOrder = append(indexOrder, id)
+	}
+
+	contentSections := map[string][2]int{}
+	contentLines := map[string]int{}
+	contentOrder := []string{}
+	for _, section := range ParseSections(lines, contentStart) {
+		if _, exists := contentSections[section.ID]; !exists {
+			contentOrder = append(contentOrder, section.ID)
+			contentLines[section.ID] = section.Start
+		}
+		contentSections[section.ID] = [2]int{section.Start, section.End}
+		if section.Level > options.MaxNestingDepth {
+			issues = append(issues, lineIssue("E011", SeverityError, lines, section.Start, fmt.Sprintf("Section nesting exceeds %d levels: %s", options.MaxNestingDepth, section.ID)))
+		}
+	}
+
+	for _, id := range indexOrder {
+		if _, exists := contentSections[id]; !exists {
+			issues = append(issues, lineIssue("E012", SeverityError, lines, indexRanges[id].line, fmt.Sprintf("INDEX references missing CONTENT section: %s", id)))
+		}
+	}
+	for _, id := range contentOrder {
+		if _, exists := indexRanges[id]; !exists {
+			issues = append(issues, lineIssue("E013", SeverityError, lines, contentLines[id], fmt.Sprintf("CONTENT section missing from INDEX: %s", id)))
+		}
+	}
+	for _, id := range contentOrder {
+		if entry, exists := indexRanges[id]; exists && entry.lines != contentSections[id] {
+			issues = append(issues, spanIssue("E014", entry.line, entry.startCol, entry.endCol, fmt.Sprintf("INDEX line range mismatch for section: %s", id)))
+		}
+	}
+
+	return issues
+}
+
+// lineIssue reports an issue spanning the text of a line (1-indexed, 0 for the whole file)
+func lineIssue(code string, severity Severity, lines []string, line int, message string) Issue {
+	issue := Issue{Code: code, Severity: severity, Message: message, Line: line}
+	if line > 0 && line <= len(lines) {
+		text := lines[line-1]
+		trimmed := strings.TrimSpace(text)
+		issue.StartCol = strings.Index(text, trimmed)
+		issue.EndCol = issue.StartCol + len(trimmed)
+	}
+	return issue
+}
+
+// spanIssue reports an error on part of a line
+func spanIssue(code string, line int, startCol int, endCol int, message string) Issue {
+	return Issue{Code: code, Severity: SeverityError, Message: message, Line: line, StartCol: startCol, EndCol: endCol}
+}
+
+// referenceIssue reports an error on the first {@target} of a line
+func referenceIssue(code string, target string, text string, line int, message string) Issue {
+	startCol := strings.Index(text, "{@"+target+"}")
+	if startCol == -1 {
+		startCol = 0
+	}
+	return spanIssue(code, line, startCol, startCol+len("{@"+target+"}"), message)
+}
@@ -0,0 +1,53 @@
+package iatf
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Values of the @word-count: header field
+const (
+	WordCountUnicode = "unicode" // Default: each CJK ideograph or kana is a word
+	WordCountSpaces  = "spaces"  // Only whitespace separates words
+)
+
+// CountWords counts the words of lines by the header's @word-count: method
+func (h Header) CountWords(lines []string) int {
+	if strings.EqualFold(strings.TrimSpace(h.WordCount), WordCountSpaces) {
+		return len(strings.Fields(strings.Join(lines, " ")))
+	}
+	words := 0
+	for _, line := range lines {
+		words += countUnicodeWords(line)
+	}
+	return words
+}
+
+// countUnicodeWords counts the whitespace-separated words of line like
+// strings.Fields, except that scripts written without spaces count each
+// character: every Han ideograph, hiragana and katakana is a word, and CJK
+// punctuation separates words like a space. Other scripts without spaces,
+// such as Thai, still count one word per run.
+func countUnicodeWords(line string) int {
+	words := 0
+	inWord := false
+	for _, r := range line {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+			words++
+			inWord = false
+		case unicode.IsSpace(r) || isCJKPunctuation(r):
+			inWord = false
+		case !inWord:
+			words++
+			inWord = true
+		}
+	}
+	return words
+}
+
+// isCJKPunctuation reports whether r is in the CJK Symbols and Punctuation
+// block or is fullwidth punctuation, such as 。、「」 and ！
+func isCJKPunctuation(r rune) bool {
+	return (r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF && unicode.IsPunct(r))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// Commands that hold a whole document in memory (validation, rebuilds and
+// most queries) keep its bytes and a string per line at once, several times
+// the size of the file. Documents over the limits below are refused with a
+// message naming the limit rather than read: a mistaken multi-gigabyte file
+// under a watched tree must not take the daemon down. 'iatf index' and
+// 'iatf read' still answer from the INDEX of such a file, as they stream it.
+
+const (
+	defaultMaxFileSizeMB = 64
+	defaultMaxFileLines  = 1000000
+)
+
+// fileLimits bounds the documents read whole; 0 is no limit
+type fileLimits struct {
+	maxSizeMB    int
+	maxLines     int
+	sizeSetting  string // Where the limits are set, for messages
+	linesSetting string
+}
+
+// activeLimits holds the limits in force; the daemon replaces them when
+// daemon.json sets its own
+var activeLimits atomic.Pointer[fileLimits]
+
+func init() {
+	limits := limitsFromEnv()
+	activeLimits.Store(&limits)
+}
+
+// limitsFromEnv returns the limits set by IATF_MAX_FILE_SIZE_MB and
+// IATF_MAX_FILE_LINES, or the defaults
+func limitsFromEnv() fileLimits {
+	limits := fileLimits{
+		maxSizeMB:    defaultMaxFileSizeMB,
+		maxLines:     defaultMaxFileLines,
+		sizeSetting:  "IATF_MAX_FILE_SIZE_MB",
+		linesSetting: "IATF_MAX_FILE_LINES",
+	}
+	for name, limit := range map[string]*int{limits.sizeSetting: &limits.maxSizeMB, limits.linesSetting: &limits.maxLines} {
+		value, set := os.LookupEnv(name)
+		if !set || value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "Warning: Ignoring %s=%s (expected a number, 0 for no limit)\n", name, value)
+			continue
+		}
+		*limit = n
+	}
+	return limits
+}
+
+// daemonLimits returns the limits of the daemon: those of daemon.json where
+// it sets them, else those of the environment
+func (c DaemonConfig) daemonLimits() fileLimits {
+	limits := limitsFromEnv()
+	if c.MaxFileSizeMB > 0 {
+		limits.maxSizeMB = c.MaxFileSizeMB
+		limits.sizeSetting = "max_file_size_mb in daemon.json"
+	}
+	if c.MaxFileLines > 0 {
+		limits.maxLines = c.MaxFileLines
+		limits.linesSetting = "max_file_lines in daemon.json"
+	}
+	return limits
+}
+
+// checkSize returns an error when a file of size bytes is over the limit
+func (l fileLimits) checkSize(path string, size int64) error {
+	if l.maxSizeMB > 0 && size > int64(l.maxSizeMB)<<20 {
+		return fmt.Errorf("%s is %.1f MB, over the %d MB limit for files read whole (raise %s, 0 for no limit)",
+			path, float64(size)/(1<<20), l.maxSizeMB, l.sizeSetting)
+	}
+	return nil
+}
+
+// tooManyLines is the error for a file with more than the allowed lines
+func (l fileLimits) tooManyLines(path string) error {
+	return fmt.Errorf("%s has more than %d lines, the limit for files read whole (raise %s, 0 for no limit)",
+		path, l.maxLines, l.linesSetting)
+}
+
+// readFileWithinLimits reads the file at path, unless it is over the size
+// or line limit
+func readFileWithinLimits(path string) ([]byte, error) {
+	limits := activeLimits.Load()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.checkSize(path, info.Size()); err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if limits.maxLines > 0 && bytes.Count(content, []byte("\n")) >= limits.maxLines {
+		return nil, limits.tooManyLines(path)
+	}
+	return content, nil
+}
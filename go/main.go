@@ -2,45 +2,32 @@ package main
 
 import (
 	"bufio"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode/utf8"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
 )
 
 var Version = "dev" // Set at build time via ldflags
 
-// Pre-compiled regex patterns for section parsing
-var (
-	sectionOpenPattern  = regexp.MustCompile(`^\{#([a-zA-Z][a-zA-Z0-9_-]*)\}`)
-	sectionClosePattern = regexp.MustCompile(`^\{/([a-zA-Z][a-zA-Z0-9_-]*)\}`)
-	referencePattern    = regexp.MustCompile(`\{@([a-zA-Z][a-zA-Z0-9_-]*)\}`)
-)
-
-type Section struct {
-	ID           string
-	Title        string
-	Start        int
-	End          int
-	Level        int
-	Summary      string
-	Created      string
-	Modified     string
-	XHash        string
-	WordCount    int
-	ContentLines []string // Actual content (excluding metadata)
-}
+// Section is a parsed CONTENT section
+type Section = iatf.Section
 
 type WatchState map[string]WatchInfo
 
@@ -48,159 +35,61 @@ type WatchInfo struct {
 	Started      string  `json:"started"`
 	LastModified float64 `json:"last_modified"`
 	PID          int     `json:"pid,omitempty"`
+	Kind         string  `json:"kind,omitempty"` // watchKindFile (default), watchKindDir or watchKindDaemon
+	Paused       bool    `json:"paused,omitempty"`
+	Host         string  `json:"host,omitempty"` // machine that owns PID (shared home directories)
 }
 
-func validateNesting(lines []string, contentStart int) error {
-	openSections := []string{}
-
-	for _, line := range lines[contentStart:] {
-		if match := sectionOpenPattern.FindStringSubmatch(line); match != nil {
-			openSections = append(openSections, match[1])
-		} else if match := sectionClosePattern.FindStringSubmatch(line); match != nil {
-			id := match[1]
-			if len(openSections) > 0 && openSections[len(openSections)-1] == id {
-				openSections = openSections[:len(openSections)-1]
-			} else {
-				return fmt.Errorf("closing tag without matching opening: %s", id)
-			}
-		}
-	}
+// Watch entry kinds recorded in the watch state
+const (
+	watchKindFile   = "file"
+	watchKindDir    = "dir"
+	watchKindDaemon = "daemon"
+)
 
-	if len(openSections) > 0 {
-		return fmt.Errorf("unclosed section: %s", openSections[len(openSections)-1])
+// kind returns the watch kind, treating entries from older versions as file watches
+func (w WatchInfo) kind() string {
+	if w.Kind == "" {
+		return watchKindFile
 	}
-
-	return nil
+	return w.Kind
 }
 
-func isCodeFenceLine(line string) bool {
-	return strings.TrimSpace(line) == "```"
+// isLocal reports whether the entry was recorded on this machine. Entries from
+// older versions carry no host and are assumed to be local.
+func (w WatchInfo) isLocal() bool {
+	return w.Host == "" || w.Host == currentHost()
 }
 
-// ReferenceLocation stores information about where a reference was found
-type ReferenceLocation struct {
-	LineNum           int
-	ContainingSection string
-}
-
-// extractReferences extracts all {@section-id} references from content, ignoring fenced code blocks.
-// Returns a map of section_id -> list of ReferenceLocation where it's referenced.
-func extractReferences(lines []string, contentStart int) map[string][]ReferenceLocation {
-	references := make(map[string][]ReferenceLocation)
-	openSections := []string{}
-	inCodeFence := false
-
-	for i := contentStart; i < len(lines); i++ {
-		line := lines[i]
-		lineNum := i + 1
-
-		if inCodeFence {
-			if isCodeFenceLine(line) {
-				inCodeFence = false
-			}
-			continue
-		}
-		if isCodeFenceLine(line) {
-			inCodeFence = true
-			continue
-		}
-
-		if match := sectionOpenPattern.FindStringSubmatch(line); match != nil {
-			openSections = append(openSections, match[1])
-			continue
-		}
-		if match := sectionClosePattern.FindStringSubmatch(line); match != nil {
-			if len(openSections) > 0 && openSections[len(openSections)-1] == match[1] {
-				openSections = openSections[:len(openSections)-1]
-			} else {
-				openSections = []string{}
-			}
-			continue
-		}
-
-		matches := referencePattern.FindAllStringSubmatch(line, -1)
-		for _, match := range matches {
-			target := match[1]
-			containingSection := ""
-			if len(openSections) > 0 {
-				containingSection = openSections[len(openSections)-1]
-			}
-			references[target] = append(references[target], ReferenceLocation{
-				LineNum:           lineNum,
-				ContainingSection: containingSection,
-			})
-		}
-	}
-
-	return references
+// isLive reports whether the entry's process is running on this machine. PIDs
+// recorded by another host (e.g. an NFS-shared home) cannot be checked here
+// and are never treated as live.
+func (w WatchInfo) isLive() bool {
+	return w.PID != 0 && w.isLocal() && isProcessRunning(w.PID)
 }
 
-// validateReferences validates that all references point to existing sections and no self-references exist.
-// Returns a list of error messages (empty if valid).
-func validateReferences(lines []string, contentStart int, sections []Section) []string {
-	errors := []string{}
-
-	// Build set of valid section IDs
-	validIDs := make(map[string]bool)
-	for _, section := range sections {
-		validIDs[section.ID] = true
-	}
-
-	// Extract references
-	references := extractReferences(lines, contentStart)
-
-	type referenceInstance struct {
-		Target            string
-		LineNum           int
-		ContainingSection string
-	}
-
-	orderedRefs := []referenceInstance{}
-	for target, locations := range references {
-		for _, loc := range locations {
-			orderedRefs = append(orderedRefs, referenceInstance{
-				Target:            target,
-				LineNum:           loc.LineNum,
-				ContainingSection: loc.ContainingSection,
-			})
-		}
-	}
-
-	sort.Slice(orderedRefs, func(i, j int) bool {
-		if orderedRefs[i].LineNum != orderedRefs[j].LineNum {
-			return orderedRefs[i].LineNum < orderedRefs[j].LineNum
-		}
-		if orderedRefs[i].Target != orderedRefs[j].Target {
-			return orderedRefs[i].Target < orderedRefs[j].Target
-		}
-		return orderedRefs[i].ContainingSection < orderedRefs[j].ContainingSection
-	})
-
-	// Validate each reference in deterministic order
-	for _, ref := range orderedRefs {
-		if !validIDs[ref.Target] {
-			errors = append(errors, fmt.Sprintf("Reference {@%s} at line %d: target section does not exist", ref.Target, ref.LineNum))
-		} else if ref.Target == ref.ContainingSection {
-			errors = append(errors, fmt.Sprintf("Reference {@%s} at line %d: self-reference not allowed", ref.Target, ref.LineNum))
-		}
+// currentHost returns the name recorded in watch entries for this machine
+func currentHost() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
 	}
-
-	return errors
+	return host
 }
 
-func findDuplicateSectionIDs(sections []Section) []string {
-	seen := make(map[string]int)
-	duplicates := []string{}
+// sectionExists reports whether a section with the given ID was parsed
+func sectionExists(sections []Section, id string) bool {
 	for _, section := range sections {
-		seen[section.ID]++
-		if seen[section.ID] == 2 {
-			duplicates = append(duplicates, section.ID)
+		if section.ID == id {
+			return true
 		}
 	}
-	return duplicates
+	return false
 }
 
 func main() {
+	initConsole()
+
 	if len(os.Args) < 2 {
 		printUsage()
 		os.Exit(1)
@@ -224,29 +113,74 @@ func main() {
 		os.Exit(rebuildCommand(os.Args[2]))
 	case "rebuild-all":
 		directory := "."
-		if len(os.Args) >= 3 {
-			directory = os.Args[2]
+		force := false
+		for _, arg := range os.Args[2:] {
+			if arg == "--force" {
+				force = true
+			} else if strings.HasPrefix(arg, "--") {
+				fmt.Fprintf(os.Stderr, "Error: unknown option: %s\n", arg)
+				fmt.Fprintln(os.Stderr, "Usage: iatf rebuild-all [directory] [--force]")
+				os.Exit(1)
+			} else {
+				directory = arg
+			}
+		}
+		os.Exit(rebuildAllCommand(directory, force))
+	case "recover":
+		filePath := ""
+		dryRun := false
+		for _, arg := range os.Args[2:] {
+			if arg == "--dry-run" {
+				dryRun = true
+			} else if strings.HasPrefix(arg, "--") {
+				fmt.Fprintf(os.Stderr, "Error: unknown option: %s\n", arg)
+				fmt.Fprintln(os.Stderr, "Usage: iatf recover <file> [--dry-run]")
+				os.Exit(1)
+			} else {
+				filePath = arg
+			}
+		}
+		if filePath == "" {
+			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf recover <file> [--dry-run]")
+			os.Exit(1)
 		}
-		os.Exit(rebuildAllCommand(directory))
+		os.Exit(recoverCommand(filePath, dryRun))
 	case "watch":
 		if len(os.Args) >= 3 && os.Args[2] == "--list" {
 			os.Exit(listWatched())
 		}
+		if len(os.Args) >= 3 && (os.Args[2] == "pause" || os.Args[2] == "resume") {
+			if len(os.Args) < 4 {
+				fmt.Fprintln(os.Stderr, "Error: Missing path argument")
+				fmt.Fprintf(os.Stderr, "Usage: iatf watch %s <file|dir>\n", os.Args[2])
+				os.Exit(1)
+			}
+			os.Exit(watchPauseCommand(os.Args[3], os.Args[2] == "pause"))
+		}
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
-			fmt.Fprintln(os.Stderr, "Usage: iatf watch <file> [--debug]")
+			fmt.Fprintln(os.Stderr, "Usage: iatf watch <file> [--debug] [--once] [--timeout <dur>] [--exec <cmd>] [--on-failure <cmd>] [--notify]")
+			os.Exit(1)
+		}
+		opts, err := parseWatchOptions(os.Args[3:], false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		debug := len(os.Args) >= 4 && os.Args[3] == "--debug"
-		os.Exit(watchCommand(os.Args[2], debug))
+		os.Exit(watchCommand(os.Args[2], opts))
 	case "watch-dir":
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "Error: Missing directory argument")
-			fmt.Fprintln(os.Stderr, "Usage: iatf watch-dir <dir> [--debug]")
+			fmt.Fprintln(os.Stderr, "Usage: iatf watch-dir <dir> [--debug] [--once] [--timeout <dur>] [--exclude <glob>]... [--symlinks <policy>] [--max-concurrent <n>] [--exec <cmd>] [--on-failure <cmd>] [--notify]")
 			os.Exit(1)
 		}
-		debug := len(os.Args) >= 4 && os.Args[3] == "--debug"
-		os.Exit(watchDirCommand(os.Args[2], debug))
+		opts, err := parseWatchOptions(os.Args[3:], true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(watchDirCommand(os.Args[2], opts))
 	case "unwatch":
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
@@ -257,35 +191,110 @@ func main() {
 	case "validate":
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
-			fmt.Fprintln(os.Stderr, "Usage: iatf validate <file>")
+			fmt.Fprintln(os.Stderr, "Usage: iatf validate <file> [--workspace <dir>] [--format text|sarif|junit]")
+			os.Exit(1)
+		}
+		workspace, format, err := parseValidateArgs(os.Args[3:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		os.Exit(validateCommand(os.Args[2]))
+		os.Exit(validateCommand(os.Args[2], workspace, format))
+	case "ci":
+		root, rest := ".", os.Args[2:]
+		if len(rest) > 0 && !strings.HasPrefix(rest[0], "--") {
+			root, rest = rest[0], rest[1:]
+		}
+		args, err := parseCIArgs(rest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Usage: iatf ci [dir] [--include <glob>]... [--exclude <glob>]... [--strict] [--format text|json|sarif|junit] [--output <file>]")
+			os.Exit(ciCannotCheck)
+		}
+		os.Exit(ciCommand(root, args))
 	case "index":
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
-			fmt.Fprintln(os.Stderr, "Usage: iatf index <file>")
+			fmt.Fprintln(os.Stderr, "Usage: iatf index <file|dir> [--tag <tag>]... [--audience <audience>] [--json] [--include-private]")
+			os.Exit(1)
+		}
+		args, err := parseIndexArgs(os.Args[3:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		os.Exit(indexCommand(os.Args[2]))
+		code := indexCommand(os.Args[2], args)
+		if code == 0 {
+			recordSessionEvent(args.session, SessionEvent{Event: sessionIndex, File: os.Args[2]})
+		}
+		os.Exit(code)
 	case "read":
 		if len(os.Args) < 4 {
 			fmt.Fprintln(os.Stderr, "Error: Missing arguments")
-			fmt.Fprintln(os.Stderr, "Usage: iatf read <file> <section-id>")
-			fmt.Fprintln(os.Stderr, "       iatf read <file> --title \"Title\"")
+			fmt.Fprintln(os.Stderr, "Usage: iatf read <file> <section-id> [--anchor <name>] [--exclude-drafts] [--audience <audience>] [--include-private]")
+			fmt.Fprintln(os.Stderr, "       iatf read <file> --title \"Title\" [--exclude-drafts] [--audience <audience>] [--include-private]")
+			fmt.Fprintln(os.Stderr, "       iatf read <file> --tag <tag>... [--exclude-drafts] [--audience <audience>] [--include-private]")
 			os.Exit(1)
 		}
 
-		// Check for --title flag
-		if os.Args[3] == "--title" {
-			if len(os.Args) < 5 {
-				fmt.Fprintln(os.Stderr, "Error: Missing title argument")
-				os.Exit(1)
-			}
-			os.Exit(readByTitleCommand(os.Args[2], os.Args[4]))
+		args, err := parseReadArgs(os.Args[3:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(args.tags) > 0 {
+			os.Exit(readByTagCommand(os.Args[2], args.tags, args.options))
+		} else if args.title != "" {
+			os.Exit(readByTitleCommand(os.Args[2], args.title, args.options))
 		} else {
-			os.Exit(readCommand(os.Args[2], os.Args[3]))
+			os.Exit(readCommand(os.Args[2], args.id, args.anchor, args.options))
+		}
+	case "query":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf query <file> [--owner <owner>]... [--tag <tag>]... [--status <status>]... [--invalid]")
+			os.Exit(1)
+		}
+		filters, err := parseQueryArgs(os.Args[3:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(queryCommand(os.Args[2], filters))
+	case "outdated":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: Missing file or directory argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf outdated <file|dir> [--days <n>]")
+			os.Exit(1)
+		}
+		days, err := parseDaysArg(os.Args[3:], 90)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(outdatedCommand(os.Args[2], days))
+	case "verify":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: Missing file or directory argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf verify <file|dir>")
+			os.Exit(1)
+		}
+		os.Exit(verifyCommand(os.Args[2]))
+	case "resolve":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf resolve <file>")
+			os.Exit(1)
+		}
+		os.Exit(resolveCommand(os.Args[2]))
+	case "explain":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: Missing code argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf explain <code>")
+			fmt.Fprintln(os.Stderr, "       iatf explain --list")
+			os.Exit(1)
 		}
+		os.Exit(explainCommand(os.Args[2]))
 	case "graph":
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
@@ -297,10 +306,152 @@ func main() {
 			showIncoming = true
 		}
 		os.Exit(graphCommand(os.Args[2], showIncoming))
+	case "mcp":
+		args, err := parseServerArgs(os.Args[2:], false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Usage: iatf mcp [directory] [--policy <file>] [--include-private]")
+			os.Exit(1)
+		}
+		os.Exit(mcpCommand(args))
+	case "plan":
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "Error: Missing arguments")
+			fmt.Fprintln(os.Stderr, "Usage: iatf plan <file> <query> [--budget <tokens>] [--json] [--include-private]")
+			os.Exit(1)
+		}
+		args, err := parsePlanArgs(os.Args[3:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(planCommand(os.Args[2], args))
+	case "similar":
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "Error: Missing arguments")
+			fmt.Fprintln(os.Stderr, "Usage: iatf similar <file> <section-id> [--workspace <dir>] [--limit <n>] [--min <score>] [--json]")
+			os.Exit(1)
+		}
+		args, err := parseSimilarArgs(os.Args[4:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(similarCommand(os.Args[2], os.Args[3], args))
+	case "session":
+		if len(os.Args) < 4 || os.Args[2] != "report" {
+			fmt.Fprintln(os.Stderr, "Error: Missing session subcommand or ID")
+			fmt.Fprintln(os.Stderr, "Usage: iatf session report <id> [--json]")
+			os.Exit(1)
+		}
+		jsonOutput := false
+		for _, arg := range os.Args[4:] {
+			if arg != "--json" {
+				fmt.Fprintf(os.Stderr, "Error: unknown option: %s\n", arg)
+				os.Exit(1)
+			}
+			jsonOutput = true
+		}
+		os.Exit(sessionReportCommand(os.Args[3], jsonOutput))
+	case "bench":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf bench <file|dir> [--iterations <n>] [--json]")
+			os.Exit(1)
+		}
+		args, err := parseBenchArgs(os.Args[3:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(benchCommand(os.Args[2], args))
+	case "blame":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf blame <file> [--json]")
+			os.Exit(1)
+		}
+		jsonOutput := false
+		for _, arg := range os.Args[3:] {
+			if arg != "--json" {
+				fmt.Fprintf(os.Stderr, "Error: unknown option: %s\n", arg)
+				os.Exit(1)
+			}
+			jsonOutput = true
+		}
+		os.Exit(blameCommand(os.Args[2], jsonOutput))
+	case "history":
+		if len(os.Args) < 4 {
+			fmt.Fprintln(os.Stderr, "Error: Missing arguments")
+			fmt.Fprintln(os.Stderr, "Usage: iatf history <file> <section-id> [--limit <n>] [--json]")
+			os.Exit(1)
+		}
+		args, err := parseHistoryArgs(os.Args[4:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(historyCommand(os.Args[2], os.Args[3], args))
+	case "git":
+		switch {
+		case len(os.Args) >= 4 && os.Args[2] == "textconv":
+			os.Exit(gitTextconvCommand(os.Args[3]))
+		case len(os.Args) >= 3 && os.Args[2] == "setup":
+			global := false
+			for _, arg := range os.Args[3:] {
+				if arg != "--global" {
+					fmt.Fprintf(os.Stderr, "Error: unknown option: %s\n", arg)
+					os.Exit(1)
+				}
+				global = true
+			}
+			os.Exit(gitSetupCommand(".", global))
+		default:
+			fmt.Fprintln(os.Stderr, "Error: Missing git subcommand or file")
+			fmt.Fprintln(os.Stderr, "Usage: iatf git textconv <file>")
+			fmt.Fprintln(os.Stderr, "       iatf git setup [--global]")
+			os.Exit(1)
+		}
+	case "summarize":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Error: Missing file argument")
+			fmt.Fprintln(os.Stderr, "Usage: iatf summarize <file> (--command <cmd> | --endpoint <url> --model <name>) [--only-missing] [--write]")
+			os.Exit(1)
+		}
+		args, err := parseSummarizeArgs(os.Args[3:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(summarizeCommand(os.Args[2], args))
+	case "manifest":
+		format, err := parseManifestArgs(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Usage: iatf manifest [--format openai|anthropic|mcp]")
+			os.Exit(1)
+		}
+		os.Exit(manifestCommand(format))
+	case "rpc":
+		args, err := parseServerArgs(os.Args[2:], false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Usage: iatf rpc [directory] [--policy <file>] [--include-private]")
+			os.Exit(1)
+		}
+		os.Exit(rpcCommand(args))
+	case "serve":
+		args, err := parseServerArgs(os.Args[2:], true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Usage: iatf serve [directory] [--addr <host:port>] [--policy <file>] [--include-private]")
+			os.Exit(1)
+		}
+		os.Exit(serveCommand(args))
 	case "daemon":
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "Error: Missing daemon subcommand")
-			fmt.Fprintln(os.Stderr, "Usage: iatf daemon <start|stop|status|run|install|uninstall>")
+			fmt.Fprintln(os.Stderr, "Usage: iatf daemon <start|stop|status|run|kick|pause|resume|reload|events|add-path|upgrade|install|uninstall>")
 			os.Exit(1)
 		}
 		subCmd := os.Args[2]
@@ -309,19 +460,34 @@ func main() {
 			debug := len(os.Args) >= 4 && os.Args[3] == "--debug"
 			os.Exit(daemonStartCommand(debug))
 		case "stop":
-			os.Exit(daemonStopCommand())
+			os.Exit(daemonStopCommand(len(os.Args) >= 4 && os.Args[3] == "--force"))
 		case "status":
-			os.Exit(daemonStatusCommand())
+			os.Exit(daemonStatusCommand(len(os.Args) >= 4 && os.Args[3] == "--json"))
 		case "run":
 			debug := len(os.Args) >= 4 && os.Args[3] == "--debug"
 			os.Exit(daemonRunCommand(debug))
+		case "kick":
+			os.Exit(daemonKickCommand(os.Args[3:]))
+		case "pause":
+			os.Exit(daemonPauseCommand(os.Args[3:], true))
+		case "resume":
+			os.Exit(daemonPauseCommand(os.Args[3:], false))
+		case "reload":
+			os.Exit(daemonReloadCommand())
+		case "events":
+			os.Exit(daemonEventsCommand())
+		case "add-path":
+			os.Exit(daemonAddPathCommand(os.Args[3:]))
+		case "upgrade":
+			debug := len(os.Args) >= 4 && os.Args[3] == "--debug"
+			os.Exit(daemonUpgradeCommand(debug))
 		case "install":
 			os.Exit(daemonInstallCommand())
 		case "uninstall":
 			os.Exit(daemonUninstallCommand())
 		default:
 			fmt.Fprintf(os.Stderr, "Error: Unknown daemon subcommand: %s\n", subCmd)
-			fmt.Fprintln(os.Stderr, "Usage: iatf daemon <start|stop|status|run|install|uninstall>")
+			fmt.Fprintln(os.Stderr, "Usage: iatf daemon <start|stop|status|run|kick|pause|resume|reload|events|add-path|upgrade|install|uninstall>")
 			os.Exit(1)
 		}
 	default:
@@ -337,36 +503,122 @@ func printUsage() {
 Usage:
     iatf rebuild <file>              Rebuild index for a single file
     iatf rebuild-all [directory]     Rebuild all .iatf files in directory
+        [--force]                    Also rebuild files whose Content-Hash is current
+    iatf recover <file>              Regenerate a broken INDEX from CONTENT alone
+        [--dry-run]                  Print the recovered header and INDEX only
     iatf watch <file> [--debug]      Watch file and auto-rebuild on changes
     iatf watch-dir <dir> [--debug]   Watch directory tree for .iatf files
-    iatf unwatch <file>              Stop watching a file
-    iatf watch --list                List all watched files
+        [--exclude <glob>]...        Skip matching directories/files (repeatable)
+        [--symlinks <policy>]        files (default), follow or ignore symlinks (watch-dir)
+        [--max-concurrent <n>]       Files rebuilt at the same time, default 2 (watch-dir)
+        [--exec <cmd>]               Run command after each auto-rebuild (watch, watch-dir)
+        [--on-failure <cmd>]         Run command when validation/rebuild fails
+        [--notify]                   Desktop notification when a file starts failing
+        [--once]                     Exit after the next change is processed
+        [--timeout <dur>]            Stop watching after a duration (e.g. 30s, 5m)
+    iatf unwatch <file|dir>          Stop watching a file or directory
+    iatf watch --list                List all watched files and directories
+    iatf watch pause <file|dir>      Suspend auto-rebuilds without stopping the watch
+    iatf watch resume <file|dir>     Resume auto-rebuilds (catches up on changes)
     iatf validate <file>             Validate iatf file structure
+        [--workspace <dir>]          Also require section IDs unique across <dir>
+        [--format <f>]               text (default), sarif or junit
+    iatf ci [dir]                    Validate, check INDEXes and lint every .iatf file
+        [--include <glob>]...        Only check matching files (repeatable)
+        [--exclude <glob>]...        Skip matching directories/files (repeatable)
+        [--strict]                   Fail on warnings too
+        [--format <f>]               text (default), json, sarif or junit
+        [--output <file>]            Write the report to a file (JSON by default)
+    iatf verify <file|dir>           Check section hashes and Content-Hash against CONTENT
+    iatf resolve <file>              Regenerate an INDEX with merge conflicts
     iatf index <file>                Output INDEX section only
+    iatf index <dir>                 Master index of every .iatf file in directory
+        [--tag <tag>]...             Only entries of sections with a tag (repeatable)
+        [--json]                     Header fields and sections as JSON
     iatf read <file> <section-id>    Extract section by ID
+    iatf read <file> <id> --anchor <name>  Extract the {#id:name} region of a section
     iatf read <file> --title "Title" Extract section by title
+    iatf read <file> --tag <tag>...  Extract every section with a tag
+        [--exclude-drafts]           Leave out sections with @status: draft (read)
+        [--audience <audience>]      Leave out sections for other audiences (read, index)
+        [--include-private]          Show sections marked @visibility: private (read, index, plan)
+        [--session <id>]             Record what is read in a session (read, index)
+    iatf query <file>                List sections with their owner, status and issues
+        [--owner <owner>]...         Only sections with @owner: <owner> (repeatable)
+        [--tag <tag>]...             Only sections with a tag (repeatable)
+        [--status <status>]...       Only sections with a status (repeatable)
+        [--invalid]                  Only sections with validation errors/warnings
+    iatf outdated <file|dir>         List sections not modified recently or due for review
+        [--days <n>]                 Age limit in days (default 90)
+    iatf plan <file> <query>         Ranked reading plan for a query, with token costs
+        [--budget <tokens>]          Token budget of the plan (default 8000)
+    iatf similar <file> <id>         Sections across the workspace most similar to a section
+        [--workspace <dir>]          Where to look (default: the file's directory)
+        [--limit <n>] [--min <score>]  At most n results (default 10) scoring at least score (default 0.05)
+    iatf session report <id>         Coverage, reading order and hot sections of a session
+    iatf summarize <file>            Fill in @summary: lines with a summarizer (prints a diff)
+        --command <cmd>              Command reading a section on stdin, printing its summary
+        --endpoint <url> --model <m> OpenAI-compatible API instead (key from OPENAI_API_KEY)
+        [--only-missing]             Only sections without a summary
+        [--write]                    Apply the changes and rebuild the INDEX
+    iatf bench <file|dir>            Time parse, validate and rebuild, with allocations
+        [--iterations <n>] [--json]  Runs per measurement (default 10), JSON output
+    iatf blame <file> [--json]       Last commit, author and date of each section (git)
+    iatf history <file> <id>         Commits that changed a section, with its diffs (git)
+        [--limit <n>] [--json]       At most n changes, newest first; JSON output
+    iatf git textconv <file>         Document by section without its INDEX, for git diff
+    iatf git setup [--global]        Use 'iatf git textconv' to diff .iatf files in this repository
     iatf graph <file>                Show section reference graph
     iatf graph <file> --show-incoming  Show incoming references (impact analysis)
+    iatf explain <code>              Explain a validation error/warning code
+    iatf explain --list              List all validation codes
+    iatf mcp [directory]             MCP server on stdio for the .iatf files in directory
+    iatf manifest [--format <fmt>]   Tool definitions of iatf mcp for openai, anthropic or mcp (default)
+    iatf rpc [directory]             Resident JSON-RPC on stdio (read, index, search, validate)
+    iatf serve [directory]           JSON HTTP API for the .iatf files in directory
+        [--addr <host:port>]         Listen address (default 127.0.0.1:8741)
+        [--policy <file>]            Access policy (mcp, rpc, serve; default <directory>/.iatf-policy.json)
+        [--include-private]          Serve sections marked @visibility: private (mcp, rpc, serve)
     iatf --help                      Show this help message
     iatf --version                   Show version
 
 Daemon Commands:
     iatf daemon start [--debug]      Start system-wide daemon
-    iatf daemon stop                 Stop running daemon
-    iatf daemon status               Show daemon status and watched paths
+    iatf daemon stop [--force]       Stop running daemon (--force kills it if it does not exit)
+    iatf daemon status [--json]      Show daemon status and watched paths
+    iatf daemon kick [path]...       Rebuild watched files now (all if no path)
+    iatf daemon pause [path]...      Suspend daemon rebuilds (all paths if none)
+    iatf daemon resume [path]...     Resume daemon rebuilds
+    iatf daemon reload               Re-read daemon.json in the running daemon
+    iatf daemon events               Stream rebuild events (one JSON object per line)
+    iatf daemon add-path <dir>...    Add watch paths (applied live if running)
+    iatf daemon upgrade [--debug]    Restart daemon if it runs another version
     iatf daemon install              Install as OS service (auto-start on boot)
     iatf daemon uninstall            Remove OS service
 
 Examples:
     iatf rebuild document.iatf
     iatf rebuild-all ./docs
+    iatf recover merged.iatf --dry-run
     iatf watch api-reference.iatf
     iatf watch api-reference.iatf --debug
+    iatf watch api-reference.iatf --exec "make site"
     iatf watch-dir ./docs
+    iatf watch-dir . --exclude "build" --exclude "docs/archive/*"
     iatf validate my-doc.iatf
     iatf index document.iatf
     iatf read document.iatf intro
     iatf read document.iatf --title "Introduction"
+    iatf read document.iatf setup --anchor linux
+    iatf read document.iatf deploy --audience agent
+    iatf index document.iatf --tag api
+    iatf index ./docs --json
+    iatf read document.iatf --tag deployment
+    iatf query document.iatf --invalid --owner platform-team
+    iatf outdated ./docs --days 180
+    iatf plan document.iatf "rate limits" --budget 2000
+    iatf mcp ./docs
+    iatf serve ./docs --addr 127.0.0.1:9000
     iatf daemon start
     iatf daemon status
 
@@ -374,85 +626,6 @@ For more information, visit: https://github.com/Winds-AI/agent-traversal-file
 `, Version)
 }
 
-func parseContentSection(lines []string, contentStart int) []Section {
-	sections := []Section{}
-	stack := []int{}
-	inHeader := []bool{}
-	summaryContinuation := []bool{}
-
-	for i := contentStart; i < len(lines); i++ {
-		line := lines[i]
-
-		if match := sectionOpenPattern.FindStringSubmatch(line); match != nil {
-			section := Section{
-				ID:    match[1],
-				Title: match[1],
-				Start: i + 1, // 1-indexed
-				Level: len(stack) + 1,
-			}
-			sections = append(sections, section)
-			stack = append(stack, len(sections)-1)
-			inHeader = append(inHeader, true)
-			summaryContinuation = append(summaryContinuation, false)
-			continue
-		}
-
-		if len(stack) > 0 && inHeader[len(inHeader)-1] {
-			if strings.HasPrefix(line, "@") {
-				if strings.HasPrefix(line, "@summary:") {
-					sections[stack[len(stack)-1]].Summary = strings.TrimSpace(line[9:])
-					summaryContinuation[len(summaryContinuation)-1] = true
-				} else if strings.HasPrefix(line, "@created:") {
-					// @created is stored in INDEX, not CONTENT
-					summaryContinuation[len(summaryContinuation)-1] = false
-				}
-				continue
-			}
-			if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && summaryContinuation[len(summaryContinuation)-1] {
-				sections[stack[len(stack)-1]].Summary = fmt.Sprintf(
-					"%s %s",
-					sections[stack[len(stack)-1]].Summary,
-					strings.TrimSpace(line),
-				)
-				continue
-			}
-			inHeader[len(inHeader)-1] = false
-			summaryContinuation[len(summaryContinuation)-1] = false
-		}
-
-		if match := sectionClosePattern.FindStringSubmatch(line); match != nil {
-			if len(stack) > 0 && sections[stack[len(stack)-1]].ID == match[1] {
-				idx := stack[len(stack)-1]
-				sections[idx].End = i + 1 // 1-indexed
-				stack = stack[:len(stack)-1]
-				inHeader = inHeader[:len(inHeader)-1]
-				summaryContinuation = summaryContinuation[:len(summaryContinuation)-1]
-			}
-			continue
-		}
-
-		if len(stack) > 0 && !inHeader[len(inHeader)-1] {
-			if strings.HasPrefix(line, "#") && !strings.HasPrefix(sections[stack[len(stack)-1]].Title, "#") {
-				sections[stack[len(stack)-1]].Title = strings.TrimSpace(strings.TrimLeft(line, "#"))
-			}
-			sections[stack[len(stack)-1]].ContentLines = append(sections[stack[len(stack)-1]].ContentLines, line)
-		}
-	}
-
-	return sections
-}
-
-func computeContentHash(contentLines []string) string {
-	contentText := strings.Join(contentLines, "\n")
-	sum := sha256.Sum256([]byte(contentText))
-	return hex.EncodeToString(sum[:])[:7]
-}
-
-func countWords(contentLines []string) int {
-	text := strings.Join(contentLines, " ")
-	return len(strings.Fields(text))
-}
-
 type indexMeta struct {
 	Hash     string
 	Modified string
@@ -524,14 +697,100 @@ func parseIndexMetadata(lines []string) map[string]indexMeta {
 	return metadata
 }
 
-func generateIndex(sections []Section, contentHash string) []string {
+// indexNotePrefix starts the hand-written INDEX comments that rebuilds keep
+const indexNotePrefix = "<!-- note:"
+
+// isIndexNote reports whether an INDEX line is a <!-- note: ... --> comment
+func isIndexNote(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, indexNotePrefix) && strings.HasSuffix(trimmed, "-->")
+}
+
+// parseIndexNotes returns the <!-- note: --> lines of the INDEX by the ID
+// of the entry they follow; notes before the first entry are under ""
+func parseIndexNotes(lines []string) map[string][]string {
+	notes := map[string][]string{}
+	contentStart := iatf.ContentStart(lines)
+	if contentStart < 0 {
+		return notes
+	}
+	entryRe := regexp.MustCompile(`^#{1,6}\s+.*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|`)
+	inIndex := false
+	currentID := ""
+	for _, line := range lines[:contentStart-1] {
+		stripped := strings.TrimSpace(line)
+		if stripped == "===INDEX===" {
+			inIndex = true
+			continue
+		}
+		if !inIndex {
+			continue
+		}
+		if match := entryRe.FindStringSubmatch(stripped); match != nil {
+			currentID = match[1]
+		} else if isIndexNote(stripped) {
+			notes[currentID] = append(notes[currentID], stripped)
+		}
+	}
+	return notes
+}
+
+// carryIndexNotes moves the notes of entries renamed into an alias over to
+// the section now using it. Notes whose section is gone are dropped with a
+// warning.
+func carryIndexNotes(notes map[string][]string, sections []Section) map[string][]string {
+	carried := map[string][]string{"": notes[""]}
+	aliases := iatf.AliasTargets(sections)
+	ids := []string{}
+	for id := range notes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		switch {
+		case id == "":
+		case sectionExists(sections, id):
+			carried[id] = append(carried[id], notes[id]...)
+		case aliases[id] != "":
+			carried[aliases[id]] = append(carried[aliases[id]], notes[id]...)
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: Dropping %d INDEX note(s) of removed section: %s\n", len(notes[id]), id)
+		}
+	}
+	return carried
+}
+
+// wrapSummary splits summary into "> " INDEX lines of at most width columns,
+// breaking between words; a word longer than the width gets a line of its
+// own. A width of 0 keeps the summary on one line.
+func wrapSummary(summary string, width int) []string {
+	words := strings.Fields(summary)
+	if width <= 0 {
+		return []string{"> " + strings.Join(words, " ")}
+	}
+	lines := []string{}
+	current := ">"
+	for _, word := range words {
+		if current != ">" && utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) > width {
+			lines = append(lines, current)
+			current = ">"
+		}
+		current += " " + word
+	}
+	return append(lines, current)
+}
+
+// generateIndex renders the INDEX block. notes are the <!-- note: -->
+// lines to keep, by section ID ("" for the document).
+func generateIndex(sections []Section, contentHash string, summaryWidth int, notes map[string][]string) []string {
 	indexLines := []string{
 		"===INDEX===",
 		"<!-- AUTO-GENERATED - DO NOT EDIT MANUALLY -->",
 		fmt.Sprintf("<!-- Generated: %s -->", time.Now().UTC().Format(time.RFC3339)),
 		fmt.Sprintf("<!-- Content-Hash: sha256:%s -->", contentHash),
-		"",
 	}
+	indexLines = append(indexLines, notes[""]...)
+	indexLines = append(indexLines, "")
 
 	for _, section := range sections {
 		levelMarker := strings.Repeat("#", section.Level)
@@ -540,7 +799,35 @@ func generateIndex(sections []Section, contentHash string) []string {
 		indexLines = append(indexLines, indexLine)
 
 		if section.Summary != "" {
-			indexLines = append(indexLines, fmt.Sprintf("> %s", section.Summary))
+			indexLines = append(indexLines, wrapSummary(section.Summary, summaryWidth)...)
+		}
+
+		if len(section.Tags) > 0 {
+			indexLines = append(indexLines, fmt.Sprintf("  Tags: %s", strings.Join(section.Tags, ", ")))
+		}
+
+		if section.Status != "" {
+			indexLines = append(indexLines, fmt.Sprintf("  Status: %s", section.Status))
+		}
+
+		if section.Owner != "" {
+			indexLines = append(indexLines, fmt.Sprintf("  Owner: %s", section.Owner))
+		}
+
+		if section.ReviewBy != "" {
+			indexLines = append(indexLines, fmt.Sprintf("  Review-By: %s", section.ReviewBy))
+		}
+
+		if len(section.Audiences) > 0 {
+			indexLines = append(indexLines, fmt.Sprintf("  Audience: %s", strings.Join(section.Audiences, ", ")))
+		}
+
+		if len(section.Anchors) > 0 {
+			indexLines = append(indexLines, fmt.Sprintf("  Anchors: %s", strings.Join(section.Anchors, ", ")))
+		}
+
+		if len(section.Aliases) > 0 {
+			indexLines = append(indexLines, fmt.Sprintf("  Aliases: %s", strings.Join(section.Aliases, ", ")))
 		}
 
 		if section.Created != "" || section.Modified != "" {
@@ -558,20 +845,116 @@ func generateIndex(sections []Section, contentHash string) []string {
 			indexLines = append(indexLines, fmt.Sprintf("  Hash: %s", section.XHash))
 		}
 
+		indexLines = append(indexLines, notes[section.ID]...)
 		indexLines = append(indexLines, "")
 	}
 
 	return indexLines
 }
 
+// rebuildIndex rebuilds the INDEX of filePath and writes it, refreshing the
+// Generated timestamp even when nothing else changed
 func rebuildIndex(filePath string) error {
-	content, err := os.ReadFile(filePath)
+	_, _, err := writeIndexRebuild(filePath, true)
+	return err
+}
+
+// rebuildIndexIfChanged rebuilds the INDEX of filePath and reports whether the
+// file was rewritten (false when only the Generated timestamp would change, so
+// the watcher's own write does not trigger another rebuild)
+func rebuildIndexIfChanged(filePath string) (bool, error) {
+	changed, _, err := rebuildIndexWithChanges(filePath)
+	return changed, err
+}
+
+// SectionChanges lists the sections added, modified or removed by a rebuild,
+// judged by the per-section hashes recorded in the previous INDEX
+type SectionChanges struct {
+	Added    []string `json:"added,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+// rebuildIndexWithChanges is rebuildIndexIfChanged that also reports which
+// sections changed since the previous INDEX was generated. Other rebuilds of
+// the file wait for it, and if the file is written while the rebuild is
+// planned, the rebuild starts over from the new content.
+func rebuildIndexWithChanges(filePath string) (bool, SectionChanges, error) {
+	return writeIndexRebuild(filePath, false)
+}
+
+// writeIndexRebuild rebuilds and writes the INDEX of filePath. Unless always
+// is set, a rebuild that would only refresh the Generated timestamp is not
+// written.
+func writeIndexRebuild(filePath string, always bool) (bool, SectionChanges, error) {
+	unlock, err := lockForRebuild(filePath)
 	if err != nil {
-		return err
+		return false, SectionChanges{}, err
 	}
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		before, err := statVersion(filePath)
+		if err != nil {
+			return false, SectionChanges{}, err
+		}
+		newContent, changed, changes, err := planIndexRebuild(filePath)
+		if err != nil || !changed && !always {
+			return false, changes, err
+		}
+		if after, err := statVersion(filePath); err == nil && !after.same(before) {
+			if attempt < rebuildAttempts {
+				continue
+			}
+			return false, changes, fmt.Errorf("file kept changing during the rebuild; try again")
+		}
+		if err := os.WriteFile(filePath, []byte(newContent), 0644); err != nil {
+			return false, changes, err
+		}
+		return true, changes, nil
+	}
+}
+
+// readDocument returns the content of the IATF file at path without its
+// byte order mark. A UTF-16 file is iatf.ErrUTF16; a file over the size
+// limits is an error naming the limit.
+func readDocument(path string) ([]byte, error) {
+	content, err := readFileWithinLimits(path)
+	if err != nil {
+		return nil, err
+	}
+	text, _, err := iatf.Decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return []byte(text), nil
+}
+
+// planIndexRebuild computes the rebuilt content of filePath without writing
+// it. changed is false when only the Generated timestamp would differ. A
+// byte order mark the file starts with is kept.
+func planIndexRebuild(filePath string) (string, bool, SectionChanges, error) {
+	content, err := readFileWithinLimits(filePath)
+	if err != nil {
+		return "", false, SectionChanges{}, err
+	}
+	text, bom, err := iatf.Decode(content)
+	if err != nil {
+		return "", false, SectionChanges{}, err
+	}
+	newContent, changed, changes, err := planIndexRebuildContent(text)
+	if bom && err == nil {
+		newContent = iatf.BOM + newContent
+	}
+	return newContent, changed, changes, err
+}
+
+// planIndexRebuildContent computes the rebuilt form of content, as
+// planIndexRebuild does for a file
+func planIndexRebuildContent(content string) (string, bool, SectionChanges, error) {
+	changes := SectionChanges{}
+	lines := strings.Split(content, "\n")
 
-	lines := strings.Split(string(content), "\n")
-
 	// Find CONTENT section
 	contentStart := -1
 	for i, line := range lines {
@@ -582,36 +965,46 @@ func rebuildIndex(filePath string) error {
 	}
 
 	if contentStart == -1 {
-		return fmt.Errorf("no ===CONTENT=== section found")
+		return "", false, changes, fmt.Errorf("no ===CONTENT=== section found")
 	}
 
 	// Validate nesting before parsing for index rebuild (fail-fast approach)
-	if err := validateNesting(lines, contentStart); err != nil {
-		return fmt.Errorf("invalid section nesting: %w", err)
+	if err := iatf.ValidateNesting(lines, contentStart); err != nil {
+		return "", false, changes, fmt.Errorf("invalid section nesting: %w", err)
 	}
 
 	// Parse sections
-	sections := parseContentSection(lines, contentStart)
+	sections := iatf.ParseSections(lines, contentStart)
 
 	if len(sections) == 0 {
-		return fmt.Errorf("no sections found")
+		return "", false, changes, fmt.Errorf("no sections found")
 	}
 
-	duplicateIDs := findDuplicateSectionIDs(sections)
+	duplicateIDs := iatf.FindDuplicateSectionIDs(sections)
 	if len(duplicateIDs) > 0 {
 		for _, id := range duplicateIDs {
 			fmt.Fprintf(os.Stderr, "  - Duplicate section ID: %s\n", id)
 		}
-		return fmt.Errorf("%d duplicate section ID(s) found", len(duplicateIDs))
+		return "", false, changes, fmt.Errorf("%d duplicate section ID(s) found", len(duplicateIDs))
+	}
+
+	// Resolve {@"Title"} references to section IDs, unless the header asks
+	// to keep them; line numbers do not move, so sections only need re-parsing
+	header := iatf.ParseHeader(lines)
+	if !header.KeepTitleReferences() {
+		if rewritten, count := iatf.RewriteTitleReferences(lines, contentStart, sections); count > 0 {
+			lines = rewritten
+			sections = iatf.ParseSections(lines, contentStart)
+		}
 	}
 
 	// Validate references before proceeding
-	refErrors := validateReferences(lines, contentStart, sections)
+	refErrors := iatf.ValidateReferences(lines, contentStart, sections)
 	if len(refErrors) > 0 {
 		for _, err := range refErrors {
 			fmt.Fprintf(os.Stderr, "  - %s\n", err)
 		}
-		return fmt.Errorf("%d reference error(s) found", len(refErrors))
+		return "", false, changes, fmt.Errorf("%d reference error(s) found", len(refErrors))
 	}
 
 	// Parse existing INDEX metadata (hash/modified)
@@ -620,12 +1013,14 @@ func rebuildIndex(filePath string) error {
 	// Auto-update Modified based on content hash changes
 	today := time.Now().Format("2006-01-02")
 	for i := range sections {
-		// Compute current content hash
-		newHash := computeContentHash(sections[i].ContentLines)
+		// Compute current content hash; a stored hash of the other length
+		// still matches, so switching @hashes: does not touch Modified
+		digest := iatf.Digest(sections[i].ContentLines)
+		newHash := header.Hash(digest)
 		meta := indexMeta[sections[i].ID]
 
 		// Compute word count
-		sections[i].WordCount = countWords(sections[i].ContentLines)
+		sections[i].WordCount = header.CountWords(sections[i].ContentLines)
 
 		// Update Created
 		if meta.Created != "" {
@@ -634,8 +1029,13 @@ func rebuildIndex(filePath string) error {
 			sections[i].Created = today
 		}
 
+		if _, known := indexMeta[sections[i].ID]; !known {
+			changes.Added = append(changes.Added, sections[i].ID)
+		}
+
 		// Update Modified
-		if meta.Hash != "" && meta.Hash != newHash {
+		if meta.Hash != "" && !iatf.HashMatches(meta.Hash, digest) {
+			changes.Modified = append(changes.Modified, sections[i].ID)
 			sections[i].Modified = today
 		} else if meta.Hash != "" {
 			sections[i].Modified = meta.Modified
@@ -648,6 +1048,12 @@ func rebuildIndex(filePath string) error {
 		// Update hash for INDEX output
 		sections[i].XHash = newHash
 	}
+	for id := range indexMeta {
+		if !sectionExists(sections, id) {
+			changes.Removed = append(changes.Removed, id)
+		}
+	}
+	sort.Strings(changes.Removed)
 
 	// Find where to insert INDEX
 	headerEnd := -1
@@ -678,7 +1084,7 @@ func rebuildIndex(filePath string) error {
 	}
 
 	if headerEnd == -1 || indexEnd == -1 {
-		return fmt.Errorf("invalid iatf file format")
+		return "", false, changes, fmt.Errorf("invalid iatf file format")
 	}
 
 	// Recalculate indexEnd before rebuild
@@ -690,26 +1096,17 @@ func rebuildIndex(filePath string) error {
 		}
 	}
 	if indexEnd == -1 {
-		return fmt.Errorf("===CONTENT=== section lost after metadata update")
+		return "", false, changes, fmt.Errorf("===CONTENT=== section lost after metadata update")
 	}
 
-	// Recalculate content hash after updates (Git-style 7 chars)
-	contentText := strings.Join(lines[contentStart:], "\n")
-	sum := sha256.Sum256([]byte(contentText))
-	contentHash := hex.EncodeToString(sum[:])[:7]
+	// Recalculate content hash after updates (Git-style 7 chars, unless
+	// the header asks for full hashes)
+	contentHash := header.Hash(iatf.Digest(lines[contentStart:]))
 
 	// Generate new INDEX (two-pass to adjust absolute line numbers)
-	newIndex := generateIndex(sections, contentHash)
-	originalSpan := indexEnd - headerEnd
-	newSpan := len(newIndex) + 1 // index + blank
-	lineDelta := newSpan - originalSpan
-	if lineDelta != 0 {
-		for i := range sections {
-			sections[i].Start += lineDelta
-			sections[i].End += lineDelta
-		}
-		newIndex = generateIndex(sections, contentHash)
-	}
+	summaryWidth := header.WrapWidth()
+	notes := carryIndexNotes(parseIndexNotes(lines), sections)
+	newIndex := generateIndex(sections, contentHash, summaryWidth, notes)
 
 	// Rebuild file (normalize spacing around INDEX)
 	preLines := append([]string{}, lines[:headerEnd]...)
@@ -717,6 +1114,17 @@ func rebuildIndex(filePath string) error {
 		preLines = preLines[:len(preLines)-1]
 	}
 
+	// ===CONTENT=== moves to after the header, a blank, the INDEX and a
+	// blank; the INDEX has as many lines whatever the numbers in it
+	lineDelta := len(preLines) + 1 + len(newIndex) + 1 - indexEnd
+	if lineDelta != 0 {
+		for i := range sections {
+			sections[i].Start += lineDelta
+			sections[i].End += lineDelta
+		}
+		newIndex = generateIndex(sections, contentHash, summaryWidth, notes)
+	}
+
 	postLines := append([]string{}, lines[indexEnd:]...)
 	for len(postLines) > 0 && strings.TrimSpace(postLines[0]) == "" {
 		postLines = postLines[1:]
@@ -731,7 +1139,19 @@ func rebuildIndex(filePath string) error {
 
 	newContent := strings.Join(newLines, "\n")
 
-	return os.WriteFile(filePath, []byte(newContent), 0644)
+	// Leave the file untouched when only the Generated timestamp would change,
+	// so watchers don't see their own rebuild as a fresh edit and loop forever
+	if stripGeneratedLine(newContent) == stripGeneratedLine(content) {
+		return newContent, false, changes, nil
+	}
+	return newContent, true, changes, nil
+}
+
+var generatedLinePattern = regexp.MustCompile(`(?m)^<!-- Generated: [^>]*-->$`)
+
+// stripGeneratedLine blanks the INDEX Generated timestamp for change comparison
+func stripGeneratedLine(content string) string {
+	return generatedLinePattern.ReplaceAllString(content, "")
 }
 
 func rebuildCommand(filePath string) int {
@@ -748,15 +1168,18 @@ func rebuildCommand(filePath string) int {
 	fmt.Printf("Rebuilding index: %s\n", filePath)
 
 	if err := rebuildIndex(filePath); err != nil {
-		fmt.Fprintf(os.Stderr, "[ERROR] Failed to rebuild index: %v\n", err)
+		fmt.Fprintf(os.Stderr, "%s Failed to rebuild index: %v\n", mark(os.Stderr, "[ERROR]"), err)
 		return 1
 	}
 
-	fmt.Println("[OK] Index rebuilt successfully")
+	fmt.Printf("%s Index rebuilt successfully\n", mark(os.Stdout, "[OK]"))
 	return 0
 }
 
-func rebuildAllCommand(directory string) int {
+// rebuildAllCommand rebuilds the INDEX of every .iatf file under directory.
+// Files whose Content-Hash matches their CONTENT are skipped as up to date
+// unless force is set.
+func rebuildAllCommand(directory string, force bool) int {
 	if _, err := os.Stat(directory); os.IsNotExist(err) {
 		fmt.Fprintf(os.Stderr, "Error: Directory not found: %s\n", directory)
 		return 1
@@ -786,17 +1209,30 @@ func rebuildAllCommand(directory string) int {
 	fmt.Printf("Found %d .iatf file(s)\n", len(iatfFiles))
 
 	successCount := 0
+	upToDate := 0
 	for _, file := range iatfFiles {
 		fmt.Printf("\nProcessing: %s\n", file)
+		if !force {
+			if current, err := contentHashCurrent(file); err == nil && current {
+				fmt.Printf("  %s Up to date\n", mark(os.Stdout, "[OK]"))
+				successCount++
+				upToDate++
+				continue
+			}
+		}
 		if err := rebuildIndex(file); err != nil {
-			fmt.Printf("  [ERROR] Failed: %v\n", err)
+			fmt.Printf("  %s Failed: %v\n", mark(os.Stdout, "[ERROR]"), err)
 		} else {
-			fmt.Println("  [OK] Success")
+			fmt.Printf("  %s Success\n", mark(os.Stdout, "[OK]"))
 			successCount++
 		}
 	}
 
-	fmt.Printf("\nCompleted: %d/%d files rebuilt successfully\n", successCount, len(iatfFiles))
+	fmt.Printf("\nCompleted: %d/%d files rebuilt successfully", successCount, len(iatfFiles))
+	if upToDate > 0 {
+		fmt.Printf(" (%d already up to date)", upToDate)
+	}
+	fmt.Println()
 
 	if successCount == len(iatfFiles) {
 		return 0
@@ -809,6 +1245,12 @@ func getWatchStateFile() string {
 	return filepath.Join(home, ".iatf", "watch.json")
 }
 
+// errCorruptWatchState is returned by loadWatchState when watch.json cannot be parsed
+var errCorruptWatchState = errors.New("watch state is corrupt")
+
+// errWatchUnchanged is returned from an updateWatchState callback to skip the save
+var errWatchUnchanged = errors.New("watch state unchanged")
+
 func loadWatchState() (WatchState, error) {
 	stateFile := getWatchStateFile()
 	data, err := os.ReadFile(stateFile)
@@ -820,10 +1262,17 @@ func loadWatchState() (WatchState, error) {
 	}
 
 	var state WatchState
-	err = json.Unmarshal(data, &state)
-	return state, err
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%w (%s): %v", errCorruptWatchState, stateFile, err)
+	}
+	if state == nil {
+		state = make(WatchState)
+	}
+	return state, nil
 }
 
+// saveWatchState writes the state to a temporary file and renames it into
+// place, so readers never observe a partially written watch.json
 func saveWatchState(state WatchState) error {
 	stateFile := getWatchStateFile()
 	os.MkdirAll(filepath.Dir(stateFile), 0755)
@@ -833,7 +1282,101 @@ func saveWatchState(state WatchState) error {
 		return err
 	}
 
-	return os.WriteFile(stateFile, data, 0644)
+	tmpFile := fmt.Sprintf("%s.%d.tmp", stateFile, os.Getpid())
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, stateFile); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
+
+// salvageWatchState recovers the entries that precede the first syntax error
+// in a damaged watch.json (typically a truncated write from an older version)
+func salvageWatchState(data []byte) WatchState {
+	state := make(WatchState)
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return state
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		key, ok := token.(string)
+		if !ok {
+			break
+		}
+		var info WatchInfo
+		if err := decoder.Decode(&info); err != nil {
+			break
+		}
+		state[key] = info
+	}
+	return state
+}
+
+// updateWatchState applies fn to the watch state while holding an exclusive
+// lock on watch.json.lock, so concurrent watchers cannot clobber each other's
+// entries. The state is saved when fn returns nil. A corrupt watch.json is
+// moved aside to watch.json.corrupt and replaced with whatever entries could
+// be salvaged from it.
+func updateWatchState(fn func(state WatchState) error) error {
+	stateFile := getWatchStateFile()
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0755); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(stateFile+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock watch state: %w", err)
+	}
+	defer unlockFile(lock)
+
+	recovered := false
+	state, err := loadWatchState()
+	if errors.Is(err, errCorruptWatchState) {
+		backup := stateFile + ".corrupt"
+		data, _ := os.ReadFile(stateFile)
+		state, err, recovered = salvageWatchState(data), nil, true
+		os.Rename(stateFile, backup)
+		fmt.Fprintf(os.Stderr, "Warning: %s was corrupt; recovered %d entries, original saved as %s\n", stateFile, len(state), backup)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := fn(state); err != nil {
+		if recovered {
+			saveWatchState(state)
+		}
+		return err
+	}
+	return saveWatchState(state)
+}
+
+// readWatchState loads the watch state for display, repairing a corrupt
+// watch.json first so read-only commands are not stuck on it
+func readWatchState() (WatchState, error) {
+	state, err := loadWatchState()
+	if !errors.Is(err, errCorruptWatchState) {
+		return state, err
+	}
+	err = updateWatchState(func(s WatchState) error {
+		state = s
+		return errWatchUnchanged
+	})
+	if err != nil && !errors.Is(err, errWatchUnchanged) {
+		return nil, err
+	}
+	return state, nil
 }
 
 func promptUserConfirmation(message string, defaultValue bool) bool {
@@ -843,8 +1386,7 @@ func promptUserConfirmation(message string, defaultValue bool) bool {
 	}
 
 	// Check if stdin is a terminal
-	stat, _ := os.Stdin.Stat()
-	if (stat.Mode() & os.ModeCharDevice) == 0 {
+	if !isTerminal(os.Stdin) {
 		// Not a terminal - return default to avoid hanging in CI/scripts
 		return defaultValue
 	}
@@ -864,43 +1406,263 @@ func promptUserConfirmation(message string, defaultValue bool) bool {
 	return response == "y" || response == "yes"
 }
 
-func checkWatchedFile(filePath string) bool {
+// resolveWatchPath returns the key of path in the watch state: its absolute
+// path with symlinks resolved, so a file watched through a link and through
+// its target is the same watch. A path that does not resolve (it no longer
+// exists) is only made absolute.
+func resolveWatchPath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
+		return resolved, nil
+	}
+	return absPath, nil
+}
+
+// findActiveWatch returns the live watch entry covering absPath: either a
+// watch on the file itself or a directory/daemon watch on one of its parents.
+// Entries without a PID (old format) or with a dead PID are ignored.
+func findActiveWatch(state WatchState, absPath string) (string, WatchInfo, bool) {
+	for candidate := absPath; ; {
+		if info, exists := state[candidate]; exists && info.isLive() {
+			if candidate == absPath || info.kind() != watchKindFile {
+				return candidate, info, true
+			}
+		}
+		parent := filepath.Dir(candidate)
+		if parent == candidate {
+			return "", WatchInfo{}, false
+		}
+		candidate = parent
+	}
+}
+
+// registerWatch records a watch entry for absPath owned by the current process
+func registerWatch(absPath string, info WatchInfo) error {
+	if info.Host == "" {
+		info.Host = currentHost()
+	}
+	return updateWatchState(func(state WatchState) error {
+		state[absPath] = info
+		return nil
+	})
+}
+
+// unregisterWatch removes the watch entry for absPath if it is still owned by pid
+func unregisterWatch(absPath string, pid int) {
+	updateWatchState(func(state WatchState) error {
+		if info, exists := state[absPath]; !exists || info.PID != pid {
+			return errWatchUnchanged
+		}
+		delete(state, absPath)
+		return nil
+	})
+}
+
+// isWatchRegistered reports whether absPath still has a watch entry; a missing
+// entry means 'iatf unwatch' asked the owning process to stop
+func isWatchRegistered(absPath string) bool {
+	registered, _ := watchEntryStatus(absPath)
+	return registered
+}
+
+// watchEntryStatus reports whether absPath has a watch entry and whether that
+// entry is paused. Unreadable state is treated as registered and running.
+func watchEntryStatus(absPath string) (registered bool, paused bool) {
 	state, err := loadWatchState()
 	if err != nil {
-		return true
+		return true, false
 	}
+	info, exists := state[absPath]
+	return exists, exists && info.Paused
+}
+
+// setWatchPaused toggles the paused flag on the watch entry for absPath
+func setWatchPaused(absPath string, paused bool) error {
+	return updateWatchState(func(state WatchState) error {
+		info, exists := state[absPath]
+		if !exists {
+			return fmt.Errorf("path is not being watched: %s", absPath)
+		}
+		info.Paused = paused
+		state[absPath] = info
+		return nil
+	})
+}
 
-	absPath, err := filepath.Abs(filePath)
+// watchPauseCommand pauses or resumes auto-rebuilds for a watched file or directory
+func watchPauseCommand(path string, paused bool) int {
+	absPath, err := resolveWatchPath(path)
 	if err != nil {
-		return true
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
 	}
 
+	state, err := readWatchState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading watch state: %v\n", err)
+		return 1
+	}
 	info, exists := state[absPath]
 	if !exists {
+		if watchedPath, _, covered := findActiveWatch(state, absPath); covered {
+			fmt.Printf("Path is covered by the watch on %s; pause that path instead\n", watchedPath)
+		} else {
+			fmt.Printf("Path is not being watched: %s\n", path)
+		}
+		return 1
+	}
+	if info.kind() == watchKindDaemon {
+		action := "resume"
+		if paused {
+			action = "pause"
+		}
+		fmt.Printf("Path is watched by the daemon; use 'iatf daemon %s %s'\n", action, path)
+		return 1
+	}
+
+	if err := setWatchPaused(absPath, paused); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving watch state: %v\n", err)
+		return 1
+	}
+	if paused {
+		fmt.Printf("Paused auto-rebuilds: %s\n", path)
+	} else {
+		fmt.Printf("Resumed auto-rebuilds: %s\n", path)
+	}
+	return 0
+}
+
+// daemonPauseCommand pauses or resumes daemon watch paths (all when none given)
+func daemonPauseCommand(paths []string, paused bool) int {
+	command := daemonCmdResume
+	if paused {
+		command = daemonCmdPause
+	}
+	if targets, err := absPaths(paths); err == nil {
+		if code, ok := runDaemonRequest(daemonRequest{Command: command, Paths: targets}); ok {
+			return code
+		}
+	}
+
+	// No daemon listening: update the watch state directly
+	state, err := readWatchState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading watch state: %v\n", err)
+		return 1
+	}
+
+	targets := []string{}
+	for _, p := range paths {
+		absPath, err := resolveWatchPath(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if info, exists := state[absPath]; !exists || info.kind() != watchKindDaemon {
+			fmt.Printf("Path is not a daemon watch path: %s\n", p)
+			return 1
+		}
+		targets = append(targets, absPath)
+	}
+	if len(targets) == 0 {
+		for path, info := range state {
+			if info.kind() == watchKindDaemon {
+				targets = append(targets, path)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Println("Daemon is not watching any paths")
+		return 1
+	}
+
+	sort.Strings(targets)
+	for _, absPath := range targets {
+		if err := setWatchPaused(absPath, paused); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving watch state: %v\n", err)
+			return 1
+		}
+		if paused {
+			fmt.Printf("Paused auto-rebuilds: %s\n", absPath)
+		} else {
+			fmt.Printf("Resumed auto-rebuilds: %s\n", absPath)
+		}
+	}
+	return 0
+}
+
+func checkWatchedFile(filePath string) bool {
+	state, err := loadWatchState()
+	if err != nil {
+		return true
+	}
+
+	absPath, err := resolveWatchPath(filePath)
+	if err != nil {
 		return true
 	}
 
-	// If no PID field (old format) or PID is not running, proceed
-	if info.PID == 0 || !isProcessRunning(info.PID) {
+	watchedPath, info, exists := findActiveWatch(state, absPath)
+	if !exists {
 		return true
 	}
 
 	// File is being watched by a running process
-	fmt.Printf("\nWarning: This file is being watched by another process (PID %d)\n", info.PID)
+	switch info.kind() {
+	case watchKindDir:
+		fmt.Printf("\nWarning: This file is inside a directory watched by another process (PID %d)\n", info.PID)
+	case watchKindDaemon:
+		fmt.Printf("\nWarning: This file is inside a path watched by the daemon (PID %d)\n", info.PID)
+	default:
+		fmt.Printf("\nWarning: This file is being watched by another process (PID %d)\n", info.PID)
+	}
 	fmt.Println("A manual rebuild will trigger an automatic rebuild from the watch process.")
 	fmt.Println("This will cause the file to be rebuilt twice.")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  - Press 'y' to proceed with manual rebuild anyway")
 	fmt.Println("  - Press 'N' (default) to cancel")
-	fmt.Printf("  - Run 'iatf unwatch %s' to stop watching first\n", filePath)
+	if info.kind() == watchKindDaemon {
+		fmt.Println("  - Run 'iatf daemon stop' to stop the daemon first")
+	} else {
+		fmt.Printf("  - Run 'iatf unwatch %s' to stop watching first\n", watchedPath)
+	}
 	fmt.Println()
 
 	return promptUserConfirmation("Continue with manual rebuild", false)
 }
 
-func watchCommand(filePath string, debug bool) int {
-	absPath, err := filepath.Abs(filePath)
+// alreadyWatched reports, and prints, whether another live process watches
+// absPath itself, which may have been given through a symlink as path
+func alreadyWatched(absPath string, path string) bool {
+	state, err := loadWatchState()
+	if err != nil {
+		return false
+	}
+	info, exists := state[absPath]
+	if !exists || !info.isLive() || info.PID == os.Getpid() {
+		return false
+	}
+	if literal, _ := filepath.Abs(path); literal != absPath {
+		fmt.Fprintf(os.Stderr, "Error: %s (%s) is already being watched (PID %d)\n", path, absPath, info.PID)
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %s is already being watched (PID %d)\n", path, info.PID)
+	}
+	if info.kind() == watchKindDaemon {
+		fmt.Fprintln(os.Stderr, "Run 'iatf daemon stop' to stop the daemon first")
+	} else {
+		fmt.Fprintf(os.Stderr, "Run 'iatf unwatch %s' to stop watching first\n", path)
+	}
+	return true
+}
+
+func watchCommand(filePath string, opts watchOptions) int {
+	debug := opts.Debug
+
+	absPath, err := resolveWatchPath(filePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
@@ -910,44 +1672,32 @@ func watchCommand(filePath string, debug bool) int {
 		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
 		return 1
 	}
-
-	state, err := loadWatchState()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading watch state: %v\n", err)
+	if alreadyWatched(absPath, filePath) {
 		return 1
 	}
 
 	pid := os.Getpid()
 	info, _ := os.Stat(absPath)
-	state[absPath] = WatchInfo{
+	err = registerWatch(absPath, WatchInfo{
 		Started:      time.Now().Format(time.RFC3339),
 		LastModified: float64(info.ModTime().Unix()),
 		PID:          pid,
-	}
-
-	if err := saveWatchState(state); err != nil {
+		Kind:         watchKindFile,
+	})
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error saving watch state: %v\n", err)
 		return 1
 	}
 
 	// Cleanup function to remove PID from watch state
 	cleanupPID := func() {
-		currentState, err := loadWatchState()
-		if err != nil {
-			return
-		}
-		if watchInfo, exists := currentState[absPath]; exists {
-			// Only remove if it's still our PID
-			if watchInfo.PID == pid {
-				delete(currentState, absPath)
-				saveWatchState(currentState)
-			}
-		}
+		unregisterWatch(absPath, pid)
 	}
 
 	// Setup signal handling for cleanup
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	kickChan := notifyRebuildSignals()
 
 	fmt.Printf("Watching: %s\n", filePath)
 
@@ -957,30 +1707,102 @@ func watchCommand(filePath string, debug bool) int {
 
 	var debounceTimer *time.Timer
 	var timerMu sync.Mutex
+	wasPaused := false
+
+	// onceDone receives the result of the first processed change in --once mode
+	onceDone := make(chan bool, 1)
+	var timeoutChan <-chan time.Time
+	if opts.Timeout > 0 {
+		timeoutChan = time.After(opts.Timeout)
+	}
+
+	// Rebuilds go through a queue so a change made while the file is being
+	// rebuilt queues one more rebuild instead of running a second alongside
+	scheduler := newRebuildScheduler(func(path string) {
+		ok := processFileForWatch(path, debug, opts.Hooks)
+		if opts.Once {
+			select {
+			case onceDone <- ok:
+			default:
+			}
+		}
+	})
+	scheduler.log = watchSchedulerLog(debug)
+	stopScheduler := make(chan struct{})
+	defer close(stopScheduler)
+	go scheduler.run(stopScheduler)
+
+	stopTimer := func() {
+		timerMu.Lock()
+		if debounceTimer != nil {
+			debounceTimer.Stop()
+		}
+		timerMu.Unlock()
+		scheduler.drop(func(string) bool { return true })
+	}
 
 	for {
 		select {
 		case <-sigChan:
-			timerMu.Lock()
-			if debounceTimer != nil {
-				debounceTimer.Stop()
-			}
-			timerMu.Unlock()
+			stopTimer()
 			cleanupPID()
 			if debug {
 				fmt.Println("\nWatch stopped")
 			}
 			return 0
+		case <-timeoutChan:
+			stopTimer()
+			cleanupPID()
+			if opts.Once {
+				fmt.Fprintf(os.Stderr, "Timed out after %s waiting for changes: %s\n", opts.Timeout, filePath)
+				return watchExitTimeout
+			}
+			if debug {
+				fmt.Println("\nWatch stopped (timeout)")
+			}
+			return 0
+		case ok := <-onceDone:
+			cleanupPID()
+			return watchOnceResult(ok)
+		case <-kickChan:
+			stopTimer()
+			if debug {
+				fmt.Printf("[%s] Rebuild requested\n", filepath.Base(absPath))
+			}
+			ok := processFileForWatch(absPath, debug, opts.Hooks)
+			if opts.Once {
+				cleanupPID()
+				return watchOnceResult(ok)
+			}
+			if currentInfo, err := os.Stat(absPath); err == nil {
+				lastMod = currentInfo.ModTime()
+			}
 		case <-ticker.C:
-			state, err := loadWatchState()
-			if err == nil {
-				if _, exists := state[absPath]; !exists {
-					if debug {
-						fmt.Printf("\nWatch stopped via unwatch: %s\n", filePath)
+			registered, paused := watchEntryStatus(absPath)
+			if !registered {
+				if debug {
+					fmt.Printf("\nWatch stopped via unwatch: %s\n", filePath)
+				}
+				return 0
+			}
+			if paused != wasPaused {
+				wasPaused = paused
+				if paused {
+					stopTimer()
+				}
+				if debug {
+					if paused {
+						fmt.Printf("[%s] Paused\n", filepath.Base(absPath))
+					} else {
+						fmt.Printf("[%s] Resumed\n", filepath.Base(absPath))
 					}
-					return 0
 				}
 			}
+			if paused {
+				// Leave lastMod untouched so edits made while paused
+				// trigger a rebuild once the watch resumes
+				continue
+			}
 
 			currentInfo, err := os.Stat(absPath)
 			if err != nil {
@@ -1002,7 +1824,7 @@ func watchCommand(filePath string, debug bool) int {
 					debounceTimer.Stop()
 				}
 				debounceTimer = time.AfterFunc(3*time.Second, func() {
-					processFileForWatch(absPath, debug)
+					scheduler.enqueue(absPath)
 				})
 				timerMu.Unlock()
 			}
@@ -1010,81 +1832,327 @@ func watchCommand(filePath string, debug bool) int {
 	}
 }
 
-// processFileForWatch validates and rebuilds a single file
-func processFileForWatch(filePath string, debug bool) {
-	valid, errors := validateFileQuiet(filePath)
-	if !valid {
-		if debug {
-			fmt.Printf("[%s] Validation failed:\n", filepath.Base(filePath))
+// notifyRebuildSignals returns a channel that receives the platform's
+// rebuild-now signal (SIGUSR1 on Unix). On Windows the channel never fires.
+func notifyRebuildSignals() chan os.Signal {
+	kickChan := make(chan os.Signal, 1)
+	if len(rebuildSignals) > 0 {
+		signal.Notify(kickChan, rebuildSignals...)
+	}
+	return kickChan
+}
+
+// watchHooks holds shell commands run after automatic rebuild attempts
+type watchHooks struct {
+	OnSuccess string // run after the INDEX was rewritten
+	OnFailure string // run when validation or rebuild fails
+	Notify    bool   // raise a desktop notification when a file starts failing
+}
+
+// watchOptions holds the flags shared by watch and watch-dir
+type watchOptions struct {
+	Debug    bool
+	Excludes []string
+	Symlinks string // symlink policy for watch-dir scans
+	Hooks    watchHooks
+	Once     bool          // exit after the first processed change
+	Timeout  time.Duration // stop watching after this long (0 = no limit)
+
+	MaxConcurrent int // watch-dir files rebuilt at the same time (0 = default)
+}
+
+// Exit codes for 'watch --once'
+const (
+	watchExitRebuilt = 0 // change processed successfully
+	watchExitFailed  = 1 // validation or rebuild failed
+	watchExitTimeout = 2 // no change before --timeout elapsed
+)
+
+// parseWatchOptions parses the flags that follow the watched path
+func parseWatchOptions(args []string, allowExclude bool) (watchOptions, error) {
+	opts := watchOptions{Symlinks: symlinksFiles}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		needsValue := arg == "--exec" || arg == "--on-failure" || arg == "--timeout" || (allowExclude && (arg == "--exclude" || arg == "--symlinks" || arg == "--max-concurrent"))
+		if needsValue && i+1 >= len(args) {
+			return opts, fmt.Errorf("missing value for %s", arg)
+		}
+		switch {
+		case arg == "--debug":
+			opts.Debug = true
+		case arg == "--once":
+			opts.Once = true
+		case arg == "--notify":
+			opts.Hooks.Notify = true
+		case arg == "--timeout":
+			i++
+			timeout, err := parseDurationArg(args[i])
+			if err != nil {
+				return opts, fmt.Errorf("invalid --timeout value %q (use seconds or a duration like 90s, 5m)", args[i])
+			}
+			opts.Timeout = timeout
+		case arg == "--exec":
+			i++
+			opts.Hooks.OnSuccess = args[i]
+		case arg == "--on-failure":
+			i++
+			opts.Hooks.OnFailure = args[i]
+		case allowExclude && arg == "--exclude":
+			i++
+			opts.Excludes = append(opts.Excludes, args[i])
+		case allowExclude && arg == "--symlinks":
+			i++
+			policy, err := parseSymlinkPolicy(args[i])
+			if err != nil {
+				return opts, err
+			}
+			opts.Symlinks = policy
+		case allowExclude && arg == "--max-concurrent":
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("invalid --max-concurrent value %q (expected a positive number)", args[i])
+			}
+			opts.MaxConcurrent = n
+		default:
+			return opts, fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+	return opts, nil
+}
+
+// parseDurationArg parses a positive duration given either as Go duration
+// syntax ("90s", "5m") or as a plain number of seconds
+func parseDurationArg(value string) (time.Duration, error) {
+	var seconds float64
+	if _, err := fmt.Sscanf(value, "%g", &seconds); err == nil && fmt.Sprint(seconds) == strings.TrimLeft(value, "+") {
+		value = fmt.Sprintf("%gs", seconds)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+	return d, nil
+}
+
+// runWatchHook runs a hook command through the shell. The file path is exposed
+// as IATF_FILE (and replaces any {file} placeholder), the outcome as IATF_EVENT,
+// and failure details as IATF_ERROR.
+func runWatchHook(command string, filePath string, event string, errorText string, debug bool) {
+	if command == "" {
+		return
+	}
+	command = strings.ReplaceAll(command, "{file}", shellQuote(filePath))
+	cmd := shellCommand(command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"IATF_FILE="+filePath,
+		"IATF_EVENT="+event,
+		"IATF_ERROR="+errorText,
+	)
+	if err := cmd.Run(); err != nil && debug {
+		fmt.Printf("[%s] Hook failed: %v\n", filepath.Base(filePath), err)
+	}
+}
+
+// processFileForWatch validates and rebuilds a single file, then runs the
+// matching hook. Rebuilds that leave the file unchanged do not fire hooks.
+func processFileForWatch(filePath string, debug bool, hooks watchHooks) bool {
+	errors := rebuildBlockers(filePath)
+	if len(errors) > 0 {
+		if debug {
+			fmt.Printf("[%s] Validation failed:\n", filepath.Base(filePath))
 			for _, e := range errors {
 				fmt.Printf("  - %s\n", e)
 			}
 		}
-		return
+		runWatchHook(hooks.OnFailure, filePath, "validation-failed", strings.Join(errors, "\n"), debug)
+		if hooks.Notify {
+			notifyFailure(filePath, "Validation failed", summarizeProblems(errors))
+		}
+		return false
 	}
-	if err := rebuildIndex(filePath); err != nil {
+	changed, err := rebuildIndexIfChanged(filePath)
+	if err != nil {
 		if debug {
 			fmt.Printf("[%s] Rebuild failed: %v\n", filepath.Base(filePath), err)
 		}
-		return
+		runWatchHook(hooks.OnFailure, filePath, "rebuild-failed", err.Error(), debug)
+		if hooks.Notify {
+			notifyFailure(filePath, "Rebuild failed", err.Error())
+		}
+		return false
+	}
+	clearFailureNotice(filePath)
+	if !changed {
+		if debug {
+			fmt.Printf("[%s] Index up to date\n", filepath.Base(filePath))
+		}
+		return true
 	}
 	if debug {
 		fmt.Printf("[%s] Index rebuilt\n", filepath.Base(filePath))
 	}
+	runWatchHook(hooks.OnSuccess, filePath, "rebuilt", "", debug)
+	return true
 }
 
-func unwatchCommand(filePath string) int {
-	absPath, _ := filepath.Abs(filePath)
-
-	state, err := loadWatchState()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading watch state: %v\n", err)
-		return 1
+// watchOnceResult converts the outcome of a --once watch into an exit code
+func watchOnceResult(ok bool) int {
+	if ok {
+		return watchExitRebuilt
 	}
+	return watchExitFailed
+}
 
-	if _, exists := state[absPath]; exists {
-		delete(state, absPath)
-		if err := saveWatchState(state); err != nil {
-			fmt.Fprintf(os.Stderr, "Error saving watch state: %v\n", err)
-			return 1
+func unwatchCommand(filePath string) int {
+	absPath, _ := resolveWatchPath(filePath)
+
+	var daemonPID int
+	found := false
+	err := updateWatchState(func(state WatchState) error {
+		info, exists := state[absPath]
+		if !exists {
+			return errWatchUnchanged
 		}
-		fmt.Printf("Stopped watching: %s\n", filePath)
-		return 0
+		found = true
+		if info.kind() == watchKindDaemon && info.isLive() {
+			daemonPID = info.PID
+			return errWatchUnchanged
+		}
+		delete(state, absPath)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errWatchUnchanged) {
+		fmt.Fprintf(os.Stderr, "Error updating watch state: %v\n", err)
+		return 1
 	}
 
-	fmt.Printf("File is not being watched: %s\n", filePath)
-	return 1
+	if !found {
+		fmt.Printf("Path is not being watched: %s\n", filePath)
+		return 1
+	}
+	if daemonPID != 0 {
+		fmt.Printf("Path is watched by the daemon (PID %d): %s\n", daemonPID, filePath)
+		fmt.Printf("Remove it from %s or run 'iatf daemon stop'\n", getDaemonConfigPath())
+		return 1
+	}
+	fmt.Printf("Stopped watching: %s\n", filePath)
+	return 0
 }
 
 func listWatched() int {
-	state, err := loadWatchState()
+	state, err := readWatchState()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading watch state: %v\n", err)
 		return 1
 	}
 
 	if len(state) == 0 {
-		fmt.Println("No files are being watched")
+		fmt.Println("No paths are being watched")
 		return 0
 	}
 
-	fmt.Printf("Watching %d file(s):\n\n", len(state))
-	for path, info := range state {
+	paths := make([]string, 0, len(state))
+	for path := range state {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	fmt.Printf("Watching %d path(s):\n\n", len(state))
+	for _, path := range paths {
+		info := state[path]
+		status := "running"
+		if !info.isLocal() {
+			status = "on " + info.Host
+		} else if !info.isLive() {
+			status = "stale"
+		}
 		fmt.Printf("  %s\n", path)
+		fmt.Printf("    Type:  %s\n", info.kind())
+		if info.Paused {
+			fmt.Println("    State: paused")
+		}
+		if info.PID != 0 {
+			fmt.Printf("    PID:   %d (%s)\n", info.PID, status)
+		}
 		fmt.Printf("    Since: %s\n", info.Started)
 	}
 
 	return 0
 }
 
+// defaultExcludePatterns lists directories that directory scans never descend into
+var defaultExcludePatterns = []string{".git", ".hg", ".svn", "node_modules", "vendor", ".venv", "__pycache__"}
+
+// isExcludedPath reports whether a path matches any exclude glob. Patterns are
+// matched against the base name and against the slash-separated path relative
+// to root, so both "node_modules" and "docs/drafts/*" work.
+func isExcludedPath(root string, target string, patterns []string) bool {
+	name := filepath.Base(target)
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		rel = target
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, rel); matched {
+			return true
+		}
+		if strings.HasPrefix(rel, pattern+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Symlink policies for directory scans (--symlinks, "symlinks" in daemon.json)
+const (
+	symlinksFiles  = "files"  // follow symlinked files, skip symlinked directories (default)
+	symlinksFollow = "follow" // follow symlinked files and directories
+	symlinksIgnore = "ignore" // skip all symlinks
+)
+
+// parseSymlinkPolicy validates a symlink policy, defaulting to symlinksFiles
+func parseSymlinkPolicy(value string) (string, error) {
+	switch value {
+	case "":
+		return symlinksFiles, nil
+	case symlinksFiles, symlinksFollow, symlinksIgnore:
+		return value, nil
+	}
+	return symlinksFiles, fmt.Errorf("invalid symlink policy %q (expected files, follow or ignore)", value)
+}
+
+// walkIATFFiles calls fn for every .iatf file under root, skipping excluded
+// directories entirely and ignoring excluded files. Symlinks are handled
+// according to symlinks; followed directories are reported under their link
+// path, and a directory already visited through another path (a symlink loop
+// or a second link to the same tree) is not scanned again.
+func walkIATFFiles(root string, excludes []string, symlinks string, fn func(path string, info os.FileInfo)) {
+	newDirScanner().walk(root, excludes, symlinks, fn)
+}
+
 // fileState tracks per-file debounce state for directory watching
 type fileState struct {
 	lastModTime time.Time
-	timer       *time.Timer
+	timer       *time.Timer // pending debounce, nil once it has fired
+	scan        uint64      // last daemon scan that saw the file
 }
 
-func watchDirCommand(dirPath string, debug bool) int {
-	absDir, err := filepath.Abs(dirPath)
+func watchDirCommand(dirPath string, opts watchOptions) int {
+	debug := opts.Debug
+
+	absDir, err := resolveWatchPath(dirPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
@@ -1099,19 +2167,20 @@ func watchDirCommand(dirPath string, debug bool) int {
 		fmt.Fprintf(os.Stderr, "Error: Not a directory: %s\n", dirPath)
 		return 1
 	}
+	if alreadyWatched(absDir, dirPath) {
+		return 1
+	}
 
 	files := make(map[string]*fileState)
 	var filesMu sync.Mutex
 
+	excludes := append(append([]string{}, defaultExcludePatterns...), opts.Excludes...)
+
 	// Initial scan to find all .iatf files
 	var watchedFiles []string
-	filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
-		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".iatf") {
-			watchedFiles = append(watchedFiles, path)
-			stat, _ := os.Stat(path)
-			files[path] = &fileState{lastModTime: stat.ModTime()}
-		}
-		return nil
+	walkIATFFiles(absDir, excludes, opts.Symlinks, func(path string, stat os.FileInfo) {
+		watchedFiles = append(watchedFiles, path)
+		files[path] = &fileState{lastModTime: stat.ModTime()}
 	})
 
 	if len(watchedFiles) == 0 {
@@ -1119,6 +2188,17 @@ func watchDirCommand(dirPath string, debug bool) int {
 		return 0
 	}
 
+	pid := os.Getpid()
+	err = registerWatch(absDir, WatchInfo{
+		Started: time.Now().Format(time.RFC3339),
+		PID:     pid,
+		Kind:    watchKindDir,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving watch state: %v\n", err)
+		return 1
+	}
+
 	fmt.Println("Watching:")
 	for _, f := range watchedFiles {
 		fmt.Printf("  %s\n", f)
@@ -1127,35 +2207,159 @@ func watchDirCommand(dirPath string, debug bool) int {
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	kickChan := notifyRebuildSignals()
 
 	ticker := time.NewTicker(250 * time.Millisecond)
 	defer ticker.Stop()
+	// Polls reuse the listings of directories that have not changed
+	scanner := newDirScanner()
+
+	// In --once mode, wait until every debounced rebuild started by the
+	// first batch of changes has finished, then report the combined result.
+	// pending (debounce timers not yet fired) and onceOK are guarded by
+	// filesMu.
+	onceDone := make(chan bool, 1)
+	pending := 0
+	onceOK := true
+	var timeoutChan <-chan time.Time
+	if opts.Timeout > 0 {
+		timeoutChan = time.After(opts.Timeout)
+	}
+
+	// Fired timers queue their file, so a burst of changes is rebuilt a few
+	// files at a time rather than all at once
+	scheduler := newRebuildScheduler(func(path string) {
+		ok := processFileForWatch(path, debug, opts.Hooks)
+		filesMu.Lock()
+		if !ok {
+			onceOK = false
+		}
+		filesMu.Unlock()
+	})
+	if opts.MaxConcurrent > 0 {
+		scheduler.maxConcurrent = opts.MaxConcurrent
+	}
+	scheduler.log = watchSchedulerLog(debug)
+	// reportOnce must be called with filesMu held
+	reportOnce := func() {
+		if opts.Once && pending == 0 && scheduler.idle() {
+			select {
+			case onceDone <- onceOK:
+			default:
+			}
+		}
+	}
+	scheduler.onIdle = func() {
+		filesMu.Lock()
+		defer filesMu.Unlock()
+		reportOnce()
+	}
+	stopScheduler := make(chan struct{})
+	defer close(stopScheduler)
+	go scheduler.run(stopScheduler)
+
+	stopTimers := func() {
+		filesMu.Lock()
+		for _, state := range files {
+			if state.timer != nil {
+				if state.timer.Stop() {
+					pending--
+				}
+				state.timer = nil
+			}
+		}
+		filesMu.Unlock()
+		scheduler.drop(func(string) bool { return true })
+	}
+	wasPaused := false
 
 	for {
 		select {
 		case <-sigChan:
-			filesMu.Lock()
-			for _, state := range files {
-				if state.timer != nil {
-					state.timer.Stop()
-				}
-			}
-			filesMu.Unlock()
+			stopTimers()
+			unregisterWatch(absDir, pid)
 			if debug {
 				fmt.Println("\nWatch stopped")
 			}
 			return 0
-		case <-ticker.C:
-			filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
-				if err != nil || d.IsDir() || !strings.HasSuffix(path, ".iatf") {
-					return nil
+		case <-timeoutChan:
+			stopTimers()
+			unregisterWatch(absDir, pid)
+			if opts.Once {
+				fmt.Fprintf(os.Stderr, "Timed out after %s waiting for changes: %s\n", opts.Timeout, dirPath)
+				return watchExitTimeout
+			}
+			if debug {
+				fmt.Println("\nWatch stopped (timeout)")
+			}
+			return 0
+		case ok := <-onceDone:
+			stopTimers()
+			unregisterWatch(absDir, pid)
+			return watchOnceResult(ok)
+		case <-kickChan:
+			if debug {
+				fmt.Println("Rebuild requested, rescanning...")
+			}
+			walkIATFFiles(absDir, excludes, opts.Symlinks, func(path string, stat os.FileInfo) {
+				filesMu.Lock()
+				state, exists := files[path]
+				if !exists {
+					state = &fileState{}
+					files[path] = state
+				}
+				if state.timer != nil {
+					if state.timer.Stop() {
+						pending--
+					}
+					state.timer = nil
 				}
+				filesMu.Unlock()
+				scheduler.drop(func(p string) bool { return p == path })
 
-				stat, statErr := os.Stat(path)
-				if statErr != nil {
-					return nil
+				ok := processFileForWatch(path, debug, opts.Hooks)
+
+				filesMu.Lock()
+				if !ok {
+					onceOK = false
+				}
+				if current, err := os.Stat(path); err == nil {
+					state.lastModTime = current.ModTime()
+				}
+				filesMu.Unlock()
+			})
+			if opts.Once {
+				stopTimers()
+				unregisterWatch(absDir, pid)
+				return watchOnceResult(onceOK)
+			}
+		case <-ticker.C:
+			registered, paused := watchEntryStatus(absDir)
+			if !registered {
+				stopTimers()
+				if debug {
+					fmt.Printf("\nWatch stopped via unwatch: %s\n", dirPath)
+				}
+				return 0
+			}
+			if paused != wasPaused {
+				wasPaused = paused
+				if paused {
+					stopTimers()
+				}
+				if debug {
+					if paused {
+						fmt.Println("Paused")
+					} else {
+						fmt.Println("Resumed")
+					}
 				}
+			}
+			if paused {
+				continue
+			}
 
+			scanner.walk(absDir, excludes, opts.Symlinks, func(path string, stat os.FileInfo) {
 				filesMu.Lock()
 				state, exists := files[path]
 
@@ -1166,7 +2370,7 @@ func watchDirCommand(dirPath string, debug bool) int {
 					if debug {
 						fmt.Printf("New file detected: %s\n", path)
 					}
-					return nil
+					return
 				}
 
 				if stat.ModTime().After(state.lastModTime) {
@@ -1175,25 +2379,31 @@ func watchDirCommand(dirPath string, debug bool) int {
 						fmt.Printf("[%s] Change detected, waiting 3s...\n", filepath.Base(path))
 					}
 
-					if state.timer != nil {
-						state.timer.Stop()
+					if state.timer == nil || !state.timer.Stop() {
+						pending++
 					}
 					pathCopy := path // Capture for closure
 					state.timer = time.AfterFunc(3*time.Second, func() {
-						processFileForWatch(pathCopy, debug)
+						// Queue before counting the timer as fired, so
+						// --once never sees a moment with nothing outstanding
+						scheduler.enqueue(pathCopy)
+						filesMu.Lock()
+						defer filesMu.Unlock()
+						pending--
+						reportOnce()
 					})
 				}
 				filesMu.Unlock()
-				return nil
 			})
 
 			// Check for deleted files
 			filesMu.Lock()
 			for path, state := range files {
 				if _, err := os.Stat(path); os.IsNotExist(err) {
-					if state.timer != nil {
-						state.timer.Stop()
+					if state.timer != nil && state.timer.Stop() {
+						pending--
 					}
+					scheduler.drop(func(p string) bool { return p == path })
 					delete(files, path)
 					if debug {
 						fmt.Printf("Stopped watching (deleted): %s\n", path)
@@ -1207,7 +2417,97 @@ func watchDirCommand(dirPath string, debug bool) int {
 
 // DaemonConfig holds the daemon configuration
 type DaemonConfig struct {
-	WatchPaths []string `json:"watch_paths"`
+	WatchPaths    []string `json:"watch_paths"`
+	Exclude       []string `json:"exclude,omitempty"`
+	Symlinks      string   `json:"symlinks,omitempty"`         // files (default), follow or ignore
+	LogMaxSizeMB  int      `json:"log_max_size_mb,omitempty"`  // rotate daemon.log above this size (default 10)
+	LogMaxAgeDays int      `json:"log_max_age_days,omitempty"` // also rotate after this many days (default off)
+	LogMaxFiles   int      `json:"log_max_files,omitempty"`    // rotated logs to keep (default 5)
+	MetricsAddr   string   `json:"metrics_addr,omitempty"`     // serve /healthz and /metrics here (e.g. "127.0.0.1:9464")
+	LogFormat     string   `json:"log_format,omitempty"`       // text (default) or json
+	LogLevel      string   `json:"log_level,omitempty"`        // debug, info (default), warn or error
+
+	Notify bool `json:"notify,omitempty"` // desktop notification when a file starts failing
+
+	WebhookURL    string `json:"webhook_url,omitempty"`    // POST rebuild results here
+	WebhookSecret string `json:"webhook_secret,omitempty"` // sign payloads with HMAC-SHA256
+
+	MaxConcurrentRebuilds int `json:"max_concurrent_rebuilds,omitempty"` // default 2
+	BurstThreshold        int `json:"burst_threshold,omitempty"`         // queued files that count as a burst (default 20)
+	BurstWindowMS         int `json:"burst_window_ms,omitempty"`         // quiet time before a burst is processed (default 2000)
+
+	ShutdownGraceSeconds int `json:"shutdown_grace_seconds,omitempty"` // time to finish pending rebuilds on stop (default 10)
+
+	MaxTrackedFiles int `json:"max_tracked_files,omitempty"` // stop tracking new files beyond this (default 100000)
+
+	MaxFileSizeMB int `json:"max_file_size_mb,omitempty"` // refuse to rebuild larger files (default 64, or IATF_MAX_FILE_SIZE_MB)
+	MaxFileLines  int `json:"max_file_lines,omitempty"`   // refuse to rebuild files with more lines (default 1000000, or IATF_MAX_FILE_LINES)
+
+	Watchdog bool `json:"watchdog,omitempty"` // recover and restart the watch loop after crashes (read at start)
+
+	ValidateOnly      bool     `json:"validate_only,omitempty"`       // validate and report, never rewrite files
+	ValidateOnlyPaths []string `json:"validate_only_paths,omitempty"` // validate-only for files under these paths
+}
+
+// isValidateOnly reports whether the daemon must only validate path
+func (c DaemonConfig) isValidateOnly(path string) bool {
+	if c.ValidateOnly {
+		return true
+	}
+	roots, _ := absPaths(c.ValidateOnlyPaths)
+	return isPathWithinAny(path, roots)
+}
+
+// defaultMaxTrackedFiles bounds the files the daemon tracks, so a watch path
+// pointed at a huge tree cannot grow the daemon without limit
+const defaultMaxTrackedFiles = 100000
+
+// maxTrackedFiles returns the configured tracked file limit
+func (c DaemonConfig) maxTrackedFiles() int {
+	if c.MaxTrackedFiles > 0 {
+		return c.MaxTrackedFiles
+	}
+	return defaultMaxTrackedFiles
+}
+
+// defaultShutdownGrace is how long a stopping daemon keeps rebuilding
+// pending files before persisting the rest for the next start
+const defaultShutdownGrace = 10 * time.Second
+
+// shutdownGrace returns the configured shutdown grace period
+func (c DaemonConfig) shutdownGrace() time.Duration {
+	if c.ShutdownGraceSeconds > 0 {
+		return time.Duration(c.ShutdownGraceSeconds) * time.Second
+	}
+	return defaultShutdownGrace
+}
+
+// daemonStopTimeout is how long the CLI waits for a stopping daemon to exit
+func daemonStopTimeout() time.Duration {
+	return loadDaemonConfig().shutdownGrace() + 5*time.Second
+}
+
+// Default daemon log rotation limits
+const (
+	defaultLogMaxSizeMB = 10
+	defaultLogMaxFiles  = 5
+)
+
+// logRotationPolicy returns the effective log size limit in bytes, the number
+// of rotated files to keep, and the maximum age (0 = no age-based rotation)
+func (c DaemonConfig) logRotationPolicy() (maxSize int64, maxFiles int, maxAge time.Duration) {
+	maxSize = int64(defaultLogMaxSizeMB) << 20
+	if c.LogMaxSizeMB > 0 {
+		maxSize = int64(c.LogMaxSizeMB) << 20
+	}
+	maxFiles = defaultLogMaxFiles
+	if c.LogMaxFiles > 0 {
+		maxFiles = c.LogMaxFiles
+	}
+	if c.LogMaxAgeDays > 0 {
+		maxAge = time.Duration(c.LogMaxAgeDays) * 24 * time.Hour
+	}
+	return maxSize, maxFiles, maxAge
 }
 
 func getDaemonConfigPath() string {
@@ -1220,11 +2520,111 @@ func getDaemonPIDPath() string {
 	return filepath.Join(home, ".iatf", "daemon.pid")
 }
 
+func getDaemonKickPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".iatf", "daemon.kick")
+}
+
 func getDaemonLogPath() string {
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, ".iatf", "daemon.log")
 }
 
+// rotateDaemonLog copies daemon.log to daemon.log.1 (shifting older copies up
+// and dropping any beyond maxFiles) and truncates the original in place.
+// Copy-and-truncate keeps the append handle held by the daemon (or launchd)
+// valid and works on Windows, where open files cannot be renamed.
+func rotateDaemonLog(logPath string, maxFiles int) error {
+	for i := maxFiles; ; i++ {
+		// Remove copies beyond the retention limit (e.g. after lowering it)
+		extra := fmt.Sprintf("%s.%d", logPath, i+1)
+		if _, err := os.Stat(extra); err != nil {
+			break
+		}
+		os.Remove(extra)
+	}
+	for i := maxFiles - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%s.%d", logPath, i)
+		if _, err := os.Stat(older); err == nil {
+			os.Rename(older, fmt.Sprintf("%s.%d", logPath, i+1))
+		}
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(logPath+".1", data, 0644); err != nil {
+		return err
+	}
+	return os.Truncate(logPath, 0)
+}
+
+// rotateDaemonLogPeriodically checks the daemon log once a minute and rotates
+// it when it exceeds the configured size or age. The policy is re-read from
+// daemon.json on every check so changes apply without a restart.
+func rotateDaemonLogPeriodically(logPath string) {
+	lastRotation := time.Now()
+	if info, err := os.Stat(logPath + ".1"); err == nil {
+		lastRotation = info.ModTime()
+	}
+
+	check := func() {
+		maxSize, maxFiles, maxAge := loadDaemonConfig().logRotationPolicy()
+		info, err := os.Stat(logPath)
+		if err != nil || info.Size() == 0 {
+			return
+		}
+		if info.Size() < maxSize && (maxAge == 0 || time.Since(lastRotation) < maxAge) {
+			return
+		}
+		if err := rotateDaemonLog(logPath, maxFiles); err != nil {
+			daemonLog(logComponentDaemon).Error("Log rotation failed", "error", err)
+			return
+		}
+		lastRotation = time.Now()
+		daemonLog(logComponentDaemon).Info("Log rotated", "previous_log", logPath+".1")
+	}
+
+	check()
+	for range time.Tick(time.Minute) {
+		check()
+	}
+}
+
+func getDaemonPendingPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".iatf", "daemon.pending")
+}
+
+// savePendingRebuilds records rebuilds a stopping daemon could not finish,
+// one path per line, so the next daemon run resumes them
+func savePendingRebuilds(paths []string) error {
+	pendingPath := getDaemonPendingPath()
+	if len(paths) == 0 {
+		os.Remove(pendingPath)
+		return nil
+	}
+	return os.WriteFile(pendingPath, []byte(strings.Join(paths, "\n")+"\n"), 0644)
+}
+
+// takePendingRebuilds returns and clears the rebuilds left by the previous run
+func takePendingRebuilds() []string {
+	pendingPath := getDaemonPendingPath()
+	data, err := os.ReadFile(pendingPath)
+	if err != nil {
+		return nil
+	}
+	os.Remove(pendingPath)
+	paths := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths
+}
+
 func loadDaemonConfig() DaemonConfig {
 	configPath := getDaemonConfigPath()
 	data, err := os.ReadFile(configPath)
@@ -1259,28 +2659,314 @@ func removeDaemonPIDFile() {
 	os.Remove(getDaemonPIDPath())
 }
 
-func checkDaemonRunning() (bool, int) {
-	pid, err := loadDaemonPID()
+// The running daemon holds an exclusive OS lock on daemon.lock for its whole
+// lifetime. The lock is released by the OS when the process exits, even if it
+// crashes, so it is the authority on whether a daemon is running: a PID file
+// left behind whose PID was recycled by an unrelated process is recognised as
+// stale. The lock file is never removed, so every daemon locks the same file.
+func getDaemonLockPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".iatf", "daemon.lock")
+}
+
+// errDaemonLocked is returned when another daemon holds the daemon lock
+var errDaemonLocked = errors.New("another daemon is already running")
+
+// acquireDaemonLock takes the daemon lock. The returned file must stay open
+// for as long as the daemon runs.
+func acquireDaemonLock() (*os.File, error) {
+	lockPath := getDaemonLockPath()
+	os.MkdirAll(filepath.Dir(lockPath), 0755)
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
-		return false, 0
+		return nil, err
 	}
-
-	if isProcessRunning(pid) {
-		return true, pid
+	locked, err := tryLockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		if err == nil {
+			err = errDaemonLocked
+		}
+		return nil, err
 	}
-
-	// Clean up stale PID file
-	removeDaemonPIDFile()
-	return false, 0
+	return f, nil
 }
 
-func daemonStartCommand(debug bool) int {
-	config := loadDaemonConfig()
-	if len(config.WatchPaths) == 0 {
-		fmt.Println("No watch paths configured.")
-		fmt.Printf("Add paths to %s\n", getDaemonConfigPath())
-		fmt.Println("\nExample config:")
-		fmt.Println(`{
+// isDaemonLockHeld reports whether a running daemon holds the daemon lock
+func isDaemonLockHeld() bool {
+	f, err := os.OpenFile(getDaemonLockPath(), os.O_RDWR, 0644)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	locked, err := tryLockFile(f)
+	if err != nil {
+		return false
+	}
+	if locked {
+		unlockFile(f)
+		return false
+	}
+	return true
+}
+
+// DaemonInfo describes the running daemon. It is written by the daemon process
+// itself so the CLI can detect when it is talking to a different version.
+type DaemonInfo struct {
+	PID        int    `json:"pid"`
+	Version    string `json:"version"`
+	Executable string `json:"executable"`
+	Started    string `json:"started"`
+}
+
+func getDaemonInfoPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".iatf", "daemon-info.json")
+}
+
+func saveDaemonInfo(info DaemonInfo) error {
+	infoPath := getDaemonInfoPath()
+	os.MkdirAll(filepath.Dir(infoPath), 0755)
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(infoPath, data, 0644)
+}
+
+// loadDaemonInfo returns the info written by the daemon running as pid. Daemons
+// started by versions that predate the info file report an empty Version.
+func loadDaemonInfo(pid int) DaemonInfo {
+	data, err := os.ReadFile(getDaemonInfoPath())
+	if err != nil {
+		return DaemonInfo{PID: pid}
+	}
+	var info DaemonInfo
+	if json.Unmarshal(data, &info) != nil || info.PID != pid {
+		return DaemonInfo{PID: pid}
+	}
+	return info
+}
+
+// DaemonFileState is the last rebuild outcome for a file tracked by the daemon.
+// Files that have not been rebuilt since the daemon started have an empty Result.
+type DaemonFileState struct {
+	LastRebuild string          `json:"last_rebuild,omitempty"`
+	Result      string          `json:"result,omitempty"` // rebuilt, up-to-date, validation-failed, rebuild-failed
+	Error       string          `json:"error,omitempty"`
+	ErrorCount  int             `json:"error_count,omitempty"` // number of validation errors
+	DurationMS  float64         `json:"duration_ms,omitempty"`
+	Sections    *SectionChanges `json:"sections_changed,omitempty"` // set when the INDEX was rewritten
+}
+
+// Daemon rebuild results recorded in DaemonFileState
+const (
+	daemonResultRebuilt          = "rebuilt"
+	daemonResultUpToDate         = "up-to-date"
+	daemonResultValidationFailed = "validation-failed"
+	daemonResultRebuildFailed    = "rebuild-failed"
+	daemonResultIndexStale       = "index-stale" // validate-only: valid, but a rebuild would change the INDEX
+)
+
+// maxDaemonFileResults bounds the rebuild results the daemon keeps for
+// status output. Results of failing files are always kept; beyond the limit
+// the oldest successful results are evicted.
+const maxDaemonFileResults = 1000
+
+// DaemonRuntimeState is written by the running daemon whenever the set of
+// tracked files or their rebuild results change, for 'daemon status --json'.
+// Files holds the latest rebuild results, not every tracked file.
+type DaemonRuntimeState struct {
+	PID     int                        `json:"pid"`
+	Updated string                     `json:"updated"`
+	Tracked int                        `json:"tracked_files"`
+	Skipped int                        `json:"skipped_files,omitempty"` // not tracked because of max_tracked_files
+	Files   map[string]DaemonFileState `json:"files"`
+}
+
+func getDaemonStatePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".iatf", "daemon-state.json")
+}
+
+// daemonRuntime guards the daemon's runtime state; debounce timers record
+// results from their own goroutines
+type daemonRuntime struct {
+	mu      sync.Mutex
+	state   DaemonRuntimeState
+	metrics daemonMetrics
+}
+
+func newDaemonRuntime() *daemonRuntime {
+	return &daemonRuntime{
+		state:   DaemonRuntimeState{PID: os.Getpid(), Files: make(map[string]DaemonFileState)},
+		metrics: newDaemonMetrics(),
+	}
+}
+
+// setTracked records how many files are tracked and how many were skipped
+// because of the tracked file limit
+func (r *daemonRuntime) setTracked(tracked int, skipped int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state.Tracked == tracked && r.state.Skipped == skipped {
+		return
+	}
+	r.state.Tracked = tracked
+	r.state.Skipped = skipped
+	r.save()
+}
+
+// forget drops the result of a file that is no longer tracked
+func (r *daemonRuntime) forget(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.state.Files[path]; exists {
+		delete(r.state.Files, path)
+		r.save()
+	}
+}
+
+// record stores the outcome of a rebuild
+func (r *daemonRuntime) record(path string, result DaemonFileState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state.Files[path] = result
+	r.evictResults()
+	r.metrics.observe(result)
+	r.save()
+}
+
+// evictResults drops the oldest successful results beyond
+// maxDaemonFileResults; the caller must hold r.mu
+func (r *daemonRuntime) evictResults() {
+	if len(r.state.Files) <= maxDaemonFileResults {
+		return
+	}
+	succeeded := []string{}
+	for path, file := range r.state.Files {
+		if file.Error == "" {
+			succeeded = append(succeeded, path)
+		}
+	}
+	sort.Slice(succeeded, func(i, j int) bool {
+		return r.state.Files[succeeded[i]].LastRebuild < r.state.Files[succeeded[j]].LastRebuild
+	})
+	for _, path := range succeeded {
+		if len(r.state.Files) <= maxDaemonFileResults {
+			break
+		}
+		delete(r.state.Files, path)
+	}
+}
+
+// counts returns the tracked and skipped file counts
+func (r *daemonRuntime) counts() (tracked int, skipped int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.Tracked, r.state.Skipped
+}
+
+// snapshot returns a copy of the per-file state
+func (r *daemonRuntime) snapshot() map[string]DaemonFileState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := make(map[string]DaemonFileState, len(r.state.Files))
+	for path, state := range r.state.Files {
+		files[path] = state
+	}
+	return files
+}
+
+// save writes the runtime state; the caller must hold r.mu
+func (r *daemonRuntime) save() {
+	r.state.Updated = time.Now().Format(time.RFC3339)
+	data, err := json.MarshalIndent(r.state, "", "  ")
+	if err != nil {
+		return
+	}
+	statePath := getDaemonStatePath()
+	tmpPath := statePath + ".tmp"
+	if os.WriteFile(tmpPath, data, 0644) == nil {
+		os.Rename(tmpPath, statePath)
+	}
+}
+
+// loadDaemonRuntimeState returns the runtime state written by the daemon
+// running as pid, or nil if it is missing or belongs to another process
+func loadDaemonRuntimeState(pid int) *DaemonRuntimeState {
+	data, err := os.ReadFile(getDaemonStatePath())
+	if err != nil {
+		return nil
+	}
+	var state DaemonRuntimeState
+	if json.Unmarshal(data, &state) != nil || state.PID != pid {
+		return nil
+	}
+	return &state
+}
+
+// daemonVersionLabel formats a daemon version for messages
+func daemonVersionLabel(version string) string {
+	if version == "" {
+		return "unknown (older than the running CLI)"
+	}
+	return "v" + version
+}
+
+// warnDaemonVersionMismatch prints a warning when the running daemon was built
+// from a different version than this CLI. Returns true if the versions differ.
+func warnDaemonVersionMismatch(pid int) bool {
+	info := loadDaemonInfo(pid)
+	if info.Version == Version {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Warning: Daemon version %s differs from CLI version v%s\n", daemonVersionLabel(info.Version), Version)
+	fmt.Fprintln(os.Stderr, "Run 'iatf daemon upgrade' to restart the daemon with this binary")
+	return true
+}
+
+// waitForProcessExit polls until pid exits or timeout elapses
+func waitForProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !isProcessRunning(pid) {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return !isProcessRunning(pid)
+}
+
+func checkDaemonRunning() (bool, int) {
+	pid, err := loadDaemonPID()
+	if err != nil {
+		return false, 0
+	}
+
+	if isProcessRunning(pid) {
+		if isDaemonLockHeld() {
+			return true, pid
+		}
+		// Daemons from versions without the lock still answer on the
+		// control socket; anything else is a recycled PID
+		if _, ok := queryDaemonStatus(); ok {
+			return true, pid
+		}
+	}
+
+	// Clean up stale PID file
+	removeDaemonPIDFile()
+	return false, 0
+}
+
+func daemonStartCommand(debug bool) int {
+	config := loadDaemonConfig()
+	if len(config.WatchPaths) == 0 {
+		fmt.Println("No watch paths configured.")
+		fmt.Printf("Add paths to %s\n", getDaemonConfigPath())
+		fmt.Println("\nExample config:")
+		fmt.Println(`{
     "watch_paths": [
         "/path/to/your/projects",
         "/another/path"
@@ -1291,6 +2977,7 @@ func daemonStartCommand(debug bool) int {
 
 	if isRunning, pid := checkDaemonRunning(); isRunning {
 		fmt.Printf("Daemon already running (PID %d)\n", pid)
+		warnDaemonVersionMismatch(pid)
 		return 1
 	}
 
@@ -1308,21 +2995,56 @@ func daemonStartCommand(debug bool) int {
 		return 1
 	}
 
-	saveDaemonPID(cmd.Process.Pid)
+	// The daemon records its own PID once it holds the daemon lock; wait for
+	// that so a daemon started concurrently by someone else is reported
+	// instead of overwriting its PID file
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	deadline := time.After(5 * time.Second)
+	for !isDaemonLockHeld() {
+		select {
+		case <-exited:
+			if isRunning, pid := checkDaemonRunning(); isRunning {
+				fmt.Printf("Daemon already running (PID %d)\n", pid)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: Daemon exited during startup, see %s\n", getDaemonLogPath())
+			}
+			return 1
+		case <-deadline:
+			fmt.Fprintf(os.Stderr, "Error: Daemon (PID %d) did not start within 5 seconds, see %s\n", cmd.Process.Pid, getDaemonLogPath())
+			return 1
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
 	fmt.Printf("Daemon started (PID %d)\n", cmd.Process.Pid)
 	fmt.Printf("Watching %d path(s)\n", len(config.WatchPaths))
 	return 0
 }
 
-func daemonStopCommand() int {
-	pid, err := loadDaemonPID()
-	if err != nil {
+// requestDaemonStop asks the daemon to stop politely: over the control
+// socket, or with SIGTERM for daemons without one (which fails on Windows)
+func requestDaemonStop(process *os.Process) error {
+	if _, err := sendDaemonRequest(daemonRequest{Command: daemonCmdStop}); err == nil {
+		return nil
+	}
+	return process.Signal(syscall.SIGTERM)
+}
+
+// daemonStopCommand asks the daemon to stop and waits until the process has
+// exited. With force, a daemon that does not exit in time (or cannot be asked
+// to stop) is killed.
+func daemonStopCommand(force bool) int {
+	if _, err := loadDaemonPID(); err != nil {
 		fmt.Println("Daemon not running")
 		return 1
 	}
 
-	if !isProcessRunning(pid) {
-		removeDaemonPIDFile()
+	isRunning, pid := checkDaemonRunning()
+	if !isRunning {
 		fmt.Println("Daemon not running (stale PID file removed)")
 		return 1
 	}
@@ -1333,21 +3055,185 @@ func daemonStopCommand() int {
 		return 1
 	}
 
-	if err := process.Signal(syscall.SIGTERM); err != nil {
-		fmt.Fprintf(os.Stderr, "Error stopping daemon: %v\n", err)
+	timeout := daemonStopTimeout()
+	requested := true
+	if err := requestDaemonStop(process); err != nil {
+		requested = false
+		if !force {
+			fmt.Fprintf(os.Stderr, "Error stopping daemon: %v\n", err)
+			return 1
+		}
+	}
+	if requested {
+		fmt.Printf("Waiting up to %s for daemon (PID %d) to exit...\n", timeout, pid)
+		if waitForProcessExit(pid, timeout) {
+			removeDaemonPIDFile()
+			fmt.Println("Daemon stopped")
+			return 0
+		}
+		if !force {
+			fmt.Fprintf(os.Stderr, "Error: Daemon (PID %d) did not exit within %s\n", pid, timeout)
+			fmt.Fprintln(os.Stderr, "Run 'iatf daemon stop --force' to kill it")
+			return 1
+		}
+	}
+
+	fmt.Printf("Killing daemon (PID %d)\n", pid)
+	if err := process.Kill(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error killing daemon: %v\n", err)
+		return 1
+	}
+	if !waitForProcessExit(pid, 5*time.Second) {
+		fmt.Fprintf(os.Stderr, "Error: Daemon (PID %d) is still running after being killed\n", pid)
+		return 1
+	}
+
+	// A killed daemon cannot clean up after itself
+	removeDaemonPIDFile()
+	os.Remove(getDaemonInfoPath())
+	os.Remove(getDaemonStatePath())
+	os.Remove(getDaemonSocketPath())
+	fmt.Println("Daemon killed; rebuilds it had not finished are lost")
+	return 0
+}
+
+// daemonUpgradeCommand restarts a daemon running a different version with this binary
+func daemonUpgradeCommand(debug bool) int {
+	isRunning, pid := checkDaemonRunning()
+	if !isRunning {
+		fmt.Println("Daemon not running, starting it")
+		return daemonStartCommand(debug)
+	}
+
+	info := loadDaemonInfo(pid)
+	executable, _ := os.Executable()
+	if info.Version == Version && info.Executable == executable {
+		fmt.Printf("Daemon already running v%s (PID %d)\n", Version, pid)
+		return 0
+	}
+
+	if installed, service := isServiceInstalled(); installed {
+		fmt.Printf("Daemon is managed by %s; restart the service to pick up v%s\n", service, Version)
 		return 1
 	}
 
+	fmt.Printf("Stopping daemon %s (PID %d)\n", daemonVersionLabel(info.Version), pid)
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding process: %v\n", err)
+		return 1
+	}
+	if err := requestDaemonStop(process); err != nil {
+		fmt.Fprintf(os.Stderr, "Error stopping daemon: %v\n", err)
+		return 1
+	}
+	if !waitForProcessExit(pid, daemonStopTimeout()) {
+		fmt.Fprintf(os.Stderr, "Error: Daemon (PID %d) did not exit, upgrade aborted\n", pid)
+		return 1
+	}
 	removeDaemonPIDFile()
-	fmt.Println("Daemon stopped")
+
+	return daemonStartCommand(debug)
+}
+
+// DaemonStatusReport is the output of 'iatf daemon status --json'
+type DaemonStatusReport struct {
+	Running       bool                       `json:"running"`
+	PID           int                        `json:"pid,omitempty"`
+	Version       string                     `json:"version,omitempty"`
+	Started       string                     `json:"started,omitempty"`
+	UptimeSeconds int64                      `json:"uptime_seconds,omitempty"`
+	WatchPaths    []string                   `json:"watch_paths"`
+	PausedPaths   []string                   `json:"paused_paths,omitempty"`
+	TrackedFiles  int                        `json:"tracked_files"`
+	SkippedFiles  int                        `json:"skipped_files,omitempty"` // over max_tracked_files
+	Files         map[string]DaemonFileState `json:"files,omitempty"`
+	Service       string                     `json:"service,omitempty"`
+}
+
+// daemonStatusJSON prints the daemon status as JSON
+func daemonStatusJSON() int {
+	config := loadDaemonConfig()
+	report := DaemonStatusReport{WatchPaths: config.WatchPaths}
+	if report.WatchPaths == nil {
+		report.WatchPaths = []string{}
+	}
+
+	if isRunning, pid := checkDaemonRunning(); isRunning {
+		if live, ok := queryDaemonStatus(); ok {
+			report = live
+		}
+		info := loadDaemonInfo(pid)
+		report.Running = true
+		report.PID = pid
+		report.Version = info.Version
+		report.Started = info.Started
+		if started, err := time.Parse(time.RFC3339, info.Started); err == nil {
+			report.UptimeSeconds = int64(time.Since(started).Seconds())
+		}
+		if state := loadDaemonRuntimeState(pid); state != nil && report.Files == nil {
+			report.Files = state.Files
+			report.TrackedFiles = state.Tracked
+			report.SkippedFiles = state.Skipped
+		}
+	}
+	if installed, service := isServiceInstalled(); installed {
+		report.Service = service
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
 	return 0
 }
 
-func daemonStatusCommand() int {
+// queryDaemonStatus asks the running daemon for its live status over the
+// control socket
+func queryDaemonStatus() (DaemonStatusReport, bool) {
+	response, err := sendDaemonRequest(daemonRequest{Command: daemonCmdStatus})
+	if err != nil || !response.OK || response.Status == nil {
+		return DaemonStatusReport{}, false
+	}
+	return *response.Status, true
+}
+
+func daemonStatusCommand(jsonOutput bool) int {
+	if jsonOutput {
+		return daemonStatusJSON()
+	}
+
 	config := loadDaemonConfig()
 
 	if isRunning, pid := checkDaemonRunning(); isRunning {
 		fmt.Printf("Daemon: running (PID %d)\n", pid)
+		info := loadDaemonInfo(pid)
+		fmt.Printf("Version: %s\n", daemonVersionLabel(info.Version))
+		files := map[string]DaemonFileState(nil)
+		tracked, skipped, known := 0, 0, false
+		if live, ok := queryDaemonStatus(); ok {
+			files, tracked, skipped, known = live.Files, live.TrackedFiles, live.SkippedFiles, true
+			for _, p := range live.PausedPaths {
+				fmt.Printf("Paused: %s\n", p)
+			}
+		} else if state := loadDaemonRuntimeState(pid); state != nil {
+			files, tracked, skipped, known = state.Files, state.Tracked, state.Skipped, true
+		}
+		if known {
+			failed := 0
+			for _, file := range files {
+				if file.Error != "" {
+					failed++
+				}
+			}
+			fmt.Printf("Tracked files: %d (%d failing)\n", tracked, failed)
+			if skipped > 0 {
+				fmt.Printf("Not tracked: %d file(s) over max_tracked_files\n", skipped)
+			}
+		}
+		warnDaemonVersionMismatch(pid)
 	} else {
 		fmt.Println("Daemon: stopped")
 	}
@@ -1382,319 +3268,1833 @@ func daemonRunCommand(debug bool) int {
 	os.MkdirAll(filepath.Dir(logPath), 0755)
 	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err == nil {
+		// Keep stdout/stderr pointed at the log too, so panics end up there
 		os.Stdout = logFile
 		os.Stderr = logFile
+		go rotateDaemonLogPeriodically(logPath)
+	}
+	logErr := setupDaemonLogging(os.Stdout, config, debug)
+	log := daemonLog(logComponentDaemon)
+
+	// Hold the daemon lock for the lifetime of the process so a second
+	// daemon can never run alongside this one
+	lock, err := acquireDaemonLock()
+	if err != nil {
+		log.Error("Not starting", "error", err)
+		return 1
+	}
+	defer lock.Close()
+
+	log.Info("Daemon started", "version", Version, "pid", os.Getpid())
+	if logErr != nil {
+		log.Warn("Ignoring log setting", "error", logErr)
+	}
+	pid := os.Getpid()
+	started := time.Now().Format(time.RFC3339)
+
+	// Record PID and version from the daemon itself so service-managed
+	// daemons are visible too and the CLI can detect version skew
+	executable, _ := os.Executable()
+	saveDaemonPID(pid)
+	saveDaemonInfo(DaemonInfo{PID: pid, Version: Version, Executable: executable, Started: started})
+	defer os.Remove(getDaemonInfoPath())
+	defer os.Remove(getDaemonStatePath())
+
+	// Listen for control requests; without the socket the daemon still
+	// responds to PID-file based commands and signals
+	listener, controls, err := listenDaemonControl()
+	if err != nil {
+		daemonLog(logComponentControl).Warn("Control socket unavailable", "error", err)
+	} else {
+		defer os.Remove(getDaemonSocketPath())
+		defer listener.Close()
 	}
 
-	fmt.Printf("[%s] Daemon started\n", time.Now().Format(time.RFC3339))
-	for _, p := range config.WatchPaths {
-		fmt.Printf("  Watching: %s\n", p)
+	daemonState := newDaemonRuntime()
+	if config.MetricsAddr != "" {
+		addr, err := serveDaemonMetrics(config.MetricsAddr, daemonState)
+		if err != nil {
+			daemonLog(logComponentControl).Warn("Metrics endpoint unavailable", "error", err)
+		} else {
+			daemonLog(logComponentControl).Info("Serving metrics", "url", "http://"+addr+"/metrics")
+		}
 	}
 
 	// Watch all configured paths
-	watchMultipleDirs(config.WatchPaths, debug)
+	if config.Watchdog {
+		return superviseWatchLoop(daemonState, func(cfg DaemonConfig) {
+			watchMultipleDirs(cfg, controls, daemonState, debug)
+		})
+	}
+	watchMultipleDirs(config, controls, daemonState, debug)
 	return 0
 }
 
-// watchMultipleDirs watches multiple directories simultaneously
-func watchMultipleDirs(paths []string, debug bool) {
+// watchMultipleDirs watches the daemon's configured paths until it is stopped.
+// Changes to daemon.json are applied as they are saved, and requests arriving
+// on controls (the control socket) are handled between scans.
+func watchMultipleDirs(config DaemonConfig, controls <-chan daemonControl, daemonState *daemonRuntime, debug bool) {
 	files := make(map[string]*fileState)
 	var filesMu sync.Mutex
+	pid := os.Getpid()
+	startTime := daemonState.metrics.started
+	started := startTime.Format(time.RFC3339)
+	log := daemonLog(logComponentDaemon)
+	watchLog := daemonLog(logComponentWatcher)
+
+	// rebuild processes one file and records (and optionally notifies) the outcome
+	var notify atomic.Bool
+	var activeConfig atomic.Pointer[DaemonConfig]
+	activeConfig.Store(&config)
+	var webhook atomic.Pointer[daemonWebhook]
+	rebuild := func(path string) (result DaemonFileState) {
+		if config.Watchdog {
+			defer recoverRebuild(path, &result)
+		}
+		result = processFileForDaemon(path, activeConfig.Load().isValidateOnly(path))
+		daemonState.record(path, result)
+		if result.Result != daemonResultUpToDate {
+			if hook := webhook.Load(); hook != nil {
+				go hook.post(path, result)
+			}
+			daemonEvents.publish(rebuildEvent(path, result))
+		}
+		switch {
+		case result.Error == "":
+			clearFailureNotice(path)
+		case notify.Load() && result.Result == daemonResultValidationFailed:
+			logNotifyFailure(path, "Validation failed", result.Error)
+		case notify.Load():
+			logNotifyFailure(path, "Rebuild failed", result.Error)
+		}
+		return result
+	}
+	scheduler := newRebuildScheduler(func(path string) {
+		rebuild(path)
+	})
+	stopScheduler := make(chan struct{})
+	defer close(stopScheduler)
+	go scheduler.run(stopScheduler)
+
+	var paths, excludes []string
+	var symlinks string
+	var maxTracked, skipped int
+	var scan uint64
+	limitWarned := false
+
+	// trackFile starts tracking a newly found file unless the tracked file
+	// limit is reached; the caller must hold filesMu
+	trackFile := func(path string, stat os.FileInfo) bool {
+		if len(files) >= maxTracked {
+			if !limitWarned {
+				watchLog.Warn("Tracked file limit reached, ignoring further files", "max_tracked_files", maxTracked)
+				limitWarned = true
+			}
+			skipped++
+			return false
+		}
+		files[path] = &fileState{lastModTime: stat.ModTime(), scan: scan}
+		return true
+	}
+	var shutdownGrace time.Duration
+	defer func() {
+		for _, absPath := range paths {
+			unregisterWatch(absPath, pid)
+		}
+	}()
+
+	// applyConfig switches to the watch paths and excludes in cfg. New paths
+	// are registered and scanned (without rebuilding), and files that are no
+	// longer covered are dropped.
+	applyConfig := func(cfg DaemonConfig) {
+		newPaths, _ := absPaths(cfg.WatchPaths)
+		for _, absPath := range paths {
+			if !contains(newPaths, absPath) {
+				unregisterWatch(absPath, pid)
+				watchLog.Info("Stopped watching", "path", absPath)
+			}
+		}
+		for _, absPath := range newPaths {
+			if !contains(paths, absPath) {
+				registerWatch(absPath, WatchInfo{Started: started, PID: pid, Kind: watchKindDaemon})
+				watchLog.Info("Watching", "path", absPath)
+			}
+		}
+		paths = newPaths
+		excludes = append(append([]string{}, defaultExcludePatterns...), cfg.Exclude...)
+		policy, err := parseSymlinkPolicy(cfg.Symlinks)
+		if err != nil {
+			log.Warn("Ignoring symlink setting", "error", err)
+		}
+		symlinks = policy
+		daemonState.setWatchPaths(len(paths))
+		scheduler.configure(cfg)
+		shutdownGrace = cfg.shutdownGrace()
+		maxTracked = cfg.maxTrackedFiles()
+		limits := cfg.daemonLimits()
+		activeLimits.Store(&limits)
+		activeConfig.Store(&cfg)
+		if err := applyDaemonLogLevel(cfg, debug); err != nil {
+			log.Warn("Ignoring log setting", "error", err)
+		}
+		notify.Store(cfg.Notify)
+		if cfg.WebhookURL != "" {
+			webhook.Store(&daemonWebhook{URL: cfg.WebhookURL, Secret: cfg.WebhookSecret})
+		} else {
+			webhook.Store(nil)
+		}
 
-	// Initial scan of all paths
-	for _, dirPath := range paths {
-		filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
-			if err == nil && !d.IsDir() && strings.HasSuffix(path, ".iatf") {
-				stat, _ := os.Stat(path)
-				files[path] = &fileState{lastModTime: stat.ModTime()}
+		filesMu.Lock()
+		scan++
+		skipped = 0
+		for _, dirPath := range paths {
+			walkIATFFiles(dirPath, excludes, symlinks, func(path string, stat os.FileInfo) {
+				if state, exists := files[path]; exists {
+					state.scan = scan
+				} else {
+					trackFile(path, stat)
+				}
+			})
+		}
+		removed := make(map[string]bool)
+		for path, state := range files {
+			if state.scan == scan {
+				continue
 			}
-			return nil
-		})
+			if state.timer != nil {
+				state.timer.Stop()
+			}
+			delete(files, path)
+			daemonState.forget(path)
+			removed[path] = true
+		}
+		limitWarned = skipped > 0
+		daemonState.setTracked(len(files), skipped)
+		filesMu.Unlock()
+		scheduler.drop(func(path string) bool { return removed[path] })
+	}
+
+	applyConfig(config)
+	configModTime := fileModTime(getDaemonConfigPath())
+
+	// Resume rebuilds the previous run could not finish before it stopped
+	if pending := takePendingRebuilds(); len(pending) > 0 {
+		resumed := 0
+		for _, path := range pending {
+			if _, err := os.Stat(path); err == nil && isPathWithinAny(path, paths) {
+				scheduler.enqueue(path)
+				resumed++
+			}
+		}
+		log.Info("Resuming pending rebuilds from the previous run", "count", resumed)
 	}
 
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	kickChan := notifyRebuildSignals()
+	defer signal.Stop(kickChan)
 
 	ticker := time.NewTicker(250 * time.Millisecond)
 	defer ticker.Stop()
+	// Polls reuse the listings of directories that have not changed
+	scanner := newDirScanner()
+
+	// shutdown finishes debounced and queued rebuilds within the grace
+	// period and persists whatever is left for the next run
+	shutdown := func(reason string) {
+		pending := []string{}
+		filesMu.Lock()
+		for path, state := range files {
+			if state.timer != nil && state.timer.Stop() {
+				pending = append(pending, path)
+			}
+		}
+		filesMu.Unlock()
 
-	for {
-		select {
-		case <-sigChan:
-			filesMu.Lock()
-			for _, state := range files {
-				if state.timer != nil {
-					state.timer.Stop()
+		if left := scheduler.drain(pending, time.Now().Add(shutdownGrace)); len(left) > 0 {
+			if err := savePendingRebuilds(left); err == nil {
+				log.Info("Saved unfinished rebuilds for the next start", "count", len(left))
+			}
+		}
+		log.Info("Daemon stopped", "reason", reason)
+	}
+
+	// kick rescans the watched paths and rebuilds every tracked file under
+	// targets right away, bypassing the debounce (all files if targets is empty).
+	// It returns the number of files processed and how many of them failed.
+	kick := func(targets []string) (processed int, failed int) {
+		log.Info("Rebuild requested", "targets", targets)
+		filesMu.Lock()
+		for _, dirPath := range paths {
+			walkIATFFiles(dirPath, excludes, symlinks, func(path string, stat os.FileInfo) {
+				if _, exists := files[path]; !exists {
+					trackFile(path, stat)
 				}
+			})
+		}
+		daemonState.setTracked(len(files), skipped)
+		// Targets have their symlinks resolved, so a file tracked through a
+		// link is also matched by its target
+		targeted := func(path string) bool {
+			if len(targets) == 0 || isPathWithinAny(path, targets) {
+				return true
 			}
-			filesMu.Unlock()
-			fmt.Printf("[%s] Daemon stopped\n", time.Now().Format(time.RFC3339))
-			return
-		case <-ticker.C:
-			for _, dirPath := range paths {
-				filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
-					if err != nil || d.IsDir() || !strings.HasSuffix(path, ".iatf") {
-						return nil
-					}
-
-					stat, statErr := os.Stat(path)
-					if statErr != nil {
-						return nil
-					}
-
-					filesMu.Lock()
-					state, exists := files[path]
+			resolved, err := resolveWatchPath(path)
+			return err == nil && isPathWithinAny(resolved, targets)
+		}
+		selected := []string{}
+		for path, state := range files {
+			if !targeted(path) {
+				continue
+			}
+			if state.timer != nil {
+				state.timer.Stop()
+				state.timer = nil
+			}
+			selected = append(selected, path)
+		}
+		filesMu.Unlock()
+		sort.Strings(selected)
+		scheduler.drop(targeted)
+
+		for _, path := range selected {
+			// Long kicks keep the loop (and /healthz) marked alive
+			daemonState.heartbeat()
+			result := rebuild(path)
+			if result.Error != "" {
+				failed++
+			}
+			if stat, err := os.Stat(path); err == nil {
+				filesMu.Lock()
+				if state, exists := files[path]; exists {
+					state.lastModTime = stat.ModTime()
+				}
+				filesMu.Unlock()
+			}
+		}
+		return len(selected), failed
+	}
+
+	// control handles a control socket request. It returns true if the
+	// daemon should stop after replying.
+	control := func(request daemonRequest) (daemonResponse, bool) {
+		switch request.Command {
+		case daemonCmdStatus:
+			watchState, _ := loadWatchState()
+			report := DaemonStatusReport{
+				Running:       true,
+				PID:           pid,
+				Version:       Version,
+				Started:       started,
+				UptimeSeconds: int64(time.Since(startTime).Seconds()),
+				WatchPaths:    append([]string{}, paths...),
+				Files:         daemonState.snapshot(),
+			}
+			report.TrackedFiles, report.SkippedFiles = daemonState.counts()
+			for _, absPath := range paths {
+				if watchState[absPath].Paused {
+					report.PausedPaths = append(report.PausedPaths, absPath)
+				}
+			}
+			return daemonResponse{OK: true, Status: &report}, false
+		case daemonCmdReload:
+			applyConfig(loadDaemonConfig())
+			configModTime = fileModTime(getDaemonConfigPath())
+			return daemonResponse{OK: true, Message: fmt.Sprintf("Reloaded configuration: watching %d path(s)", len(paths))}, false
+		case daemonCmdAddPath:
+			cfg := loadDaemonConfig()
+			added := addDaemonWatchPaths(&cfg, request.Paths)
+			if len(added) == 0 {
+				return daemonResponse{OK: true, Message: "Paths are already being watched by the daemon"}, false
+			}
+			if err := saveDaemonConfig(cfg); err != nil {
+				return daemonResponse{Error: fmt.Sprintf("saving daemon config: %v", err)}, false
+			}
+			applyConfig(cfg)
+			configModTime = fileModTime(getDaemonConfigPath())
+			return daemonResponse{OK: true, Message: fmt.Sprintf("Added %d watch path(s): %s", len(added), strings.Join(added, ", "))}, false
+		case daemonCmdPause, daemonCmdResume:
+			paused := request.Command == daemonCmdPause
+			targets := request.Paths
+			for _, target := range targets {
+				if !contains(paths, target) {
+					return daemonResponse{Error: fmt.Sprintf("path is not a daemon watch path: %s", target)}, false
+				}
+			}
+			if len(targets) == 0 {
+				targets = paths
+			}
+			for _, target := range targets {
+				if err := setWatchPaused(target, paused); err != nil {
+					return daemonResponse{Error: err.Error()}, false
+				}
+			}
+			verb := "Resumed"
+			if paused {
+				verb = "Paused"
+			}
+			return daemonResponse{OK: true, Message: fmt.Sprintf("%s auto-rebuilds: %s", verb, strings.Join(targets, ", "))}, false
+		case daemonCmdRebuild:
+			processed, failed := kick(request.Paths)
+			response := daemonResponse{OK: failed == 0, Message: fmt.Sprintf("Processed %d file(s), %d failed", processed, failed)}
+			if failed > 0 {
+				response.Error = fmt.Sprintf("%d file(s) failed validation or rebuild; see %s", failed, getDaemonLogPath())
+			}
+			return response, false
+		case daemonCmdStop:
+			return daemonResponse{OK: true, Message: "Daemon stopping"}, true
+		}
+		return daemonResponse{Error: fmt.Sprintf("unknown command: %s", request.Command)}, false
+	}
+
+	for {
+		select {
+		case <-sigChan:
+			shutdown("signal")
+			return
+		case ctl := <-controls:
+			response, stop := control(ctl.request)
+			ctl.reply <- response
+			if stop {
+				shutdown("control request")
+				return
+			}
+		case <-kickChan:
+			targets, _ := consumeDaemonKick()
+			kick(targets)
+		case <-ticker.C:
+			daemonState.heartbeat()
+			if targets, pending := consumeDaemonKick(); pending {
+				kick(targets)
+			}
+			if modTime := fileModTime(getDaemonConfigPath()); !modTime.Equal(configModTime) {
+				configModTime = modTime
+				log.Info("Configuration changed, reloading")
+				applyConfig(loadDaemonConfig())
+			}
+
+			watchState, _ := loadWatchState()
+			filesMu.Lock()
+			scan++
+			skipped = 0
+			pausedPaths := []string{}
+			filesMu.Unlock()
+			for _, dirPath := range paths {
+				if watchState[dirPath].Paused {
+					pausedPaths = append(pausedPaths, dirPath)
+					// Drop pending rebuilds; changes are picked up after resume
+					// because lastModTime is left untouched while paused
+					filesMu.Lock()
+					for path, state := range files {
+						if state.timer != nil && isPathWithinAny(path, []string{dirPath}) {
+							state.timer.Stop()
+							state.timer = nil
+						}
+					}
+					filesMu.Unlock()
+					scheduler.drop(func(path string) bool { return isPathWithinAny(path, []string{dirPath}) })
+					continue
+				}
+
+				scanner.walk(dirPath, excludes, symlinks, func(path string, stat os.FileInfo) {
+					filesMu.Lock()
+					state, exists := files[path]
 
 					if !exists {
-						files[path] = &fileState{lastModTime: stat.ModTime()}
-						filesMu.Unlock()
-						if debug {
-							fmt.Printf("[%s] New file: %s\n", time.Now().Format(time.RFC3339), path)
+						if trackFile(path, stat) {
+							watchLog.Debug("New file", "file", path)
 						}
-						return nil
+						filesMu.Unlock()
+						return
 					}
 
+					state.scan = scan
 					if stat.ModTime().After(state.lastModTime) {
 						state.lastModTime = stat.ModTime()
-						if debug {
-							fmt.Printf("[%s] Change: %s\n", time.Now().Format(time.RFC3339), path)
-						}
+						watchLog.Debug("Change", "file", path)
 
 						if state.timer != nil {
 							state.timer.Stop()
 						}
 						pathCopy := path
-						state.timer = time.AfterFunc(3*time.Second, func() {
-							valid, errors := validateFileQuiet(pathCopy)
-							if !valid {
-								fmt.Printf("[%s] Validation failed: %s\n", time.Now().Format(time.RFC3339), pathCopy)
-								for _, e := range errors {
-									fmt.Printf("  - %s\n", e)
-								}
-								return
-							}
-							if err := rebuildIndex(pathCopy); err != nil {
-								fmt.Printf("[%s] Rebuild failed: %s - %v\n", time.Now().Format(time.RFC3339), pathCopy, err)
-								return
+						var timer *time.Timer
+						timer = time.AfterFunc(3*time.Second, func() {
+							// Release the fired timer so idle files hold no timers
+							filesMu.Lock()
+							if state.timer == timer {
+								state.timer = nil
 							}
-							fmt.Printf("[%s] Rebuilt: %s\n", time.Now().Format(time.RFC3339), pathCopy)
+							filesMu.Unlock()
+							scheduler.enqueue(pathCopy)
 						})
+						state.timer = timer
 					}
 					filesMu.Unlock()
-					return nil
 				})
 			}
 
-			// Check for deleted files
+			// Check for deleted files; only files the scan did not see
+			// (outside paused paths) need a stat
 			filesMu.Lock()
 			for path, state := range files {
+				if state.scan == scan || isPathWithinAny(path, pausedPaths) {
+					continue
+				}
 				if _, err := os.Stat(path); os.IsNotExist(err) {
 					if state.timer != nil {
 						state.timer.Stop()
 					}
 					delete(files, path)
-					if debug {
-						fmt.Printf("[%s] Deleted: %s\n", time.Now().Format(time.RFC3339), path)
-					}
+					daemonState.forget(path)
+					scheduler.drop(func(p string) bool { return p == path })
+					watchLog.Debug("Deleted", "file", path)
 				}
 			}
+			limitWarned = skipped > 0
+			daemonState.setTracked(len(files), skipped)
 			filesMu.Unlock()
 		}
 	}
 }
 
-func indexCommand(filePath string) int {
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+// fileModTime returns the modification time of path, or the zero time if it
+// cannot be read
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// processFileForDaemon validates and rebuilds a single file, logging the
+// outcome. With validateOnly the file is never rewritten; a valid file whose
+// INDEX is out of date is reported as index-stale instead.
+func processFileForDaemon(path string, validateOnly bool) (result DaemonFileState) {
+	start := time.Now()
+	now := start.Format(time.RFC3339)
+	defer func() {
+		result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	log := daemonLog(logComponentRebuilder).With("file", path)
+
+	errors := rebuildBlockers(path)
+	if len(errors) > 0 {
+		log.Warn("Validation failed", "errors", errors)
+		return DaemonFileState{LastRebuild: now, Result: daemonResultValidationFailed, Error: strings.Join(errors, "; "), ErrorCount: len(errors)}
+	}
+	if validateOnly {
+		_, stale, sections, err := planIndexRebuild(path)
+		if err != nil {
+			log.Error("Rebuild check failed", "error", err)
+			return DaemonFileState{LastRebuild: now, Result: daemonResultRebuildFailed, Error: err.Error()}
+		}
+		if !stale {
+			log.Info("Up to date")
+			return DaemonFileState{LastRebuild: now, Result: daemonResultUpToDate}
+		}
+		log.Info("INDEX out of date (validate-only, not rewritten)", "added", len(sections.Added), "modified", len(sections.Modified), "removed", len(sections.Removed))
+		return DaemonFileState{LastRebuild: now, Result: daemonResultIndexStale, Sections: &sections}
+	}
+	changed, sections, err := rebuildIndexWithChanges(path)
+	if err != nil {
+		log.Error("Rebuild failed", "error", err)
+		return DaemonFileState{LastRebuild: now, Result: daemonResultRebuildFailed, Error: err.Error()}
+	}
+	if !changed {
+		log.Info("Up to date")
+		return DaemonFileState{LastRebuild: now, Result: daemonResultUpToDate}
+	}
+	log.Info("Rebuilt", "added", len(sections.Added), "modified", len(sections.Modified), "removed", len(sections.Removed))
+	return DaemonFileState{LastRebuild: now, Result: daemonResultRebuilt, Sections: &sections}
+}
+
+// isPathWithinAny reports whether path equals or lies under one of roots
+func isPathWithinAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// consumeDaemonKick reads and clears pending kick requests. It returns the
+// requested paths (empty means everything) and whether a request was pending.
+func consumeDaemonKick() ([]string, bool) {
+	kickPath := getDaemonKickPath()
+	data, err := os.ReadFile(kickPath)
+	if err != nil {
+		return nil, false
+	}
+	os.Remove(kickPath)
+
+	targets := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "*" {
+			return nil, true
+		}
+		if line != "" {
+			targets = append(targets, line)
+		}
+	}
+	return targets, true
+}
+
+func daemonKickCommand(paths []string) int {
+	isRunning, pid := checkDaemonRunning()
+	if !isRunning {
+		fmt.Println("Daemon not running")
 		return 1
 	}
+	warnDaemonVersionMismatch(pid)
 
-	content, err := os.ReadFile(filePath)
+	targets, err := absPaths(paths)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
+	if code, ok := runDaemonRequest(daemonRequest{Command: daemonCmdRebuild, Paths: targets}); ok {
+		return code
+	}
 
-	lines := strings.Split(string(content), "\n")
+	// Daemons without a control socket pick requests up from the kick file
+	lines := append([]string{}, targets...)
+	if len(lines) == 0 {
+		lines = append(lines, "*")
+	}
 
-	indexStart := -1
-	indexEnd := -1
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "===INDEX===" {
-			indexStart = i
-		} else if strings.TrimSpace(line) == "===CONTENT===" {
-			indexEnd = i
-			break
+	kickPath := getDaemonKickPath()
+	kickFile, err := os.OpenFile(kickPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing kick request: %v\n", err)
+		return 1
+	}
+	_, err = kickFile.WriteString(strings.Join(lines, "\n") + "\n")
+	kickFile.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing kick request: %v\n", err)
+		return 1
+	}
+
+	if err := signalRebuild(pid); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to signal daemon, it will pick up the request on its next scan: %v\n", err)
+	}
+
+	if len(paths) == 0 {
+		fmt.Println("Rebuild requested for all watched files")
+	} else {
+		fmt.Printf("Rebuild requested for %d path(s)\n", len(paths))
+	}
+	return 0
+}
+
+func indexCommand(filePath string, args indexArgs) int {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+	if err == nil && info.IsDir() {
+		return masterIndexCommand(filePath, args)
+	}
+
+	// The plain INDEX is printed as stored, but for private sections, so
+	// CONTENT need not be kept
+	if !args.json && !args.filtered() {
+		indexLines, private, found, err := streamIndexLines(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if found {
+			if !args.includePrivate {
+				indexLines = filterIndexEntries(indexLines, func(id string) bool { return !private[id] })
+			}
+			for _, line := range indexLines {
+				fmt.Println(line)
+			}
+			return 0
 		}
 	}
 
-	if indexStart == -1 || indexEnd == -1 {
-		fmt.Fprintln(os.Stderr, "Error: INDEX not generated")
+	lines, err := readFileLines(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		return 1
 	}
 
-	contentStart := indexEnd + 1
-	if err := validateNesting(lines, contentStart); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Invalid section nesting: %v\n", err)
+	if args.json {
+		report, err := buildIndexReport(filePath, lines, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if args.filtered() && len(report.Sections) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", args.noMatch())
+			return 1
+		}
+		return printJSON(report)
+	}
+
+	indexLines, inMemory, err := indexText(lines, args)
+	if inMemory {
+		fmt.Fprintf(os.Stderr, "Warning: No INDEX in %s; using an in-memory index (run 'iatf rebuild %s' to persist it)\n", filePath, filePath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
 
-	for _, line := range lines[indexStart+1 : indexEnd] {
+	for _, line := range indexLines {
 		fmt.Println(line)
 	}
 
 	return 0
 }
 
-func readCommand(filePath string, sectionID string) int {
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+// indexText returns the INDEX lines 'iatf index' prints for a document,
+// generated in memory (inMemory) when the file has no INDEX
+func indexText(lines []string, args indexArgs) (indexLines []string, inMemory bool, err error) {
+	indexLines, inMemory, err = loadIndexLines(lines)
+	if err != nil {
+		return indexLines, inMemory, err
+	}
+	if !args.filtered() {
+		if !args.includePrivate {
+			private := privateSections(iatf.ParseSections(lines, iatf.ContentStart(lines)))
+			indexLines = filterIndexEntries(indexLines, func(id string) bool { return !private[id] })
+		}
+		return indexLines, inMemory, nil
+	}
+
+	// Tags and audiences are taken from CONTENT, so an INDEX not rebuilt
+	// since they were edited is still filtered correctly
+	ids := args.selectedSections(iatf.ParseSections(lines, iatf.ContentStart(lines)))
+	if len(ids) == 0 {
+		return nil, inMemory, errors.New(args.noMatch())
+	}
+	return filterIndexEntries(indexLines, func(id string) bool { return ids[id] }), inMemory, nil
+}
+
+// IndexReport is the output of 'iatf index --json': the header fields and
+// sections of a document
+type IndexReport struct {
+	File        string         `json:"file"`
+	Title       string         `json:"title,omitempty"`
+	Purpose     string         `json:"purpose,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Version     string         `json:"version,omitempty"`
+	Updated     string         `json:"updated,omitempty"`
+	Sections    []IndexSection `json:"sections"`
+}
+
+// IndexSection is a section of an IndexReport. Line ranges and hashes are
+// computed from CONTENT; created/modified come from the INDEX.
+type IndexSection struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Level    int      `json:"level"`
+	Start    int      `json:"start"`
+	End      int      `json:"end"`
+	Words    int      `json:"words"`
+	Summary  string   `json:"summary,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Status   string   `json:"status,omitempty"`
+	Owner    string   `json:"owner,omitempty"`
+	ReviewBy string   `json:"review_by,omitempty"`
+	Audience []string `json:"audience,omitempty"`
+	Anchors  []string `json:"anchors,omitempty"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Created  string   `json:"created,omitempty"`
+	Modified string   `json:"modified,omitempty"`
+	Hash     string   `json:"hash"`
+}
+
+// MasterIndexReport is the output of 'iatf index <dir> --json'
+type MasterIndexReport struct {
+	Root  string        `json:"root"`
+	Files []IndexReport `json:"files"`
+}
+
+// indexArgs are the parsed arguments of 'iatf index' after the path
+type indexArgs struct {
+	tags           []string
+	audience       string
+	json           bool
+	includePrivate bool          // List sections marked @visibility: private
+	session        string        // Record the index as printed in this session, if set
+	policy         *accessPolicy // Leave out the sections it denies (servers only)
+}
+
+// parseIndexArgs reads the --tag <tag> pairs, --audience <audience>,
+// --session <id>, --json and --include-private
+func parseIndexArgs(args []string) (indexArgs, error) {
+	parsed := indexArgs{}
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			parsed.json = true
+		case "--include-private":
+			parsed.includePrivate = true
+		case "--session":
+			session, err := parseSessionArg(args, i)
+			if err != nil {
+				return parsed, err
+			}
+			parsed.session = session
+			i++
+		case "--audience":
+			audience, err := parseAudienceArg(args, i)
+			if err != nil {
+				return parsed, err
+			}
+			parsed.audience = audience
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	tags, err := parseTagArgs(rest)
+	parsed.tags = tags
+	return parsed, err
+}
+
+// filtered reports whether only some sections are indexed
+func (a indexArgs) filtered() bool {
+	return len(a.tags) > 0 || a.audience != "" || a.policy.restrictsSections()
+}
+
+// selectedSections returns the IDs of the sections with any of the tags
+// (if given) that are meant for the audience (if given), not private
+// (unless included) and not denied by the access policy
+func (a indexArgs) selectedSections(sections []Section) map[string]bool {
+	excluded := audienceExcluded(sections, a.audience)
+	if !a.includePrivate {
+		for id := range privateSections(sections) {
+			excluded[id] = true
+		}
+	}
+	denied := a.policy.deniedSections(sections)
+	ids := map[string]bool{}
+	for _, section := range sections {
+		if (len(a.tags) == 0 || section.HasTag(a.tags...)) && !excluded[section.ID] && !denied[section.ID] {
+			ids[section.ID] = true
+		}
+	}
+	return ids
+}
+
+// noMatch describes a filter that selected no sections
+func (a indexArgs) noMatch() string {
+	if len(a.tags) == 0 && a.audience == "" {
+		return "No sections available"
+	}
+	if len(a.tags) == 0 {
+		return "No sections for audience: " + a.audience
+	}
+	if a.audience != "" {
+		return fmt.Sprintf("No sections tagged %s for audience %s", strings.Join(a.tags, ", "), a.audience)
+	}
+	return "No sections tagged: " + strings.Join(a.tags, ", ")
+}
+
+// buildIndexReport describes the document at filePath, keeping only the
+// sections selected by args
+func buildIndexReport(filePath string, lines []string, args indexArgs) (IndexReport, error) {
+	header := iatf.ParseHeader(lines)
+	report := IndexReport{
+		File:        filePath,
+		Title:       header.Title,
+		Purpose:     header.Purpose,
+		Description: header.Description,
+		Version:     header.Version,
+		Updated:     header.Updated,
+		Sections:    []IndexSection{},
+	}
+
+	contentStart := iatf.ContentStart(lines)
+	if contentStart == -1 {
+		return report, fmt.Errorf("no ===CONTENT=== section found")
+	}
+	if err := iatf.ValidateNesting(lines, contentStart); err != nil {
+		return report, fmt.Errorf("invalid section nesting: %w", err)
+	}
+
+	metadata := parseIndexMetadata(lines)
+	sections := iatf.ParseSections(lines, contentStart)
+	selected := args.selectedSections(sections)
+	for _, section := range sections {
+		if !selected[section.ID] {
+			continue
+		}
+		report.Sections = append(report.Sections, IndexSection{
+			ID:       section.ID,
+			Title:    section.Title,
+			Level:    section.Level,
+			Start:    section.Start,
+			End:      section.End,
+			Words:    header.CountWords(section.ContentLines),
+			Summary:  section.Summary,
+			Tags:     section.Tags,
+			Status:   section.Status,
+			Owner:    section.Owner,
+			ReviewBy: section.ReviewBy,
+			Audience: section.Audiences,
+			Anchors:  section.Anchors,
+			Aliases:  section.Aliases,
+			Created:  metadata[section.ID].Created,
+			Modified: metadata[section.ID].Modified,
+			Hash:     header.Hash(iatf.Digest(section.ContentLines)),
+		})
+	}
+	return report, nil
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) int {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
+	fmt.Println(string(data))
+	return 0
+}
 
-	content, err := os.ReadFile(filePath)
+// masterIndexCommand indexes every .iatf file under a directory: one entry
+// per document with its header fields and section count, or the full index
+// of each document as JSON
+func masterIndexCommand(directory string, args indexArgs) int {
+	files := []string{}
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".iatf" {
+			files = append(files, path)
+		}
+		return nil
+	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error walking directory: %v\n", err)
 		return 1
 	}
 
-	lines := strings.Split(string(content), "\n")
+	master := MasterIndexReport{Root: directory, Files: []IndexReport{}}
+	failed := false
+	for _, file := range files {
+		content, err := readDocument(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		report, err := buildIndexReport(file, strings.Split(string(content), "\n"), args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Skipping %s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		if args.filtered() && len(report.Sections) == 0 {
+			continue
+		}
+		master.Files = append(master.Files, report)
+	}
 
-	indexStart := -1
-	contentStart := -1
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "===CONTENT===" {
-			contentStart = i + 1
-			break
+	if args.json {
+		if code := printJSON(master); code != 0 {
+			return code
 		}
-		if strings.TrimSpace(line) == "===INDEX===" {
-			indexStart = i
+	} else {
+		for _, line := range masterIndexLines(master.Files) {
+			fmt.Println(line)
+		}
+		if len(master.Files) == 0 {
+			fmt.Printf("No .iatf files found in %s\n", directory)
 		}
 	}
 
-	if indexStart == -1 {
-		fmt.Fprintln(os.Stderr, "Error: No ===INDEX=== section found")
+	if failed {
 		return 1
 	}
+	return 0
+}
 
-	if contentStart == -1 {
-		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
+// masterIndexLines returns the master index of reports: an entry per
+// document with its title, path, section count and description
+func masterIndexLines(reports []IndexReport) []string {
+	lines := []string{}
+	for i, report := range reports {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		title := report.Title
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(report.File), ".iatf")
+		}
+		lines = append(lines, fmt.Sprintf("# %s {%s | sections:%d}", title, report.File, len(report.Sections)))
+		if report.Description != "" {
+			lines = append(lines, "> "+report.Description)
+		} else if report.Purpose != "" {
+			lines = append(lines, "> "+report.Purpose)
+		}
+		details := []string{}
+		if report.Version != "" {
+			details = append(details, "Version: "+report.Version)
+		}
+		if report.Updated != "" {
+			details = append(details, "Updated: "+report.Updated)
+		}
+		if len(details) > 0 {
+			lines = append(lines, "  "+strings.Join(details, " | "))
+		}
+	}
+	return lines
+}
+
+// parseTagArgs reads the --tag <tag> pairs of args
+func parseTagArgs(args []string) ([]string, error) {
+	tags := []string{}
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--tag" {
+			return nil, fmt.Errorf("unknown argument: %s", args[i])
+		}
+		if i+1 >= len(args) || strings.TrimSpace(args[i+1]) == "" {
+			return nil, fmt.Errorf("--tag requires a value")
+		}
+		tags = append(tags, args[i+1])
+		i++
+	}
+	return tags, nil
+}
+
+// readOptions controls what 'iatf read' prints
+type readOptions struct {
+	excludeDrafts  bool          // Leave out sections with @status: draft
+	audience       string        // Leave out sections for other audiences, if set
+	includePrivate bool          // Print sections marked @visibility: private
+	session        string        // Record what is read in this session, if set
+	policy         *accessPolicy // Leave out the sections it denies (servers only)
+}
+
+// privateSections returns the IDs of the sections marked @visibility:
+// private and the sections nested in them
+func privateSections(sections []Section) map[string]bool {
+	private := map[string]bool{}
+	stack := []Section{}
+	for _, section := range sections {
+		for len(stack) >= section.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if section.IsPrivate() || (len(stack) > 0 && private[stack[len(stack)-1].ID]) {
+			private[section.ID] = true
+		}
+		stack = append(stack, section)
+	}
+	return private
+}
+
+// audienceExcluded returns the IDs of the sections not meant for audience:
+// those whose @audience: does not list it, and the sections nested in them
+func audienceExcluded(sections []Section, audience string) map[string]bool {
+	excluded := map[string]bool{}
+	if audience == "" {
+		return excluded
+	}
+	stack := []Section{}
+	for _, section := range sections {
+		for len(stack) >= section.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if !section.ForAudience(audience) || (len(stack) > 0 && excluded[stack[len(stack)-1].ID]) {
+			excluded[section.ID] = true
+		}
+		stack = append(stack, section)
+	}
+	return excluded
+}
+
+// parseAudienceArg reads the value of an --audience flag at args[i]
+func parseAudienceArg(args []string, i int) (string, error) {
+	if i+1 >= len(args) || strings.TrimSpace(args[i+1]) == "" {
+		return "", fmt.Errorf("--audience requires a value")
+	}
+	return strings.TrimSpace(args[i+1]), nil
+}
+
+// readArgs are the parsed arguments of 'iatf read' after the file
+type readArgs struct {
+	id      string
+	anchor  string // Only the region of this anchor of section id
+	title   string
+	tags    []string
+	options readOptions
+}
+
+// parseReadArgs reads a section ID, --title <title> or --tag <tag>...,
+// --anchor, --exclude-drafts, --audience, --include-private and --session
+func parseReadArgs(args []string) (readArgs, error) {
+	parsed := readArgs{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--exclude-drafts":
+			parsed.options.excludeDrafts = true
+		case "--include-private":
+			parsed.options.includePrivate = true
+		case "--session":
+			session, err := parseSessionArg(args, i)
+			if err != nil {
+				return parsed, err
+			}
+			parsed.options.session = session
+			i++
+		case "--audience":
+			audience, err := parseAudienceArg(args, i)
+			if err != nil {
+				return parsed, err
+			}
+			parsed.options.audience = audience
+			i++
+		case "--title", "--tag", "--anchor":
+			if i+1 >= len(args) || strings.TrimSpace(args[i+1]) == "" {
+				return parsed, fmt.Errorf("%s requires a value", args[i])
+			}
+			switch args[i] {
+			case "--title":
+				parsed.title = args[i+1]
+			case "--tag":
+				parsed.tags = append(parsed.tags, args[i+1])
+			default:
+				parsed.anchor = args[i+1]
+			}
+			i++
+		default:
+			if strings.HasPrefix(args[i], "--") || parsed.id != "" {
+				return parsed, fmt.Errorf("unknown argument: %s", args[i])
+			}
+			parsed.id = args[i]
+		}
+	}
+
+	selectors := 0
+	for _, set := range []bool{parsed.id != "", parsed.title != "", len(parsed.tags) > 0} {
+		if set {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		return parsed, fmt.Errorf("expected one of <section-id>, --title or --tag")
+	}
+
+	// <section-id>:<anchor> is short for <section-id> --anchor <anchor>
+	if id, anchor, found := strings.Cut(parsed.id, ":"); found && parsed.anchor == "" {
+		parsed.id, parsed.anchor = id, anchor
+	}
+	if parsed.anchor != "" && parsed.id == "" {
+		return parsed, fmt.Errorf("--anchor requires a <section-id>")
+	}
+	return parsed, nil
+}
+
+// printSection prints the lines of section, leaving out the nested sections
+// that options exclude
+func printSection(lines []string, section Section, sections []Section, options readOptions) {
+	printLines(lines, section.Start, section.End, section.ID, sections, options)
+}
+
+// printLines prints lines start to end (1-indexed, inclusive) of section id;
+// with excludeDrafts, draft sections nested in it are left out, and with an
+// audience, the nested sections meant for others. Nested private sections
+// are replaced by a placeholder unless includePrivate is set.
+func printLines(lines []string, start int, end int, id string, sections []Section, options readOptions) {
+	for _, line := range sectionLines(lines, start, end, id, sections, options) {
+		fmt.Println(line)
+	}
+}
+
+// sectionLines returns the lines printLines prints
+func sectionLines(lines []string, start int, end int, id string, sections []Section, options readOptions) []string {
+	excluded := audienceExcluded(sections, options.audience)
+	for id := range options.policy.deniedSections(sections) {
+		excluded[id] = true
+	}
+	selected := []string{}
+	skipUntil := 0
+	for i := start; i <= end; i++ {
+		if i <= skipUntil {
+			continue
+		}
+		if nested := sectionStartingAt(sections, i); nested != nil && nested.ID != id {
+			if (options.excludeDrafts && nested.Status == iatf.StatusDraft) || excluded[nested.ID] {
+				skipUntil = nested.End
+				continue
+			}
+			if nested.IsPrivate() && !options.includePrivate {
+				selected = append(selected, fmt.Sprintf("[private section omitted: %s]", nested.ID))
+				skipUntil = nested.End
+				continue
+			}
+		}
+		selected = append(selected, lines[i-1])
+	}
+	return selected
+}
+
+// sectionStartingAt returns the section whose open tag is on line (1-indexed)
+func sectionStartingAt(sections []Section, line int) *Section {
+	for i := range sections {
+		if sections[i].Start == line {
+			return &sections[i]
+		}
+	}
+	return nil
+}
+
+// filterIndexEntries keeps the INDEX header and the entries (with their
+// summary and metadata lines) of the sections keep reports true for
+func filterIndexEntries(indexLines []string, keep func(id string) bool) []string {
+	entryRe := regexp.MustCompile(`^#{1,6}\s+.*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|`)
+	filtered := []string{}
+	kept := true
+	for _, line := range indexLines {
+		if match := entryRe.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			kept = keep(match[1])
+		}
+		if kept {
+			filtered = append(filtered, line)
+		}
+	}
+	return filtered
+}
+
+// buildIndexInMemory generates INDEX lines for the file as it currently is,
+// without writing anything. Line ranges refer to the current file layout and
+// no Created/Modified history is available.
+func buildIndexInMemory(lines []string, contentStart int) ([]string, error) {
+	if err := iatf.ValidateNesting(lines, contentStart); err != nil {
+		return nil, fmt.Errorf("invalid section nesting: %w", err)
+	}
+
+	sections := iatf.ParseSections(lines, contentStart)
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no sections found")
+	}
+
+	header := iatf.ParseHeader(lines)
+	for i := range sections {
+		sections[i].WordCount = header.CountWords(sections[i].ContentLines)
+		sections[i].XHash = header.Hash(iatf.Digest(sections[i].ContentLines))
+	}
+
+	contentHash := header.Hash(iatf.Digest(lines[contentStart:]))
+	return generateIndex(sections, contentHash, header.WrapWidth(), nil), nil
+}
+
+// loadIndexLines returns the INDEX block of a file, excluding the ===INDEX===
+// marker. Files that were never rebuilt get an index generated in memory so
+// read-only consumers are not blocked; inMemory reports when that happened.
+func loadIndexLines(lines []string) (indexLines []string, inMemory bool, err error) {
+	indexStart := -1
+	contentStart := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "===INDEX===" {
+			indexStart = i
+		} else if strings.TrimSpace(line) == "===CONTENT===" {
+			contentStart = i + 1
+			break
+		}
+	}
+
+	if contentStart == -1 {
+		return nil, false, fmt.Errorf("no ===CONTENT=== section found")
+	}
+
+	if indexStart == -1 {
+		generated, err := buildIndexInMemory(lines, contentStart)
+		if err != nil {
+			return nil, false, err
+		}
+		return generated[1:], true, nil
+	}
+
+	if err := iatf.ValidateNesting(lines, contentStart); err != nil {
+		return nil, false, fmt.Errorf("invalid section nesting: %w", err)
+	}
+
+	return lines[indexStart+1 : contentStart-1], false, nil
+}
+
+func readCommand(filePath string, sectionID string, anchorName string, options readOptions) int {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+
+	// Anchors are found by scanning CONTENT, so only whole sections can
+	// use the INDEX line ranges
+	if anchorName == "" {
+		if target, sections, window, ok := readIndexedSection(filePath, sectionID); ok {
+			if !sectionReadable(target, sections, sectionID, options) {
+				return 1
+			}
+			printSection(window, target, sections, options)
+			recordSessionRead(options.session, filePath, window, target.ID, "", target.Start, target.End)
+			return 0
+		}
+	}
+
+	lines, err := readFileLines(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+
+	indexStart := -1
+	contentStart := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "===CONTENT===" {
+			contentStart = i + 1
+			break
+		}
+		if strings.TrimSpace(line) == "===INDEX===" {
+			indexStart = i
+		}
+	}
+
+	if contentStart == -1 {
+		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
+		return 1
+	}
+
+	if indexStart == -1 {
+		fmt.Fprintf(os.Stderr, "Warning: No INDEX in %s; reading sections directly from CONTENT (run 'iatf rebuild %s' to create it)\n", filePath, filePath)
+	}
+
+	sections := iatf.ParseSections(lines, contentStart)
+
+	target, alias, found := iatf.ResolveSectionID(sections, sectionID)
+	if !found {
+		fmt.Fprintf(os.Stderr, "Error: Section not found: %s\n", sectionID)
+		return 1
+	}
+	if alias {
+		fmt.Fprintf(os.Stderr, "Note: %s is an alias of %s\n", sectionID, target.ID)
+	}
+	targetSection := &target
+
+	if !sectionReadable(*targetSection, sections, sectionID, options) {
+		return 1
+	}
+
+	if anchorName != "" {
+		anchor, found := iatf.FindAnchor(lines, contentStart, sections, targetSection.ID, anchorName)
+		if !found {
+			fmt.Fprintf(os.Stderr, "Error: Anchor not found: %s:%s\n", targetSection.ID, anchorName)
+			return 1
+		}
+		printLines(lines, anchor.Line, anchor.End, targetSection.ID, sections, options)
+		recordSessionRead(options.session, filePath, lines, targetSection.ID, anchorName, anchor.Line, anchor.End)
+		return 0
+	}
+
+	printSection(lines, *targetSection, sections, options)
+	recordSessionRead(options.session, filePath, lines, targetSection.ID, "", targetSection.Start, targetSection.End)
+	return 0
+}
+
+// sectionReadable reports whether the read options let target be read,
+// printing why not
+func sectionReadable(target Section, sections []Section, sectionID string, options readOptions) bool {
+	if options.excludeDrafts && target.Status == iatf.StatusDraft {
+		fmt.Fprintf(os.Stderr, "Error: Section is a draft: %s\n", sectionID)
+		return false
+	}
+	if audienceExcluded(sections, options.audience)[target.ID] {
+		fmt.Fprintf(os.Stderr, "Error: Section is not for audience %s: %s\n", options.audience, sectionID)
+		return false
+	}
+	if !options.includePrivate && privateSections(sections)[target.ID] {
+		fmt.Fprintf(os.Stderr, "Error: Section is private: %s (use --include-private)\n", sectionID)
+		return false
+	}
+	return true
+}
+
+// readByTagCommand prints every section that has one of tags, in document
+// order. Sections nested in a printed section are not repeated.
+func readByTagCommand(filePath string, tags []string, options readOptions) int {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+
+	content, err := readDocument(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+
+	lines := strings.Split(string(content), "\n")
+	contentStart := iatf.ContentStart(lines)
+	if contentStart == -1 {
+		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
+		return 1
+	}
+	if err := iatf.ValidateNesting(lines, contentStart); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid section nesting: %v\n", err)
+		return 1
+	}
+
+	printed := 0
+	printedEnd := 0
+	sections := iatf.ParseSections(lines, contentStart)
+	excluded := audienceExcluded(sections, options.audience)
+	if !options.includePrivate {
+		for id := range privateSections(sections) {
+			excluded[id] = true
+		}
+	}
+	for _, section := range sections {
+		if !section.HasTag(tags...) || section.Start <= printedEnd {
+			continue
+		}
+		if (options.excludeDrafts && section.Status == iatf.StatusDraft) || excluded[section.ID] {
+			printedEnd = section.End // Its nested sections are left out too
+			continue
+		}
+		if printed > 0 {
+			fmt.Println()
+		}
+		printSection(lines, section, sections, options)
+		recordSessionRead(options.session, filePath, lines, section.ID, "", section.Start, section.End)
+		printed++
+		printedEnd = section.End
+	}
+
+	if printed == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No sections tagged: %s\n", strings.Join(tags, ", "))
+		return 1
+	}
+	return 0
+}
+
+func readByTitleCommand(filePath string, title string, options readOptions) int {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+
+	content, err := readDocument(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+
+	lines := strings.Split(string(content), "\n")
+
+	// readCommand warns about a missing INDEX once the section is resolved
+	indexLines, _, err := loadIndexLines(lines)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	indexEntryPattern := regexp.MustCompile(`^#{1,6}\s+(.+)\s*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|.*\}$`)
+
+	type indexEntry struct {
+		title string
+		id    string
+	}
+
+	entries := []indexEntry{}
+	for _, line := range indexLines {
+		match := indexEntryPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match != nil {
+			entries = append(entries, indexEntry{title: match[1], id: match[2]})
+		}
+	}
+
+	var matchedID string
+
+	for _, entry := range entries {
+		if strings.EqualFold(entry.title, title) {
+			matchedID = entry.id
+			break
+		}
+	}
+
+	if matchedID == "" {
+		titleLower := strings.ToLower(title)
+		for _, entry := range entries {
+			if strings.Contains(strings.ToLower(entry.title), titleLower) {
+				matchedID = entry.id
+				break
+			}
+		}
+	}
+
+	if matchedID == "" {
+		fmt.Fprintf(os.Stderr, "Error: No section found with title matching: %s\n", title)
+		return 1
+	}
+
+	return readCommand(filePath, matchedID, "", options)
+}
+
+// outdatedSection is a section that is due for review
+type outdatedSection struct {
+	file    string
+	section iatf.Section
+	reason  string
+}
+
+// outdatedCommand lists the sections of a file, or of every .iatf file under
+// a directory, that were not modified within the last days days. A section
+// with @review-by: is instead outdated once that date has passed.
+func outdatedCommand(path string, days int) int {
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", path)
+		return 1
+	}
+
+	files, err := listIATFFiles(path, info)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error walking directory: %v\n", err)
+		return 1
+	}
+
+	now := time.Now()
+	// Dates in DateFormat compare as strings
+	cutoff := now.AddDate(0, 0, -days).Format(iatf.DateFormat)
+	today := now.Format(iatf.DateFormat)
+
+	outdated := []outdatedSection{}
+	failed := false
+	for _, file := range files {
+		content, err := readDocument(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		contentStart := iatf.ContentStart(lines)
+		if contentStart == -1 {
+			fmt.Fprintf(os.Stderr, "Warning: No ===CONTENT=== section in %s\n", file)
+			continue
+		}
+
+		metadata := parseIndexMetadata(lines)
+		undated := 0
+		for _, section := range iatf.ParseSections(lines, contentStart) {
+			if _, err := time.Parse(iatf.DateFormat, section.ReviewBy); err == nil {
+				if section.ReviewBy <= today {
+					outdated = append(outdated, outdatedSection{file, section, "review due " + section.ReviewBy})
+				}
+				continue
+			}
+
+			modified := metadata[section.ID].Modified
+			if modified == "" {
+				modified = metadata[section.ID].Created
+			}
+			date, err := time.Parse(iatf.DateFormat, modified)
+			if err != nil {
+				undated++
+				continue
+			}
+			if modified < cutoff {
+				age := int(now.Sub(date).Hours() / 24)
+				outdated = append(outdated, outdatedSection{file, section, fmt.Sprintf("last modified %s (%d days ago)", modified, age)})
+			}
+		}
+		if undated > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d section(s) in %s have no Modified date (run 'iatf rebuild %s')\n", undated, file, file)
+		}
+	}
+
+	for _, entry := range outdated {
+		fmt.Printf("%s:%d: {#%s} %s - %s\n", entry.file, entry.section.Start, entry.section.ID, entry.section.Title, entry.reason)
+	}
+	if len(outdated) > 0 {
+		fmt.Printf("\n%d outdated section(s) (not modified in %d days or past @review-by)\n", len(outdated), days)
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	fmt.Printf("No outdated sections (modified within %d days)\n", days)
+	return 0
+}
+
+// listIATFFiles returns path itself, or the .iatf files under it when it is
+// a directory
+func listIATFFiles(path string, info os.FileInfo) ([]string, error) {
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	files := []string{}
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".iatf" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// verifyCodes are the validation issues about the INDEX Content-Hash that
+// verify reports along with the section hashes
+var verifyCodes = map[string]bool{"W001": true, "W002": true, "W003": true, "W004": true, "W005": true}
+
+// verifyCommand checks the Content-Hash and every section hash of a file,
+// or of every .iatf file under a directory, against CONTENT
+func verifyCommand(path string) int {
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", path)
+		return 1
+	}
+	files, err := listIATFFiles(path, info)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error walking directory: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, file := range files {
+		content, err := readDocument(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+			failed++
+			continue
+		}
+		lines := strings.Split(string(content), "\n")
+		contentStart := iatf.ContentStart(lines)
+		if contentStart == -1 {
+			fmt.Printf("%s: no ===CONTENT=== section\n", file)
+			failed++
+			continue
+		}
+
+		problems := []string{}
+		report := iatf.Validate(lines, iatf.DefaultOptions())
+		for _, issue := range report.Issues() {
+			if verifyCodes[issue.Code] {
+				problems = append(problems, fmt.Sprintf("%s:%d: [%s] %s", file, issue.Line, issue.Code, issue.Message))
+			}
+		}
+		sections := iatf.ParseSections(lines, contentStart)
+		hashes := iatf.IndexHashes(lines)
+		for _, section := range sections {
+			if _, found := hashes[section.ID]; !found && report.HasIndex {
+				problems = append(problems, fmt.Sprintf("%s:%d: {#%s} has no Hash: in the INDEX", file, section.Start, section.ID))
+			}
+		}
+		for _, issue := range iatf.SectionHashIssues(lines, sections) {
+			problems = append(problems, fmt.Sprintf("%s:%d: [%s] %s", file, issue.Line, issue.Code, issue.Message))
+		}
+
+		if len(problems) > 0 {
+			failed++
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			continue
+		}
+		length := iatf.HashesShort
+		if iatf.ParseHeader(lines).FullHashes() {
+			length = iatf.HashesFull
+		}
+		fmt.Printf("%s %s: %d section hash(es) verified (%s)\n", mark(os.Stdout, "[OK]"), file, len(sections), length)
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%s %d of %d file(s) failed verification\n", mark(os.Stdout, "[ERROR]"), failed, len(files))
 		return 1
 	}
+	return 0
+}
 
-	sections := parseContentSection(lines, contentStart)
-
-	var targetSection *Section
-	for i := range sections {
-		if sections[i].ID == sectionID {
-			targetSection = &sections[i]
-			break
+// parseDaysArg reads an optional --days <n> from args
+func parseDaysArg(args []string, defaultDays int) (int, error) {
+	days := defaultDays
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--days" {
+			return 0, fmt.Errorf("unknown argument: %s", args[i])
+		}
+		if i+1 >= len(args) {
+			return 0, fmt.Errorf("--days requires a value")
 		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --days value: %s (expected a whole number of days)", args[i+1])
+		}
+		days = n
+		i++
 	}
+	return days, nil
+}
 
-	if targetSection == nil {
-		fmt.Fprintf(os.Stderr, "Error: Section not found: %s\n", sectionID)
-		return 1
-	}
+// queryFilters selects sections for 'iatf query'. Each kind of filter matches
+// any of its values; a section has to match every kind given.
+type queryFilters struct {
+	owners   []string
+	tags     []string
+	statuses []string
+	invalid  bool // Only sections with validation errors or warnings
+}
 
-	sectionLines := lines[targetSection.Start-1 : targetSection.End]
-	for _, line := range sectionLines {
-		fmt.Println(line)
+// parseQueryArgs reads the --owner, --tag and --status pairs and --invalid
+func parseQueryArgs(args []string) (queryFilters, error) {
+	filters := queryFilters{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--invalid":
+			filters.invalid = true
+		case "--owner", "--tag", "--status":
+			if i+1 >= len(args) || strings.TrimSpace(args[i+1]) == "" {
+				return filters, fmt.Errorf("%s requires a value", args[i])
+			}
+			value := strings.TrimSpace(args[i+1])
+			switch args[i] {
+			case "--owner":
+				filters.owners = append(filters.owners, value)
+			case "--tag":
+				filters.tags = append(filters.tags, value)
+			default:
+				filters.statuses = append(filters.statuses, strings.ToLower(value))
+			}
+			i++
+		default:
+			return filters, fmt.Errorf("unknown argument: %s", args[i])
+		}
 	}
+	return filters, nil
+}
 
-	return 0
+// matches reports whether section passes the filters; issues are the codes
+// of the validation issues inside it
+func (f queryFilters) matches(section iatf.Section, issues []string) bool {
+	if len(f.owners) > 0 && !section.HasOwner(f.owners...) {
+		return false
+	}
+	if len(f.tags) > 0 && !section.HasTag(f.tags...) {
+		return false
+	}
+	if len(f.statuses) > 0 {
+		found := false
+		for _, status := range f.statuses {
+			found = found || section.Status == status
+		}
+		if !found {
+			return false
+		}
+	}
+	return !f.invalid || len(issues) > 0
 }
 
-func readByTitleCommand(filePath string, title string) int {
+// queryCommand lists the sections matching filters with their owner, so that
+// problems can be routed to whoever maintains the section
+func queryCommand(filePath string, filters queryFilters) int {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
 		return 1
 	}
 
-	content, err := os.ReadFile(filePath)
+	content, err := readDocument(filePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		return 1
 	}
 
 	lines := strings.Split(string(content), "\n")
-
-	indexStart := -1
-	indexEnd := -1
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "===INDEX===" {
-			indexStart = i
-		} else if strings.TrimSpace(line) == "===CONTENT===" {
-			indexEnd = i
-			break
-		}
-	}
-
-	if indexStart == -1 || indexEnd == -1 {
-		fmt.Fprintln(os.Stderr, "Error: Invalid iatf file format")
+	contentStart := iatf.ContentStart(lines)
+	if contentStart == -1 {
+		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
 		return 1
 	}
 
-	indexEntryPattern := regexp.MustCompile(`^#{1,6}\s+(.+)\s*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|.*\}$`)
-
-	type indexEntry struct {
-		title string
-		id    string
-	}
+	sections := iatf.ParseSections(lines, contentStart)
 
-	entries := []indexEntry{}
-	for _, line := range lines[indexStart+1 : indexEnd] {
-		match := indexEntryPattern.FindStringSubmatch(strings.TrimSpace(line))
-		if match != nil {
-			entries = append(entries, indexEntry{title: match[1], id: match[2]})
+	// Each issue is charged to the innermost section containing its line
+	issues := map[string][]string{}
+	for _, issue := range iatf.Validate(lines, iatf.DefaultOptions()).Issues() {
+		owner := ""
+		for _, section := range sections {
+			if issue.Line >= section.Start && (issue.Line <= section.End || section.End == 0) {
+				owner = section.ID
+			}
 		}
-	}
-
-	var matchedID string
-
-	for _, entry := range entries {
-		if strings.EqualFold(entry.title, title) {
-			matchedID = entry.id
-			break
+		if owner != "" && !contains(issues[owner], issue.Code) {
+			issues[owner] = append(issues[owner], issue.Code)
 		}
 	}
 
-	if matchedID == "" {
-		titleLower := strings.ToLower(title)
-		for _, entry := range entries {
-			if strings.Contains(strings.ToLower(entry.title), titleLower) {
-				matchedID = entry.id
-				break
-			}
+	matched := 0
+	for _, section := range sections {
+		if !filters.matches(section, issues[section.ID]) {
+			continue
+		}
+		owner := section.Owner
+		if owner == "" {
+			owner = "-"
 		}
+		status := section.Status
+		if status == "" {
+			status = "-"
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\tlines:%d-%d\t%s", section.ID, owner, status, section.Start, section.End, section.Title)
+		if len(issues[section.ID]) > 0 {
+			line += "\t" + strings.Join(issues[section.ID], ",")
+		}
+		fmt.Println(line)
+		matched++
 	}
 
-	if matchedID == "" {
-		fmt.Fprintf(os.Stderr, "Error: No section found with title matching: %s\n", title)
+	if matched == 0 {
+		fmt.Fprintln(os.Stderr, "Error: No sections match the query")
 		return 1
 	}
-
-	return readCommand(filePath, matchedID)
+	return 0
 }
 
 func graphCommand(filePath string, showIncoming bool) int {
-	// Extract base filename first before any shadowing
-	baseFilename := filepath.Base(filePath)
-
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
 		return 1
 	}
 
-	content, err := os.ReadFile(filePath)
+	content, err := readDocument(filePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		return 1
 	}
 
-	lines := strings.Split(string(content), "\n")
+	graph, err := referenceGraph(filepath.Base(filePath), strings.Split(string(content), "\n"), showIncoming, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, line := range graph {
+		fmt.Println(line)
+	}
+	return 0
+}
 
+// referenceGraph returns the lines of 'iatf graph' for a document named
+// name, leaving out the denied sections and the references to and from them
+func referenceGraph(name string, lines []string, showIncoming bool, denied map[string]bool) ([]string, error) {
 	// Find CONTENT section start
 	contentStart := -1
 	for i, line := range lines {
@@ -1705,32 +5105,47 @@ func graphCommand(filePath string, showIncoming bool) int {
 	}
 
 	if contentStart == -1 {
-		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
-		return 1
+		return nil, fmt.Errorf("no ===CONTENT=== section found")
 	}
 
-	if err := validateNesting(lines, contentStart); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Invalid section nesting: %v\n", err)
-		return 1
+	if err := iatf.ValidateNesting(lines, contentStart); err != nil {
+		return nil, fmt.Errorf("invalid section nesting: %w", err)
 	}
 
 	// Parse sections to get ordered list
-	sections := parseContentSection(lines, contentStart)
+	sections := iatf.ParseSections(lines, contentStart)
 
 	if len(sections) == 0 {
-		fmt.Fprintln(os.Stderr, "Error: No sections found in CONTENT")
-		return 1
+		return nil, fmt.Errorf("no sections found in CONTENT")
 	}
 
 	// Extract references (returns map of target -> locations where it's referenced)
 	// This is the "incoming" map: targetID -> who references it
-	incomingRefsMap := extractReferences(lines, contentStart)
+	incomingRefsMap := iatf.ExtractReferences(lines, contentStart)
+
+	// References to an anchor from another section are references to its section
+	for _, ref := range iatf.ExtractAnchorReferences(lines, contentStart) {
+		if ref.Section != ref.ContainingSection {
+			incomingRefsMap[ref.Section] = append(incomingRefsMap[ref.Section], iatf.ReferenceLocation{LineNum: ref.LineNum, ContainingSection: ref.ContainingSection})
+		}
+	}
+
+	// References through an alias are references to its section
+	for alias, canonical := range iatf.AliasTargets(sections) {
+		if locations, exists := incomingRefsMap[alias]; exists {
+			incomingRefsMap[canonical] = append(incomingRefsMap[canonical], locations...)
+			delete(incomingRefsMap, alias)
+		}
+	}
 
 	// Build outgoing reference map (section -> what it references)
 	outgoingRefs := make(map[string][]string)
 	for targetID, locations := range incomingRefsMap {
+		if denied[targetID] {
+			continue
+		}
 		for _, loc := range locations {
-			if loc.ContainingSection != "" {
+			if loc.ContainingSection != "" && !denied[loc.ContainingSection] {
 				// Add targetID to the list of refs from ContainingSection
 				if !contains(outgoingRefs[loc.ContainingSection], targetID) {
 					outgoingRefs[loc.ContainingSection] = append(outgoingRefs[loc.ContainingSection], targetID)
@@ -1742,8 +5157,11 @@ func graphCommand(filePath string, showIncoming bool) int {
 	// Convert incoming refs to simpler format
 	incomingRefs := make(map[string][]string)
 	for targetID, locations := range incomingRefsMap {
+		if denied[targetID] {
+			continue
+		}
 		for _, loc := range locations {
-			if loc.ContainingSection != "" {
+			if loc.ContainingSection != "" && !denied[loc.ContainingSection] {
 				if !contains(incomingRefs[targetID], loc.ContainingSection) {
 					incomingRefs[targetID] = append(incomingRefs[targetID], loc.ContainingSection)
 				}
@@ -1760,31 +5178,23 @@ func graphCommand(filePath string, showIncoming bool) int {
 	}
 
 	// Output in compact format
-	fmt.Printf("@graph: %s\n\n", baseFilename)
-
+	graph := []string{fmt.Sprintf("@graph: %s", name), ""}
+	refs, arrow := outgoingRefs, " -> "
 	if showIncoming {
 		// Show incoming references (who references this section)
-		for _, section := range sections {
-			refs := incomingRefs[section.ID]
-			if len(refs) > 0 {
-				fmt.Printf("%s <- %s\n", section.ID, strings.Join(refs, ", "))
-			} else {
-				fmt.Println(section.ID)
-			}
+		refs, arrow = incomingRefs, " <- "
+	}
+	for _, section := range sections {
+		if denied[section.ID] {
+			continue
 		}
-	} else {
-		// Show outgoing references (what this section references)
-		for _, section := range sections {
-			refs := outgoingRefs[section.ID]
-			if len(refs) > 0 {
-				fmt.Printf("%s -> %s\n", section.ID, strings.Join(refs, ", "))
-			} else {
-				fmt.Println(section.ID)
-			}
+		if len(refs[section.ID]) > 0 {
+			graph = append(graph, section.ID+arrow+strings.Join(refs[section.ID], ", "))
+		} else {
+			graph = append(graph, section.ID)
 		}
 	}
-
-	return 0
+	return graph, nil
 }
 
 func contains(slice []string, value string) bool {
@@ -1796,367 +5206,182 @@ func contains(slice []string, value string) bool {
 	return false
 }
 
-// validateFileQuiet performs validation without printing, returns errors
-func validateFileQuiet(filePath string) (bool, []string) {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return false, []string{fmt.Sprintf("Cannot read file: %v", err)}
-	}
-
-	lines := strings.Split(string(content), "\n")
-	errors := []string{}
-
-	// Check format declaration
-	if len(lines) == 0 || strings.TrimSpace(lines[0]) != ":::IATF" {
-		errors = append(errors, "Missing format declaration (:::IATF)")
+// rebuildBlockers validates filePath as 'iatf validate' does and returns
+// the errors that keep its INDEX from being rebuilt: all of them but those
+// of an INDEX that no longer matches CONTENT, which the rebuild fixes
+func rebuildBlockers(filePath string) []string {
+	// A UTF-16 file is reported by validation (E024)
+	lines, err := readFileLines(filePath)
+	if err != nil && !errors.Is(err, iatf.ErrUTF16) {
+		return []string{fmt.Sprintf("Cannot read file: %v", err)}
 	}
 
-	// Check INDEX and CONTENT sections exist
-	indexPositions := []int{}
-	contentPositions := []int{}
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "===INDEX===" {
-			indexPositions = append(indexPositions, i)
-		} else if strings.TrimSpace(line) == "===CONTENT===" {
-			contentPositions = append(contentPositions, i)
+	blockers := []string{}
+	for _, issue := range iatf.Validate(lines, iatf.DefaultOptions()).Errors {
+		if !contains(rebuildFixes, issue.Code) {
+			blockers = append(blockers, issue.Message)
 		}
 	}
+	return blockers
+}
 
-	hasContent := len(contentPositions) > 0
-	if !hasContent {
-		errors = append(errors, "Missing CONTENT section")
+// parseValidateArgs reads the optional --workspace <dir> and --format <format>
+func parseValidateArgs(args []string) (workspace string, format string, err error) {
+	format = formatText
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--workspace":
+			if i+1 >= len(args) {
+				return "", "", fmt.Errorf("--workspace requires a directory")
+			}
+			workspace = args[i+1]
+		case "--format":
+			if i+1 >= len(args) {
+				return "", "", fmt.Errorf("--format requires a value")
+			}
+			if format, err = parseFormat(args[i+1]); err != nil {
+				return "", "", err
+			}
+		default:
+			return "", "", fmt.Errorf("unknown argument: %s", args[i])
+		}
+		i++
 	}
+	return workspace, format, nil
+}
 
-	if len(indexPositions) > 1 {
-		errors = append(errors, "Multiple INDEX sections found")
+// workspaceIDIssues checks that the section IDs of filePath are not used by
+// any other .iatf file under workspace
+func workspaceIDIssues(filePath string, lines []string, workspace string) ([]iatf.Issue, error) {
+	info, err := os.Stat(workspace)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("workspace is not a directory: %s", workspace)
 	}
-	if len(contentPositions) > 1 {
-		errors = append(errors, "Multiple CONTENT sections found")
-	}
-	if len(indexPositions) > 0 && hasContent && indexPositions[0] > contentPositions[0] {
-		errors = append(errors, "INDEX section appears after CONTENT")
+	files, err := listIATFFiles(workspace, info)
+	if err != nil {
+		return nil, err
 	}
+	self, _ := filepath.Abs(filePath)
 
-	// Validate nesting
-	contentStart := -1
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "===CONTENT===" {
-			contentStart = i + 1
-			break
+	others := map[string][]string{}
+	for _, file := range files {
+		if abs, _ := filepath.Abs(file); abs == self {
+			continue
 		}
-	}
-
-	if contentStart != -1 {
-		if err := validateNesting(lines, contentStart); err != nil {
-			errors = append(errors, fmt.Sprintf("Invalid section nesting: %v", err))
+		content, err := readDocument(file)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	// Check for unclosed/mismatched sections
-	openSections := []string{}
-	for _, line := range lines {
-		if match := sectionOpenPattern.FindStringSubmatch(line); match != nil {
-			openSections = append(openSections, match[1])
-		} else if match := sectionClosePattern.FindStringSubmatch(line); match != nil {
-			id := match[1]
-			if len(openSections) > 0 && openSections[len(openSections)-1] == id {
-				openSections = openSections[:len(openSections)-1]
-			} else {
-				errors = append(errors, fmt.Sprintf("Closing tag without matching opening: %s", id))
-			}
+		otherLines := strings.Split(string(content), "\n")
+		contentStart := iatf.ContentStart(otherLines)
+		if contentStart < 0 {
+			continue
 		}
-	}
-	for _, id := range openSections {
-		errors = append(errors, fmt.Sprintf("Unclosed section: %s", id))
-	}
-
-	// Check for duplicate section IDs
-	sectionIDs := make(map[string]bool)
-	for _, line := range lines {
-		if match := sectionOpenPattern.FindStringSubmatch(line); match != nil {
-			id := match[1]
-			if sectionIDs[id] {
-				errors = append(errors, fmt.Sprintf("Duplicate section ID: %s", id))
-			}
-			sectionIDs[id] = true
+		name, err := filepath.Rel(workspace, file)
+		if err != nil {
+			name = file
+		}
+		for _, section := range iatf.ParseSections(otherLines, contentStart) {
+			others[filepath.ToSlash(name)] = append(others[filepath.ToSlash(name)], section.ID)
 		}
 	}
 
-	// Validate references
-	if contentStart != -1 && len(openSections) == 0 {
-		parsedSections := parseContentSection(lines, contentStart)
-		refErrors := validateReferences(lines, contentStart, parsedSections)
-		errors = append(errors, refErrors...)
+	contentStart := iatf.ContentStart(lines)
+	if contentStart < 0 {
+		return nil, nil
 	}
-
-	return len(errors) == 0, errors
+	return iatf.WorkspaceIDIssues(lines, iatf.ParseSections(lines, contentStart), others), nil
 }
 
-func validateCommand(filePath string) int {
+func validateCommand(filePath string, workspace string, format string) int {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
 		return 1
 	}
 
-	fmt.Printf("Validating: %s\n\n", filePath)
+	if format == formatText {
+		fmt.Printf("Validating: %s\n\n", filePath)
+	}
 
-	content, err := os.ReadFile(filePath)
-	if err != nil {
+	// A UTF-16 file is reported by validation (E024)
+	lines, err := readFileLines(filePath)
+	if err != nil && !errors.Is(err, iatf.ErrUTF16) {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		return 1
 	}
 
-	lines := strings.Split(string(content), "\n")
-	errors := []string{}
-	warnings := []string{}
-
-	if strings.TrimSpace(lines[0]) != ":::IATF" {
-		errors = append(errors, "Missing format declaration (:::IATF)")
-	} else {
-		fmt.Println("[OK] Format declaration found")
-	}
-	indexPositions := []int{}
-	contentPositions := []int{}
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "===INDEX===" {
-			indexPositions = append(indexPositions, i)
-		} else if strings.TrimSpace(line) == "===CONTENT===" {
-			contentPositions = append(contentPositions, i)
+	report := iatf.Validate(lines, iatf.DefaultOptions())
+	if workspace != "" {
+		workspaceErrors, err := workspaceIDIssues(filePath, lines, workspace)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
 		}
+		report.Errors = append(report.Errors, workspaceErrors...)
 	}
-	hasIndex := len(indexPositions) > 0
-	hasContent := len(contentPositions) > 0
-
-	if hasIndex {
-		fmt.Println("[OK] INDEX section found")
-	} else {
-		warnings = append(warnings, "No INDEX section (Run 'iatf rebuild' to create)")
-	}
-
-	if hasContent {
-		fmt.Println("[OK] CONTENT section found")
-	} else {
-		errors = append(errors, "Missing CONTENT section")
-	}
-
-	if len(indexPositions) > 1 {
-		errors = append(errors, "Multiple INDEX sections found")
-	}
-	if len(contentPositions) > 1 {
-		errors = append(errors, "Multiple CONTENT sections found")
-	}
-	if hasIndex && hasContent && indexPositions[0] > contentPositions[0] {
-		errors = append(errors, "INDEX section appears after CONTENT")
-	}
-
-	indexStart := -1
-	contentStart := -1
-	for i, line := range lines {
-		if strings.TrimSpace(line) == "===INDEX===" {
-			indexStart = i
-		} else if strings.TrimSpace(line) == "===CONTENT===" {
-			contentStart = i + 1
-			break
+	if format != formatText {
+		if err := writeValidationReport(os.Stdout, format, []validationResult{{File: filePath, Issues: report.Issues()}}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
 		}
+	} else {
+		writeValidationText(os.Stdout, report)
 	}
-
-	if contentStart != -1 {
-		if err := validateNesting(lines, contentStart); err != nil {
-			errors = append(errors, fmt.Sprintf("Invalid section nesting: %v", err))
-		}
+	if len(report.Errors) > 0 {
+		return 1
 	}
+	return 0
+}
 
-	if hasIndex {
-		contentHashLine := ""
-		if indexStart != -1 && contentStart != -1 {
-			for _, line := range lines[indexStart:contentStart] {
-				if strings.HasPrefix(line, "<!-- Content-Hash:") {
-					contentHashLine = line
-					break
-				}
-			}
-		}
-		if contentHashLine != "" && contentStart != -1 {
-			hashRe := regexp.MustCompile(`^<!-- Content-Hash:\s*([a-z0-9]+):([a-f0-9]+)\s*-->$`)
-			matches := hashRe.FindStringSubmatch(strings.TrimSpace(contentHashLine))
-			if matches == nil {
-				warnings = append(warnings, "Invalid Content-Hash format in INDEX")
-			} else {
-				algo := matches[1]
-				expectedHash := matches[2]
-				if algo != "sha256" {
-					warnings = append(warnings, fmt.Sprintf("Unsupported Content-Hash algorithm: %s", algo))
-				} else {
-					contentText := strings.Join(lines[contentStart:], "\n")
-					sum := sha256.Sum256([]byte(contentText))
-					actualHash := hex.EncodeToString(sum[:])
-					hashMatches := false
-					if len(expectedHash) == 7 {
-						hashMatches = strings.HasPrefix(actualHash, expectedHash)
-					} else {
-						hashMatches = actualHash == expectedHash
-					}
-					if !hashMatches {
-						warnings = append(warnings, "INDEX Content-Hash does not match CONTENT (index may be stale)")
-					}
-				}
-			}
-		} else {
-			warnings = append(warnings, "INDEX missing Content-Hash (Run 'iatf rebuild' to add)")
-		}
-	}
+// writeValidationText writes the text report of 'iatf validate' for report,
+// from the checks that passed to the verdict
+func writeValidationText(w io.Writer, report iatf.Report) {
+	errors := report.Errors
+	warnings := report.Warnings
 
-	openSections := []string{}
-	invalidNesting := false
-	for _, line := range lines {
-		if match := sectionOpenPattern.FindStringSubmatch(line); match != nil {
-			openSections = append(openSections, match[1])
-		} else if match := sectionClosePattern.FindStringSubmatch(line); match != nil {
-			id := match[1]
-			if len(openSections) > 0 && openSections[len(openSections)-1] == id {
-				openSections = openSections[:len(openSections)-1]
-			} else {
-				errors = append(errors, fmt.Sprintf("Closing tag without matching opening: %s", id))
-				invalidNesting = true
-			}
-		}
-	}
-	if len(openSections) > 0 {
-		for _, id := range openSections {
-			errors = append(errors, fmt.Sprintf("Unclosed section: %s", id))
-		}
-		invalidNesting = true
-	}
-	if !invalidNesting {
-		fmt.Println("[OK] All sections properly closed")
+	if report.HasFormat {
+		fmt.Fprintf(w, "%s Format declaration found\n", mark(w, "[OK]"))
 	}
-
-	if !invalidNesting && contentStart != -1 {
-		contentOpen := []string{}
-		for i := contentStart; i < len(lines); i++ {
-			line := lines[i]
-			if match := sectionOpenPattern.FindStringSubmatch(line); match != nil {
-				contentOpen = append(contentOpen, match[1])
-				continue
-			}
-			if match := sectionClosePattern.FindStringSubmatch(line); match != nil {
-				if len(contentOpen) > 0 && contentOpen[len(contentOpen)-1] == match[1] {
-					contentOpen = contentOpen[:len(contentOpen)-1]
-				}
-				continue
-			}
-			if len(contentOpen) == 0 && strings.TrimSpace(line) != "" {
-				errors = append(errors, fmt.Sprintf("Content outside section block at line %d", i+1))
-				break
-			}
-		}
+	if report.HasIndex {
+		fmt.Fprintf(w, "%s INDEX section found\n", mark(w, "[OK]"))
 	}
-
-	if !invalidNesting && hasIndex && contentStart != -1 && indexStart != -1 {
-		indexEntryRe := regexp.MustCompile(`^#{1,6}\s+.*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|\s*lines:(\d+)-(\d+)[^}]*\}$`)
-		indexRanges := map[string][2]int{}
-		for _, line := range lines[indexStart+1 : contentStart] {
-			match := indexEntryRe.FindStringSubmatch(strings.TrimSpace(line))
-			if match == nil {
-				continue
-			}
-			id := match[1]
-			start := match[2]
-			end := match[3]
-			if _, exists := indexRanges[id]; exists {
-				errors = append(errors, fmt.Sprintf("Duplicate INDEX section ID: %s", id))
-				continue
-			}
-			startNum := 0
-			endNum := 0
-			fmt.Sscanf(start, "%d", &startNum)
-			fmt.Sscanf(end, "%d", &endNum)
-			if startNum < 1 || endNum < startNum || endNum > len(lines) {
-				errors = append(errors, fmt.Sprintf("Invalid line range for INDEX section: %s", id))
-			}
-			indexRanges[id] = [2]int{startNum, endNum}
-		}
-
-		contentSections := map[string][2]int{}
-		parsedSections := parseContentSection(lines, contentStart)
-		for _, section := range parsedSections {
-			contentSections[section.ID] = [2]int{section.Start, section.End}
-			if section.Level > 2 {
-				errors = append(errors, fmt.Sprintf("Section nesting exceeds 2 levels: %s", section.ID))
-			}
-		}
-
-		for id := range indexRanges {
-			if _, exists := contentSections[id]; !exists {
-				errors = append(errors, fmt.Sprintf("INDEX references missing CONTENT section: %s", id))
-			}
-		}
-		for id := range contentSections {
-			if _, exists := indexRanges[id]; !exists {
-				errors = append(errors, fmt.Sprintf("CONTENT section missing from INDEX: %s", id))
-			}
-		}
-		for id, contentRange := range contentSections {
-			if indexRange, exists := indexRanges[id]; exists {
-				if indexRange != contentRange {
-					errors = append(errors, fmt.Sprintf("INDEX line range mismatch for section: %s", id))
-				}
-			}
-		}
+	if report.HasContent {
+		fmt.Fprintf(w, "%s CONTENT section found\n", mark(w, "[OK]"))
 	}
-
-	sectionIDs := make(map[string]bool)
-	for _, line := range lines {
-		if match := sectionOpenPattern.FindStringSubmatch(line); match != nil {
-			id := match[1]
-			if sectionIDs[id] {
-				errors = append(errors, fmt.Sprintf("Duplicate section ID: %s", id))
-			}
-			sectionIDs[id] = true
-		}
+	if report.Closed {
+		fmt.Fprintf(w, "%s All sections properly closed\n", mark(w, "[OK]"))
 	}
-
-	if len(sectionIDs) > 0 {
-		fmt.Printf("[OK] Found %d section(s) with unique IDs\n", len(sectionIDs))
-	} else {
-		warnings = append(warnings, "No sections found in CONTENT")
+	if report.SectionCount > 0 {
+		fmt.Fprintf(w, "%s Found %d section(s) with unique IDs\n", mark(w, "[OK]"), report.SectionCount)
 	}
-
-	if !invalidNesting && contentStart != -1 {
-		parsedSectionsForRefs := parseContentSection(lines, contentStart)
-		refErrors := validateReferences(lines, contentStart, parsedSectionsForRefs)
-		if len(refErrors) == 0 {
-			fmt.Println("[OK] All references valid")
-		} else {
-			for _, refErr := range refErrors {
-				errors = append(errors, refErr)
-			}
-		}
+	if report.ReferencesValid {
+		fmt.Fprintf(w, "%s All references valid\n", mark(w, "[OK]"))
 	}
 
-	fmt.Println()
+	fmt.Fprintln(w)
 	if len(errors) > 0 {
-		fmt.Printf("[ERROR] %d error(s) found:\n", len(errors))
+		fmt.Fprintf(w, "%s %d error(s) found:\n", mark(w, "[ERROR]"), len(errors))
 		for _, err := range errors {
-			fmt.Printf("  - %s\n", err)
+			fmt.Fprintf(w, "  - [%s] %s\n", err.Code, err.Message)
 		}
 	}
 
 	if len(warnings) > 0 {
-		fmt.Printf("[WARN] %d warning(s):\n", len(warnings))
+		fmt.Fprintf(w, "%s %d warning(s):\n", mark(w, "[WARN]"), len(warnings))
 		for _, warn := range warnings {
-			fmt.Printf("  - %s\n", warn)
+			fmt.Fprintf(w, "  - [%s] %s\n", warn.Code, warn.Message)
 		}
 	}
 
+	if len(errors) > 0 || len(warnings) > 0 {
+		fmt.Fprintln(w, "\nRun 'iatf explain <code>' for details on any issue.")
+	}
+
 	if len(errors) == 0 && len(warnings) == 0 {
-		fmt.Println("[OK] File is valid!")
-		return 0
+		fmt.Fprintf(w, "%s File is valid!\n", mark(w, "[OK]"))
 	} else if len(errors) == 0 {
-		fmt.Println("\n[WARN] File is valid (with warnings)")
-		return 0
+		fmt.Fprintf(w, "\n%s File is valid (with warnings)\n", mark(w, "[WARN]"))
+	} else {
+		fmt.Fprintf(w, "\n%s File is invalid\n", mark(w, "[ERROR]"))
 	}
-
-	fmt.Println("\n[ERROR] File is invalid")
-	return 1
 }
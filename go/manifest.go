@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Formats of 'iatf manifest'
+const (
+	manifestMCP       = "mcp"       // The tools/list result of 'iatf mcp'
+	manifestOpenAI    = "openai"    // Chat Completions "tools" array
+	manifestAnthropic = "anthropic" // Messages API "tools" array
+)
+
+// parseManifestArgs reads --format <format>, defaulting to mcp
+func parseManifestArgs(args []string) (string, error) {
+	format := manifestMCP
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--format" {
+			return format, fmt.Errorf("unknown option: %s", args[i])
+		}
+		if i+1 >= len(args) {
+			return format, fmt.Errorf("--format requires a value")
+		}
+		format = args[i+1]
+		i++
+	}
+	switch format {
+	case manifestMCP, manifestOpenAI, manifestAnthropic:
+		return format, nil
+	}
+	return format, fmt.Errorf("invalid format %q (expected openai, anthropic or mcp)", format)
+}
+
+// manifestCommand prints the tools of 'iatf mcp' with their parameter
+// schemas, in the shape a function-calling API expects, so agent builders
+// can register them without copying definitions by hand
+func manifestCommand(format string) int {
+	tools := mcpTools()
+	switch format {
+	case manifestOpenAI:
+		functions := make([]map[string]interface{}, 0, len(tools))
+		for _, tool := range tools {
+			functions = append(functions, map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        tool.Name,
+					"description": tool.Description,
+					"parameters":  tool.InputSchema,
+				},
+			})
+		}
+		return printJSON(functions)
+	case manifestAnthropic:
+		definitions := make([]map[string]interface{}, 0, len(tools))
+		for _, tool := range tools {
+			definitions = append(definitions, map[string]interface{}{
+				"name":         tool.Name,
+				"description":  tool.Description,
+				"input_schema": tool.InputSchema,
+			})
+		}
+		return printJSON(definitions)
+	case manifestMCP:
+		return printJSON(map[string]interface{}{"tools": tools})
+	}
+	fmt.Fprintf(os.Stderr, "Error: invalid format %q\n", format)
+	return 1
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf mcp' is a Model Context Protocol server on stdin/stdout: one JSON-RPC
+// 2.0 message per line. Its tools answer as the iatf commands would for the
+// .iatf files of a workspace directory, with paths relative to it, so agents
+// can traverse documents without a shell.
+
+// mcpProtocolVersions are the MCP revisions the server speaks, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// mcpTool describes a tool in the tools/list result
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// mcpContent is a block of a tools/call result
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult is the result of tools/call. Failures of the tool itself
+// (a missing file or section) are results with IsError set, so the agent
+// sees the message, rather than JSON-RPC errors.
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// mcpToolArgs are the arguments of all tools; each tool reads its own
+type mcpToolArgs struct {
+	File         string   `json:"file"`
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	Anchor       string   `json:"anchor"`
+	Tags         []string `json:"tags"`
+	Audience     string   `json:"audience"`
+	Query        string   `json:"query"`
+	Limit        int      `json:"limit"`
+	ShowIncoming bool     `json:"show_incoming"`
+	Code         string   `json:"code"`
+}
+
+// mcpServer answers MCP requests for the .iatf files under root. Every tool
+// is answered in-process, so the access policy applies to all of them the
+// same way; a nil policy (--include-private without a policy file) allows
+// everything.
+type mcpServer struct {
+	root   string
+	policy *accessPolicy
+}
+
+// mcpCommand serves MCP on stdin/stdout until stdin is closed
+func mcpCommand(args serverArgs) int {
+	absRoot, policy, err := openWorkspace(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	server := &mcpServer{root: absRoot, policy: policy}
+	if err := serveJSONRPC(os.Stdin, os.Stdout, server.handle); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// handle answers a request
+func (s *mcpServer) handle(request rpcRequest) rpcResponse {
+	response := rpcResponse{JSONRPC: "2.0", ID: request.ID}
+	switch request.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(request.Params, &params)
+		version := mcpProtocolVersions[0]
+		if contains(mcpProtocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		response.Result = map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "iatf", "version": Version},
+			"instructions":    "Start with iatf_index (no file) to list the documents of the workspace, then iatf_index on a file and iatf_read_section for the sections you need.",
+		}
+	case "ping":
+		response.Result = map[string]interface{}{}
+	case "tools/list":
+		response.Result = map[string]interface{}{"tools": mcpTools()}
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			response.Error = &rpcError{Code: rpcInvalidParams, Message: "Invalid params: " + err.Error()}
+			return response
+		}
+		args := mcpToolArgs{}
+		if len(params.Arguments) > 0 {
+			if err := json.Unmarshal(params.Arguments, &args); err != nil {
+				response.Error = &rpcError{Code: rpcInvalidParams, Message: "Invalid arguments: " + err.Error()}
+				return response
+			}
+		}
+		result, known := s.callTool(params.Name, args)
+		if !known {
+			response.Error = &rpcError{Code: rpcInvalidParams, Message: "Unknown tool: " + params.Name}
+			return response
+		}
+		response.Result = result
+	default:
+		response.Error = &rpcError{Code: rpcMethodNotFound, Message: "Method not found: " + request.Method}
+	}
+	return response
+}
+
+// mcpSchema builds a JSON schema for an object with the given properties
+func mcpSchema(required []string, properties map[string]interface{}) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func mcpString(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+// mcpTools lists the tools of the server
+func mcpTools() []mcpTool {
+	file := mcpString("Path of the .iatf file, relative to the workspace")
+	audience := mcpString("Leave out sections whose @audience: does not include this audience")
+	return []mcpTool{
+		{
+			Name:        "iatf_index",
+			Description: "Table of contents. Without file: every .iatf document of the workspace with its title and section count. With file: the document's INDEX (section IDs, titles, line ranges, summaries).",
+			InputSchema: mcpSchema(nil, map[string]interface{}{
+				"file":     mcpString("Path of the .iatf file, relative to the workspace; omit for all documents"),
+				"tags":     map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}, "description": "Only sections with any of these tags"},
+				"audience": audience,
+			}),
+		},
+		{
+			Name:        "iatf_read_section",
+			Description: "Read one section of a document, by ID (optionally one {#id:anchor} region of it) or by exact title.",
+			InputSchema: mcpSchema([]string{"file"}, map[string]interface{}{
+				"file":     file,
+				"id":       mcpString("Section ID, as listed by iatf_index"),
+				"title":    mcpString("Exact section title, instead of id"),
+				"anchor":   mcpString("Anchor name, to read only that region of the section"),
+				"audience": audience,
+			}),
+		},
+		{
+			Name:        "iatf_search",
+			Description: "Find sections whose title, summary or content contain every word of the query (case-insensitive), in one document or the whole workspace.",
+			InputSchema: mcpSchema([]string{"query"}, map[string]interface{}{
+				"query": mcpString("Words to look for"),
+				"file":  mcpString("Only search this .iatf file, relative to the workspace"),
+				"limit": map[string]interface{}{"type": "integer", "description": "Maximum number of sections to return (default 20)"},
+			}),
+		},
+		{
+			Name:        "iatf_graph",
+			Description: "Section reference graph of a document: which sections each section references, or with show_incoming, which sections reference it.",
+			InputSchema: mcpSchema([]string{"file"}, map[string]interface{}{
+				"file":          file,
+				"show_incoming": map[string]interface{}{"type": "boolean", "description": "List incoming instead of outgoing references"},
+			}),
+		},
+		{
+			Name:        "iatf_validate",
+			Description: "Validate a document and list its errors and warnings.",
+			InputSchema: mcpSchema([]string{"file"}, map[string]interface{}{
+				"file": file,
+			}),
+		},
+		{
+			Name:        "iatf_explain",
+			Description: "Explain a validation error or warning code, as reported by iatf_validate: what it means, common causes and how to fix it. Without code, list every code.",
+			InputSchema: mcpSchema(nil, map[string]interface{}{
+				"code": mcpString("Code such as E008 (case-insensitive); omit to list all codes"),
+			}),
+		},
+	}
+}
+
+// callTool runs a tool; known is false when there is no tool called name
+func (s *mcpServer) callTool(name string, args mcpToolArgs) (result mcpToolResult, known bool) {
+	switch name {
+	case "iatf_index":
+		return s.index(args), true
+	case "iatf_read_section":
+		return s.read(args), true
+	case "iatf_search":
+		return s.search(args), true
+	case "iatf_graph":
+		return s.graph(args), true
+	case "iatf_validate":
+		return s.validate(args), true
+	case "iatf_explain":
+		return explain(args.Code), true
+	}
+	return mcpToolResult{}, false
+}
+
+// resolve checks that file is a .iatf file inside the workspace that the
+// access policy allows and returns its path relative to the root
+func (s *mcpServer) resolve(file string) (string, error) {
+	rel, err := resolveWorkspaceFile(s.root, file)
+	if err == nil && !s.policy.fileAllowed(rel) {
+		return "", fmt.Errorf("file not found: %s", file)
+	}
+	return rel, err
+}
+
+// load resolves and parses a document of the workspace
+func (s *mcpServer) load(file string) (string, *document, error) {
+	rel, err := s.resolve(file)
+	if err != nil {
+		return "", nil, err
+	}
+	doc, err := loadDocument(filepath.Join(s.root, rel))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, fmt.Errorf("file not found: %s", file)
+	}
+	return filepath.ToSlash(rel), doc, err
+}
+
+// index answers iatf_index in-process as 'iatf index' would, leaving out
+// what the access policy denies
+func (s *mcpServer) index(args mcpToolArgs) mcpToolResult {
+	filter := indexArgs{tags: args.Tags, audience: args.Audience, includePrivate: true, policy: s.policy}
+	if args.File == "" {
+		reports := []IndexReport{}
+		for _, rel := range workspaceFiles(s.root) {
+			if !s.policy.fileAllowed(rel) {
+				continue
+			}
+			doc, err := loadDocument(filepath.Join(s.root, rel))
+			if err != nil {
+				continue
+			}
+			report, err := buildIndexReport(filepath.ToSlash(rel), doc.lines, filter)
+			if err != nil || (filter.filtered() && len(report.Sections) == 0) {
+				continue
+			}
+			reports = append(reports, report)
+		}
+		if len(reports) == 0 {
+			return mcpToolResult{Content: []mcpContent{{Type: "text", Text: "No .iatf files found in ."}}}
+		}
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: strings.Join(masterIndexLines(reports), "\n")}}}
+	}
+
+	_, doc, err := s.load(args.File)
+	if err != nil {
+		return mcpError(err)
+	}
+	lines, _, err := indexText(doc.lines, filter)
+	if err != nil {
+		return mcpError(err)
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: strings.TrimRight(strings.Join(lines, "\n"), "\n")}}}
+}
+
+// read answers iatf_read_section in-process as 'iatf read' would, leaving
+// out what the access policy denies
+func (s *mcpServer) read(args mcpToolArgs) mcpToolResult {
+	rel, doc, err := s.load(args.File)
+	if err != nil {
+		return mcpError(err)
+	}
+	id := args.ID
+	if args.Title != "" {
+		id = ""
+		denied := s.policy.deniedSections(doc.sections)
+		for _, section := range doc.sections {
+			if strings.EqualFold(section.Title, args.Title) && !denied[section.ID] && id == "" {
+				id = section.ID
+			}
+		}
+		if id == "" {
+			return mcpError(fmt.Errorf("no section found with title: %s", args.Title))
+		}
+	} else if id == "" {
+		return mcpError(fmt.Errorf("id or title is required"))
+	}
+
+	section, err := sectionContent(rel, doc.lines, id, args.Anchor, readOptions{audience: args.Audience, includePrivate: true, policy: s.policy})
+	if err != nil {
+		return mcpError(err)
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: section.Content}}}
+}
+
+// graph answers iatf_graph in-process as 'iatf graph' would, leaving out
+// the sections the access policy denies and their references
+func (s *mcpServer) graph(args mcpToolArgs) mcpToolResult {
+	rel, doc, err := s.load(args.File)
+	if err != nil {
+		return mcpError(err)
+	}
+	graph, err := referenceGraph(filepath.Base(rel), doc.lines, args.ShowIncoming, s.policy.deniedSections(doc.sections))
+	if err != nil {
+		return mcpError(err)
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: strings.Join(graph, "\n")}}}
+}
+
+// validate answers iatf_validate in-process as 'iatf validate' would,
+// leaving out the issues in sections the access policy denies
+func (s *mcpServer) validate(args mcpToolArgs) mcpToolResult {
+	rel, doc, err := s.load(args.File)
+	if err != nil {
+		return mcpError(err)
+	}
+	report := iatf.Validate(doc.lines, iatf.DefaultOptions())
+	issues := s.policy.visibleIssues(doc.lines, doc.sections, report.Issues())
+	report.Errors, report.Warnings = nil, nil
+	for _, issue := range issues {
+		if issue.Severity == iatf.SeverityError {
+			report.Errors = append(report.Errors, issue)
+		} else {
+			report.Warnings = append(report.Warnings, issue)
+		}
+	}
+	report.SectionCount -= len(s.policy.deniedSections(doc.sections))
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Validating: %s\n\n", rel)
+	writeValidationText(&text, report)
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: strings.TrimRight(text.String(), "\n")}}, IsError: len(report.Errors) > 0}
+}
+
+func mcpError(err error) mcpToolResult {
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: "Error: " + err.Error()}}, IsError: true}
+}
+
+// explain answers iatf_explain with the text of 'iatf explain'
+func explain(code string) mcpToolResult {
+	if code == "" {
+		codes := []string{}
+		for _, doc := range issueDocs {
+			codes = append(codes, doc.Code+"  "+doc.Title)
+		}
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: strings.Join(codes, "\n")}}}
+	}
+	doc, found := findIssueDoc(code)
+	if !found {
+		return mcpError(fmt.Errorf("unknown code: %s", code))
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: strings.TrimRight(renderIssueDoc(doc), "\n")}}}
+}
+
+// search lists the sections containing every word of the query
+func (s *mcpServer) search(args mcpToolArgs) mcpToolResult {
+	terms := strings.Fields(strings.ToLower(args.Query))
+	if len(terms) == 0 {
+		return mcpError(fmt.Errorf("query is required"))
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	hits, err := searchWorkspace(s.root, args.File, terms, loadDocument, s.policy)
+	if err != nil {
+		return mcpError(err)
+	}
+
+	if len(hits) == 0 {
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: "No sections match: " + args.Query}}}
+	}
+	var text strings.Builder
+	for i, hit := range hits {
+		if i == limit {
+			fmt.Fprintf(&text, "... %d more; narrow the query or raise limit\n", len(hits)-limit)
+			break
+		}
+		fmt.Fprintf(&text, "%s#%s  %s (lines %d-%d)\n", hit.File, hit.Section.ID, hit.Section.Title, hit.Section.Start, hit.Section.End)
+		if hit.Line > 0 {
+			fmt.Fprintf(&text, "  %d: %s\n", hit.Line, hit.Text)
+		}
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: strings.TrimRight(text.String(), "\n")}}}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// maxNotificationLength caps the notification body; desktop notifiers
+// truncate long text anyway
+const maxNotificationLength = 200
+
+// failureNotices remembers the last failure notified for each file, so a file
+// that stays broken across saves raises one notification per distinct error
+var failureNotices = struct {
+	sync.Mutex
+	last map[string]string
+}{last: make(map[string]string)}
+
+// notifyFailure raises a desktop notification that filePath failed to
+// validate or rebuild, unless the same failure was already reported
+func notifyFailure(filePath string, heading string, detail string) {
+	if err := sendFailureNotice(filePath, heading, detail); err != nil {
+		fmt.Printf("[%s] Notification failed: %v\n", filepath.Base(filePath), err)
+	}
+}
+
+// logNotifyFailure is notifyFailure for the daemon, which reports problems
+// in its log
+func logNotifyFailure(filePath string, heading string, detail string) {
+	if err := sendFailureNotice(filePath, heading, detail); err != nil {
+		daemonLog(logComponentNotify).Warn("Notification failed", "file", filePath, "error", err)
+	}
+}
+
+// sendFailureNotice shows the notification for notifyFailure
+func sendFailureNotice(filePath string, heading string, detail string) error {
+	failureNotices.Lock()
+	if failureNotices.last[filePath] == detail {
+		failureNotices.Unlock()
+		return nil
+	}
+	failureNotices.last[filePath] = detail
+	failureNotices.Unlock()
+
+	message := fmt.Sprintf("%s: %s", filepath.Base(filePath), detail)
+	if len(message) > maxNotificationLength {
+		message = message[:maxNotificationLength-3] + "..."
+	}
+	return sendDesktopNotification("IATF: "+heading, message)
+}
+
+// clearFailureNotice forgets the failure recorded for filePath after it
+// rebuilds successfully, so the next failure notifies again
+func clearFailureNotice(filePath string) {
+	failureNotices.Lock()
+	delete(failureNotices.last, filePath)
+	failureNotices.Unlock()
+}
+
+// summarizeProblems formats validation errors for a notification body
+func summarizeProblems(problems []string) string {
+	if len(problems) == 0 {
+		return ""
+	}
+	if len(problems) == 1 {
+		return problems[0]
+	}
+	return fmt.Sprintf("%s (+%d more)", problems[0], len(problems)-1)
+}
+
+// sendDesktopNotification shows a notification without waiting for the
+// notifier to exit
+func sendDesktopNotification(title string, message string) error {
+	cmd := desktopNotificationCommand(title, message)
+	if cmd == nil {
+		return errors.New("desktop notifications are not supported on this platform")
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
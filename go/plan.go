@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf plan' automates "index first, then read selectively": it ranks the
+// sections of a document for a query and lists the ones worth reading, in
+// document order, within a token budget.
+
+// defaultPlanBudget is the token budget of a plan without --budget
+const defaultPlanBudget = 8000
+
+// Scores of a query word found in each part of a section; a section linked
+// by a reference to a matching one gets planNeighborShare of its score
+const (
+	planTitleScore    = 3.0
+	planSummaryScore  = 2.0
+	planTagScore      = 2.0
+	planContentScore  = 1.0
+	planNeighborShare = 0.5
+)
+
+// planArgs are the parsed arguments of 'iatf plan' after the file
+type planArgs struct {
+	query          string
+	budget         int
+	json           bool
+	includePrivate bool // Rank sections marked @visibility: private too
+}
+
+// PlanReport is the output of 'iatf plan --json'
+type PlanReport struct {
+	File        string     `json:"file"`
+	Query       string     `json:"query"`
+	Budget      int        `json:"budget"`
+	Tokens      int        `json:"tokens"`          // Estimated tokens of the steps
+	TotalTokens int        `json:"document_tokens"` // Estimated tokens of all of CONTENT
+	Steps       []PlanStep `json:"steps"`
+	Skipped     []PlanStep `json:"skipped,omitempty"` // Relevant, but over the budget
+}
+
+// PlanStep is a section of a reading plan
+type PlanStep struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Start   int      `json:"start"`
+	End     int      `json:"end"`
+	Tokens  int      `json:"tokens"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// parsePlanArgs reads the query words, --budget <tokens>, --json and
+// --include-private
+func parsePlanArgs(args []string) (planArgs, error) {
+	parsed := planArgs{budget: defaultPlanBudget}
+	words := []string{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			parsed.json = true
+		case "--include-private":
+			parsed.includePrivate = true
+		case "--budget":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("--budget requires a number of tokens")
+			}
+			budget, err := strconv.Atoi(args[i+1])
+			if err != nil || budget <= 0 {
+				return parsed, fmt.Errorf("invalid budget %q (expected a positive number of tokens)", args[i+1])
+			}
+			parsed.budget = budget
+			i++
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				return parsed, fmt.Errorf("unknown option: %s", args[i])
+			}
+			words = append(words, args[i])
+		}
+	}
+	parsed.query = strings.Join(words, " ")
+	if strings.TrimSpace(parsed.query) == "" {
+		return parsed, fmt.Errorf("missing query")
+	}
+	return parsed, nil
+}
+
+// estimateTokens approximates the tokens a model needs for lines, at the
+// usual four characters per token of English text
+func estimateTokens(lines []string) int {
+	chars := 0
+	for _, line := range lines {
+		chars += len(line) + 1
+	}
+	return (chars + 3) / 4
+}
+
+// planCommand prints the reading plan of a document for a query
+func planCommand(filePath string, args planArgs) int {
+	content, err := readDocument(filePath)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+
+	report, err := buildReadingPlan(filePath, strings.Split(string(content), "\n"), args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if args.json {
+		return printJSON(report)
+	}
+	if len(report.Steps) == 0 && len(report.Skipped) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No sections match: %s\n", args.query)
+		return 1
+	}
+
+	fmt.Printf("@plan: %s \"%s\" (~%d of %d tokens budget, document ~%d)\n\n", filepath.Base(filePath), report.Query, report.Tokens, report.Budget, report.TotalTokens)
+	for i, step := range report.Steps {
+		fmt.Printf("%d. %s  %s (lines %d-%d, ~%d tokens)\n", i+1, step.ID, step.Title, step.Start, step.End, step.Tokens)
+		fmt.Printf("   %s\n", strings.Join(step.Reasons, "; "))
+	}
+	if len(report.Skipped) > 0 {
+		ids := []string{}
+		for _, step := range report.Skipped {
+			ids = append(ids, fmt.Sprintf("%s (~%d)", step.ID, step.Tokens))
+		}
+		fmt.Printf("\nOver budget: %s\n", strings.Join(ids, ", "))
+	}
+	if len(report.Steps) > 0 {
+		fmt.Printf("\nRead with: iatf read %s %s\n", filePath, report.Steps[0].ID)
+	}
+	return 0
+}
+
+// buildReadingPlan ranks the sections of a document for the query and
+// picks the best ones that fit the budget. A section contains its nested
+// sections, so a nested section is dropped when its parent is picked.
+// Private sections are left out, as 'iatf read' refuses them, unless
+// includePrivate is set.
+func buildReadingPlan(filePath string, lines []string, args planArgs) (PlanReport, error) {
+	report := PlanReport{File: filePath, Query: args.query, Budget: args.budget, Steps: []PlanStep{}}
+	contentStart := iatf.ContentStart(lines)
+	if contentStart == -1 {
+		return report, fmt.Errorf("no ===CONTENT=== section found")
+	}
+	if err := iatf.ValidateNesting(lines, contentStart); err != nil {
+		return report, fmt.Errorf("invalid section nesting: %w", err)
+	}
+	sections := iatf.ParseSections(lines, contentStart)
+	report.TotalTokens = estimateTokens(lines[contentStart:])
+
+	private := map[string]bool{}
+	if !args.includePrivate {
+		private = privateSections(sections)
+	}
+
+	terms := strings.Fields(strings.ToLower(args.query))
+	steps := map[string]*PlanStep{}
+	for _, section := range sections {
+		if private[section.ID] {
+			continue
+		}
+		step := &PlanStep{ID: section.ID, Title: section.Title, Start: section.Start, End: section.End}
+		end := section.End
+		if end == 0 {
+			end = len(lines)
+		}
+		step.Tokens = estimateTokens(lines[section.Start-1 : end])
+
+		title := strings.ToLower(section.Title)
+		summary := strings.ToLower(section.Summary)
+		body := strings.ToLower(strings.Join(section.ContentLines, "\n"))
+		matched := map[string][]string{}
+		for _, term := range terms {
+			switch {
+			case strings.Contains(title, term):
+				step.Score += planTitleScore
+				matched["title"] = append(matched["title"], term)
+			case strings.Contains(summary, term):
+				step.Score += planSummaryScore
+				matched["summary"] = append(matched["summary"], term)
+			case section.HasTag(term):
+				step.Score += planTagScore
+				matched["tags"] = append(matched["tags"], term)
+			case strings.Contains(body, term):
+				step.Score += planContentScore
+				matched["content"] = append(matched["content"], term)
+			}
+		}
+		for _, part := range []string{"title", "summary", "tags", "content"} {
+			if len(matched[part]) > 0 {
+				step.Reasons = append(step.Reasons, fmt.Sprintf("%s matches %s", part, strings.Join(matched[part], ", ")))
+			}
+		}
+		steps[section.ID] = step
+	}
+
+	// Sections linked to a match by a reference either way are likely
+	// prerequisites or follow-ups
+	direct := map[string]float64{}
+	for id, step := range steps {
+		direct[id] = step.Score
+	}
+	references := sectionReferences(lines, contentStart, sections)
+	for _, section := range sections {
+		from := section.ID
+		for _, to := range references[from] {
+			if steps[from] == nil || steps[to] == nil {
+				continue
+			}
+			if direct[to] > 0 && direct[from] == 0 {
+				steps[from].Score += planNeighborShare * direct[to]
+				steps[from].Reasons = append(steps[from].Reasons, "references "+to)
+			}
+			if direct[from] > 0 && direct[to] == 0 {
+				steps[to].Score += planNeighborShare * direct[from]
+				steps[to].Reasons = append(steps[to].Reasons, "referenced by "+from)
+			}
+		}
+	}
+
+	ranked := []*PlanStep{}
+	for _, section := range sections {
+		if steps[section.ID] != nil && steps[section.ID].Score > 0 {
+			ranked = append(ranked, steps[section.ID])
+		}
+	}
+	// Best first; on equal scores the cheaper section, then document order
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Tokens < ranked[j].Tokens
+	})
+
+	picked := map[string]bool{}
+	nests := func(outer *PlanStep, inner *PlanStep) bool {
+		return outer.Start < inner.Start && (outer.End == 0 || inner.End <= outer.End)
+	}
+	for _, step := range ranked {
+		covered := false
+		for id := range picked {
+			if nests(steps[id], step) {
+				covered = true
+			}
+		}
+		if covered {
+			continue
+		}
+		if report.Tokens+step.Tokens > args.budget {
+			report.Skipped = append(report.Skipped, *step)
+			continue
+		}
+		// Picking a parent replaces the nested sections already picked
+		for id := range picked {
+			if nests(step, steps[id]) {
+				delete(picked, id)
+				report.Tokens -= steps[id].Tokens
+			}
+		}
+		picked[step.ID] = true
+		report.Tokens += step.Tokens
+	}
+
+	for _, section := range sections {
+		if picked[section.ID] {
+			report.Steps = append(report.Steps, *steps[section.ID])
+		}
+	}
+	return report, nil
+}
+
+// sectionReferences maps each section to the sections it references, with
+// anchor and alias references counted as references to the section
+func sectionReferences(lines []string, contentStart int, sections []iatf.Section) map[string][]string {
+	aliases := iatf.AliasTargets(sections)
+	canonical := func(id string) string {
+		if target, isAlias := aliases[id]; isAlias {
+			return target
+		}
+		return id
+	}
+	references := map[string][]string{}
+	add := func(from string, to string) {
+		to = canonical(to)
+		if from != "" && from != to && !contains(references[from], to) {
+			references[from] = append(references[from], to)
+		}
+	}
+	for target, locations := range iatf.ExtractReferences(lines, contentStart) {
+		for _, loc := range locations {
+			add(loc.ContainingSection, target)
+		}
+	}
+	for _, ref := range iatf.ExtractAnchorReferences(lines, contentStart) {
+		add(ref.ContainingSection, ref.Section)
+	}
+	for from := range references {
+		sort.Strings(references[from])
+	}
+	return references
+}
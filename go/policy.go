@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// An access policy limits what the servers (serve, mcp, rpc) hand out to
+// agents. It is read from .iatf-policy.json in the workspace root, or the
+// file given with --policy:
+//
+//	{
+//	  "allow_paths": ["docs/**"],
+//	  "deny_paths": ["docs/internal/*"],
+//	  "deny_tags": ["internal", "secret"]
+//	}
+//
+// Denied files and sections are served as if they did not exist. Sections
+// marked @visibility: private are denied as well, unless the server was
+// started with --include-private. The CLI commands that read files directly
+// do not apply it.
+
+// policyFileName is the policy a server picks up from its workspace root
+const policyFileName = ".iatf-policy.json"
+
+// apiTokenEnv names the environment variable holding the token 'iatf serve'
+// requires from clients that are not on the same machine
+const apiTokenEnv = "IATF_API_TOKEN"
+
+// accessPolicy is the content of a policy file. A nil policy allows everything.
+type accessPolicy struct {
+	AllowPaths []string `json:"allow_paths"` // When set, only files matching one are served
+	DenyPaths  []string `json:"deny_paths"`  // Files never served, even when allowed
+	DenyTags   []string `json:"deny_tags"`   // Sections with any of these tags, and those nested in them
+
+	file        string // The policy file, "" when there is none
+	hidePrivate bool   // Deny private sections, and those nested in them
+}
+
+// loadAccessPolicy reads the policy at file, or the policy file of root
+// when file is empty. Without a policy file it returns nil.
+func loadAccessPolicy(root string, file string) (*accessPolicy, error) {
+	explicit := file != ""
+	if !explicit {
+		file = filepath.Join(root, policyFileName)
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	policy := accessPolicy{file: file}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", file, err)
+	}
+	for _, pattern := range append(append([]string{}, policy.AllowPaths...), policy.DenyPaths...) {
+		if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q in %s", pattern, file)
+		}
+	}
+	return &policy, nil
+}
+
+// fileAllowed reports whether the file at rel (relative to the workspace
+// root) may be served
+func (p *accessPolicy) fileAllowed(rel string) bool {
+	if p == nil {
+		return true
+	}
+	rel = foldPathCase(filepath.ToSlash(rel))
+	if len(p.AllowPaths) > 0 && !matchesPolicyPath(rel, p.AllowPaths) {
+		return false
+	}
+	return !matchesPolicyPath(rel, p.DenyPaths)
+}
+
+// foldPathCase lowercases a path or pattern on macOS and Windows, whose file
+// systems ignore case: Docs/Internal/x.iatf is the same file as
+// docs/internal/x.iatf there, and must be denied like it
+func foldPathCase(name string) string {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// matchesPolicyPath reports whether rel matches any pattern. Patterns are
+// matched like --exclude globs; a trailing "/**" matches everything below
+// a directory.
+func matchesPolicyPath(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = foldPathCase(filepath.ToSlash(pattern))
+		if dir, found := strings.CutSuffix(pattern, "/**"); found {
+			pattern = dir
+		}
+		if isExcludedPath("", rel, []string{pattern}) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictsSections reports whether the policy hides any sections of the
+// files it allows
+func (p *accessPolicy) restrictsSections() bool {
+	return p != nil && (len(p.DenyTags) > 0 || p.hidePrivate)
+}
+
+// deniedSections returns the IDs of the sections the policy hides: those
+// with a denied tag or, unless private ones are included, marked private,
+// and the sections nested in them
+func (p *accessPolicy) deniedSections(sections []iatf.Section) map[string]bool {
+	denied := map[string]bool{}
+	if !p.restrictsSections() {
+		return denied
+	}
+	deniedEnd := 0
+	for _, section := range sections {
+		if section.Start < deniedEnd || section.HasTag(p.DenyTags...) || (p.hidePrivate && section.IsPrivate()) {
+			denied[section.ID] = true
+			if section.End == 0 {
+				deniedEnd = math.MaxInt
+			} else if section.End > deniedEnd {
+				deniedEnd = section.End
+			}
+		}
+	}
+	return denied
+}
+
+// visibleHits drops the search hits in denied files and sections, and the
+// matching line of a hit when it lies in a denied nested section
+func (p *accessPolicy) visibleHits(root string, hits []searchHit, load func(path string) (*document, error)) []searchHit {
+	if p == nil {
+		return hits
+	}
+	type visibility struct {
+		sections []iatf.Section
+		denied   map[string]bool
+	}
+	files := map[string]*visibility{}
+	visible := []searchHit{}
+	for _, hit := range hits {
+		if !p.fileAllowed(hit.File) {
+			continue
+		}
+		file := files[hit.File]
+		if file == nil {
+			file = &visibility{denied: map[string]bool{}}
+			if doc, err := load(filepath.Join(root, filepath.FromSlash(hit.File))); err == nil {
+				file.sections, file.denied = doc.sections, p.deniedSections(doc.sections)
+			}
+			files[hit.File] = file
+		}
+		if file.denied[hit.Section.ID] {
+			continue
+		}
+		if nested := innermostSection(file.sections, hit.Line); hit.Line > 0 && nested != nil && file.denied[nested.ID] {
+			hit.Line, hit.Text = 0, ""
+		}
+		visible = append(visible, hit)
+	}
+	return visible
+}
+
+// visibleIssues drops the validation issues on the lines of denied
+// sections, in CONTENT or in their INDEX entries
+func (p *accessPolicy) visibleIssues(lines []string, sections []iatf.Section, issues []iatf.Issue) []iatf.Issue {
+	denied := p.deniedSections(sections)
+	if len(denied) == 0 {
+		return issues
+	}
+	// An INDEX entry runs from its heading to the next blank line
+	deniedEntry := map[int]bool{}
+	inEntry := false
+	for i := 0; i < len(lines) && strings.TrimSpace(lines[i]) != "===CONTENT==="; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if match := indexRangePattern.FindStringSubmatch(trimmed); match != nil {
+			inEntry = denied[match[2]]
+		} else if trimmed == "" {
+			inEntry = false
+		}
+		deniedEntry[i+1] = inEntry
+	}
+
+	visible := []iatf.Issue{}
+	for _, issue := range issues {
+		if issue.Line > 0 {
+			if section := innermostSection(sections, issue.Line); deniedEntry[issue.Line] || section != nil && denied[section.ID] {
+				continue
+			}
+		}
+		visible = append(visible, issue)
+	}
+	return visible
+}
+
+// innermostSection returns the innermost section containing line (1-indexed)
+func innermostSection(sections []iatf.Section, line int) *iatf.Section {
+	var found *iatf.Section
+	for i := range sections {
+		if sections[i].Start <= line && (sections[i].End == 0 || line <= sections[i].End) {
+			found = &sections[i]
+		}
+	}
+	return found
+}
+
+// isLoopbackAddr reports whether host:port (or a bare host) only accepts
+// connections from the same machine
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireToken wraps handler so that clients not on this machine must send
+// "Authorization: Bearer <token>"
+func requireToken(handler http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackAddr(r.RemoteAddr) {
+			given, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "missing or invalid token")
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
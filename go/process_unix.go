@@ -2,8 +2,13 @@
 
 package main
 
-import "syscall"
-import "os"
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+)
 
 // isProcessRunning checks if a process with the given PID is running.
 func isProcessRunning(pid int) bool {
@@ -18,3 +23,61 @@ func isProcessRunning(pid int) bool {
 	err = process.Signal(syscall.Signal(0))
 	return err == nil
 }
+
+// rebuildSignals are the signals that ask a watcher to rebuild immediately
+var rebuildSignals = []os.Signal{syscall.SIGUSR1}
+
+// signalRebuild asks the watcher or daemon running as pid to rebuild immediately
+func signalRebuild(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(syscall.SIGUSR1)
+}
+
+// shellCommand builds a command that runs a command line through the shell
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+// shellQuote quotes s as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// lockFile takes an exclusive advisory lock on f, blocking until it is free
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// tryLockFile takes an exclusive advisory lock on f without blocking. It
+// returns false if another process holds the lock.
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unlockFile releases a lock taken with lockFile
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// desktopNotificationCommand builds the command that shows a desktop
+// notification: osascript on macOS, notify-send elsewhere
+func desktopNotificationCommand(title string, message string) *exec.Cmd {
+	if runtime.GOOS == "darwin" {
+		// Pass the text through the environment to avoid AppleScript quoting
+		cmd := exec.Command("osascript", "-e",
+			`display notification (system attribute "IATF_MESSAGE") with title (system attribute "IATF_TITLE")`)
+		cmd.Env = append(os.Environ(), "IATF_TITLE="+title, "IATF_MESSAGE="+message)
+		return cmd
+	}
+	if _, err := exec.LookPath("notify-send"); err != nil {
+		return nil
+	}
+	return exec.Command("notify-send", "--app-name=iatf", title, message)
+}
@@ -2,7 +2,13 @@
 
 package main
 
-import "golang.org/x/sys/windows"
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
 
 // isProcessRunning checks if a process with the given PID is running.
 func isProcessRunning(pid int) bool {
@@ -16,3 +22,61 @@ func isProcessRunning(pid int) bool {
 	windows.CloseHandle(handle)
 	return true
 }
+
+// rebuildSignals is empty on Windows, which has no user-defined signals;
+// the daemon picks up kick requests from its kick file instead
+var rebuildSignals []os.Signal
+
+// signalRebuild is a no-op on Windows; the daemon polls its kick file
+func signalRebuild(pid int) error {
+	return nil
+}
+
+// shellCommand builds a command that runs a command line through cmd.exe
+func shellCommand(command string) *exec.Cmd {
+	cmd := exec.Command("cmd")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `/S /C "` + command + `"`}
+	return cmd
+}
+
+// shellQuote quotes s as a single cmd.exe argument
+func shellQuote(s string) string {
+	return `"` + s + `"`
+}
+
+// lockFile takes an exclusive lock on the first byte of f, blocking until it is free
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+}
+
+// tryLockFile takes an exclusive lock on the first byte of f without
+// blocking. It returns false if another process holds the lock.
+func tryLockFile(f *os.File) (bool, error) {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &windows.Overlapped{})
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unlockFile releases a lock taken with lockFile
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
+
+// toastScript shows a Windows toast notification with the text passed in
+// IATF_TITLE and IATF_MESSAGE
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:IATF_TITLE)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:IATF_MESSAGE)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('IATF').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+
+// desktopNotificationCommand builds the command that shows a toast notification
+func desktopNotificationCommand(title string, message string) *exec.Cmd {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "IATF_TITLE="+title, "IATF_MESSAGE="+message)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	return cmd
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A rebuild reads a file, computes its INDEX and writes it back. When the
+// daemon, a watcher and a manual 'iatf rebuild' do this at the same time,
+// the last write wins and can undo an edit another process had already
+// indexed. Rebuilds of the same file therefore take an exclusive lock
+// around the whole read-modify-write. The lock is a file under ~/.iatf/locks
+// rather than the document itself, since Windows locks also block writes
+// from the lock holder's other handles, and rather than a file beside it,
+// which would show up in the user's tree.
+
+// rebuildAttempts is how often a rebuild is planned again when the file
+// changes while it is being planned (an editor saving, say)
+const rebuildAttempts = 3
+
+// getRebuildLockDir returns the directory holding the rebuild lock files
+func getRebuildLockDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".iatf", "locks")
+}
+
+// rebuildLockPath returns the lock file of filePath. Paths are resolved as
+// watch paths are, so a file reached through a symlink shares the lock of
+// its target.
+func rebuildLockPath(filePath string) string {
+	path, err := resolveWatchPath(filePath)
+	if err != nil {
+		path = filePath
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(getRebuildLockDir(), hex.EncodeToString(sum[:8])+".lock")
+}
+
+// lockForRebuild blocks until no other process is rebuilding filePath and
+// returns the function releasing the lock
+func lockForRebuild(filePath string) (func(), error) {
+	lockPath := rebuildLockPath(filePath)
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("failed to lock %s for rebuild: %w", filePath, err)
+	}
+	return func() {
+		unlockFile(lock)
+		lock.Close()
+	}, nil
+}
+
+// fileVersion identifies the content of a file by size and modification
+// time, to notice a write made while a rebuild was being planned
+type fileVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+// statVersion returns the version of the file at path
+func statVersion(path string) (fileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// same reports whether v and other are the same version
+func (v fileVersion) same(other fileVersion) bool {
+	return v.size == other.size && v.modTime.Equal(other.modTime)
+}
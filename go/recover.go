@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf rebuild' reuses the INDEX it replaces: dates, hashes and notes are
+// carried over, and whatever sits above the last ===INDEX=== marker is kept
+// as header. That is what keeps an INDEX stable, but an INDEX that was
+// truncated, duplicated by a merge or hand-edited beyond repair then
+// survives the rebuild. 'iatf recover' keeps only the header's declaration
+// and @ fields, discards everything else above ===CONTENT===, and indexes
+// CONTENT as if the file never had an INDEX.
+
+// recoveredDocument is a document reduced to its header and CONTENT
+type recoveredDocument struct {
+	content        string // Header, a blank line and CONTENT, with no INDEX
+	discarded      []string
+	addedHeader    bool // :::IATF was missing
+	contentAddedAt int  // 1-indexed line ===CONTENT=== was inserted before, 0 if it was there
+}
+
+// stripIndex reduces content to its :::IATF declaration, the @ fields
+// following it and CONTENT. Without a ===CONTENT=== marker, CONTENT starts
+// at the first section tag.
+func stripIndex(content string) (recoveredDocument, error) {
+	lines := strings.Split(content, "\n")
+	recovered := recoveredDocument{}
+
+	contentMarker := iatf.ContentStart(lines) - 1
+	contentLines := []string{}
+	if contentMarker >= 0 {
+		contentLines = lines[contentMarker:]
+	} else {
+		for i, line := range lines {
+			if iatf.SectionOpenPattern.MatchString(line) {
+				contentMarker = i
+				recovered.contentAddedAt = i + 1
+				contentLines = append([]string{"===CONTENT===", ""}, lines[i:]...)
+				break
+			}
+		}
+		if contentMarker < 0 {
+			return recovered, fmt.Errorf("no ===CONTENT=== marker or section found to index")
+		}
+	}
+
+	declaration := -1
+	for i, line := range lines[:contentMarker] {
+		if strings.TrimSpace(line) == ":::IATF" {
+			declaration = i
+			break
+		}
+	}
+	header := []string{":::IATF"}
+	headerEnd := -1 // Last line of the header kept, -1 when there is none
+	if declaration == -1 {
+		recovered.addedHeader = true
+	} else {
+		headerEnd = declaration
+		for headerEnd+1 < contentMarker && (strings.HasPrefix(lines[headerEnd+1], "@") || strings.TrimSpace(lines[headerEnd+1]) == "") {
+			headerEnd++
+		}
+		header = append([]string{}, lines[declaration:headerEnd+1]...)
+	}
+	for len(header) > 1 && strings.TrimSpace(header[len(header)-1]) == "" {
+		header = header[:len(header)-1]
+	}
+	for i, line := range lines[:contentMarker] {
+		if (i < declaration || i > headerEnd) && strings.TrimSpace(line) != "" {
+			recovered.discarded = append(recovered.discarded, line)
+		}
+	}
+
+	recovered.content = strings.Join(append(append(header, ""), contentLines...), "\n")
+	return recovered, nil
+}
+
+// countIndexNotes returns how many hand-written INDEX notes are in lines
+func countIndexNotes(lines []string) int {
+	count := 0
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "<!-- note:") {
+			count++
+		}
+	}
+	return count
+}
+
+// recoverCommand regenerates the INDEX of filePath from CONTENT alone. With
+// dryRun, the recovered header and INDEX are printed instead of written.
+func recoverCommand(filePath string, dryRun bool) int {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+	if !dryRun && !checkWatchedFile(filePath) {
+		fmt.Println("Recovery cancelled, no changes made.")
+		return 1
+	}
+
+	unlock, err := lockForRebuild(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer unlock()
+
+	content, err := readFileWithinLimits(filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	text, bom, err := iatf.Decode(content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s Cannot recover %s: %v\n", mark(os.Stderr, "[ERROR]"), filePath, err)
+		return 1
+	}
+	recovered, err := stripIndex(text)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s Cannot recover %s: %v\n", mark(os.Stderr, "[ERROR]"), filePath, err)
+		return 1
+	}
+	newContent, _, changes, err := planIndexRebuildContent(recovered.content)
+	if err != nil {
+		// The INDEX was not the problem: CONTENT itself has to be fixed
+		fmt.Fprintf(os.Stderr, "%s Cannot index CONTENT: %v\n", mark(os.Stderr, "[ERROR]"), err)
+		fmt.Fprintf(os.Stderr, "Run 'iatf validate %s' for the problems in CONTENT\n", filePath)
+		return 1
+	}
+
+	fmt.Printf("Recovering INDEX: %s\n", filePath)
+	if recovered.addedHeader {
+		fmt.Println("  Added the missing :::IATF declaration")
+	}
+	if recovered.contentAddedAt > 0 {
+		fmt.Printf("  Added the missing ===CONTENT=== marker before line %d\n", recovered.contentAddedAt)
+	}
+	fmt.Printf("  Discarded %d line(s) between the header and ===CONTENT===\n", len(recovered.discarded))
+	if notes := countIndexNotes(recovered.discarded); notes > 0 {
+		fmt.Printf("%s %d INDEX note(s) were discarded; add them back to the new INDEX if still needed\n", mark(os.Stdout, "[WARN]"), notes)
+	}
+
+	if dryRun {
+		newLines := strings.Split(newContent, "\n")
+		fmt.Println()
+		for _, line := range newLines[:iatf.ContentStart(newLines)] {
+			fmt.Println(line)
+		}
+		fmt.Println()
+		fmt.Printf("%s Dry run, no changes made\n", mark(os.Stdout, "[OK]"))
+		return 0
+	}
+
+	if bom {
+		newContent = iatf.BOM + newContent
+	}
+	if err := os.WriteFile(filePath, []byte(newContent), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s INDEX regenerated from CONTENT (%d section(s), dated today)\n", mark(os.Stdout, "[OK]"), len(changes.Added))
+	return 0
+}
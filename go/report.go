@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// Validation results in formats CI systems ingest: SARIF for code scanning
+// (GitHub shows the issues as annotations on the lines of a pull request)
+// and JUnit XML for test reporters. Each file is a test case that fails
+// when it has errors.
+
+// Output formats of 'iatf validate --format'
+const (
+	formatText  = "text"
+	formatSARIF = "sarif"
+	formatJUnit = "junit"
+)
+
+// sarifSchema is the JSON schema of SARIF 2.1.0 logs
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// projectURL is where the tool's documentation lives
+const projectURL = "https://github.com/Winds-AI/agent-traversal-file"
+
+// validationResult is the validation of one file
+type validationResult struct {
+	File   string // As given on the command line
+	Issues []iatf.Issue
+}
+
+// parseFormat checks the value of --format
+func parseFormat(value string) (string, error) {
+	switch value {
+	case formatText, formatSARIF, formatJUnit:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown format %q (expected text, sarif or junit)", value)
+}
+
+// writeValidationReport writes results in format (sarif or junit)
+func writeValidationReport(w io.Writer, format string, results []validationResult) error {
+	if format == formatJUnit {
+		return writeJUnit(w, results)
+	}
+	return writeSARIF(w, results)
+}
+
+// sarifLevel maps an issue severity to a SARIF level
+func sarifLevel(severity iatf.Severity) string {
+	if severity == iatf.SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// ruleName turns an issue title into a SARIF rule name: its words joined,
+// each starting with a capital ("Unknown section status" becomes
+// "UnknownSectionStatus")
+func ruleName(title string) string {
+	var name strings.Builder
+	for _, word := range strings.Fields(title) {
+		name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return name.String()
+}
+
+// writeSARIF writes results as a SARIF 2.1.0 log with one run. The rules
+// are the documented codes that occur, described as 'iatf explain' does.
+func writeSARIF(w io.Writer, results []validationResult) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type region struct {
+		StartLine int `json:"startLine"`
+	}
+	type physicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *region `json:"region,omitempty"`
+	}
+	type location struct {
+		PhysicalLocation physicalLocation `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type rule struct {
+		ID                   string            `json:"id"`
+		Name                 string            `json:"name,omitempty"`
+		ShortDescription     *message          `json:"shortDescription,omitempty"`
+		FullDescription      *message          `json:"fullDescription,omitempty"`
+		Help                 *message          `json:"help,omitempty"`
+		DefaultConfiguration map[string]string `json:"defaultConfiguration"`
+	}
+
+	rules := []rule{}
+	seen := map[string]bool{}
+	sarifResults := []result{}
+	for _, file := range results {
+		for _, issue := range file.Issues {
+			var loc location
+			loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(file.File)
+			if issue.Line > 0 {
+				loc.PhysicalLocation.Region = &region{StartLine: issue.Line}
+			}
+			sarifResults = append(sarifResults, result{
+				RuleID:    issue.Code,
+				Level:     sarifLevel(issue.Severity),
+				Message:   message{Text: issue.Message},
+				Locations: []location{loc},
+			})
+
+			if seen[issue.Code] {
+				continue
+			}
+			seen[issue.Code] = true
+			r := rule{ID: issue.Code, DefaultConfiguration: map[string]string{"level": sarifLevel(issue.Severity)}}
+			if doc, found := findIssueDoc(issue.Code); found {
+				r.Name = ruleName(doc.Title)
+				r.ShortDescription = &message{Text: doc.Title}
+				r.FullDescription = &message{Text: doc.Explanation}
+				r.Help = &message{Text: renderIssueDoc(doc)}
+			}
+			rules = append(rules, r)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	type driver struct {
+		Name           string `json:"name"`
+		Version        string `json:"version"`
+		InformationURI string `json:"informationUri"`
+		Rules          []rule `json:"rules"`
+	}
+	type run struct {
+		Tool struct {
+			Driver driver `json:"driver"`
+		} `json:"tool"`
+		Results []result `json:"results"`
+	}
+	type sarifLog struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []run  `json:"runs"`
+	}
+
+	single := run{Results: sarifResults}
+	single.Tool.Driver = driver{Name: "iatf", Version: Version, InformationURI: projectURL, Rules: rules}
+	log := sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []run{single}}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+// writeJUnit writes results as JUnit XML: a test case per file, failing
+// with its errors; warnings go to the case's system-out
+func writeJUnit(w io.Writer, results []validationResult) error {
+	type failure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",cdata"`
+	}
+	type output struct {
+		Text string `xml:",cdata"`
+	}
+	type testCase struct {
+		Name      string   `xml:"name,attr"`
+		ClassName string   `xml:"classname,attr"`
+		Failure   *failure `xml:"failure,omitempty"`
+		SystemOut *output  `xml:"system-out,omitempty"`
+	}
+	type testSuite struct {
+		XMLName  xml.Name   `xml:"testsuite"`
+		Name     string     `xml:"name,attr"`
+		Tests    int        `xml:"tests,attr"`
+		Failures int        `xml:"failures,attr"`
+		Cases    []testCase `xml:"testcase"`
+	}
+	type testSuites struct {
+		XMLName  xml.Name    `xml:"testsuites"`
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Suites   []testSuite `xml:"testsuite"`
+	}
+
+	suite := testSuite{Name: "iatf validate", Tests: len(results)}
+	for _, file := range results {
+		test := testCase{Name: filepath.ToSlash(file.File), ClassName: "iatf.validate"}
+		errors, warnings := []string{}, []string{}
+		firstCode := ""
+		for _, issue := range file.Issues {
+			line := fmt.Sprintf("%s:%d: [%s] %s", filepath.ToSlash(file.File), issue.Line, issue.Code, issue.Message)
+			if issue.Severity != iatf.SeverityError {
+				warnings = append(warnings, line)
+				continue
+			}
+			if firstCode == "" {
+				firstCode = issue.Code
+			}
+			errors = append(errors, line)
+		}
+		if len(errors) > 0 {
+			test.Failure = &failure{Message: fmt.Sprintf("%d error(s)", len(errors)), Type: firstCode, Text: strings.Join(errors, "\n")}
+			suite.Failures++
+		}
+		if len(warnings) > 0 {
+			test.SystemOut = &output{Text: strings.Join(warnings, "\n")}
+		}
+		suite.Cases = append(suite.Cases, test)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(testSuites{Name: suite.Name, Tests: suite.Tests, Failures: suite.Failures, Suites: []testSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf resolve' finishes a merge of a document: the INDEX is generated,
+// so rather than merging its conflicts by hand it is dropped and rebuilt
+// from the merged CONTENT. Conflicts elsewhere are left to the author;
+// resolve refuses to run until they are gone.
+
+// resolveCommand regenerates the INDEX of a document whose only remaining
+// merge conflicts are in the INDEX
+func resolveCommand(filePath string) int {
+	content, err := readFileWithinLimits(filePath)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+
+	lines := strings.Split(string(content), "\n")
+	indexStart, contentMarker := -1, -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "===INDEX===" && indexStart == -1 {
+			indexStart = i
+		} else if strings.TrimSpace(line) == "===CONTENT===" {
+			contentMarker = i
+			break
+		}
+	}
+	if contentMarker == -1 {
+		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
+		return 1
+	}
+
+	conflicts := iatf.FindConflicts(lines)
+	remaining := 0
+	for _, conflict := range conflicts {
+		if conflict.InIndex(indexStart, contentMarker) {
+			continue
+		}
+		if conflict.End == 0 {
+			fmt.Fprintf(os.Stderr, "  - Merge conflict at line %d (no closing >>>>>>> marker)\n", conflict.Start)
+		} else {
+			fmt.Fprintf(os.Stderr, "  - Merge conflict at lines %d-%d\n", conflict.Start, conflict.End)
+		}
+		remaining++
+	}
+	if remaining > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d merge conflict(s) outside the INDEX; fix them, then run 'iatf resolve %s' again\n", remaining, filePath)
+		return 1
+	}
+
+	// The marker lines go, the entries of both sides stay until the rebuild
+	// replaces them, so Created dates and notes carry over from either side
+	if indexStart != -1 && len(conflicts) > 0 {
+		cleaned := append([]string{}, lines[:indexStart+1]...)
+		for _, line := range lines[indexStart+1 : contentMarker] {
+			if !isConflictLine(line) {
+				cleaned = append(cleaned, line)
+			}
+		}
+		cleaned = append(cleaned, lines[contentMarker:]...)
+		if err := os.WriteFile(filePath, []byte(strings.Join(cleaned, "\n")), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+			return 1
+		}
+	}
+
+	if err := rebuildIndex(filePath); err != nil {
+		if writeErr := os.WriteFile(filePath, content, 0644); writeErr != nil {
+			fmt.Fprintf(os.Stderr, "Error restoring %s: %v\n", filePath, writeErr)
+		}
+		fmt.Fprintf(os.Stderr, "Error: The INDEX could not be regenerated: %v\n", err)
+		return 1
+	}
+	if len(conflicts) == 0 {
+		fmt.Printf("%s No merge conflicts in %s; INDEX rebuilt\n", mark(os.Stdout, "[OK]"), filePath)
+	} else {
+		fmt.Printf("%s Resolved %d INDEX conflict(s) in %s by regenerating the INDEX\n", mark(os.Stdout, "[OK]"), len(conflicts), filePath)
+	}
+	return 0
+}
+
+// isConflictLine reports whether line is one of the markers of a conflict
+// block inside the INDEX, where "=======" cannot be a Markdown underline
+func isConflictLine(line string) bool {
+	line = strings.TrimRight(line, "\r")
+	for _, marker := range []string{"<<<<<<<", "|||||||", "=======", ">>>>>>>"} {
+		if line == marker || strings.HasPrefix(line, marker+" ") {
+			return true
+		}
+	}
+	return false
+}
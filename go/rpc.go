@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf rpc' stays resident and answers JSON-RPC 2.0 requests on stdin, one
+// per line (or a batch array per line), with the results of read, index,
+// search and validate as JSON on stdout. Parsed documents are cached, so a
+// loop of calls neither starts a process nor re-parses unchanged files.
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcFailed         = -32000 // The file cannot be read or is malformed
+	rpcNotFound       = -32001 // The file, section or anchor does not exist
+)
+
+// rpcRequest is a JSON-RPC request, or a notification when ID is absent
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is the reply to an rpcRequest with an ID
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// serveJSONRPC reads one request, or batch array of requests, per line from
+// in and writes the replies of handle to out, one line each. Notifications
+// get no reply; handle is only called for well-formed requests.
+func serveJSONRPC(in io.Reader, out io.Writer, handle func(request rpcRequest) rpcResponse) error {
+	reader := bufio.NewReader(in)
+	encoder := json.NewEncoder(out)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if message := bytes.TrimSpace(line); len(message) > 0 {
+			if reply := answerJSONRPC(message, handle); reply != nil {
+				if err := encoder.Encode(reply); err != nil {
+					return err
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// answerJSONRPC returns the reply to a message: a response, an array of
+// responses for a batch, or nil when there is nothing to reply
+func answerJSONRPC(message []byte, handle func(request rpcRequest) rpcResponse) interface{} {
+	if message[0] != '[' {
+		if response, reply := answerRequest(message, handle); reply {
+			return response
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(message, &batch); err != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: "Parse error: " + err.Error()}}
+	}
+	if len(batch) == 0 {
+		return rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcInvalidRequest, Message: "Invalid request: empty batch"}}
+	}
+	responses := []rpcResponse{}
+	for _, item := range batch {
+		if response, reply := answerRequest(item, handle); reply {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// answerRequest answers one request; reply is false for notifications
+func answerRequest(message []byte, handle func(request rpcRequest) rpcResponse) (response rpcResponse, reply bool) {
+	var request rpcRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		var syntaxErr *json.SyntaxError
+		code := rpcInvalidRequest
+		if errors.As(err, &syntaxErr) {
+			code = rpcParseError
+		}
+		return rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: code, Message: "Parse error: " + err.Error()}}, true
+	}
+	if len(request.ID) == 0 {
+		return rpcResponse{}, false
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		return rpcResponse{JSONRPC: "2.0", ID: request.ID, Error: &rpcError{Code: rpcInvalidRequest, Message: "Invalid request"}}, true
+	}
+	return handle(request), true
+}
+
+// rpcParams are the parameters of all methods; each method reads its own
+type rpcParams struct {
+	File          string   `json:"file"`
+	ID            string   `json:"id"`
+	Anchor        string   `json:"anchor"`
+	Tags          []string `json:"tags"`
+	Audience      string   `json:"audience"`
+	ExcludeDrafts bool     `json:"exclude_drafts"`
+	Query         string   `json:"query"`
+	Limit         int      `json:"limit"`
+}
+
+// rpcIssue is a validation error or warning in the validate result
+type rpcIssue struct {
+	Code    string `json:"code"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// rpcValidation is the result of validate
+type rpcValidation struct {
+	File     string     `json:"file"`
+	Valid    bool       `json:"valid"`
+	Errors   []rpcIssue `json:"errors"`
+	Warnings []rpcIssue `json:"warnings"`
+}
+
+// rpcServer answers requests about the .iatf files under root
+type rpcServer struct {
+	root   string
+	cache  *documentCache
+	policy *accessPolicy
+}
+
+// rpcCommand answers requests on stdin until it is closed
+func rpcCommand(args serverArgs) int {
+	absRoot, policy, err := openWorkspace(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	server := &rpcServer{root: absRoot, cache: newDocumentCache(), policy: policy}
+	if err := serveJSONRPC(os.Stdin, os.Stdout, server.handle); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// handle answers a request
+func (s *rpcServer) handle(request rpcRequest) rpcResponse {
+	response := rpcResponse{JSONRPC: "2.0", ID: request.ID}
+	params := rpcParams{}
+	if len(request.Params) > 0 {
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			response.Error = &rpcError{Code: rpcInvalidParams, Message: "Invalid params: " + err.Error()}
+			return response
+		}
+	}
+
+	var result interface{}
+	var err *rpcError
+	switch request.Method {
+	case "index":
+		result, err = s.index(params)
+	case "read":
+		result, err = s.read(params)
+	case "search":
+		result, err = s.search(params)
+	case "validate":
+		result, err = s.validate(params)
+	default:
+		err = &rpcError{Code: rpcMethodNotFound, Message: "Method not found: " + request.Method}
+	}
+	if err != nil {
+		response.Error = err
+	} else {
+		response.Result = result
+	}
+	return response
+}
+
+// load returns a document of the workspace and its path relative to the root
+func (s *rpcServer) load(file string) (string, *document, *rpcError) {
+	rel, err := resolveWorkspaceFile(s.root, file)
+	if err != nil {
+		return "", nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	if !s.policy.fileAllowed(rel) {
+		return "", nil, &rpcError{Code: rpcNotFound, Message: "File not found: " + file}
+	}
+	doc, err := s.cache.load(filepath.Join(s.root, rel))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, &rpcError{Code: rpcNotFound, Message: "File not found: " + file}
+	}
+	if err != nil {
+		return "", nil, &rpcError{Code: rpcFailed, Message: err.Error()}
+	}
+	return filepath.ToSlash(rel), doc, nil
+}
+
+// index returns the sections of file as 'iatf index --json' does, or the
+// documents of the workspace without file
+func (s *rpcServer) index(params rpcParams) (interface{}, *rpcError) {
+	if params.File == "" {
+		return map[string]interface{}{"files": listDocuments(s.root, s.cache.load, s.policy)}, nil
+	}
+
+	rel, doc, rpcErr := s.load(params.File)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	report, err := buildIndexReport(rel, doc.lines, indexArgs{tags: params.Tags, audience: params.Audience, includePrivate: true, policy: s.policy})
+	if err != nil {
+		return nil, &rpcError{Code: rpcFailed, Message: err.Error()}
+	}
+	return report, nil
+}
+
+// read returns a section, or one of its anchor regions, as 'iatf read' prints it
+func (s *rpcServer) read(params rpcParams) (interface{}, *rpcError) {
+	if params.ID == "" {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "id is required"}
+	}
+	rel, doc, rpcErr := s.load(params.File)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	// The policy hides private sections unless the server includes them
+	options := readOptions{excludeDrafts: params.ExcludeDrafts, audience: params.Audience, includePrivate: true, policy: s.policy}
+	section, err := sectionContent(rel, doc.lines, params.ID, params.Anchor, options)
+	var notFound notFoundError
+	if errors.As(err, &notFound) {
+		return nil, &rpcError{Code: rpcNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return nil, &rpcError{Code: rpcFailed, Message: err.Error()}
+	}
+	return section, nil
+}
+
+// search returns the sections containing every word of the query
+func (s *rpcServer) search(params rpcParams) (interface{}, *rpcError) {
+	terms := strings.Fields(strings.ToLower(params.Query))
+	if len(terms) == 0 {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "query is required"}
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	hits, err := searchWorkspace(s.root, params.File, terms, s.cache.load, s.policy)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return map[string]interface{}{"query": params.Query, "total": len(hits), "results": searchResults(hits, limit)}, nil
+}
+
+// validate returns the errors and warnings of file, leaving out those in
+// sections the access policy denies
+func (s *rpcServer) validate(params rpcParams) (interface{}, *rpcError) {
+	rel, doc, rpcErr := s.load(params.File)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	report := iatf.Validate(doc.lines, iatf.DefaultOptions())
+	result := rpcValidation{File: rel, Valid: true, Errors: []rpcIssue{}, Warnings: []rpcIssue{}}
+	for _, issue := range s.policy.visibleIssues(doc.lines, doc.sections, report.Issues()) {
+		entry := rpcIssue{Code: issue.Code, Line: issue.Line, Message: issue.Message}
+		if issue.Severity == iatf.SeverityError {
+			result.Valid = false
+			result.Errors = append(result.Errors, entry)
+		} else {
+			result.Warnings = append(result.Warnings, entry)
+		}
+	}
+	return result, nil
+}
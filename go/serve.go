@@ -0,0 +1,490 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf serve' answers read-only JSON queries about the .iatf files of a
+// workspace directory over HTTP:
+//
+//	GET /files                              documents with their header fields
+//	GET /files/{path}/index                 sections of a document (index --json)
+//	GET /files/{path}/sections/{id}         a section's content
+//	GET /search?q=                          sections containing every word of q
+//	GET /events                             the daemon's rebuilds, as Server-Sent Events
+
+// defaultServeAddr is where 'iatf serve' listens without --addr. Only local
+// clients can reach it, so they need no token.
+const defaultServeAddr = "127.0.0.1:8741"
+
+// apiFile is an entry of GET /files
+type apiFile struct {
+	File        string `json:"file"`
+	Title       string `json:"title,omitempty"`
+	Purpose     string `json:"purpose,omitempty"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Updated     string `json:"updated,omitempty"`
+	Sections    int    `json:"sections"`
+}
+
+// apiSection is the response of GET /files/{path}/sections/{id}
+type apiSection struct {
+	File    string `json:"file"`
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	AliasOf string `json:"alias_of,omitempty"` // Set when {id} is an alias; ID is then the section's ID
+	Anchor  string `json:"anchor,omitempty"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Content string `json:"content"`
+}
+
+// apiSearchResult is an entry of GET /search
+type apiSearchResult struct {
+	File  string `json:"file"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Line  int    `json:"line,omitempty"` // First content line that matched, 0 if only the title or summary did
+	Text  string `json:"text,omitempty"`
+}
+
+// apiServer serves the .iatf files under root
+type apiServer struct {
+	root   string
+	policy *accessPolicy
+}
+
+// serveCommand serves the HTTP API until interrupted. Listening on an
+// address other machines can reach requires a token in IATF_API_TOKEN.
+func serveCommand(args serverArgs) int {
+	absRoot, policy, err := openWorkspace(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	server := &apiServer{root: absRoot, policy: policy}
+	handler := server.handler()
+	token := os.Getenv(apiTokenEnv)
+	if token != "" {
+		handler = requireToken(handler, token)
+	} else if !isLoopbackAddr(args.addr) {
+		fmt.Fprintf(os.Stderr, "Error: %s is reachable from other machines; set %s to the token clients must send\n", args.addr, apiTokenEnv)
+		return 1
+	}
+
+	fmt.Printf("Serving %s on http://%s (Ctrl+C to stop)\n", absRoot, args.addr)
+	if policy != nil && policy.file != "" {
+		fmt.Printf("Access policy applied: %s\n", policy.file)
+	}
+	if err := http.ListenAndServe(args.addr, handler); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// handler routes the API requests
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files", s.handleFiles)
+	mux.HandleFunc("GET /files/{rest...}", s.handleFile)
+	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	return mux
+}
+
+// writeJSON writes v with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeError writes {"error": message}
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// readWorkspaceFile resolves file inside the workspace and returns its path
+// relative to the root and its lines
+func (s *apiServer) readWorkspaceFile(file string) (string, []string, int, error) {
+	rel, err := resolveWorkspaceFile(s.root, file)
+	if err != nil {
+		return "", nil, http.StatusBadRequest, err
+	}
+	if !s.policy.fileAllowed(rel) {
+		return "", nil, http.StatusNotFound, fmt.Errorf("file not found: %s", file)
+	}
+	content, err := readDocument(filepath.Join(s.root, rel))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, http.StatusNotFound, fmt.Errorf("file not found: %s", file)
+	}
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, err
+	}
+	return filepath.ToSlash(rel), strings.Split(string(content), "\n"), http.StatusOK, nil
+}
+
+func (s *apiServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"files": listDocuments(s.root, loadDocument, s.policy)})
+}
+
+// handleFile serves {path}/index and {path}/sections/{id}; the path may
+// contain slashes, so it ends at the first ".iatf/"
+func (s *apiServer) handleFile(w http.ResponseWriter, r *http.Request) {
+	rest := r.PathValue("rest")
+	end := strings.Index(rest, ".iatf/")
+	if end < 0 {
+		writeError(w, http.StatusNotFound, "expected /files/{path}.iatf/index or /files/{path}.iatf/sections/{id}")
+		return
+	}
+	file, resource := rest[:end+len(".iatf")], rest[end+len(".iatf/"):]
+	switch {
+	case resource == "index":
+		s.handleIndex(w, r, file)
+	case strings.HasPrefix(resource, "sections/") && len(resource) > len("sections/"):
+		s.handleSection(w, r, file, strings.TrimPrefix(resource, "sections/"))
+	default:
+		writeError(w, http.StatusNotFound, "unknown resource: "+resource)
+	}
+}
+
+// handleIndex serves the sections of a document, filtered by the tag
+// (repeatable) and audience query parameters
+func (s *apiServer) handleIndex(w http.ResponseWriter, r *http.Request, file string) {
+	rel, lines, status, err := s.readWorkspaceFile(file)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	args := indexArgs{tags: r.URL.Query()["tag"], audience: r.URL.Query().Get("audience"), includePrivate: true, policy: s.policy}
+	report, err := buildIndexReport(rel, lines, args)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleSection serves a section by ID or alias, or one of its anchors with
+// the anchor query parameter, leaving out nested sections for other
+// audiences (audience) and drafts (exclude_drafts=true)
+func (s *apiServer) handleSection(w http.ResponseWriter, r *http.Request, file string, id string) {
+	rel, lines, status, err := s.readWorkspaceFile(file)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	query := r.URL.Query()
+	// The policy hides private sections unless the server includes them
+	options := readOptions{excludeDrafts: query.Get("exclude_drafts") == "true", audience: query.Get("audience"), includePrivate: true, policy: s.policy}
+	section, err := sectionContent(rel, lines, id, query.Get("anchor"), options)
+	var notFound notFoundError
+	if errors.As(err, &notFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, section)
+}
+
+// notFoundError is returned by sectionContent for a section or anchor that
+// does not exist or is filtered out
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+// sectionContent returns section id (or the section it is an alias of) of
+// a document, or only its anchor region when anchorName is set, as
+// 'iatf read' prints it with options
+func sectionContent(file string, lines []string, id string, anchorName string, options readOptions) (apiSection, error) {
+	contentStart := iatf.ContentStart(lines)
+	if contentStart < 0 {
+		return apiSection{}, fmt.Errorf("no ===CONTENT=== section found")
+	}
+
+	sections := iatf.ParseSections(lines, contentStart)
+	section, alias, found := iatf.ResolveSectionID(sections, id)
+	switch {
+	case !found:
+		return apiSection{}, notFoundError("section not found: " + id)
+	case options.excludeDrafts && section.Status == iatf.StatusDraft:
+		return apiSection{}, notFoundError("section is a draft: " + id)
+	case audienceExcluded(sections, options.audience)[section.ID]:
+		return apiSection{}, notFoundError(fmt.Sprintf("section is not for audience %s: %s", options.audience, id))
+	case options.policy.deniedSections(sections)[section.ID]:
+		return apiSection{}, notFoundError("section not found: " + id)
+	case !options.includePrivate && privateSections(sections)[section.ID]:
+		return apiSection{}, notFoundError("section is private: " + id)
+	}
+
+	response := apiSection{File: file, ID: section.ID, Title: section.Title, Start: section.Start, End: section.End}
+	if alias {
+		response.AliasOf = id
+	}
+	if anchorName != "" {
+		anchor, found := iatf.FindAnchor(lines, contentStart, sections, section.ID, anchorName)
+		if !found {
+			return apiSection{}, notFoundError(fmt.Sprintf("anchor not found: %s:%s", section.ID, anchorName))
+		}
+		response.Anchor = anchorName
+		response.Start, response.End = anchor.Line, anchor.End
+	}
+	response.Content = strings.Join(sectionLines(lines, response.Start, response.End, section.ID, sections, options), "\n")
+	return response, nil
+}
+
+// handleSearch serves the sections containing every word of q, in the file
+// query parameter or the whole workspace, at most limit (default 20)
+func (s *apiServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	terms := strings.Fields(strings.ToLower(query.Get("q")))
+	if len(terms) == 0 {
+		writeError(w, http.StatusBadRequest, "missing query parameter: q")
+		return
+	}
+	limit := 20
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = parsed
+	}
+
+	hits, err := searchWorkspace(s.root, query.Get("file"), terms, loadDocument, s.policy)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"query": query.Get("q"), "total": len(hits), "results": searchResults(hits, limit)})
+}
+
+// searchResults returns the first limit hits as search results
+func searchResults(hits []searchHit, limit int) []apiSearchResult {
+	results := []apiSearchResult{}
+	for _, hit := range hits {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, apiSearchResult{
+			File:  hit.File,
+			ID:    hit.Section.ID,
+			Title: hit.Section.Title,
+			Start: hit.Section.Start,
+			End:   hit.Section.End,
+			Line:  hit.Line,
+			Text:  hit.Text,
+		})
+	}
+	return results
+}
+
+// listDocuments returns the path, header fields and section count of every
+// .iatf file under root that policy allows, reading them with load
+func listDocuments(root string, load func(path string) (*document, error), policy *accessPolicy) []apiFile {
+	files := []apiFile{}
+	for _, rel := range workspaceFiles(root) {
+		if !policy.fileAllowed(rel) {
+			continue
+		}
+		doc, err := load(filepath.Join(root, rel))
+		if err != nil {
+			continue
+		}
+		header := iatf.ParseHeader(doc.lines)
+		files = append(files, apiFile{
+			File:        filepath.ToSlash(rel),
+			Title:       header.Title,
+			Purpose:     header.Purpose,
+			Description: header.Description,
+			Version:     header.Version,
+			Updated:     header.Updated,
+			Sections:    len(doc.sections) - len(policy.deniedSections(doc.sections)),
+		})
+	}
+	return files
+}
+
+// eventKeepAlive is how often an idle event stream gets a comment line, so
+// proxies and clients do not time it out
+const eventKeepAlive = 30 * time.Second
+
+// handleEvents relays the daemon's rebuild events for files in the
+// workspace that the policy allows as Server-Sent Events, with file
+// relative to the root. It fails with 503 when no daemon is running.
+func (s *apiServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	stream, err := subscribeDaemonEvents()
+	if errors.Is(err, errDaemonUnreachable) {
+		writeError(w, http.StatusServiceUnavailable, "daemon not running (start it with 'iatf daemon start')")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer stream.Close()
+
+	events := make(chan WebhookPayload)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			event, err := stream.next()
+			if err != nil {
+				failed <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": subscribed to rebuild events\n\n")
+	flusher.Flush()
+
+	visible := s.visibleSections()
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-events:
+			event, ok := s.visibleEvent(event, visible)
+			if !ok {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case err := <-failed:
+			// The daemon stopped or dropped this slow client; clients
+			// should resync before subscribing again
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// visibleSections returns the IDs of the sections the policy lets be seen,
+// by file relative to the root, when it hides any
+func (s *apiServer) visibleSections() map[string]map[string]bool {
+	visible := map[string]map[string]bool{}
+	if !s.policy.restrictsSections() {
+		return visible
+	}
+	for _, rel := range workspaceFiles(s.root) {
+		if !s.policy.fileAllowed(rel) {
+			continue
+		}
+		if doc, err := loadDocument(filepath.Join(s.root, rel)); err == nil {
+			visible[filepath.ToSlash(rel)] = s.allowedSections(doc)
+		}
+	}
+	return visible
+}
+
+// allowedSections returns the IDs of the sections of doc the policy allows
+func (s *apiServer) allowedSections(doc *document) map[string]bool {
+	denied := s.policy.deniedSections(doc.sections)
+	allowed := map[string]bool{}
+	for _, section := range doc.sections {
+		if !denied[section.ID] {
+			allowed[section.ID] = true
+		}
+	}
+	return allowed
+}
+
+// visibleEvent returns event with file relative to the root and the changed
+// sections the policy hides left out, or false when its file is outside the
+// workspace or denied, or all the sections it changed are hidden. Added and
+// modified sections are checked against the document as it is now; removed
+// ones against the sections last seen in it, which visible keeps.
+func (s *apiServer) visibleEvent(event WebhookPayload, visible map[string]map[string]bool) (WebhookPayload, bool) {
+	rel, err := filepath.Rel(s.root, event.File)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || !s.policy.fileAllowed(rel) {
+		return event, false
+	}
+	event.File = filepath.ToSlash(rel)
+	if !s.policy.restrictsSections() {
+		return event, true
+	}
+
+	previous := visible[event.File]
+	allowed := map[string]bool{}
+	doc, err := loadDocument(filepath.Join(s.root, rel))
+	if err == nil {
+		allowed = s.allowedSections(doc)
+		visible[event.File] = allowed
+	}
+	if event.Error != "" && err == nil && len(allowed) < len(doc.sections) {
+		// Validation messages name sections, the hidden ones too
+		event.Error = "validation failed; run 'iatf validate' on the file for details"
+	}
+	if event.SectionsChanged == nil {
+		return event, true
+	}
+
+	keep := func(ids []string, allowed map[string]bool) []string {
+		kept := []string{}
+		for _, id := range ids {
+			if allowed[id] {
+				kept = append(kept, id)
+			}
+		}
+		return kept
+	}
+	changes := SectionChanges{
+		Added:    keep(event.SectionsChanged.Added, allowed),
+		Modified: keep(event.SectionsChanged.Modified, allowed),
+		Removed:  keep(event.SectionsChanged.Removed, previous),
+	}
+	original := event.SectionsChanged
+	if len(changes.Added)+len(changes.Modified)+len(changes.Removed) == 0 && len(original.Added)+len(original.Modified)+len(original.Removed) > 0 {
+		return event, false
+	}
+	event.SectionsChanged = &changes
+	return event, true
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Read sessions are opt-in telemetry: 'iatf read' and 'iatf index' with
+// --session <id> append what they printed to ~/.iatf/sessions/<id>.jsonl,
+// and 'iatf session report <id>' shows which sections of each file were
+// read, in what order and how often, to tune how documents are split up.
+
+// sessionIDPattern keeps session IDs usable as file names
+var sessionIDPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Session event kinds
+const (
+	sessionRead  = "read"
+	sessionIndex = "index"
+)
+
+// SessionEvent is a line of a session log
+type SessionEvent struct {
+	Time    string `json:"time"`
+	Event   string `json:"event"` // read or index
+	File    string `json:"file"`  // Absolute path
+	Section string `json:"section,omitempty"`
+	Anchor  string `json:"anchor,omitempty"`
+	Tokens  int    `json:"tokens,omitempty"` // Estimated tokens of the lines read
+}
+
+// SessionReport is the output of 'iatf session report --json'
+type SessionReport struct {
+	Session string              `json:"session"`
+	Reads   int                 `json:"reads"`
+	Tokens  int                 `json:"tokens"`
+	First   string              `json:"first,omitempty"`
+	Last    string              `json:"last,omitempty"`
+	Files   []SessionFileReport `json:"files"`
+}
+
+// SessionFileReport is the coverage of one file in a session
+type SessionFileReport struct {
+	File     string           `json:"file"`
+	Indexed  int              `json:"indexed"` // Times its index was printed
+	Sections int              `json:"sections"`
+	Read     int              `json:"read"`              // Distinct sections read, nested ones included
+	Coverage float64          `json:"coverage"`          // Read out of sections, 0 to 1
+	Order    []string         `json:"order"`             // Sections (id or id:anchor) in reading order
+	Hot      []SessionHotspot `json:"hot"`               // Sections by number of reads, most first
+	Unread   []string         `json:"unread,omitempty"`  // Sections never read
+	Missing  bool             `json:"missing,omitempty"` // The file can no longer be parsed
+	Tokens   int              `json:"tokens"`            // Estimated tokens read from it
+}
+
+// SessionHotspot is a section and how often it was read
+type SessionHotspot struct {
+	ID    string `json:"id"`
+	Reads int    `json:"reads"`
+}
+
+// checkSessionID rejects session IDs that are not plain file names
+func checkSessionID(id string) error {
+	if !sessionIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid session ID %q (use letters, digits, '.', '_' and '-')", id)
+	}
+	return nil
+}
+
+// parseSessionArg reads the session ID following args[i] (--session)
+func parseSessionArg(args []string, i int) (string, error) {
+	if i+1 >= len(args) {
+		return "", fmt.Errorf("--session requires a session ID")
+	}
+	return args[i+1], checkSessionID(args[i+1])
+}
+
+// getSessionPath returns the log of session id
+func getSessionPath(id string) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".iatf", "sessions", id+".jsonl")
+}
+
+// recordSessionEvent appends an event to the log of session id. Nothing is
+// recorded without a session; a failure is a warning, never a failed read.
+func recordSessionEvent(session string, event SessionEvent) {
+	if session == "" {
+		return
+	}
+	if abs, err := filepath.Abs(event.File); err == nil {
+		event.File = abs
+	}
+	event.Time = time.Now().UTC().Format(time.RFC3339)
+
+	err := func() error {
+		path := getSessionPath(session)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return json.NewEncoder(file).Encode(event)
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not record session %s: %v\n", session, err)
+	}
+}
+
+// recordSessionRead records lines start to end (1-indexed) of a section as read
+func recordSessionRead(session string, filePath string, lines []string, id string, anchor string, start int, end int) {
+	if session == "" {
+		return
+	}
+	if end == 0 || end > len(lines) {
+		end = len(lines)
+	}
+	recordSessionEvent(session, SessionEvent{
+		Event:   sessionRead,
+		File:    filePath,
+		Section: id,
+		Anchor:  anchor,
+		Tokens:  estimateTokens(lines[start-1 : end]),
+	})
+}
+
+// loadSessionEvents reads the log of session id. Lines that cannot be
+// parsed (a write cut short) are skipped.
+func loadSessionEvents(id string) ([]SessionEvent, error) {
+	file, err := os.Open(getSessionPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := []SessionEvent{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event SessionEvent
+		if json.Unmarshal(scanner.Bytes(), &event) == nil {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// buildSessionReport summarizes the events of a session per file, in the
+// order the files were first used. Coverage is judged against the sections
+// the files have now.
+func buildSessionReport(id string, events []SessionEvent) SessionReport {
+	report := SessionReport{Session: id, Files: []SessionFileReport{}}
+	byFile := map[string]*SessionFileReport{}
+	reads := map[string]map[string]int{}
+	files := []string{}
+	for _, event := range events {
+		if report.First == "" {
+			report.First = event.Time
+		}
+		report.Last = event.Time
+
+		file := byFile[event.File]
+		if file == nil {
+			file = &SessionFileReport{File: event.File, Order: []string{}, Hot: []SessionHotspot{}}
+			byFile[event.File] = file
+			reads[event.File] = map[string]int{}
+			files = append(files, event.File)
+		}
+		switch event.Event {
+		case sessionIndex:
+			file.Indexed++
+		case sessionRead:
+			step := event.Section
+			if event.Anchor != "" {
+				step += ":" + event.Anchor
+			}
+			file.Order = append(file.Order, step)
+			file.Tokens += event.Tokens
+			reads[event.File][event.Section]++
+			report.Reads++
+			report.Tokens += event.Tokens
+		}
+	}
+
+	for _, path := range files {
+		file := byFile[path]
+		for id, count := range reads[path] {
+			file.Hot = append(file.Hot, SessionHotspot{ID: id, Reads: count})
+		}
+		sort.Slice(file.Hot, func(i, j int) bool {
+			if file.Hot[i].Reads != file.Hot[j].Reads {
+				return file.Hot[i].Reads > file.Hot[j].Reads
+			}
+			return file.Hot[i].ID < file.Hot[j].ID
+		})
+
+		doc, err := loadDocument(path)
+		if err != nil || doc.contentStart == -1 {
+			file.Missing = true
+			file.Read = len(reads[path])
+			report.Files = append(report.Files, *file)
+			continue
+		}
+		// Reading a section also reads the sections nested in it
+		file.Sections = len(doc.sections)
+		readEnd := 0
+		for _, section := range doc.sections {
+			if section.Start < readEnd || reads[path][section.ID] > 0 {
+				file.Read++
+				if section.End == 0 {
+					readEnd = len(doc.lines) + 1
+				} else if section.End > readEnd {
+					readEnd = section.End
+				}
+			} else {
+				file.Unread = append(file.Unread, section.ID)
+			}
+		}
+		if file.Sections > 0 {
+			file.Coverage = float64(file.Read) / float64(file.Sections)
+		}
+		report.Files = append(report.Files, *file)
+	}
+	return report
+}
+
+// sessionReportCommand prints the coverage and hot sections of a session
+func sessionReportCommand(id string, jsonOutput bool) int {
+	if err := checkSessionID(id); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	events, err := loadSessionEvents(id)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: Session not found: %s\n", id)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading session: %v\n", err)
+		return 1
+	}
+
+	report := buildSessionReport(id, events)
+	if jsonOutput {
+		return printJSON(report)
+	}
+
+	fmt.Printf("@session: %s (%d reads, ~%d tokens, %d file(s))\n", id, report.Reads, report.Tokens, len(report.Files))
+	if report.First != "" {
+		fmt.Printf("From %s to %s\n", report.First, report.Last)
+	}
+	for _, file := range report.Files {
+		fmt.Printf("\n%s\n", file.File)
+		if file.Missing {
+			fmt.Printf("  %d section(s) read; the file can no longer be parsed\n", file.Read)
+		} else {
+			fmt.Printf("  Coverage: %d of %d sections (%.0f%%), ~%d tokens, index printed %d time(s)\n", file.Read, file.Sections, file.Coverage*100, file.Tokens, file.Indexed)
+		}
+		if len(file.Order) > 0 {
+			fmt.Printf("  Order: %s\n", strings.Join(file.Order, " -> "))
+		}
+		if len(file.Hot) > 0 {
+			hot := []string{}
+			for _, spot := range file.Hot {
+				hot = append(hot, fmt.Sprintf("%s (%d)", spot.ID, spot.Reads))
+			}
+			fmt.Printf("  Hot: %s\n", strings.Join(hot, ", "))
+		}
+		if len(file.Unread) > 0 {
+			fmt.Printf("  Unread: %s\n", strings.Join(file.Unread, ", "))
+		}
+	}
+	return 0
+}
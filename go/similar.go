@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf similar' finds sections that say much the same as a given one, so
+// authors can consolidate duplicated knowledge. Sections are compared by
+// their shingles, the hashes of every run of shingleSize consecutive words,
+// and scored by Jaccard similarity: the shingles they share out of all the
+// shingles either has. Each section counts only its own lines, not those of
+// its nested sections.
+
+// shingleSize is the number of consecutive words in a shingle
+const shingleSize = 3
+
+// similarArgs are the parsed arguments of 'iatf similar' after the file and ID
+type similarArgs struct {
+	workspace string // Defaults to the directory of the file
+	limit     int
+	minScore  float64
+	json      bool
+}
+
+// SimilarReport is the output of 'iatf similar --json'
+type SimilarReport struct {
+	File      string          `json:"file"`
+	ID        string          `json:"id"`
+	Shingles  int             `json:"shingles"`
+	Workspace string          `json:"workspace"`
+	Results   []SimilarResult `json:"results"`
+}
+
+// SimilarResult is a section similar to the one asked about
+type SimilarResult struct {
+	File   string  `json:"file"` // Relative to the workspace
+	ID     string  `json:"id"`
+	Title  string  `json:"title"`
+	Start  int     `json:"start"`
+	End    int     `json:"end"`
+	Score  float64 `json:"score"`  // Jaccard similarity, 0 to 1
+	Shared int     `json:"shared"` // Shingles in common
+}
+
+// parseSimilarArgs reads --workspace <dir>, --limit <n>, --min <score> and --json
+func parseSimilarArgs(args []string) (similarArgs, error) {
+	parsed := similarArgs{limit: 10, minScore: 0.05}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			parsed.json = true
+		case "--workspace", "--limit", "--min":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("%s requires a value", args[i])
+			}
+			value := args[i+1]
+			switch args[i] {
+			case "--workspace":
+				parsed.workspace = value
+			case "--limit":
+				limit, err := strconv.Atoi(value)
+				if err != nil || limit <= 0 {
+					return parsed, fmt.Errorf("invalid limit %q (expected a positive number)", value)
+				}
+				parsed.limit = limit
+			case "--min":
+				score, err := strconv.ParseFloat(value, 64)
+				if err != nil || score < 0 || score > 1 {
+					return parsed, fmt.Errorf("invalid minimum score %q (expected 0 to 1)", value)
+				}
+				parsed.minScore = score
+			}
+			i++
+		default:
+			return parsed, fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	return parsed, nil
+}
+
+// shingles returns the set of shingle hashes of text. Text shorter than a
+// shingle yields one shingle of all its words.
+func shingles(text string) map[uint64]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	set := map[uint64]bool{}
+	if len(words) == 0 {
+		return set
+	}
+	size := shingleSize
+	if len(words) < size {
+		size = len(words)
+	}
+	for i := 0; i+size <= len(words); i++ {
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.Join(words[i:i+size], " ")))
+		set[hash.Sum64()] = true
+	}
+	return set
+}
+
+// jaccard returns the similarity of two shingle sets and the shingles they share
+func jaccard(a map[uint64]bool, b map[uint64]bool) (float64, int) {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	shared := 0
+	for hash := range a {
+		if b[hash] {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0, 0
+	}
+	return float64(shared) / float64(union), shared
+}
+
+// similarCommand prints the sections of the workspace most similar to a section
+func similarCommand(filePath string, sectionID string, args similarArgs) int {
+	doc, err := loadDocument(filePath)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+	if doc.contentStart == -1 {
+		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
+		return 1
+	}
+
+	var target *iatf.Section
+	for i := range doc.sections {
+		if doc.sections[i].ID == sectionID {
+			target = &doc.sections[i]
+			break
+		}
+	}
+	if target == nil {
+		fmt.Fprintf(os.Stderr, "Error: Section not found: %s\n", sectionID)
+		return 1
+	}
+
+	workspace := args.workspace
+	if workspace == "" {
+		workspace = filepath.Dir(filePath)
+	}
+	if info, err := os.Stat(workspace); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: Not a directory: %s\n", workspace)
+		return 1
+	}
+
+	report := SimilarReport{File: filePath, ID: sectionID, Workspace: workspace, Results: []SimilarResult{}}
+	source := shingles(strings.Join(target.ContentLines, "\n"))
+	report.Shingles = len(source)
+	self, _ := filepath.Abs(filePath)
+
+	for _, rel := range workspaceFiles(workspace) {
+		path := filepath.Join(workspace, rel)
+		other := doc
+		if abs, _ := filepath.Abs(path); abs != self {
+			if other, err = loadDocument(path); err != nil {
+				continue
+			}
+		}
+		for _, section := range other.sections {
+			if other == doc && section.ID == sectionID {
+				continue
+			}
+			score, shared := jaccard(source, shingles(strings.Join(section.ContentLines, "\n")))
+			if shared == 0 || score < args.minScore {
+				continue
+			}
+			report.Results = append(report.Results, SimilarResult{
+				File:   filepath.ToSlash(rel),
+				ID:     section.ID,
+				Title:  section.Title,
+				Start:  section.Start,
+				End:    section.End,
+				Score:  math.Round(score*1000) / 1000,
+				Shared: shared,
+			})
+		}
+	}
+
+	sort.SliceStable(report.Results, func(i, j int) bool {
+		return report.Results[i].Score > report.Results[j].Score
+	})
+	if len(report.Results) > args.limit {
+		report.Results = report.Results[:args.limit]
+	}
+
+	if args.json {
+		return printJSON(report)
+	}
+	fmt.Printf("@similar: %s#%s (%d shingles, workspace %s)\n\n", filepath.Base(filePath), sectionID, report.Shingles, workspace)
+	if len(report.Results) == 0 {
+		fmt.Println("No similar sections found")
+		return 0
+	}
+	for _, result := range report.Results {
+		fmt.Printf("%.3f  %s#%s  %s (lines %d-%d, %d shared)\n", result.Score, result.File, result.ID, result.Title, result.Start, result.End, result.Shared)
+	}
+	return 0
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// 'iatf summarize' fills in @summary: lines with a summarizer: an external
+// command that reads a section on stdin and prints its summary, or an
+// OpenAI-compatible chat completions endpoint. Without --write it only
+// prints the changes as a diff, so generated summaries get reviewed before
+// they land in the document.
+
+// summarizeTimeout bounds each call to the summarizer
+const summarizeTimeout = 2 * time.Minute
+
+// summarizePrompt is the instruction sent to an endpoint with each section
+const summarizePrompt = "Summarize the following section of a document in one sentence of at most 25 words, " +
+	"for the index an AI agent reads to decide which sections to open. " +
+	"Reply with the summary only."
+
+// summarizeArgs are the parsed arguments of 'iatf summarize' after the file
+type summarizeArgs struct {
+	onlyMissing bool
+	write       bool
+	command     string // Shell command reading a section on stdin
+	endpoint    string // Base URL of an OpenAI-compatible API
+	model       string
+}
+
+// summaryEdit replaces the @summary: lines of a section (none when
+// oldCount is 0) with a single line
+type summaryEdit struct {
+	section  iatf.Section
+	at       int // 0-indexed line of the old summary, or where the new one goes
+	oldCount int
+	summary  string
+}
+
+// parseSummarizeArgs reads --only-missing, --write, --command <cmd>,
+// --endpoint <url> and --model <name>
+func parseSummarizeArgs(args []string) (summarizeArgs, error) {
+	parsed := summarizeArgs{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--only-missing":
+			parsed.onlyMissing = true
+		case "--write":
+			parsed.write = true
+		case "--command", "--endpoint", "--model":
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("%s requires a value", args[i])
+			}
+			switch args[i] {
+			case "--command":
+				parsed.command = args[i+1]
+			case "--endpoint":
+				parsed.endpoint = args[i+1]
+			case "--model":
+				parsed.model = args[i+1]
+			}
+			i++
+		default:
+			return parsed, fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+	if (parsed.command == "") == (parsed.endpoint == "") {
+		return parsed, fmt.Errorf("exactly one of --command or --endpoint is required")
+	}
+	if parsed.endpoint != "" && parsed.model == "" {
+		return parsed, fmt.Errorf("--endpoint requires --model")
+	}
+	return parsed, nil
+}
+
+// summarizeCommand summarizes the sections of filePath and prints the diff,
+// or applies it and rebuilds the INDEX with --write
+func summarizeCommand(filePath string, args summarizeArgs) int {
+	content, err := readFileWithinLimits(filePath)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: File not found: %s\n", filePath)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		return 1
+	}
+
+	lines := strings.Split(string(content), "\n")
+	contentStart := iatf.ContentStart(lines)
+	if contentStart == -1 {
+		fmt.Fprintln(os.Stderr, "Error: No ===CONTENT=== section found")
+		return 1
+	}
+	if err := iatf.ValidateNesting(lines, contentStart); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid section nesting: %v\n", err)
+		return 1
+	}
+
+	edits := []summaryEdit{}
+	failed := 0
+	for _, section := range iatf.ParseSections(lines, contentStart) {
+		if args.onlyMissing && section.Summary != "" {
+			continue
+		}
+		summary, err := summarizeSection(section, sectionBody(lines, section), args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", mark(os.Stderr, "[ERROR]"), section.ID, err)
+			failed++
+			continue
+		}
+		if summary == section.Summary {
+			continue
+		}
+		at, oldCount := summaryLines(lines, section)
+		edits = append(edits, summaryEdit{section: section, at: at, oldCount: oldCount, summary: summary})
+	}
+
+	if len(edits) == 0 {
+		fmt.Fprintln(os.Stderr, "No summaries to change")
+	} else if args.write {
+		if err := os.WriteFile(filePath, []byte(strings.Join(applySummaryEdits(lines, edits), "\n")), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+			return 1
+		}
+		if err := rebuildIndex(filePath); err != nil {
+			fmt.Fprintf(os.Stderr, "%s Summaries written, but the index rebuild failed: %v\n", mark(os.Stderr, "[ERROR]"), err)
+			return 1
+		}
+		fmt.Printf("%s Updated %d summary(ies) in %s\n", mark(os.Stdout, "[OK]"), len(edits), filePath)
+	} else {
+		printSummaryDiff(filePath, lines, edits)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// sectionBody returns the lines between the tags of a section, nested
+// sections included
+func sectionBody(lines []string, section iatf.Section) string {
+	end := section.End - 1
+	if section.End == 0 {
+		end = len(lines)
+	}
+	return strings.Join(lines[section.Start:end], "\n")
+}
+
+// summaryLines locates the @summary: line of a section and its indented
+// continuation lines. Without one, the new line goes right after the tag.
+func summaryLines(lines []string, section iatf.Section) (at int, count int) {
+	for i := section.Start; i < len(lines) && strings.HasPrefix(lines[i], "@"); i++ {
+		if !strings.HasPrefix(lines[i], "@summary:") {
+			continue
+		}
+		count = 1
+		for i+count < len(lines) {
+			next := lines[i+count]
+			if strings.TrimSpace(next) == "" || !(strings.HasPrefix(next, " ") || strings.HasPrefix(next, "\t")) {
+				break
+			}
+			count++
+		}
+		return i, count
+	}
+	return section.Start, 0
+}
+
+// applySummaryEdits returns lines with the edits made, last first so the
+// positions of the earlier ones stay valid
+func applySummaryEdits(lines []string, edits []summaryEdit) []string {
+	result := append([]string{}, lines...)
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		replaced := append([]string{"@summary: " + edit.summary}, result[edit.at+edit.oldCount:]...)
+		result = append(result[:edit.at], replaced...)
+	}
+	return result
+}
+
+// printSummaryDiff prints the edits as a unified diff, with the lines from
+// the section tag to the summary and the line after it as context
+func printSummaryDiff(filePath string, lines []string, edits []summaryEdit) {
+	fmt.Printf("--- a/%s\n+++ b/%s\n", filePath, filePath)
+	offset := 0
+	for _, edit := range edits {
+		context := lines[edit.section.Start-1 : edit.at]
+		after := []string{}
+		if next := edit.at + edit.oldCount; next < len(lines) {
+			after = lines[next : next+1]
+		}
+		oldCount := len(context) + edit.oldCount + len(after)
+		newCount := len(context) + 1 + len(after)
+		fmt.Printf("@@ -%d,%d +%d,%d @@ %s\n", edit.section.Start, oldCount, edit.section.Start+offset, newCount, edit.section.Title)
+		for _, line := range context {
+			fmt.Printf(" %s\n", line)
+		}
+		for _, old := range lines[edit.at : edit.at+edit.oldCount] {
+			fmt.Printf("-%s\n", old)
+		}
+		fmt.Printf("+@summary: %s\n", edit.summary)
+		for _, line := range after {
+			fmt.Printf(" %s\n", line)
+		}
+		offset += 1 - edit.oldCount
+	}
+	fmt.Fprintf(os.Stderr, "\n%d summary(ies) to change; run again with --write to apply them\n", len(edits))
+}
+
+// summarizeSection asks the summarizer for the summary of a section, as a
+// single line
+func summarizeSection(section iatf.Section, body string, args summarizeArgs) (string, error) {
+	var summary string
+	var err error
+	if args.command != "" {
+		summary, err = runSummarizerCommand(args.command, section, body)
+	} else {
+		summary, err = requestSummary(args.endpoint, args.model, section, body)
+	}
+	if err != nil {
+		return "", err
+	}
+	summary = strings.Join(strings.Fields(summary), " ")
+	if summary == "" {
+		return "", fmt.Errorf("summarizer returned an empty summary")
+	}
+	return summary, nil
+}
+
+// runSummarizerCommand runs command with the section on stdin and its ID
+// and title as IATF_SECTION_ID and IATF_SECTION_TITLE
+func runSummarizerCommand(command string, section iatf.Section, body string) (string, error) {
+	cmd := shellCommand(command)
+	cmd.Stdin = strings.NewReader(body)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"IATF_SECTION_ID="+section.ID,
+		"IATF_SECTION_TITLE="+section.Title,
+	)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("summarizer failed: %w", err)
+	}
+	finished := make(chan error, 1)
+	go func() { finished <- cmd.Wait() }()
+	select {
+	case err := <-finished:
+		if err != nil {
+			return "", fmt.Errorf("summarizer failed: %w", err)
+		}
+	case <-time.After(summarizeTimeout):
+		cmd.Process.Kill()
+		<-finished
+		return "", fmt.Errorf("summarizer timed out after %s", summarizeTimeout)
+	}
+	return output.String(), nil
+}
+
+// requestSummary asks an OpenAI-compatible chat completions endpoint for the
+// summary of a section. The API key, if any, is read from OPENAI_API_KEY.
+func requestSummary(endpoint string, model string, section iatf.Section, body string) (string, error) {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/chat/completions") {
+		url += "/chat/completions"
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "system", "content": summarizePrompt},
+			{"role": "user", "content": "# " + section.Title + "\n\n" + body},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "iatf/"+Version)
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	client := &http.Client{Timeout: summarizeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", fmt.Errorf("unexpected response (%s): %w", resp.Status, err)
+	}
+	if completion.Error != nil {
+		return "", fmt.Errorf("endpoint error (%s): %s", resp.Status, completion.Error.Message)
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("endpoint returned no choices")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// Helpers shared by the commands that answer queries about a workspace
+// directory of .iatf files (mcp, serve, rpc)
+
+// serverArgs are the parsed arguments of the servers (serve, mcp, rpc)
+type serverArgs struct {
+	root           string
+	addr           string // serve only
+	policy         string // Policy file; "" for the workspace's own, if any
+	includePrivate bool   // Serve sections marked @visibility: private
+}
+
+// parseServerArgs reads the optional directory, --policy <file>,
+// --include-private and, when withAddr is set, --addr <host:port>
+func parseServerArgs(args []string, withAddr bool) (serverArgs, error) {
+	parsed := serverArgs{root: ".", addr: defaultServeAddr}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--policy" || (withAddr && args[i] == "--addr"):
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("%s requires a value", args[i])
+			}
+			if args[i] == "--policy" {
+				parsed.policy = args[i+1]
+			} else {
+				parsed.addr = args[i+1]
+			}
+			i++
+		case args[i] == "--include-private":
+			parsed.includePrivate = true
+		case strings.HasPrefix(args[i], "--"):
+			return parsed, fmt.Errorf("unknown option: %s", args[i])
+		default:
+			parsed.root = args[i]
+		}
+	}
+	return parsed, nil
+}
+
+// openWorkspace returns the absolute root of a server's workspace and its
+// access policy. The policy is nil only when there is no policy file and
+// private sections are included.
+func openWorkspace(args serverArgs) (string, *accessPolicy, error) {
+	info, err := os.Stat(args.root)
+	if err != nil || !info.IsDir() {
+		return "", nil, fmt.Errorf("Not a directory: %s", args.root)
+	}
+	absRoot, err := filepath.Abs(args.root)
+	if err != nil {
+		return "", nil, err
+	}
+	policy, err := loadAccessPolicy(absRoot, args.policy)
+	if err != nil {
+		return "", nil, err
+	}
+	if !args.includePrivate {
+		if policy == nil {
+			policy = &accessPolicy{}
+		}
+		policy.hidePrivate = true
+	}
+	return absRoot, policy, nil
+}
+
+// resolveWorkspaceFile checks that file, relative to root or absolute, is a
+// .iatf file inside root and returns its path relative to root
+func resolveWorkspaceFile(root string, file string) (string, error) {
+	if file == "" {
+		return "", fmt.Errorf("file is required")
+	}
+	path := file
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	rel, err := filepath.Rel(root, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the workspace", file)
+	}
+	if filepath.Ext(rel) != ".iatf" {
+		return "", fmt.Errorf("%s is not a .iatf file", file)
+	}
+	return rel, nil
+}
+
+// workspaceFiles returns the .iatf files under root, relative to it and sorted
+func workspaceFiles(root string) []string {
+	files := []string{}
+	walkIATFFiles(root, nil, symlinksFiles, func(path string, info os.FileInfo) {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			files = append(files, rel)
+		}
+	})
+	sort.Strings(files)
+	return files
+}
+
+// document is a parsed .iatf file
+type document struct {
+	lines        []string
+	contentStart int            // -1 when there is no ===CONTENT=== marker
+	sections     []iatf.Section // Empty when contentStart is -1
+}
+
+// parseDocument splits and parses the content of a .iatf file
+func parseDocument(content []byte) *document {
+	doc := &document{lines: strings.Split(string(content), "\n")}
+	doc.contentStart = iatf.ContentStart(doc.lines)
+	if doc.contentStart >= 0 {
+		doc.sections = iatf.ParseSections(doc.lines, doc.contentStart)
+	}
+	return doc
+}
+
+// loadDocument reads and parses the .iatf file at path
+func loadDocument(path string) (*document, error) {
+	content, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseDocument(content), nil
+}
+
+// documentCache keeps parsed documents between requests of a long-running
+// command. An entry is reused while the file's modification time and size
+// are unchanged; when they change, the file is read again but only
+// re-parsed if its content hash differs (a touch or a save without edits).
+type documentCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedDocument
+}
+
+type cachedDocument struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+	doc     *document
+}
+
+func newDocumentCache() *documentCache {
+	return &documentCache{entries: map[string]*cachedDocument{}}
+}
+
+// load returns the parsed document at path, from the cache when it is
+// current. Documents must not be modified by callers.
+func (c *documentCache) load(path string) (*document, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		c.forget(path)
+		return nil, err
+	}
+
+	c.mu.Lock()
+	entry := c.entries[path]
+	c.mu.Unlock()
+	if entry != nil && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.doc, nil
+	}
+
+	content, err := readDocument(path)
+	if err != nil {
+		c.forget(path)
+		return nil, err
+	}
+	hash := sha256.Sum256(content)
+	if entry == nil || entry.hash != hash {
+		entry = &cachedDocument{hash: hash, doc: parseDocument(content)}
+	} else {
+		entry = &cachedDocument{hash: hash, doc: entry.doc}
+	}
+	entry.modTime, entry.size = info.ModTime(), info.Size()
+
+	c.mu.Lock()
+	c.entries[path] = entry
+	c.mu.Unlock()
+	return entry.doc, nil
+}
+
+// forget drops the entry of a file that can no longer be read
+func (c *documentCache) forget(path string) {
+	c.mu.Lock()
+	delete(c.entries, path)
+	c.mu.Unlock()
+}
+
+// searchHit is a section matching a search query
+type searchHit struct {
+	File    string
+	Section iatf.Section
+	Line    int    // 1-indexed line of the first content match, 0 if only the title or summary matched
+	Text    string // That line, trimmed
+}
+
+// searchWorkspace searches file, or every .iatf file under root when file
+// is empty, for sections containing every term (lowercase), reading the
+// documents with load and leaving out what policy denies
+func searchWorkspace(root string, file string, terms []string, load func(path string) (*document, error), policy *accessPolicy) ([]searchHit, error) {
+	files := []string{}
+	if file != "" {
+		rel, err := resolveWorkspaceFile(root, file)
+		if err != nil {
+			return nil, err
+		}
+		if !policy.fileAllowed(rel) {
+			return nil, fmt.Errorf("file not found: %s", file)
+		}
+		files = append(files, rel)
+	} else {
+		files = workspaceFiles(root)
+	}
+
+	hits := []searchHit{}
+	for _, rel := range files {
+		doc, err := load(filepath.Join(root, rel))
+		if err != nil {
+			if file != "" {
+				return nil, err
+			}
+			continue
+		}
+		hits = append(hits, searchSections(filepath.ToSlash(rel), doc, terms)...)
+	}
+	return policy.visibleHits(root, hits, load), nil
+}
+
+// searchSections returns the sections of a document whose title, summary and
+// content together contain every term (lowercase)
+func searchSections(file string, doc *document, terms []string) []searchHit {
+	lines := doc.lines
+	hits := []searchHit{}
+	for _, section := range doc.sections {
+		text := strings.ToLower(section.Title + "\n" + section.Summary + "\n" + strings.Join(section.ContentLines, "\n"))
+		matched := true
+		for _, term := range terms {
+			if !strings.Contains(text, term) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		hit := searchHit{File: file, Section: section}
+		end := section.End
+		if end == 0 {
+			end = len(lines)
+		}
+		for i := section.Start; i < end-1 && i < len(lines); i++ {
+			if strings.Contains(strings.ToLower(lines[i]), terms[0]) {
+				hit.Line = i + 1
+				hit.Text = strings.TrimSpace(lines[i])
+				break
+			}
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
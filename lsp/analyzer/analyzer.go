@@ -1,18 +1,68 @@
 package analyzer
 
 import (
+	"path"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
 	protocol "github.com/tliron/glsp/protocol_3_16"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+	protocol317 "github.com/Winds-AI/agent-traversal-file/lsp/protocol_3_17"
 )
 
-// Pre-compiled regex patterns for IATF parsing (matching go/main.go patterns)
+// longSectionLines is the length above which a section gets an inlay hint at
+// its midpoint naming the enclosing sections
+const longSectionLines = 60
+
+// previewLines is how many lines of a section hovers on references and INDEX entries show
+const previewLines = 10
+
+// metadataKey documents an @key: annotation for completion
+type metadataKey struct {
+	Key           string
+	Documentation string
+}
+
+// sectionMetadataKeys are the annotations allowed right after {#id}
+var sectionMetadataKeys = []metadataKey{
+	{"summary", "Description of the section, copied into the INDEX entry. Continue it on indented lines up to a blank line; the lines are joined with spaces and the INDEX wraps it at the header's `@summary-width:`."},
+	{"created", "Creation date (YYYY-MM-DD). `iatf rebuild` records it in the INDEX entry; it is not part of the content hash."},
+	{"tags", "Comma-separated tags, copied into the INDEX entry. `iatf index --tag` and `iatf read --tag` select sections by tag."},
+	{"status", "`draft`, `stable` or `deprecated`, copied into the INDEX entry. References to deprecated sections are reported, and `iatf read --exclude-drafts` leaves drafts out."},
+	{"owner", "Person or team maintaining the section, copied into the INDEX entry. `iatf query --owner` lists their sections."},
+	{"audience", "Comma-separated audiences of the section, such as `agent`, `human` or `internal`. `iatf read --audience` and `iatf index --audience` leave out sections for other audiences."},
+	{"visibility", "`public` or `private`. `iatf read` and the servers leave private sections out, unless given `--include-private`."},
+	{"aliases", "Comma-separated former IDs of the section. References and `iatf read` still resolve them; `iatf validate` warns where they are used."},
+	{"review-by", "Date (YYYY-MM-DD) by which the section should be reviewed. `iatf outdated` reports it once the date has passed, instead of going by its Modified date."},
+}
+
+// headerMetadataKeys are the annotations allowed in the file header
+var headerMetadataKeys = []metadataKey{
+	{"title", "Document title, shown by tools that list IATF files."},
+	{"purpose", "What the document is for, to help agents decide whether to read it."},
+	{"description", "Short description of the document, shown in the master index (`iatf index <dir>`)."},
+	{"version", "Version of the document's content, such as `1.2` or `2026.10`."},
+	{"updated", "Date (YYYY-MM-DD) the document was last revised."},
+	{"hashes", "`short` (default) or `full`. With `full`, `iatf rebuild` records whole sha256 hashes in the INDEX, and they are checked against each section's CONTENT."},
+	{"word-count", "`unicode` (default) or `spaces`: how INDEX word counts are taken. `unicode` counts each CJK ideograph and kana as a word; `spaces` only splits on whitespace."},
+	{"summary-width", "Column at which `iatf rebuild` wraps INDEX summaries (default 100); 0 keeps each summary on one line."},
+}
+
+// Pre-compiled regex patterns for IATF parsing; tags and references are the CLI's
 var (
-	sectionOpenPattern  = regexp.MustCompile(`\{#([a-zA-Z][a-zA-Z0-9_-]*)\}`)
-	sectionClosePattern = regexp.MustCompile(`\{/([a-zA-Z][a-zA-Z0-9_-]*)\}`)
-	referencePattern    = regexp.MustCompile(`\{@([a-zA-Z][a-zA-Z0-9_-]*)\}`)
+	sectionOpenPattern    = iatf.SectionOpenPattern
+	sectionClosePattern   = iatf.SectionClosePattern
+	referencePattern      = iatf.ReferencePattern
+	crossReferencePattern = regexp.MustCompile(`\{@([^{}#\s]+)#([a-zA-Z][a-zA-Z0-9_-]*)\}`) // {@path/to/file.iatf#id}, relative to the file
+	metadataPrefixPattern = regexp.MustCompile(`^@[a-zA-Z-]*$`)
+	snippetPrefixPattern  = regexp.MustCompile(`^\s*[a-zA-Z:]*$`)
+	headingPattern        = regexp.MustCompile(`^(#{1,6})\s+(.+)$`)
+	slugSeparatorPattern  = regexp.MustCompile(`[^a-z0-9]+`)
+	indexEntryPattern     = regexp.MustCompile(`^#{1,6}\s+.*\{#([a-zA-Z][a-zA-Z0-9_-]*)\s*\|`)
 )
 
 // Section represents an IATF section with its metadata
@@ -20,17 +70,26 @@ type Section struct {
 	ID       string
 	Title    string
 	Summary  string
-	Start    int // 0-indexed line number
-	End      int // 0-indexed line number
+	Tags     []string
+	Status   string   // draft, stable, deprecated or "" (see iatf.Statuses)
+	Owner    string   // Person or team from @owner:
+	ReviewBy string   // YYYY-MM-DD from @review-by:
+	Aliases  []string // Former IDs from @aliases:
+	Audience []string // Audiences from @audience:
+	Start    int      // 0-indexed line number
+	End      int      // 0-indexed line number
 	Level    int
 	StartCol int
 	EndCol   int
+	Parent   *Section // Enclosing section, nil at top level
 }
 
 // Reference represents a cross-reference to a section
 type Reference struct {
 	TargetID string
-	Line     int // 0-indexed
+	Anchor   string // Anchor name of {@id:anchor}, empty for section references
+	File     string // Target file as written in {@file#id}, empty within the document
+	Line     int    // 0-indexed
 	StartCol int
 	EndCol   int
 }
@@ -40,32 +99,119 @@ type Document struct {
 	URI             string
 	Content         string
 	Lines           []string
-	Sections        map[string]*Section // ID -> Section
-	OrderedSections []*Section          // Sections in order of appearance
-	References      []Reference         // All references found
-	Errors          []ValidationError
+	Sections        map[string]*Section    // ID -> Section
+	Aliases         map[string]string      // Alias -> ID of its section (see iatf.AliasTargets)
+	Anchors         map[string]iatf.Anchor // "id:name" -> anchor inside section id
+	OrderedSections []*Section             // Sections in order of appearance
+	References      []Reference            // All references found
+	CrossReferences []Reference            // References to sections of other files
+	Errors          []ValidationError      // Set by validation, which runs on first use after a parse
+	options         Options
+	validated       bool
+	generation      int // Incremented by every parse
 	mu              sync.RWMutex
 }
 
+// Options configures validation
+type Options struct {
+	MaxNestingDepth int
+	// Severities overrides the severity of diagnostics by code (e.g. "W001"):
+	// error, warning, information, hint, or off to hide them
+	Severities map[string]string
+}
+
+// DefaultOptions returns the validation rules of 'iatf validate'
+func DefaultOptions() Options {
+	return Options{MaxNestingDepth: 2}
+}
+
+// ParseSeverity parses a severity setting; off reports ok with a zero severity
+func ParseSeverity(name string) (severity protocol.DiagnosticSeverity, ok bool) {
+	switch strings.ToLower(name) {
+	case "error":
+		return protocol.DiagnosticSeverityError, true
+	case "warning":
+		return protocol.DiagnosticSeverityWarning, true
+	case "information", "info":
+		return protocol.DiagnosticSeverityInformation, true
+	case "hint":
+		return protocol.DiagnosticSeverityHint, true
+	case "off":
+		return 0, true
+	}
+	return 0, false
+}
+
 // ValidationError represents a validation error in the document
 type ValidationError struct {
 	Message  string
-	Line     int // 0-indexed
+	Code     string // Code shared with 'iatf validate' and 'iatf explain'
+	Line     int    // 0-indexed
 	StartCol int
 	EndCol   int
 	Severity protocol.DiagnosticSeverity
+	Fixes    []Fix // Quick fixes offered as code actions
+}
+
+// Fix is a quick fix for a validation error: a single edit replacing
+// StartCol..EndCol on Line (an insertion when they are equal), or a rebuild
+// of the whole INDEX
+type Fix struct {
+	Title     string
+	Line      int // 0-indexed
+	StartCol  int
+	EndLine   int // Line of EndCol when the edit spans lines, else 0
+	EndCol    int
+	NewText   string
+	Rebuild   bool // Run the rebuild command instead of editing
+	Preferred bool
 }
 
 // DocumentStore manages all open documents
 type DocumentStore struct {
 	documents map[string]*Document
+	options   Options
 	mu        sync.RWMutex
 }
 
+// NewDocument creates and parses a document that is not tracked by a store
+func NewDocument(uri string, content string, options Options) *Document {
+	doc := &Document{
+		URI:      uri,
+		Content:  content,
+		Sections: make(map[string]*Section),
+		options:  options,
+	}
+	doc.Parse()
+	return doc
+}
+
 // NewDocumentStore creates a new document store
 func NewDocumentStore() *DocumentStore {
 	return &DocumentStore{
 		documents: make(map[string]*Document),
+		options:   DefaultOptions(),
+	}
+}
+
+// Options returns the validation options used for new documents
+func (ds *DocumentStore) Options() Options {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.options
+}
+
+// SetOptions changes the validation options and re-parses every open document
+func (ds *DocumentStore) SetOptions(options Options) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.options = options
+	for _, doc := range ds.documents {
+		doc.mu.Lock()
+		doc.options = options
+		doc.mu.Unlock()
+		doc.Parse()
 	}
 }
 
@@ -74,13 +220,7 @@ func (ds *DocumentStore) Open(uri string, content string) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	doc := &Document{
-		URI:      uri,
-		Content:  content,
-		Sections: make(map[string]*Section),
-	}
-	doc.Parse()
-	ds.documents[uri] = doc
+	ds.documents[uri] = NewDocument(uri, content, ds.options)
 }
 
 // Update updates an existing document and re-parses it
@@ -94,13 +234,7 @@ func (ds *DocumentStore) Update(uri string, content string) {
 		doc.mu.Unlock()
 		doc.Parse()
 	} else {
-		doc := &Document{
-			URI:      uri,
-			Content:  content,
-			Sections: make(map[string]*Section),
-		}
-		doc.Parse()
-		ds.documents[uri] = doc
+		ds.documents[uri] = NewDocument(uri, content, ds.options)
 	}
 }
 
@@ -111,6 +245,18 @@ func (ds *DocumentStore) Close(uri string) {
 	delete(ds.documents, uri)
 }
 
+// All returns every open document
+func (ds *DocumentStore) All() []*Document {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	docs := make([]*Document, 0, len(ds.documents))
+	for _, doc := range ds.documents {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
 // Get returns a document by URI
 func (ds *DocumentStore) Get(uri string) *Document {
 	ds.mu.RLock()
@@ -118,360 +264,742 @@ func (ds *DocumentStore) Get(uri string) *Document {
 	return ds.documents[uri]
 }
 
-// Parse parses the document content
+// Parse parses the document content. Validation, the costly part on large
+// documents, is deferred until diagnostics or quick fixes are requested, so
+// edits stay responsive.
 func (d *Document) Parse() {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	d.Lines = strings.Split(d.Content, "\n")
+	d.parseLines()
+}
+
+// parseLines parses d.Lines from scratch
+func (d *Document) parseLines() {
 	d.Sections = make(map[string]*Section)
+	d.Aliases = map[string]string{}
+	d.Anchors = map[string]iatf.Anchor{}
 	d.OrderedSections = nil
 	d.References = nil
+	d.CrossReferences = nil
 	d.Errors = nil
+	d.validated = false
+	d.generation++
 
-	d.validate()
 	d.parseSections()
 	d.parseReferences()
-	d.validateReferences()
 }
 
-// validate performs basic validation of the IATF file structure
-func (d *Document) validate() {
-	// Check format declaration
-	if len(d.Lines) == 0 || strings.TrimSpace(d.Lines[0]) != ":::IATF" {
-		d.Errors = append(d.Errors, ValidationError{
-			Message:  "Missing format declaration (:::IATF) at the beginning of the file",
-			Line:     0,
-			StartCol: 0,
-			EndCol:   len(d.Lines[0]),
-			Severity: protocol.DiagnosticSeverityError,
-		})
+// ensureValidated validates the document if it changed since the last validation
+func (d *Document) ensureValidated() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.validated {
+		return
 	}
+	d.validate()
+	d.applySeverities()
+	d.validated = true
+}
 
-	// Find INDEX and CONTENT sections
-	hasIndex := false
-	hasContent := false
-	indexLine := -1
-	contentLine := -1
+// Generation identifies the parsed content; it changes on every parse
+func (d *Document) Generation() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.generation
+}
 
-	for i, line := range d.Lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "===INDEX===" {
-			hasIndex = true
-			indexLine = i
-		} else if trimmed == "===CONTENT===" {
-			hasContent = true
-			contentLine = i
-		}
+// LineCount returns the number of lines of the document
+func (d *Document) LineCount() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.Lines)
+}
+
+// Size returns the length of the document's content in bytes
+func (d *Document) Size() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.Content)
+}
+
+// applySeverities applies the configured severity overrides
+func (d *Document) applySeverities() {
+	if len(d.options.Severities) == 0 {
+		return
 	}
 
-	if !hasContent {
-		lastLine := len(d.Lines) - 1
-		if lastLine < 0 {
-			lastLine = 0
+	d.Errors = d.options.applySeverities(d.Errors)
+}
+
+// applySeverities applies the severity overrides to errors, dropping those turned off
+func (o Options) applySeverities(errors []ValidationError) []ValidationError {
+	kept := errors[:0]
+	for _, err := range errors {
+		if name, exists := o.Severities[err.Code]; exists {
+			severity, ok := ParseSeverity(name)
+			if ok && severity == 0 {
+				continue // off
+			}
+			if ok {
+				err.Severity = severity
+			}
 		}
-		d.Errors = append(d.Errors, ValidationError{
-			Message:  "Missing ===CONTENT=== section",
-			Line:     lastLine,
-			StartCol: 0,
-			EndCol:   1,
-			Severity: protocol.DiagnosticSeverityError,
-		})
+		kept = append(kept, err)
 	}
+	return kept
+}
 
-	if !hasIndex {
-		d.Errors = append(d.Errors, ValidationError{
-			Message:  "Missing ===INDEX=== section (Run 'iatf rebuild' to create)",
-			Line:     0,
-			StartCol: 0,
-			EndCol:   1,
-			Severity: protocol.DiagnosticSeverityWarning,
-		})
-	}
+// indexFixCodes are the issues that 'iatf rebuild' resolves
+var indexFixCodes = map[string]bool{"E012": true, "E013": true, "E014": true, "W004": true, "W005": true}
 
-	if hasIndex && hasContent && indexLine > contentLine {
-		d.Errors = append(d.Errors, ValidationError{
-			Message:  "INDEX section must appear before CONTENT section",
-			Line:     indexLine,
-			StartCol: 0,
-			EndCol:   len(d.Lines[indexLine]),
-			Severity: protocol.DiagnosticSeverityError,
-		})
-	}
+// IsIndexIssue reports whether a diagnostic code means the INDEX is out of date
+func IsIndexIssue(code string) bool {
+	return indexFixCodes[code]
 }
 
-// parseSections parses all section tags in the document
-func (d *Document) parseSections() {
-	// Find CONTENT section start
-	contentStart := -1
-	for i, line := range d.Lines {
-		if strings.TrimSpace(line) == "===CONTENT===" {
-			contentStart = i + 1
-			break
+// validate runs the validation of 'iatf validate', so the editor reports
+// exactly what the CLI does, and attaches quick fixes
+func (d *Document) validate() {
+	report := iatf.Validate(d.Lines, iatf.Options{MaxNestingDepth: d.options.MaxNestingDepth})
+
+	reported := map[string]bool{}
+	similar := map[string][]string{} // Dangling reference target -> similar section IDs
+	for _, issue := range report.Issues() {
+		err := ValidationError{
+			Message:  issue.Message,
+			Code:     issue.Code,
+			Line:     issue.Line - 1,
+			StartCol: issue.StartCol,
+			EndCol:   issue.EndCol,
+			Severity: protocol.DiagnosticSeverityError,
+		}
+		if issue.Severity == iatf.SeverityWarning {
+			err.Severity = protocol.DiagnosticSeverityWarning
+		}
+		if issue.Line == 0 {
+			err.Line, err.StartCol, err.EndCol = 0, 0, len(d.Lines[0])
+		}
+
+		// The CLI can report a nesting problem twice (as invalid nesting and
+		// as the tag itself); show it once
+		key := issue.Code + ":" + strconv.Itoa(err.Line)
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+
+		switch {
+		case issue.Code == "E008":
+			err.Fixes = d.strayContentFixes(err.Line)
+		case issue.Code == "E007":
+			if section := d.sectionStartingAt(err.Line); section != nil {
+				err.Fixes = d.closingTagFixes(section)
+			}
+		case issue.Code == "E016":
+			if ref, ok := d.referenceAt(err.Line, err.StartCol); ok {
+				if _, exists := similar[ref.TargetID]; !exists {
+					similar[ref.TargetID] = d.similarSectionIDs(ref.TargetID, 3)
+				}
+				err.Fixes = d.danglingReferenceFixes(ref, similar[ref.TargetID])
+			}
+		case issue.Code == "W012":
+			if ref, ok := d.referenceAt(err.Line, err.StartCol); ok {
+				err.Fixes = []Fix{{
+					Title:     "Replace with {@" + d.canonicalID(ref.TargetID) + "}",
+					Line:      ref.Line,
+					StartCol:  ref.StartCol,
+					EndCol:    ref.EndCol,
+					NewText:   "{@" + d.canonicalID(ref.TargetID) + "}",
+					Preferred: true,
+				}}
+			}
+		case indexFixCodes[issue.Code]:
+			err.Fixes = []Fix{{Title: "Regenerate INDEX", Rebuild: true, Preferred: true}}
 		}
+		d.Errors = append(d.Errors, err)
 	}
+}
 
+// parseSections builds the section tree from the CLI's parse of CONTENT
+func (d *Document) parseSections() {
+	contentStart := iatf.ContentStart(d.Lines)
 	if contentStart == -1 {
 		return
 	}
 
-	// Parse sections using a stack for nesting
+	parsedSections := iatf.ParseSections(d.Lines, contentStart)
+	d.Aliases = iatf.AliasTargets(parsedSections)
+	for _, anchor := range iatf.ParseAnchors(d.Lines, contentStart, parsedSections) {
+		key := anchor.Section + ":" + anchor.Name
+		if _, exists := d.Anchors[key]; anchor.Inside && !exists {
+			d.Anchors[key] = anchor
+		}
+	}
+
 	stack := []*Section{}
-	seenIDs := make(map[string]int) // ID -> first occurrence line
+	for _, parsed := range parsedSections {
+		section := &Section{
+			ID:       parsed.ID,
+			Title:    parsed.Title,
+			Summary:  parsed.Summary,
+			Tags:     parsed.Tags,
+			Status:   parsed.Status,
+			Owner:    parsed.Owner,
+			ReviewBy: parsed.ReviewBy,
+			Aliases:  parsed.Aliases,
+			Audience: parsed.Audiences,
+			Start:    parsed.Start - 1,
+			Level:    parsed.Level,
+		}
+		if parsed.End > 0 {
+			section.End = parsed.End - 1
+			section.EndCol = len("{/" + parsed.ID + "}")
+		}
+		for len(stack) >= parsed.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 {
+			section.Parent = stack[len(stack)-1]
+		}
+		stack = append(stack, section)
 
-	for i := contentStart; i < len(d.Lines); i++ {
-		line := d.Lines[i]
+		d.Sections[section.ID] = section
+		d.OrderedSections = append(d.OrderedSections, section)
+	}
+}
 
-		// Check for section open tag
-		if matches := sectionOpenPattern.FindStringSubmatchIndex(line); matches != nil {
-			id := line[matches[2]:matches[3]]
-			startCol := matches[0]
-
-			// Check for duplicate IDs
-			if firstLine, exists := seenIDs[id]; exists {
-				d.Errors = append(d.Errors, ValidationError{
-					Message:  "Duplicate section ID '" + id + "' (first defined on line " + string(rune(firstLine+1)) + ")",
-					Line:     i,
-					StartCol: startCol,
-					EndCol:   matches[1],
-					Severity: protocol.DiagnosticSeverityError,
-				})
-			} else {
-				seenIDs[id] = i
-			}
+// section returns the section with id, or the section id is an alias of
+func (d *Document) section(id string) (*Section, bool) {
+	if section, exists := d.Sections[id]; exists {
+		return section, true
+	}
+	section, exists := d.Sections[d.Aliases[id]]
+	return section, exists
+}
 
-			section := &Section{
-				ID:       id,
-				Title:    id, // Default title to ID
-				Start:    i,
-				StartCol: startCol,
-				Level:    len(stack) + 1,
-			}
+// anchor returns the anchor an {@id:anchor} reference points to
+func (d *Document) anchor(ref Reference) (iatf.Anchor, bool) {
+	if ref.Anchor == "" {
+		return iatf.Anchor{}, false
+	}
+	anchor, exists := d.Anchors[d.canonicalID(ref.TargetID)+":"+ref.Anchor]
+	return anchor, exists
+}
 
-			// Look for summary annotation and title in the following lines
-			d.extractSectionMetadata(section, i+1)
-
-			d.Sections[id] = section
-			d.OrderedSections = append(d.OrderedSections, section)
-			stack = append(stack, section)
-
-			// Check nesting depth
-			if len(stack) > 2 {
-				d.Errors = append(d.Errors, ValidationError{
-					Message:  "Section nesting exceeds maximum depth of 2",
-					Line:     i,
-					StartCol: startCol,
-					EndCol:   matches[1],
-					Severity: protocol.DiagnosticSeverityError,
-				})
-			}
+// canonicalID returns the ID of the section id is an alias of, or id itself
+func (d *Document) canonicalID(id string) string {
+	if canonical, isAlias := d.Aliases[id]; isAlias {
+		return canonical
+	}
+	return id
+}
+
+// CanonicalID resolves id if it is an alias
+func (d *Document) CanonicalID(id string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.canonicalID(id)
+}
+
+// sectionStartingAt returns the section whose open tag is on line
+func (d *Document) sectionStartingAt(line int) *Section {
+	for _, section := range d.OrderedSections {
+		if section.Start == line {
+			return section
 		}
+	}
+	return nil
+}
 
-		// Check for section close tag
-		if matches := sectionClosePattern.FindStringSubmatchIndex(line); matches != nil {
-			id := line[matches[2]:matches[3]]
+// referenceAt returns the reference starting at col on line
+func (d *Document) referenceAt(line int, col int) (Reference, bool) {
+	for _, ref := range d.References {
+		if ref.Line == line && ref.StartCol == col {
+			return ref, true
+		}
+	}
+	return Reference{}, false
+}
 
-			if len(stack) == 0 {
-				d.Errors = append(d.Errors, ValidationError{
-					Message:  "Closing tag {/" + id + "} without matching opening tag",
-					Line:     i,
-					StartCol: matches[0],
-					EndCol:   matches[1],
-					Severity: protocol.DiagnosticSeverityError,
-				})
-			} else if stack[len(stack)-1].ID != id {
-				d.Errors = append(d.Errors, ValidationError{
-					Message:  "Closing tag {/" + id + "} does not match expected {/" + stack[len(stack)-1].ID + "}",
-					Line:     i,
-					StartCol: matches[0],
-					EndCol:   matches[1],
-					Severity: protocol.DiagnosticSeverityError,
-				})
-			} else {
-				stack[len(stack)-1].End = i
-				stack[len(stack)-1].EndCol = matches[1]
-				stack = stack[:len(stack)-1]
+// closingTagFixes suggests where to insert the missing close tag of an
+// unclosed section: before the next open tag that is not nested inside a
+// section opened after it (most likely a sibling), or before a close tag of
+// an enclosing section, falling back to the end of content
+func (d *Document) closingTagFixes(section *Section) []Fix {
+	closeTag := "{/" + section.ID + "}"
+	endOfContent := d.lastContentLine(len(d.Lines), section.Start)
+
+	stop := len(d.Lines)
+	depth := 0
+	for i := section.Start + 1; i < len(d.Lines); i++ {
+		line := d.Lines[i]
+		if sectionOpenPattern.MatchString(line) {
+			if depth == 0 {
+				stop = i
+				break
+			}
+			depth++
+		}
+		if sectionClosePattern.MatchString(line) {
+			if depth == 0 {
+				stop = i
+				break
 			}
+			depth--
 		}
 	}
 
-	// Check for unclosed sections
-	for _, section := range stack {
-		d.Errors = append(d.Errors, ValidationError{
-			Message:  "Unclosed section: " + section.ID,
-			Line:     section.Start,
-			StartCol: section.StartCol,
-			EndCol:   section.StartCol + len("{#"+section.ID+"}"),
-			Severity: protocol.DiagnosticSeverityError,
+	fixes := []Fix{}
+	if stop < len(d.Lines) {
+		line := d.lastContentLine(stop, section.Start)
+		fixes = append(fixes, Fix{
+			Title:     "Insert " + closeTag + " before line " + strconv.Itoa(stop+1),
+			Line:      line,
+			StartCol:  len(d.Lines[line]),
+			EndCol:    len(d.Lines[line]),
+			NewText:   "\n" + closeTag,
+			Preferred: true,
 		})
 	}
+	fixes = append(fixes, Fix{
+		Title:     "Insert " + closeTag + " at end of content",
+		Line:      endOfContent,
+		StartCol:  len(d.Lines[endOfContent]),
+		EndCol:    len(d.Lines[endOfContent]),
+		NewText:   "\n" + closeTag,
+		Preferred: len(fixes) == 0,
+	})
+	return fixes
 }
 
-// extractSectionMetadata extracts @summary and title from section content
-func (d *Document) extractSectionMetadata(section *Section, startLine int) {
-	for i := startLine; i < len(d.Lines) && i < startLine+10; i++ {
-		line := d.Lines[i]
-		trimmed := strings.TrimSpace(line)
-
-		// Stop if we hit a close tag or another open tag
-		if sectionOpenPattern.MatchString(line) || sectionClosePattern.MatchString(line) {
+// strayContentFixes wraps the CONTENT lines starting at line, up to the next
+// section tag, in a new section named after their first heading
+func (d *Document) strayContentFixes(line int) []Fix {
+	stop := len(d.Lines)
+	title := ""
+	for j := line; j < len(d.Lines); j++ {
+		current := d.Lines[j]
+		if sectionOpenPattern.MatchString(current) || sectionClosePattern.MatchString(current) || strings.TrimSpace(current) == "===INDEX===" {
+			stop = j
 			break
 		}
-
-		// Extract @summary
-		if strings.HasPrefix(trimmed, "@summary:") {
-			section.Summary = strings.TrimSpace(strings.TrimPrefix(trimmed, "@summary:"))
-			continue
+		if match := headingPattern.FindStringSubmatch(current); match != nil && title == "" {
+			title = match[2]
 		}
+	}
+	last := d.lastContentLine(stop, line)
+
+	id := d.uniqueSectionID(slugify(title))
+	block := strings.Join(d.Lines[line:last+1], "\n")
+	return []Fix{{
+		Title:     "Wrap in section {#" + id + "}",
+		Line:      line,
+		EndLine:   last,
+		EndCol:    len(d.Lines[last]),
+		NewText:   "{#" + id + "}\n" + block + "\n{/" + id + "}",
+		Preferred: true,
+	}}
+}
 
-		// Extract title from first heading
-		if strings.HasPrefix(trimmed, "#") && section.Title == section.ID {
-			section.Title = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
-		}
+// danglingReferenceFixes suggests creating the missing section at the end of
+// content, or pointing the reference at one of the similar section IDs
+func (d *Document) danglingReferenceFixes(ref Reference, similar []string) []Fix {
+	fixes := []Fix{}
+	for _, id := range similar {
+		fixes = append(fixes, Fix{
+			Title:     "Change reference to {@" + id + "}",
+			Line:      ref.Line,
+			StartCol:  ref.StartCol,
+			EndCol:    ref.EndCol,
+			NewText:   "{@" + id + "}",
+			Preferred: len(fixes) == 0,
+		})
 	}
+
+	last := d.lastContentLine(len(d.Lines), 0)
+	title := strings.Join(strings.FieldsFunc(ref.TargetID, func(r rune) bool { return r == '-' || r == '_' }), " ")
+	title = strings.ToUpper(title[:1]) + title[1:]
+	fixes = append(fixes, Fix{
+		Title:    "Create section {#" + ref.TargetID + "}",
+		Line:     last,
+		StartCol: len(d.Lines[last]),
+		EndCol:   len(d.Lines[last]),
+		NewText:  "\n\n{#" + ref.TargetID + "}\n@summary: \n# " + title + "\n\n{/" + ref.TargetID + "}",
+	})
+	return fixes
 }
 
-// parseReferences parses all cross-references in the document
-func (d *Document) parseReferences() {
-	inCodeFence := false
+// similarSectionIDs returns up to limit section IDs within a small edit
+// distance of id, closest first
+func (d *Document) similarSectionIDs(id string, limit int) []string {
+	maxDistance := len(id) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	if maxDistance > 3 {
+		maxDistance = 3
+	}
 
-	for i, line := range d.Lines {
-		// Track code fences
-		if strings.TrimSpace(line) == "```" || strings.HasPrefix(strings.TrimSpace(line), "```") {
-			inCodeFence = !inCodeFence
+	type candidate struct {
+		id       string
+		distance int
+	}
+	candidates := []candidate{}
+	lower := strings.ToLower(id)
+	for _, section := range d.OrderedSections {
+		// The distance is at least the difference in length
+		if diff := len(section.ID) - len(id); diff > maxDistance || -diff > maxDistance {
 			continue
 		}
+		distance := editDistance(lower, strings.ToLower(section.ID))
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{section.ID, distance})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
 
-		if inCodeFence {
-			continue
+	ids := []string{}
+	for _, c := range candidates {
+		if len(ids) == limit {
+			break
 		}
+		ids = append(ids, c.id)
+	}
+	return ids
+}
 
-		// Find all references in this line
-		matches := referencePattern.FindAllStringSubmatchIndex(line, -1)
-		for _, match := range matches {
-			targetID := line[match[2]:match[3]]
-			d.References = append(d.References, Reference{
-				TargetID: targetID,
-				Line:     i,
-				StartCol: match[0],
-				EndCol:   match[1],
-			})
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
 		}
+		previous, current = current, previous
 	}
+	return previous[len(b)]
 }
 
-// validateReferences checks that all references point to valid sections
-func (d *Document) validateReferences() {
-	for _, ref := range d.References {
-		if _, exists := d.Sections[ref.TargetID]; !exists {
-			d.Errors = append(d.Errors, ValidationError{
-				Message:  "Reference {@" + ref.TargetID + "} points to non-existent section",
-				Line:     ref.Line,
-				StartCol: ref.StartCol,
-				EndCol:   ref.EndCol,
-				Severity: protocol.DiagnosticSeverityError,
-			})
+// lastContentLine returns the last non-blank line before end, but not before floor
+func (d *Document) lastContentLine(end int, floor int) int {
+	for i := end - 1; i > floor; i-- {
+		if strings.TrimSpace(d.Lines[i]) != "" {
+			return i
 		}
 	}
+	return floor
+}
 
-	// Check for self-references
-	for _, ref := range d.References {
-		for _, section := range d.OrderedSections {
-			if ref.Line >= section.Start && ref.Line <= section.End {
-				if ref.TargetID == section.ID {
-					d.Errors = append(d.Errors, ValidationError{
-						Message:  "Self-reference not allowed: {@" + ref.TargetID + "}",
-						Line:     ref.Line,
-						StartCol: ref.StartCol,
-						EndCol:   ref.EndCol,
-						Severity: protocol.DiagnosticSeverityError,
-					})
-				}
-				break
-			}
+// parseReferences parses all cross-references in the document
+func (d *Document) parseReferences() {
+	contentStart := iatf.ContentStart(d.Lines)
+	if contentStart == -1 {
+		return
+	}
+
+	// Skip code fences, tag lines, inline code and escaped references, like the CLI
+	fence := iatf.CodeFence{}
+	for i := contentStart; i < len(d.Lines); i++ {
+		line := d.Lines[i]
+		if fence.Line(line) || sectionOpenPattern.MatchString(line) || sectionClosePattern.MatchString(line) {
+			continue
 		}
+		references, crossReferences := lineReferences(i, line)
+		d.References = append(d.References, references...)
+		d.CrossReferences = append(d.CrossReferences, crossReferences...)
+	}
+}
+
+// lineReferences returns the references and cross-file references on line i
+func lineReferences(i int, line string) (references []Reference, crossReferences []Reference) {
+	for _, match := range iatf.FindReferenceMatches(referencePattern, line) {
+		references = append(references, Reference{
+			TargetID: line[match[2]:match[3]],
+			Line:     i,
+			StartCol: match[0],
+			EndCol:   match[1],
+		})
+	}
+	for _, match := range iatf.FindReferenceMatches(iatf.AnchorReferencePattern, line) {
+		references = append(references, Reference{
+			TargetID: line[match[2]:match[3]],
+			Anchor:   line[match[4]:match[5]],
+			Line:     i,
+			StartCol: match[0],
+			EndCol:   match[1],
+		})
 	}
+	for _, match := range iatf.FindReferenceMatches(crossReferencePattern, line) {
+		crossReferences = append(crossReferences, Reference{
+			TargetID: line[match[4]:match[5]],
+			File:     line[match[2]:match[3]],
+			Line:     i,
+			StartCol: match[0],
+			EndCol:   match[1],
+		})
+	}
+	return references, crossReferences
 }
 
 // GetDiagnostics returns LSP diagnostics for the document
 func (d *Document) GetDiagnostics() []protocol.Diagnostic {
+	d.ensureValidated()
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
 	diagnostics := make([]protocol.Diagnostic, len(d.Errors))
 	for i, err := range d.Errors {
-		diagnostics[i] = protocol.Diagnostic{
-			Range: protocol.Range{
-				Start: protocol.Position{Line: protocol.UInteger(err.Line), Character: protocol.UInteger(err.StartCol)},
-				End:   protocol.Position{Line: protocol.UInteger(err.Line), Character: protocol.UInteger(err.EndCol)},
-			},
-			Severity: &err.Severity,
-			Source:   ptrString("iatf"),
-			Message:  err.Message,
-		}
+		diagnostics[i] = err.diagnostic()
 	}
 	return diagnostics
 }
 
-// GetCompletions returns completion items at the given position
-func (d *Document) GetCompletions(pos protocol.Position) []protocol.CompletionItem {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-
-	line := int(pos.Line)
-	if line >= len(d.Lines) {
-		return nil
+// diagnostic converts a validation error to an LSP diagnostic
+func (err ValidationError) diagnostic() protocol.Diagnostic {
+	return protocol.Diagnostic{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: protocol.UInteger(err.Line), Character: protocol.UInteger(err.StartCol)},
+			End:   protocol.Position{Line: protocol.UInteger(err.Line), Character: protocol.UInteger(err.EndCol)},
+		},
+		Severity: &err.Severity,
+		Code:     &protocol.IntegerOrString{Value: err.Code},
+		Source:   ptrString("iatf"),
+		Message:  err.Message,
+		Tags:     deprecatedTags(err.Code),
 	}
+}
 
-	lineContent := d.Lines[line]
-	col := int(pos.Character)
-	if col > len(lineContent) {
-		col = len(lineContent)
+// deprecatedTags marks references to deprecated sections, which editors
+// render struck through
+func deprecatedTags(code string) []protocol.DiagnosticTag {
+	if code == "W008" {
+		return []protocol.DiagnosticTag{protocol.DiagnosticTagDeprecated}
 	}
+	return nil
+}
 
-	// Check if we're in a reference context: typing after "{@"
-	beforeCursor := lineContent[:col]
-	refIdx := strings.LastIndex(beforeCursor, "{@")
-	if refIdx != -1 {
-		// We're completing a reference
-		prefix := beforeCursor[refIdx+2:]
-		items := []protocol.CompletionItem{}
+// GetCodeActions returns quick fixes for the validation errors in the given
+// range. INDEX rebuilds run rebuildCommand with the document URI.
+func (d *Document) GetCodeActions(rng protocol.Range, uri string, rebuildCommand string) []protocol.CodeAction {
+	d.ensureValidated()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 
-		for id, section := range d.Sections {
-			if strings.HasPrefix(id, prefix) {
-				item := protocol.CompletionItem{
-					Label:  id,
-					Kind:   ptrCompletionItemKind(protocol.CompletionItemKindReference),
-					Detail: ptrString(section.Title),
-				}
-				if section.Summary != "" {
-					item.Documentation = section.Summary
-				}
-				items = append(items, item)
+	actions := []protocol.CodeAction{}
+	for _, err := range d.Errors {
+		if len(err.Fixes) == 0 || err.Line < int(rng.Start.Line) || err.Line > int(rng.End.Line) {
+			continue
+		}
+		for _, fix := range err.Fixes {
+			kind := protocol.CodeActionKindQuickFix
+			if fix.Rebuild {
+				actions = append(actions, protocol.CodeAction{
+					Title:       fix.Title,
+					Kind:        &kind,
+					Diagnostics: []protocol.Diagnostic{err.diagnostic()},
+					IsPreferred: ptrBool(fix.Preferred),
+					Command: &protocol.Command{
+						Title:     fix.Title,
+						Command:   rebuildCommand,
+						Arguments: []any{uri},
+					},
+				})
+				continue
 			}
+			endLine := max(fix.EndLine, fix.Line)
+			editRange := protocol.Range{
+				Start: protocol.Position{Line: protocol.UInteger(fix.Line), Character: protocol.UInteger(fix.StartCol)},
+				End:   protocol.Position{Line: protocol.UInteger(endLine), Character: protocol.UInteger(fix.EndCol)},
+			}
+			actions = append(actions, protocol.CodeAction{
+				Title:       fix.Title,
+				Kind:        &kind,
+				Diagnostics: []protocol.Diagnostic{err.diagnostic()},
+				IsPreferred: ptrBool(fix.Preferred),
+				Edit: &protocol.WorkspaceEdit{
+					Changes: map[protocol.DocumentUri][]protocol.TextEdit{
+						uri: {{Range: editRange, NewText: fix.NewText}},
+					},
+				},
+			})
 		}
-		return items
 	}
+	return append(actions, d.headingToSectionActions(rng, uri)...)
+}
 
-	// Check if we're after "{#" for section definition
-	openIdx := strings.LastIndex(beforeCursor, "{#")
-	if openIdx != -1 {
-		// Suggest existing section IDs (for creating matching close tags)
-		prefix := beforeCursor[openIdx+2:]
-		items := []protocol.CompletionItem{}
+// headingToSectionActions offers to wrap a Markdown heading in CONTENT that
+// is outside any section, with the lines up to the next heading of the same
+// or a higher level, into a section
+func (d *Document) headingToSectionActions(rng protocol.Range, uri string) []protocol.CodeAction {
+	actions := []protocol.CodeAction{}
+	kind := protocol.CodeActionKindRefactorRewrite
+	content := d.contentLine()
+
+	for i := int(rng.Start.Line); i <= int(rng.End.Line) && i < len(d.Lines); i++ {
+		match := headingPattern.FindStringSubmatch(d.Lines[i])
+		if i <= content || match == nil || d.sectionAt(i) != nil {
+			continue
+		}
+
+		level := len(match[1])
+		stop := len(d.Lines)
+		for j := i + 1; j < len(d.Lines); j++ {
+			line := d.Lines[j]
+			if next := headingPattern.FindStringSubmatch(line); next != nil && len(next[1]) <= level {
+				stop = j
+				break
+			}
+			if sectionOpenPattern.MatchString(line) || sectionClosePattern.MatchString(line) || d.sectionAt(j) != nil {
+				stop = j
+				break
+			}
+		}
+		last := d.lastContentLine(stop, i)
+
+		id := d.uniqueSectionID(slugify(match[2]))
+		start := protocol.Position{Line: protocol.UInteger(i), Character: 0}
+		end := protocol.Position{Line: protocol.UInteger(last), Character: protocol.UInteger(len(d.Lines[last]))}
+		actions = append(actions, protocol.CodeAction{
+			Title: "Convert heading to section {#" + id + "}",
+			Kind:  &kind,
+			Edit: &protocol.WorkspaceEdit{
+				Changes: map[protocol.DocumentUri][]protocol.TextEdit{
+					uri: {
+						{Range: protocol.Range{Start: start, End: start}, NewText: "{#" + id + "}\n"},
+						{Range: protocol.Range{Start: end, End: end}, NewText: "\n{/" + id + "}"},
+					},
+				},
+			},
+		})
+	}
+	return actions
+}
+
+// slugify turns a heading into a section ID: lowercase words joined by
+// hyphens, starting with a letter
+func slugify(title string) string {
+	slug := strings.Trim(slugSeparatorPattern.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if slug == "" || slug[0] < 'a' || slug[0] > 'z' {
+		slug = strings.TrimSuffix("section-"+slug, "-")
+	}
+	return slug
+}
+
+// uniqueSectionID appends -2, -3, ... to id while a section already uses it
+func (d *Document) uniqueSectionID(id string) string {
+	candidate := id
+	for n := 2; ; n++ {
+		if _, exists := d.Sections[candidate]; !exists {
+			return candidate
+		}
+		candidate = id + "-" + strconv.Itoa(n)
+	}
+}
+
+// GetAutoCloseEdits returns the edit that closes a section after Enter was
+// pressed at pos, when the line above is a lone {#id} that is not closed yet
+func (d *Document) GetAutoCloseEdits(pos protocol.Position) []protocol.TextEdit {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	line := int(pos.Line)
+	if line < 1 || line >= len(d.Lines) {
+		return nil
+	}
+	opened := strings.TrimSpace(d.Lines[line-1])
+	match := sectionOpenPattern.FindStringSubmatch(opened)
+	if match == nil || match[0] != opened {
+		return nil
+	}
+	section, exists := d.Sections[match[1]]
+	if !exists || section.Start != line-1 || section.End > section.Start {
+		return nil
+	}
+
+	indent := d.Lines[line-1][:strings.Index(d.Lines[line-1], opened)]
+	closeTag := indent + "{/" + section.ID + "}"
+	if line+1 < len(d.Lines) {
+		start := protocol.Position{Line: protocol.UInteger(line + 1), Character: 0}
+		return []protocol.TextEdit{{Range: protocol.Range{Start: start, End: start}, NewText: closeTag + "\n"}}
+	}
+	end := protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(len(d.Lines[line]))}
+	return []protocol.TextEdit{{Range: protocol.Range{Start: end, End: end}, NewText: "\n" + closeTag}}
+}
+
+// GetCompletions returns completion items at the given position
+// When snippets is true (the client supports them), snippet items for section
+// skeletons and the file header are offered while typing a plain word.
+func (d *Document) GetCompletions(pos protocol.Position, snippets bool) []protocol.CompletionItem {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	line := int(pos.Line)
+	if line >= len(d.Lines) {
+		return nil
+	}
+
+	lineContent := d.Lines[line]
+	col := int(pos.Character)
+	if col > len(lineContent) {
+		col = len(lineContent)
+	}
+
+	// Check if we're in a reference context: typing after "{@"
+	beforeCursor := lineContent[:col]
+	refIdx := strings.LastIndex(beforeCursor, "{@")
+	if refIdx != -1 && !iatf.IsEscaped(beforeCursor, refIdx) && !iatf.InCodeSpan(lineContent, refIdx) {
+		// We're completing a reference
+		prefix := beforeCursor[refIdx+2:]
+		items := []protocol.CompletionItem{}
+
+		// {@id: completes the anchors of section id
+		if id, anchorPrefix, found := strings.Cut(prefix, ":"); found {
+			for _, anchor := range d.Anchors {
+				if anchor.Section == d.canonicalID(id) && strings.HasPrefix(anchor.Name, anchorPrefix) {
+					items = append(items, protocol.CompletionItem{
+						Label:  anchor.Name,
+						Kind:   ptrCompletionItemKind(protocol.CompletionItemKindReference),
+						Detail: ptrString("Lines " + strconv.Itoa(anchor.Line) + "-" + strconv.Itoa(anchor.End)),
+					})
+				}
+			}
+			return items
+		}
 
 		for id, section := range d.Sections {
 			if strings.HasPrefix(id, prefix) {
-				items = append(items, protocol.CompletionItem{
+				item := protocol.CompletionItem{
 					Label:  id,
-					Kind:   ptrCompletionItemKind(protocol.CompletionItemKindClass),
+					Kind:   ptrCompletionItemKind(protocol.CompletionItemKindReference),
 					Detail: ptrString(section.Title),
-				})
+				}
+				if section.Summary != "" {
+					item.Documentation = section.Summary
+				}
+				items = append(items, item)
 			}
 		}
 		return items
 	}
 
+	// Check if we're after "{#" for section definition
+	openIdx := strings.LastIndex(beforeCursor, "{#")
+	if openIdx != -1 {
+		return d.openTagCompletions(line, openIdx, col)
+	}
+
 	// Check if we're after "{/" for close tag
 	closeIdx := strings.LastIndex(beforeCursor, "{/")
 	if closeIdx != -1 {
@@ -490,9 +1018,308 @@ func (d *Document) GetCompletions(pos protocol.Position) []protocol.CompletionIt
 		return items
 	}
 
+	if strings.HasPrefix(beforeCursor, "@tags:") && line > d.headerEnd() && d.metadataKeysAt(line) != nil {
+		return d.tagCompletions(line, beforeCursor)
+	}
+	if strings.HasPrefix(beforeCursor, "@status:") && line > d.headerEnd() && d.metadataKeysAt(line) != nil {
+		return statusCompletions(line, beforeCursor)
+	}
+
+	if metadataPrefixPattern.MatchString(beforeCursor) {
+		if keys := d.metadataKeysAt(line); keys != nil {
+			return metadataCompletions(keys, line, strings.Index(beforeCursor, "@"), col)
+		}
+	}
+
+	if snippets && snippetPrefixPattern.MatchString(beforeCursor) {
+		return d.snippetCompletions(line)
+	}
+
+	return nil
+}
+
+// openTagCompletions completes {#id} with the IDs that are referenced but not
+// defined yet, or the ID typed so far, and inserts {/id} on the next line
+func (d *Document) openTagCompletions(line int, openIdx int, col int) []protocol.CompletionItem {
+	lineContent := d.Lines[line]
+	prefix := lineContent[openIdx+2 : col]
+
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, ref := range d.References {
+		if _, exists := d.Sections[ref.TargetID]; !exists && !seen[ref.TargetID] && strings.HasPrefix(ref.TargetID, prefix) {
+			ids = append(ids, ref.TargetID)
+			seen[ref.TargetID] = true
+		}
+	}
+	if _, exists := d.Sections[prefix]; !exists && !seen[prefix] && sectionOpenPattern.MatchString("{#"+prefix+"}") {
+		ids = append(ids, prefix)
+	}
+
+	// Replace "{#prefix", and the "}" an editor may have auto-inserted
+	end := col
+	if end < len(lineContent) && lineContent[end] == '}' {
+		end++
+	}
+	indent := lineContent[:len(lineContent)-len(strings.TrimLeft(lineContent, " \t"))]
+
+	// Insert at the start of the next line, so the edit does not touch the completed tag
+	closeAt := protocol.Position{Line: protocol.UInteger(line + 1), Character: 0}
+	closeTag := func(id string) string { return indent + "{/" + id + "}\n" }
+	if line+1 >= len(d.Lines) {
+		closeAt = protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(len(lineContent))}
+		closeTag = func(id string) string { return "\n" + indent + "{/" + id + "}" }
+	}
+
+	items := []protocol.CompletionItem{}
+	for _, id := range ids {
+		detail := "New section"
+		if seen[id] {
+			detail = "Referenced, not defined yet"
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:  id,
+			Kind:   ptrCompletionItemKind(protocol.CompletionItemKindClass),
+			Detail: ptrString(detail),
+			TextEdit: protocol.TextEdit{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(openIdx)},
+					End:   protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(end)},
+				},
+				NewText: "{#" + id + "}",
+			},
+			FilterText: ptrString("{#" + id),
+			AdditionalTextEdits: []protocol.TextEdit{{
+				Range:   protocol.Range{Start: closeAt, End: closeAt},
+				NewText: closeTag(id),
+			}},
+		})
+	}
+	return items
+}
+
+// tagCompletions completes the tag being typed on an @tags: line with the
+// tags of the other sections, leaving out those already on the line
+func (d *Document) tagCompletions(line int, beforeCursor string) []protocol.CompletionItem {
+	start := strings.LastIndex(beforeCursor, ",") + 1
+	if start == 0 {
+		start = len("@tags:")
+	}
+	for start < len(beforeCursor) && beforeCursor[start] == ' ' {
+		start++
+	}
+	prefix := strings.ToLower(beforeCursor[start:])
+
+	used := map[string]bool{}
+	for _, tag := range iatf.ParseTags(d.Lines[line][len("@tags:"):]) {
+		used[strings.ToLower(tag)] = true
+	}
+
+	counts := map[string]int{}
+	tags := []string{}
+	current := d.sectionAt(line)
+	for _, section := range d.OrderedSections {
+		if section == current {
+			continue
+		}
+		for _, tag := range section.Tags {
+			key := strings.ToLower(tag)
+			if counts[key] == 0 {
+				tags = append(tags, tag)
+			}
+			counts[key]++
+		}
+	}
+
+	kind := protocol.CompletionItemKindValue
+	items := []protocol.CompletionItem{}
+	for _, tag := range tags {
+		key := strings.ToLower(tag)
+		if (used[key] && key != prefix) || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:  tag,
+			Kind:   &kind,
+			Detail: ptrString("Used by " + plural(counts[key], "section", "sections")),
+			TextEdit: protocol.TextEdit{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(start)},
+					End:   protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(len(beforeCursor))},
+				},
+				NewText: tag,
+			},
+		})
+	}
+	return items
+}
+
+// statusDocumentation describes the @status: values
+var statusDocumentation = map[string]string{
+	iatf.StatusDraft:      "Work in progress; `iatf read --exclude-drafts` leaves it out.",
+	iatf.StatusStable:     "Reviewed and current.",
+	iatf.StatusDeprecated: "Outdated; references from sections that are not deprecated are reported.",
+}
+
+// statusCompletions completes the value of an @status: line
+func statusCompletions(line int, beforeCursor string) []protocol.CompletionItem {
+	start := len("@status:")
+	for start < len(beforeCursor) && beforeCursor[start] == ' ' {
+		start++
+	}
+	prefix := strings.ToLower(beforeCursor[start:])
+
+	kind := protocol.CompletionItemKindEnumMember
+	items := []protocol.CompletionItem{}
+	for _, status := range iatf.Statuses {
+		if !strings.HasPrefix(status, prefix) {
+			continue
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:         status,
+			Kind:          &kind,
+			Documentation: statusDocumentation[status],
+			TextEdit: protocol.TextEdit{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(start)},
+					End:   protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(len(beforeCursor))},
+				},
+				NewText: status,
+			},
+		})
+	}
+	return items
+}
+
+// metadataKeysAt returns the annotations that may appear on line: header
+// keys before the INDEX/CONTENT markers, section keys in the lines right
+// after an open tag, nil elsewhere
+func (d *Document) metadataKeysAt(line int) []metadataKey {
+	if line > 0 && d.hasFormatDeclaration() && line < d.headerEnd() {
+		return headerMetadataKeys
+	}
+
+	for i := line - 1; i >= 0; i-- {
+		current := d.Lines[i]
+		trimmed := strings.TrimSpace(current)
+		if match := sectionOpenPattern.FindString(trimmed); match != "" && match == trimmed {
+			return sectionMetadataKeys
+		}
+		// Walk up through the annotations (and summary continuations) above the cursor
+		if !strings.HasPrefix(current, "@") && (trimmed == "" || !(strings.HasPrefix(current, " ") || strings.HasPrefix(current, "\t"))) {
+			return nil
+		}
+	}
 	return nil
 }
 
+// headerEnd returns the line of the first ===INDEX=== or ===CONTENT=== marker
+func (d *Document) headerEnd() int {
+	for i, line := range d.Lines {
+		if trimmed := strings.TrimSpace(line); trimmed == "===INDEX===" || trimmed == "===CONTENT===" {
+			return i
+		}
+	}
+	return len(d.Lines)
+}
+
+// metadataCompletions completes @key: annotations, replacing from the @ at startCol to col
+func metadataCompletions(keys []metadataKey, line int, startCol int, col int) []protocol.CompletionItem {
+	kind := protocol.CompletionItemKindProperty
+	items := []protocol.CompletionItem{}
+	for _, key := range keys {
+		annotation := "@" + key.Key + ": "
+		items = append(items, protocol.CompletionItem{
+			Label:  "@" + key.Key + ":",
+			Kind:   &kind,
+			Detail: ptrString("IATF annotation"),
+			Documentation: protocol.MarkupContent{
+				Kind:  protocol.MarkupKindMarkdown,
+				Value: key.Documentation,
+			},
+			TextEdit: protocol.TextEdit{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(startCol)},
+					End:   protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(col)},
+				},
+				NewText: annotation,
+			},
+		})
+	}
+	return items
+}
+
+// snippetCompletions returns the snippets that fit on line
+func (d *Document) snippetCompletions(line int) []protocol.CompletionItem {
+	snippet := protocol.InsertTextFormatSnippet
+	kind := protocol.CompletionItemKindSnippet
+	items := []protocol.CompletionItem{}
+
+	if !d.hasFormatDeclaration() {
+		items = append(items, protocol.CompletionItem{
+			Label:            "iatf",
+			Kind:             &kind,
+			Detail:           ptrString("IATF file header"),
+			Documentation:    "Format declaration, title and a first section. Run 'iatf rebuild' afterwards to generate the INDEX.",
+			InsertText:       ptrString(":::IATF\n@title: ${1:Title}\n\n===CONTENT===\n\n{#${2:intro}}\n@summary: ${3:Summary}\n# ${4:Introduction}\n\n$0\n{/${2:intro}}"),
+			InsertTextFormat: &snippet,
+		})
+	}
+
+	if line > d.contentLine() {
+		items = append(items, protocol.CompletionItem{
+			Label:            "section",
+			Kind:             &kind,
+			Detail:           ptrString("Section skeleton"),
+			Documentation:    "{#id}, @summary, heading and the matching {/id}.",
+			InsertText:       ptrString("{#${1:id}}\n@summary: ${2:Summary}\n# ${3:Title}\n\n$0\n{/${1:id}}"),
+			InsertTextFormat: &snippet,
+		})
+
+		if len(d.OrderedSections) > 0 {
+			ids := make([]string, len(d.OrderedSections))
+			for i, section := range d.OrderedSections {
+				ids[i] = section.ID
+			}
+			items = append(items, protocol.CompletionItem{
+				Label:            "ref",
+				Kind:             &kind,
+				Detail:           ptrString("Reference to a section"),
+				InsertText:       ptrString("{@${1|" + strings.Join(ids, ",") + "|}}$0"),
+				InsertTextFormat: &snippet,
+			})
+		}
+	}
+	return items
+}
+
+// hasFormatDeclaration reports whether the document starts with :::IATF
+func (d *Document) hasFormatDeclaration() bool {
+	return len(d.Lines) > 0 && iatf.IsDeclaration(d.Lines[0])
+}
+
+// contentLine returns the line of the ===CONTENT=== marker, or len(Lines) if there is none
+func (d *Document) contentLine() int {
+	for i, line := range d.Lines {
+		if strings.TrimSpace(line) == "===CONTENT===" {
+			return i
+		}
+	}
+	return len(d.Lines)
+}
+
+// ContentText returns the text below ===CONTENT===, which an INDEX rebuild leaves unchanged
+func (d *Document) ContentText() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	start := d.contentLine()
+	if start == len(d.Lines) {
+		return ""
+	}
+	return strings.Join(d.Lines[start+1:], "\n")
+}
+
 // GetHover returns hover information at the given position
 func (d *Document) GetHover(pos protocol.Position) *protocol.Hover {
 	d.mu.RLock()
@@ -509,17 +1336,15 @@ func (d *Document) GetHover(pos protocol.Position) *protocol.Hover {
 	// Check if hovering over a reference
 	for _, ref := range d.References {
 		if ref.Line == line && col >= ref.StartCol && col <= ref.EndCol {
-			if section, exists := d.Sections[ref.TargetID]; exists {
-				content := "**" + section.Title + "** (`{#" + section.ID + "}`)"
-				if section.Summary != "" {
-					content += "\n\n" + section.Summary
+			if section, exists := d.section(ref.TargetID); exists {
+				preview := d.sectionPreview(section)
+				if anchor, exists := d.anchor(ref); exists {
+					preview = d.anchorPreview(section, anchor)
 				}
-				content += "\n\n*Lines " + string(rune(section.Start+1)) + "-" + string(rune(section.End+1)) + "*"
-
 				return &protocol.Hover{
 					Contents: protocol.MarkupContent{
 						Kind:  protocol.MarkupKindMarkdown,
-						Value: content,
+						Value: preview,
 					},
 					Range: &protocol.Range{
 						Start: protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(ref.StartCol)},
@@ -530,6 +1355,38 @@ func (d *Document) GetHover(pos protocol.Position) *protocol.Hover {
 		}
 	}
 
+	// Check if hovering over an INDEX entry
+	if section, exists := d.Sections[d.indexEntryAt(line)]; exists {
+		trimmed := strings.TrimSpace(lineContent)
+		startCol := strings.Index(lineContent, trimmed)
+		return &protocol.Hover{
+			Contents: protocol.MarkupContent{
+				Kind:  protocol.MarkupKindMarkdown,
+				Value: d.sectionPreview(section),
+			},
+			Range: &protocol.Range{
+				Start: protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(startCol)},
+				End:   protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(startCol + len(trimmed))},
+			},
+		}
+	}
+
+	// Check if hovering over the header
+	if d.hasFormatDeclaration() && line < d.headerEnd() && strings.TrimSpace(lineContent) != "" {
+		trimmed := strings.TrimSpace(lineContent)
+		startCol := strings.Index(lineContent, trimmed)
+		return &protocol.Hover{
+			Contents: protocol.MarkupContent{
+				Kind:  protocol.MarkupKindMarkdown,
+				Value: d.headerPreview(),
+			},
+			Range: &protocol.Range{
+				Start: protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(startCol)},
+				End:   protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(startCol + len(trimmed))},
+			},
+		}
+	}
+
 	// Check if hovering over a section open tag
 	if matches := sectionOpenPattern.FindStringSubmatchIndex(lineContent); matches != nil {
 		if col >= matches[0] && col <= matches[1] {
@@ -557,7 +1414,109 @@ func (d *Document) GetHover(pos protocol.Position) *protocol.Hover {
 	return nil
 }
 
-// GetDefinition returns the definition location for a reference at the given position
+// headerPreview describes the document for hovers on its header: title,
+// description, purpose, version and update date, and section count
+func (d *Document) headerPreview() string {
+	header := iatf.ParseHeader(d.Lines)
+	title := header.Title
+	if title == "" {
+		title = path.Base(d.URI)
+	}
+	content := "**" + title + "**"
+	if header.Description != "" {
+		content += "\n\n" + header.Description
+	}
+	if header.Purpose != "" {
+		content += "\n\nPurpose: " + header.Purpose
+	}
+	details := []string{}
+	if header.Version != "" {
+		details = append(details, "Version "+header.Version)
+	}
+	if header.Updated != "" {
+		details = append(details, "updated "+header.Updated)
+	}
+	details = append(details, strconv.Itoa(len(d.Sections))+" sections")
+	return content + "\n\n*" + strings.Join(details, ", ") + "*"
+}
+
+// sectionPreview describes a section for hovers: title, summary, line range
+// and its first lines of content
+func (d *Document) sectionPreview(section *Section) string {
+	content := "**" + section.Title + "** (`{#" + section.ID + "}`)"
+	if section.Summary != "" {
+		content += "\n\n" + section.Summary
+	}
+	if section.Status != "" {
+		content += "\n\nStatus: **" + section.Status + "**"
+	}
+	if section.Owner != "" {
+		content += "\n\nOwner: " + section.Owner
+	}
+	if section.ReviewBy != "" {
+		content += "\n\nReview by: " + section.ReviewBy
+	}
+	if len(section.Tags) > 0 {
+		content += "\n\nTags: `" + strings.Join(section.Tags, "`, `") + "`"
+	}
+	if len(section.Audience) > 0 {
+		content += "\n\nAudience: `" + strings.Join(section.Audience, "`, `") + "`"
+	}
+	if len(section.Aliases) > 0 {
+		content += "\n\nAliases: `" + strings.Join(section.Aliases, "`, `") + "`"
+	}
+	if section.End <= section.Start {
+		return content
+	}
+	content += "\n\n*Lines " + strconv.Itoa(section.Start+1) + "-" + strconv.Itoa(section.End+1) + "*"
+
+	// Skip the @key: metadata (and indented summary continuations) and leading blank lines
+	first := section.Start + 1
+	for first < section.End {
+		line := d.Lines[first]
+		if strings.HasPrefix(line, "@") || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.TrimSpace(line) == "" {
+			first++
+			continue
+		}
+		break
+	}
+	if first >= section.End {
+		return content
+	}
+	return content + "\n\n" + d.linesPreview(first, section.End)
+}
+
+// anchorPreview describes the region of an anchor for hovers: its section,
+// line range and first lines
+func (d *Document) anchorPreview(section *Section, anchor iatf.Anchor) string {
+	content := "**" + section.Title + "** › `" + anchor.Name + "` (`{@" + section.ID + ":" + anchor.Name + "}`)"
+	content += "\n\n*Lines " + strconv.Itoa(anchor.Line) + "-" + strconv.Itoa(anchor.End) + "*"
+	if anchor.End <= anchor.Line {
+		return content
+	}
+	return content + "\n\n" + d.linesPreview(anchor.Line, anchor.End)
+}
+
+// linesPreview renders up to previewLines lines from first (0-indexed) up to
+// end (exclusive) as a markdown code block
+func (d *Document) linesPreview(first int, end int) string {
+	last := min(first+previewLines, end)
+	preview := d.Lines[first:last]
+	if last < end {
+		preview = append(append([]string{}, preview...), "…")
+	}
+
+	// The fence must be longer than any backtick run of the preview
+	fence := "```"
+	for _, line := range preview {
+		for run := fence; strings.Contains(line, run); run += "`" {
+			fence = run + "`"
+		}
+	}
+	return fence + "markdown\n" + strings.Join(preview, "\n") + "\n" + fence
+}
+
+// GetDefinition returns the section a reference, or an INDEX entry, at the given position points to
 func (d *Document) GetDefinition(pos protocol.Position, uri string) *protocol.Location {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
@@ -569,32 +1528,71 @@ func (d *Document) GetDefinition(pos protocol.Position, uri string) *protocol.Lo
 
 	col := int(pos.Character)
 
+	targetID := d.indexEntryAt(line)
+
 	// Check if on a reference
 	for _, ref := range d.References {
 		if ref.Line == line && col >= ref.StartCol && col <= ref.EndCol {
-			if section, exists := d.Sections[ref.TargetID]; exists {
+			if anchor, exists := d.anchor(ref); exists {
 				return &protocol.Location{
 					URI: protocol.DocumentUri(uri),
 					Range: protocol.Range{
-						Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol)},
-						End:   protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol + len("{#"+section.ID+"}"))},
+						Start: protocol.Position{Line: protocol.UInteger(anchor.Line - 1), Character: 0},
+						End:   protocol.Position{Line: protocol.UInteger(anchor.Line - 1), Character: protocol.UInteger(len(d.Lines[anchor.Line-1]))},
 					},
 				}
 			}
+			targetID = ref.TargetID
+			break
+		}
+	}
+
+	if section, exists := d.section(targetID); exists {
+		return &protocol.Location{
+			URI: protocol.DocumentUri(uri),
+			Range: protocol.Range{
+				Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol)},
+				End:   protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol + len("{#"+section.ID+"}"))},
+			},
 		}
 	}
 
 	return nil
 }
 
-// GetReferences returns all references to a section at the given position
-func (d *Document) GetReferences(pos protocol.Position, uri string) []protocol.Location {
+// indexEntryAt returns the section ID of the INDEX entry on line, if any
+func (d *Document) indexEntryAt(line int) string {
+	inIndex := false
+	for i := 0; i < line; i++ {
+		switch strings.TrimSpace(d.Lines[i]) {
+		case "===INDEX===":
+			inIndex = true
+		case "===CONTENT===":
+			return ""
+		}
+	}
+	if !inIndex {
+		return ""
+	}
+
+	if match := indexEntryPattern.FindStringSubmatch(strings.TrimSpace(d.Lines[line])); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// SectionIDAt returns the ID of the section whose open or close tag, or a
+// reference to which, is at pos
+func (d *Document) SectionIDAt(pos protocol.Position) string {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
+	return d.sectionIDAt(pos)
+}
 
+func (d *Document) sectionIDAt(pos protocol.Position) string {
 	line := int(pos.Line)
 	if line >= len(d.Lines) {
-		return nil
+		return ""
 	}
 
 	lineContent := d.Lines[line]
@@ -609,6 +1607,13 @@ func (d *Document) GetReferences(pos protocol.Position, uri string) []protocol.L
 		}
 	}
 
+	// Check if on a section close tag
+	if matches := sectionClosePattern.FindStringSubmatchIndex(lineContent); matches != nil {
+		if col >= matches[0] && col <= matches[1] {
+			sectionID = lineContent[matches[2]:matches[3]]
+		}
+	}
+
 	// Check if on a reference
 	for _, ref := range d.References {
 		if ref.Line == line && col >= ref.StartCol && col <= ref.EndCol {
@@ -617,60 +1622,418 @@ func (d *Document) GetReferences(pos protocol.Position, uri string) []protocol.L
 		}
 	}
 
+	return d.canonicalID(sectionID)
+}
+
+// referencesTo returns the locations of the references to a section of this document
+func (d *Document) referencesTo(sectionID string, uri string) []protocol.Location {
+	locations := []protocol.Location{}
+	sectionID = d.canonicalID(sectionID)
+	for _, ref := range d.References {
+		if d.canonicalID(ref.TargetID) == sectionID {
+			locations = append(locations, ref.location(uri))
+		}
+	}
+	return locations
+}
+
+// GetDocumentHighlights returns the open and close tags of the section at pos
+// and every reference to it
+func (d *Document) GetDocumentHighlights(pos protocol.Position) []protocol.DocumentHighlight {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sectionID := d.sectionIDAt(pos)
 	if sectionID == "" {
 		return nil
 	}
 
-	// Find all references to this section
-	locations := []protocol.Location{}
-	for _, ref := range d.References {
-		if ref.TargetID == sectionID {
-			locations = append(locations, protocol.Location{
-				URI: protocol.DocumentUri(uri),
+	write := protocol.DocumentHighlightKindWrite
+	text := protocol.DocumentHighlightKindText
+	read := protocol.DocumentHighlightKindRead
+
+	highlights := []protocol.DocumentHighlight{}
+	for _, section := range d.OrderedSections {
+		if section.ID != sectionID {
+			continue
+		}
+		highlights = append(highlights, protocol.DocumentHighlight{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol)},
+				End:   protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol + len("{#"+section.ID+"}"))},
+			},
+			Kind: &write,
+		})
+		if section.End > section.Start {
+			highlights = append(highlights, protocol.DocumentHighlight{
 				Range: protocol.Range{
-					Start: protocol.Position{Line: protocol.UInteger(ref.Line), Character: protocol.UInteger(ref.StartCol)},
-					End:   protocol.Position{Line: protocol.UInteger(ref.Line), Character: protocol.UInteger(ref.EndCol)},
+					Start: protocol.Position{Line: protocol.UInteger(section.End), Character: protocol.UInteger(section.EndCol - len("{/"+section.ID+"}"))},
+					End:   protocol.Position{Line: protocol.UInteger(section.End), Character: protocol.UInteger(section.EndCol)},
 				},
+				Kind: &text,
 			})
 		}
 	}
+	for _, ref := range d.References {
+		if d.canonicalID(ref.TargetID) == sectionID {
+			highlights = append(highlights, protocol.DocumentHighlight{
+				Range: ref.location("").Range,
+				Kind:  &read,
+			})
+		}
+	}
+	return highlights
+}
 
-	return locations
+func (ref Reference) location(uri string) protocol.Location {
+	return protocol.Location{
+		URI: protocol.DocumentUri(uri),
+		Range: protocol.Range{
+			Start: protocol.Position{Line: protocol.UInteger(ref.Line), Character: protocol.UInteger(ref.StartCol)},
+			End:   protocol.Position{Line: protocol.UInteger(ref.Line), Character: protocol.UInteger(ref.EndCol)},
+		},
+	}
 }
 
-// GetDocumentSymbols returns document symbols for the outline view
+// GetDocumentSymbols returns the section outline, with nested sections as
+// children of their parent
 func (d *Document) GetDocumentSymbols() []protocol.DocumentSymbol {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	// Build nested structure based on level
-	symbols := []protocol.DocumentSymbol{}
+	return d.sectionSymbols(nil)
+}
 
+// sectionSymbols returns the symbols for the sections directly inside parent
+// (top-level sections when parent is nil)
+func (d *Document) sectionSymbols(parent *Section) []protocol.DocumentSymbol {
+	symbols := []protocol.DocumentSymbol{}
 	for _, section := range d.OrderedSections {
-		sym := protocol.DocumentSymbol{
+		if section.Parent != parent {
+			continue
+		}
+
+		detail := section.Summary
+		if detail == "" {
+			detail = "{#" + section.ID + "}"
+		}
+		end := section.End
+		if end < section.Start {
+			end = section.Start // Unclosed section
+		}
+		symbols = append(symbols, protocol.DocumentSymbol{
 			Name:   section.Title,
-			Detail: ptrString("{#" + section.ID + "}"),
+			Detail: ptrString(detail),
 			Kind:   protocol.SymbolKindClass,
 			Range: protocol.Range{
 				Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: 0},
-				End:   protocol.Position{Line: protocol.UInteger(section.End), Character: protocol.UInteger(len(d.Lines[section.End]))},
+				End:   protocol.Position{Line: protocol.UInteger(end), Character: protocol.UInteger(len(d.Lines[end]))},
 			},
 			SelectionRange: protocol.Range{
 				Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol)},
 				End:   protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol + len("{#"+section.ID+"}"))},
 			},
+			Children: d.sectionSymbols(section),
+		})
+	}
+	return symbols
+}
+
+// GetSymbolInformation returns the sections whose ID or title matches query,
+// as flat symbols for workspace-wide search. container is shown next to each
+// symbol, typically the file name.
+func (d *Document) GetSymbolInformation(query string, container string) []protocol.SymbolInformation {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	symbols := []protocol.SymbolInformation{}
+	for _, section := range d.OrderedSections {
+		if !FuzzyMatch(query, section.ID) && !FuzzyMatch(query, section.Title) {
+			continue
+		}
+		end := section.End
+		if end < section.Start {
+			end = section.Start
 		}
+		symbols = append(symbols, protocol.SymbolInformation{
+			Name: section.Title + " {#" + section.ID + "}",
+			Kind: protocol.SymbolKindClass,
+			Location: protocol.Location{
+				URI: d.URI,
+				Range: protocol.Range{
+					Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: 0},
+					End:   protocol.Position{Line: protocol.UInteger(end), Character: protocol.UInteger(len(d.Lines[end]))},
+				},
+			},
+			ContainerName: &container,
+		})
+	}
+	return symbols
+}
 
-		// For level 1 sections, add to root
-		if section.Level == 1 {
-			symbols = append(symbols, sym)
+// FuzzyMatch reports whether the characters of query appear in text in
+// order, ignoring case. An empty query matches everything.
+func FuzzyMatch(query string, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(text, r)
+		if i < 0 {
+			return false
 		}
-		// For nested sections, add to parent
-		// Note: This simple implementation adds all at root level for now
-		// A more complex implementation would build a proper tree
+		text = text[i+len(string(r)):]
 	}
+	return true
+}
 
-	return symbols
+// GetCodeLenses returns a lens above each section with its reference and word
+// counts, and one on the INDEX header (or the format declaration when there
+// is no INDEX yet) that runs rebuildCommand with the document URI
+func (d *Document) GetCodeLenses(rebuildCommand string) []protocol.CodeLens {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	lenses := []protocol.CodeLens{}
+
+	indexLine := -1
+	for i, line := range d.Lines {
+		if strings.TrimSpace(line) == "===INDEX===" {
+			indexLine = i
+			break
+		}
+	}
+	rebuildTitle := "Rebuild index"
+	if indexLine < 0 {
+		indexLine = 0
+		rebuildTitle = "Build index"
+	}
+	lenses = append(lenses, protocol.CodeLens{
+		Range: lineRange(indexLine),
+		Command: &protocol.Command{
+			Title:     rebuildTitle,
+			Command:   rebuildCommand,
+			Arguments: []any{d.URI},
+		},
+	})
+
+	incoming := map[string]int{}
+	for _, ref := range d.References {
+		incoming[ref.TargetID]++
+	}
+	for _, section := range d.OrderedSections {
+		words := d.sectionWordCount(section)
+		lenses = append(lenses,
+			protocol.CodeLens{
+				Range:   lineRange(section.Start),
+				Command: &protocol.Command{Title: plural(incoming[section.ID], "reference", "references")},
+			},
+			protocol.CodeLens{
+				Range:   lineRange(section.Start),
+				Command: &protocol.Command{Title: plural(words, "word", "words") + " · ~" + plural(estimateTokens(words), "token", "tokens")},
+			},
+		)
+	}
+	return lenses
+}
+
+// sectionWordCount counts the words of a section like the INDEX does: the
+// header annotations, tags and nested sections are not counted
+func (d *Document) sectionWordCount(section *Section) int {
+	if section.End <= section.Start {
+		return 0
+	}
+
+	counted := []string{}
+	inHeader := true
+	inSummary := false
+	for i := section.Start + 1; i < section.End; i++ {
+		line := d.Lines[i]
+		if child := d.childAt(section, i); child != nil {
+			if child.End > i {
+				i = child.End
+			}
+			continue
+		}
+		if inHeader {
+			if strings.HasPrefix(line, "@") {
+				inSummary = strings.HasPrefix(line, "@summary:")
+				continue
+			}
+			if inSummary && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && strings.TrimSpace(line) != "" {
+				continue
+			}
+			inHeader = false
+		}
+		counted = append(counted, line)
+	}
+	return iatf.ParseHeader(d.Lines).CountWords(counted)
+}
+
+// childAt returns the section nested in parent that opens on line
+func (d *Document) childAt(parent *Section, line int) *Section {
+	for _, section := range d.OrderedSections {
+		if section.Parent == parent && section.Start == line {
+			return section
+		}
+	}
+	return nil
+}
+
+// estimateTokens approximates the LLM token count of a number of words
+func estimateTokens(words int) int {
+	return (words*4 + 2) / 3
+}
+
+func plural(n int, singular string, pluralForm string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return strconv.Itoa(n) + " " + pluralForm
+}
+
+func lineRange(line int) protocol.Range {
+	return protocol.Range{
+		Start: protocol.Position{Line: protocol.UInteger(line), Character: 0},
+		End:   protocol.Position{Line: protocol.UInteger(line), Character: 0},
+	}
+}
+
+// GetInlayHints returns the hints in rng: the section title after each close
+// tag, and the enclosing section path at the midpoint of long sections
+func (d *Document) GetInlayHints(rng protocol.Range) []protocol317.InlayHint {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	inRange := func(line int) bool {
+		return line >= int(rng.Start.Line) && line <= int(rng.End.Line)
+	}
+
+	hints := []protocol317.InlayHint{}
+	for _, section := range d.OrderedSections {
+		if section.End <= section.Start {
+			continue
+		}
+
+		if inRange(section.End) && section.Title != section.ID {
+			hints = append(hints, protocol317.InlayHint{
+				Position:    protocol.Position{Line: protocol.UInteger(section.End), Character: protocol.UInteger(section.EndCol)},
+				Label:       section.Title,
+				PaddingLeft: ptrBool(true),
+			})
+		}
+
+		if section.End-section.Start > longSectionLines {
+			middle := (section.Start + section.End) / 2
+			if !inRange(middle) || sectionOpenPattern.MatchString(d.Lines[middle]) || sectionClosePattern.MatchString(d.Lines[middle]) {
+				continue
+			}
+			if innermost := d.sectionAt(middle); innermost == section {
+				hints = append(hints, protocol317.InlayHint{
+					Position:    protocol.Position{Line: protocol.UInteger(middle), Character: protocol.UInteger(len(d.Lines[middle]))},
+					Label:       "in " + sectionPath(section),
+					Tooltip:     ptrString("Lines " + strconv.Itoa(section.Start+1) + "-" + strconv.Itoa(section.End+1)),
+					PaddingLeft: ptrBool(true),
+				})
+			}
+		}
+	}
+	return hints
+}
+
+// sectionAt returns the innermost closed section containing line
+func (d *Document) sectionAt(line int) *Section {
+	var innermost *Section
+	for _, section := range d.OrderedSections {
+		if line >= section.Start && line <= section.End {
+			innermost = section
+		}
+	}
+	return innermost
+}
+
+// sectionPath returns the titles from the top-level section down to section
+func sectionPath(section *Section) string {
+	path := section.Title
+	for parent := section.Parent; parent != nil; parent = parent.Parent {
+		path = parent.Title + " › " + path
+	}
+	return path
+}
+
+// GetDocumentLinks returns a link for each reference to an existing section,
+// targeting the line of its open tag
+func (d *Document) GetDocumentLinks(uri string) []protocol.DocumentLink {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	links := []protocol.DocumentLink{}
+	for _, ref := range d.References {
+		section, exists := d.section(ref.TargetID)
+		if !exists {
+			continue
+		}
+		target := uri + "#L" + strconv.Itoa(section.Start+1)
+		if anchor, exists := d.anchor(ref); exists {
+			target = uri + "#L" + strconv.Itoa(anchor.Line)
+		}
+		links = append(links, protocol.DocumentLink{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: protocol.UInteger(ref.Line), Character: protocol.UInteger(ref.StartCol)},
+				End:   protocol.Position{Line: protocol.UInteger(ref.Line), Character: protocol.UInteger(ref.EndCol)},
+			},
+			Target:  &target,
+			Tooltip: ptrString("Go to " + section.Title),
+		})
+	}
+	return links
+}
+
+// GetFoldingRanges returns foldable regions: sections, the INDEX block and code fences
+func (d *Document) GetFoldingRanges() []protocol.FoldingRange {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	region := string(protocol.FoldingRangeKindRegion)
+	ranges := []protocol.FoldingRange{}
+
+	indexStart := -1
+	fence := iatf.CodeFence{}
+	fenceStart := -1
+	for i, line := range d.Lines {
+		wasOpen := fence.Open()
+		inCodeFence := fence.Line(line)
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "===INDEX===":
+			indexStart = i
+		case trimmed == "===CONTENT===" && indexStart >= 0:
+			if end := d.lastContentLine(i, indexStart); end > indexStart {
+				ranges = append(ranges, protocol.FoldingRange{
+					StartLine: protocol.UInteger(indexStart),
+					EndLine:   protocol.UInteger(end),
+					Kind:      &region,
+				})
+			}
+			indexStart = -1
+		case inCodeFence && !wasOpen:
+			fenceStart = i
+		case wasOpen && !fence.Open():
+			ranges = append(ranges, protocol.FoldingRange{
+				StartLine: protocol.UInteger(fenceStart),
+				EndLine:   protocol.UInteger(i),
+			})
+		}
+	}
+
+	for _, section := range d.OrderedSections {
+		if section.End > section.Start {
+			ranges = append(ranges, protocol.FoldingRange{
+				StartLine: protocol.UInteger(section.Start),
+				EndLine:   protocol.UInteger(section.End),
+				Kind:      &region,
+			})
+		}
+	}
+	return ranges
 }
 
 // Helper functions
@@ -678,6 +2041,10 @@ func ptrString(s string) *string {
 	return &s
 }
 
+func ptrBool(b bool) *bool {
+	return &b
+}
+
 func ptrCompletionItemKind(k protocol.CompletionItemKind) *protocol.CompletionItemKind {
 	return &k
 }
@@ -0,0 +1,170 @@
+package analyzer
+
+import (
+	"strconv"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// Resolver returns the document a cross-file reference points to, given the
+// file as written in {@file#id}, or nil if it does not exist
+type Resolver func(file string) *Document
+
+// crossReferences returns a copy of the cross-file references, so callers can
+// resolve them (which may lock other documents, or this one) without holding d.mu
+func (d *Document) crossReferences() []Reference {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]Reference{}, d.CrossReferences...)
+}
+
+// CrossReferenceAt returns the cross-file reference at pos
+func (d *Document) CrossReferenceAt(pos protocol.Position) (Reference, bool) {
+	for _, ref := range d.crossReferences() {
+		if ref.Line == int(pos.Line) && int(pos.Character) >= ref.StartCol && int(pos.Character) <= ref.EndCol {
+			return ref, true
+		}
+	}
+	return Reference{}, false
+}
+
+// SectionLocation returns the location of a section's open tag
+func (d *Document) SectionLocation(id string) (protocol.Location, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	section, exists := d.section(id)
+	if !exists {
+		return protocol.Location{}, false
+	}
+	return protocol.Location{
+		URI: d.URI,
+		Range: protocol.Range{
+			Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol)},
+			End:   protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol + len("{#"+section.ID+"}"))},
+		},
+	}, true
+}
+
+// ReferencesTo returns the references to a section from within this document
+func (d *Document) ReferencesTo(id string) []protocol.Location {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.referencesTo(id, d.URI)
+}
+
+// CrossReferencesTo returns the references from this document to section id of target
+func (d *Document) CrossReferencesTo(resolve Resolver, target *Document, id string) []protocol.Location {
+	locations := []protocol.Location{}
+	id = target.CanonicalID(id)
+	for _, ref := range d.crossReferences() {
+		if target.CanonicalID(ref.TargetID) != id {
+			continue
+		}
+		if resolved := resolve(ref.File); resolved != nil && resolved.URI == target.URI {
+			locations = append(locations, ref.location(d.URI))
+		}
+	}
+	return locations
+}
+
+// GetCrossFileDiagnostics reports cross-file references whose file or section does not exist
+func (d *Document) GetCrossFileDiagnostics(resolve Resolver) []protocol.Diagnostic {
+	errors := []ValidationError{}
+	for _, ref := range d.crossReferences() {
+		message := ""
+		if target := resolve(ref.File); target == nil {
+			message = "Reference {@" + ref.File + "#" + ref.TargetID + "} points to a file that does not exist"
+		} else if _, exists := target.SectionLocation(ref.TargetID); !exists {
+			message = "Reference {@" + ref.File + "#" + ref.TargetID + "} points to non-existent section"
+		}
+		if message != "" {
+			errors = append(errors, ValidationError{
+				Message:  message,
+				Code:     "E016",
+				Line:     ref.Line,
+				StartCol: ref.StartCol,
+				EndCol:   ref.EndCol,
+				Severity: protocol.DiagnosticSeverityError,
+			})
+		}
+	}
+
+	d.mu.RLock()
+	errors = d.options.applySeverities(errors)
+	d.mu.RUnlock()
+
+	diagnostics := make([]protocol.Diagnostic, len(errors))
+	for i, err := range errors {
+		diagnostics[i] = err.diagnostic()
+	}
+	return diagnostics
+}
+
+// SectionIDs returns the IDs of the sections in document order
+func (d *Document) SectionIDs() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ids := make([]string, 0, len(d.OrderedSections))
+	for _, section := range d.OrderedSections {
+		ids = append(ids, section.ID)
+	}
+	return ids
+}
+
+// GetWorkspaceIDDiagnostics reports the sections whose ID is also used in
+// another file of the workspace. others maps each other file, as it should
+// be shown, to its section IDs.
+func (d *Document) GetWorkspaceIDDiagnostics(others map[string][]string) []protocol.Diagnostic {
+	d.mu.RLock()
+	lines := d.Lines
+	options := d.options
+	d.mu.RUnlock()
+
+	contentStart := iatf.ContentStart(lines)
+	if contentStart < 0 {
+		return []protocol.Diagnostic{}
+	}
+	errors := []ValidationError{}
+	for _, issue := range iatf.WorkspaceIDIssues(lines, iatf.ParseSections(lines, contentStart), others) {
+		errors = append(errors, ValidationError{
+			Message:  issue.Message,
+			Code:     issue.Code,
+			Line:     issue.Line - 1,
+			StartCol: issue.StartCol,
+			EndCol:   issue.EndCol,
+			Severity: protocol.DiagnosticSeverityError,
+		})
+	}
+	errors = options.applySeverities(errors)
+
+	diagnostics := make([]protocol.Diagnostic, len(errors))
+	for i, err := range errors {
+		diagnostics[i] = err.diagnostic()
+	}
+	return diagnostics
+}
+
+// GetCrossFileLinks returns a document link for each resolvable cross-file reference
+func (d *Document) GetCrossFileLinks(resolve Resolver) []protocol.DocumentLink {
+	links := []protocol.DocumentLink{}
+	for _, ref := range d.crossReferences() {
+		target := resolve(ref.File)
+		if target == nil {
+			continue
+		}
+		location, exists := target.SectionLocation(ref.TargetID)
+		if !exists {
+			continue
+		}
+		uri := target.URI + "#L" + strconv.Itoa(int(location.Range.Start.Line)+1)
+		links = append(links, protocol.DocumentLink{
+			Range:   ref.location(d.URI).Range,
+			Target:  &uri,
+			Tooltip: ptrString("Go to " + ref.File + "#" + ref.TargetID),
+		})
+	}
+	return links
+}
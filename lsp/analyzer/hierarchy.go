@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// HierarchySectionAt returns the ID of the section for a reference hierarchy
+// at pos: the section whose tag or reference is under the cursor, else the
+// innermost section containing it
+func (d *Document) HierarchySectionAt(pos protocol.Position) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if id := d.sectionIDAt(pos); id != "" {
+		if _, exists := d.Sections[id]; exists {
+			return id
+		}
+		return ""
+	}
+	if section := d.sectionAt(int(pos.Line)); section != nil {
+		return section.ID
+	}
+	return ""
+}
+
+// HierarchyItem returns the call hierarchy item of a section. Data holds the
+// section ID, which incoming and outgoing calls are resolved by.
+func (d *Document) HierarchyItem(id string) (protocol.CallHierarchyItem, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	section, exists := d.section(id)
+	if !exists {
+		return protocol.CallHierarchyItem{}, false
+	}
+
+	end := section.End
+	if end < section.Start {
+		end = section.Start // Unclosed section
+	}
+	return protocol.CallHierarchyItem{
+		Name:   section.Title,
+		Kind:   protocol.SymbolKindClass,
+		Detail: ptrString("{#" + section.ID + "}"),
+		URI:    d.URI,
+		Range: protocol.Range{
+			Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: 0},
+			End:   protocol.Position{Line: protocol.UInteger(end), Character: protocol.UInteger(len(d.Lines[end]))},
+		},
+		SelectionRange: protocol.Range{
+			Start: protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol)},
+			End:   protocol.Position{Line: protocol.UInteger(section.Start), Character: protocol.UInteger(section.StartCol + len("{#"+section.ID+"}"))},
+		},
+		Data: section.ID,
+	}, true
+}
+
+// ContainingSectionID returns the ID of the innermost section containing line,
+// or "" outside every section
+func (d *Document) ContainingSectionID(line int) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if section := d.sectionAt(line); section != nil {
+		return section.ID
+	}
+	return ""
+}
+
+// ReferencesFrom returns the references, within the document and to other
+// files, made directly by section id (not by its nested sections)
+func (d *Document) ReferencesFrom(id string) []Reference {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	refs := []Reference{}
+	if _, exists := d.Sections[id]; !exists {
+		return refs
+	}
+	for _, list := range [][]Reference{d.References, d.CrossReferences} {
+		for _, ref := range list {
+			if section := d.sectionAt(ref.Line); section != nil && section.ID == id {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+// Range returns the range of the reference's {@...} text
+func (ref Reference) Range() protocol.Range {
+	return ref.location("").Range
+}
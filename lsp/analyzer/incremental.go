@@ -0,0 +1,217 @@
+package analyzer
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+)
+
+// Editors send each keystroke as a small change. Re-parsing the whole
+// document for every one of them makes typing slower the longer the
+// document gets, so a change that cannot alter the section structure (it
+// is in the body of a section and neither removes nor adds a tag, heading,
+// anchor or fence line) is applied in place: the sections and anchors below
+// it move by the number of lines it added or removed, and only its own lines
+// are scanned for references. Any other change re-parses the document.
+// Validation still covers the whole document once diagnostics are requested.
+
+// Change is a change of an open document: Range replaced by Text, or the
+// whole content when Range is nil
+type Change struct {
+	Range *protocol.Range
+	Text  string
+}
+
+// Edit applies changes to an open document, in order, and returns its new
+// content; ok is false when the document is not open
+func (ds *DocumentStore) Edit(uri string, changes []Change) (content string, ok bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	doc, exists := ds.documents[uri]
+	if !exists {
+		return "", false
+	}
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	for _, change := range changes {
+		if change.Range == nil {
+			doc.Content = change.Text
+			doc.Lines = strings.Split(doc.Content, "\n")
+			doc.parseLines()
+			continue
+		}
+		doc.edit(*change.Range, change.Text)
+	}
+	return doc.Content, true
+}
+
+// edit replaces rng with text, re-parsing only what the change can affect
+func (d *Document) edit(rng protocol.Range, text string) {
+	first, startCol := d.byteOffset(rng.Start)
+	last, endCol := d.byteOffset(rng.End)
+	if last < first || last == first && endCol < startCol {
+		last, endCol = first, startCol
+	}
+
+	removed := d.Lines[first : last+1]
+	added := strings.Split(d.Lines[first][:startCol]+text+d.Lines[last][endCol:], "\n")
+	delta := len(added) - len(removed)
+	structural := d.changesStructure(first, removed, added)
+
+	// A new slice, as readers may hold on to the old one after unlocking
+	lines := make([]string, 0, len(d.Lines)+delta)
+	lines = append(lines, d.Lines[:first]...)
+	lines = append(lines, added...)
+	lines = append(lines, d.Lines[last+1:]...)
+	d.Lines = lines
+	d.Content = strings.Join(lines, "\n")
+	if structural {
+		d.parseLines()
+		return
+	}
+
+	d.shiftLines(first, last, delta)
+	d.rescanReferences(first, last, len(added), delta)
+	d.Errors = nil
+	d.validated = false
+	d.generation++
+}
+
+// byteOffset returns the line and byte column of pos, whose character
+// counts UTF-16 code units. Positions past the end are clamped to it.
+func (d *Document) byteOffset(pos protocol.Position) (line int, col int) {
+	line = int(pos.Line)
+	if line >= len(d.Lines) {
+		line = len(d.Lines) - 1
+		return line, len(d.Lines[line])
+	}
+	units := 0
+	for i, r := range d.Lines[line] {
+		if units >= int(pos.Character) {
+			return line, i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return line, len(d.Lines[line])
+}
+
+// changesStructure reports whether replacing the lines from first on with
+// added could change the sections or anchors, so the document has to be
+// parsed again
+func (d *Document) changesStructure(first int, removed []string, added []string) bool {
+	contentStart := iatf.ContentStart(d.Lines)
+	if contentStart == -1 || first < contentStart {
+		return true
+	}
+	for _, section := range d.OrderedSections {
+		if section.End == 0 {
+			return true // Unclosed: the parse of everything below depends on it
+		}
+	}
+	for _, lines := range [][]string{removed, added} {
+		for _, line := range lines {
+			if isStructuralLine(line) {
+				return true
+			}
+		}
+	}
+	// The first body line can become part of the section's metadata
+	section := d.sectionAt(first)
+	return section != nil && first <= d.sectionHeaderEnd(section)+1
+}
+
+// isStructuralLine reports whether line is a tag, a heading (which may give
+// its section a title), an anchor marker, a code fence or the CONTENT marker
+func isStructuralLine(line string) bool {
+	fence := iatf.CodeFence{}
+	return fence.Line(line) ||
+		strings.HasPrefix(line, "#") ||
+		strings.TrimSpace(line) == "===CONTENT===" ||
+		sectionOpenPattern.MatchString(line) ||
+		sectionClosePattern.MatchString(line) ||
+		iatf.AnchorPattern.MatchString(line)
+}
+
+// sectionHeaderEnd returns the last line of the opening tag and metadata of
+// section, counting every @ line and indented line after the tag
+func (d *Document) sectionHeaderEnd(section *Section) int {
+	end := section.Start
+	for end+1 < section.End {
+		line := d.Lines[end+1]
+		indented := (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && strings.TrimSpace(line) != ""
+		if !strings.HasPrefix(line, "@") && !indented {
+			break
+		}
+		end++
+	}
+	return end
+}
+
+// shiftLines moves the sections and anchors below the replaced lines
+// first..last by delta lines. The replaced lines hold no tag or anchor, so
+// every boundary is either above or below them.
+func (d *Document) shiftLines(first int, last int, delta int) {
+	if delta == 0 {
+		return
+	}
+	for _, section := range d.OrderedSections {
+		if section.Start > last {
+			section.Start += delta
+		}
+		if section.End > last {
+			section.End += delta
+		}
+	}
+	for key, anchor := range d.Anchors {
+		// Anchor lines are 1-indexed
+		if anchor.Line-1 > last {
+			anchor.Line += delta
+		}
+		if anchor.Inside && anchor.End-1 >= first {
+			anchor.End += delta
+		}
+		d.Anchors[key] = anchor
+	}
+}
+
+// rescanReferences replaces the references found on the replaced lines
+// first..last with those on the count lines now starting at first
+func (d *Document) rescanReferences(first int, last int, count int, delta int) {
+	// The change holds no fence line, so its lines are all in or all out
+	// of a code block
+	fence := iatf.CodeFence{}
+	for i := iatf.ContentStart(d.Lines); i < first; i++ {
+		fence.Line(d.Lines[i])
+	}
+
+	var references, crossReferences []Reference
+	if !fence.Open() {
+		for i := first; i < first+count; i++ {
+			lineRefs, lineCrossRefs := lineReferences(i, d.Lines[i])
+			references = append(references, lineRefs...)
+			crossReferences = append(crossReferences, lineCrossRefs...)
+		}
+	}
+	d.References = spliceReferences(d.References, first, last, delta, references)
+	d.CrossReferences = spliceReferences(d.CrossReferences, first, last, delta, crossReferences)
+}
+
+// spliceReferences returns refs, which are in line order, with those on
+// lines first..last replaced by replacement and those below moved by delta
+func spliceReferences(refs []Reference, first int, last int, delta int, replacement []Reference) []Reference {
+	start := sort.Search(len(refs), func(i int) bool { return refs[i].Line >= first })
+	end := sort.Search(len(refs), func(i int) bool { return refs[i].Line > last })
+	refs = slices.Replace(refs, start, end, replacement...)
+	if delta != 0 {
+		for i := start + len(replacement); i < len(refs); i++ {
+			refs[i].Line += delta
+		}
+	}
+	return refs
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Server commands (workspace/executeCommand)
+const (
+	commandRebuildIndex = "iatf.rebuildIndex" // arguments: [uri]
+)
+
+// serverCommands lists every command advertised in executeCommandProvider
+var serverCommands = []string{commandRebuildIndex}
+
+// cliName is the IATF command-line tool, looked up in PATH
+const cliName = "iatf"
+
+func workspaceExecuteCommand(context *glsp.Context, params *protocol.ExecuteCommandParams) (any, error) {
+	switch params.Command {
+	case commandRebuildIndex:
+		return rebuildIndexCommand(context, params.Arguments)
+	default:
+		return nil, fmt.Errorf("unknown command: %s", params.Command)
+	}
+}
+
+// rebuildIndexCommand runs 'iatf rebuild' on the saved file, so the INDEX is
+// regenerated by exactly the same logic as the CLI, and reports the outcome
+func rebuildIndexCommand(context *glsp.Context, arguments []any) (any, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("%s expects the document URI as its argument", commandRebuildIndex)
+	}
+	uri, ok := arguments[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s expects the document URI as its argument", commandRebuildIndex)
+	}
+	path, err := uriToPath(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := exec.LookPath(cliName)
+	if err != nil {
+		showMessage(context, protocol.MessageTypeError, "Rebuild failed: the '"+cliName+"' command was not found in PATH")
+		return nil, err
+	}
+
+	output, err := exec.Command(cli, "rebuild", path).CombinedOutput()
+	// The CLI prints progress first and the outcome on its last line
+	message := strings.TrimSpace(string(output))
+	if i := strings.LastIndex(message, "\n"); i >= 0 {
+		message = message[i+1:]
+	}
+	if err != nil {
+		if message == "" {
+			message = err.Error()
+		}
+		showMessage(context, protocol.MessageTypeError, "Rebuild failed for "+filepath.Base(path)+": "+message)
+		return nil, fmt.Errorf("rebuild failed: %s", message)
+	}
+
+	showMessage(context, protocol.MessageTypeInfo, message)
+	return message, nil
+}
+
+func showMessage(context *glsp.Context, messageType protocol.MessageType, message string) {
+	context.Notify(protocol.ServerWindowShowMessage, protocol.ShowMessageParams{
+		Type:    messageType,
+		Message: message,
+	})
+}
@@ -1,8 +1,9 @@
 module github.com/Winds-AI/agent-traversal-file/lsp
 
-go 1.22
+go 1.24.0
 
 require (
+	github.com/Winds-AI/agent-traversal-file v0.0.0-00010101000000-000000000000
 	github.com/tliron/commonlog v0.2.18
 	github.com/tliron/glsp v0.2.2
 )
@@ -23,6 +24,8 @@ require (
 	github.com/sourcegraph/jsonrpc2 v0.2.0 // indirect
 	github.com/tliron/kutil v0.3.25 // indirect
 	golang.org/x/crypto v0.26.0 // indirect
-	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/sys v0.40.0 // indirect
 	golang.org/x/term v0.23.0 // indirect
 )
+
+replace github.com/Winds-AI/agent-traversal-file => ../go
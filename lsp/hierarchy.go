@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+
+	"github.com/Winds-AI/agent-traversal-file/lsp/analyzer"
+)
+
+// The call hierarchy walks section references: the incoming calls of a
+// section are the sections referencing it, its outgoing calls the sections it
+// references, in this document or (through {@file#id}) in others.
+
+func textDocumentPrepareCallHierarchy(context *glsp.Context, params *protocol.CallHierarchyPrepareParams) ([]protocol.CallHierarchyItem, error) {
+	doc := documentStore.Get(params.TextDocument.URI)
+	if doc == nil {
+		return nil, nil
+	}
+
+	target, id := doc, doc.HierarchySectionAt(params.Position)
+	if ref, ok := doc.CrossReferenceAt(params.Position); ok {
+		target, id = resolverFor(doc)(ref.File), ref.TargetID
+	}
+	if target == nil || id == "" {
+		return nil, nil
+	}
+
+	if item, exists := target.HierarchyItem(id); exists {
+		return []protocol.CallHierarchyItem{item}, nil
+	}
+	return nil, nil
+}
+
+func callHierarchyIncomingCalls(context *glsp.Context, params *protocol.CallHierarchyIncomingCallsParams) ([]protocol.CallHierarchyIncomingCall, error) {
+	target, id := hierarchyTarget(params.Item)
+	if target == nil {
+		return nil, nil
+	}
+
+	calls := hierarchyCalls{}
+	for _, location := range target.ReferencesTo(id) {
+		calls.add(target, target.ContainingSectionID(int(location.Range.Start.Line)), location.Range)
+	}
+	for _, other := range allDocuments() {
+		for _, location := range other.CrossReferencesTo(resolverFor(other), target, id) {
+			calls.add(other, other.ContainingSectionID(int(location.Range.Start.Line)), location.Range)
+		}
+	}
+
+	incoming := make([]protocol.CallHierarchyIncomingCall, len(calls.items))
+	for i, item := range calls.items {
+		incoming[i] = protocol.CallHierarchyIncomingCall{From: item, FromRanges: calls.ranges[i]}
+	}
+	return incoming, nil
+}
+
+func callHierarchyOutgoingCalls(context *glsp.Context, params *protocol.CallHierarchyOutgoingCallsParams) ([]protocol.CallHierarchyOutgoingCall, error) {
+	source, id := hierarchyTarget(params.Item)
+	if source == nil {
+		return nil, nil
+	}
+
+	resolve := resolverFor(source)
+	calls := hierarchyCalls{}
+	for _, ref := range source.ReferencesFrom(id) {
+		target := source
+		if ref.File != "" {
+			target = resolve(ref.File)
+		}
+		if target != nil {
+			calls.add(target, ref.TargetID, ref.Range())
+		}
+	}
+
+	outgoing := make([]protocol.CallHierarchyOutgoingCall, len(calls.items))
+	for i, item := range calls.items {
+		outgoing[i] = protocol.CallHierarchyOutgoingCall{To: item, FromRanges: calls.ranges[i]}
+	}
+	return outgoing, nil
+}
+
+// hierarchyTarget returns the document and section ID of a hierarchy item
+func hierarchyTarget(item protocol.CallHierarchyItem) (*analyzer.Document, string) {
+	id, ok := item.Data.(string)
+	if !ok || id == "" {
+		return nil, ""
+	}
+	return lookupDocument(item.URI), id
+}
+
+// hierarchyCalls groups reference ranges by the section they come from or
+// point to, in order of first appearance
+type hierarchyCalls struct {
+	keys   map[string]int
+	items  []protocol.CallHierarchyItem
+	ranges [][]protocol.Range
+}
+
+// add records rng under section id of doc; sections that do not exist (and
+// references outside every section) are skipped
+func (c *hierarchyCalls) add(doc *analyzer.Document, id string, rng protocol.Range) {
+	if id == "" {
+		return
+	}
+	key := doc.URI + "#" + id
+	if i, exists := c.keys[key]; exists {
+		c.ranges[i] = append(c.ranges[i], rng)
+		return
+	}
+
+	item, exists := doc.HierarchyItem(id)
+	if !exists {
+		return
+	}
+	if c.keys == nil {
+		c.keys = map[string]int{}
+	}
+	c.keys[key] = len(c.items)
+	c.items = append(c.items, item)
+	c.ranges = append(c.ranges, []protocol.Range{rng})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+
+	"github.com/Winds-AI/agent-traversal-file/lsp/analyzer"
+)
+
+// Validating a document walks every line and every reference in it, which
+// for a document of hundreds of thousands of lines takes long enough to hold
+// up the editor after each edit. Documents over maxFileLines or
+// maxFileSizeMb are therefore not validated: their diagnostics are cleared
+// and the user is told why, once, while the features that only need the
+// parse (symbols, navigation, completion) keep working.
+
+// diagnosticsOff holds the documents the user was told have no diagnostics
+var diagnosticsOff = struct {
+	sync.Mutex
+	uris map[protocol.DocumentUri]bool
+}{uris: map[protocol.DocumentUri]bool{}}
+
+// overDiagnosticsLimit reports whether doc is too large to be validated. The
+// first time it is, the user is told; once it is back under the limits, it
+// will be told again should it grow past them.
+func overDiagnosticsLimit(context *glsp.Context, doc *analyzer.Document) bool {
+	reason := currentSettings().diagnosticsLimit(doc.LineCount(), doc.Size())
+
+	diagnosticsOff.Lock()
+	told := diagnosticsOff.uris[doc.URI]
+	if reason == "" {
+		delete(diagnosticsOff.uris, doc.URI)
+	} else {
+		diagnosticsOff.uris[doc.URI] = true
+	}
+	diagnosticsOff.Unlock()
+
+	if reason != "" && !told {
+		showMessage(context, protocol.MessageTypeWarning,
+			"Diagnostics are off for "+documentName(doc.URI)+" because "+reason+"; symbols and navigation still work")
+	}
+	return reason != ""
+}
+
+// forgetDiagnosticsOff drops a closed document, so reopening it tells again
+func forgetDiagnosticsOff(uri protocol.DocumentUri) {
+	diagnosticsOff.Lock()
+	delete(diagnosticsOff.uris, uri)
+	diagnosticsOff.Unlock()
+}
@@ -1,6 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
 	"github.com/tliron/commonlog"
 	_ "github.com/tliron/commonlog/simple"
 	"github.com/tliron/glsp"
@@ -8,32 +14,73 @@ import (
 	"github.com/tliron/glsp/server"
 
 	"github.com/Winds-AI/agent-traversal-file/lsp/analyzer"
+	protocol317 "github.com/Winds-AI/agent-traversal-file/lsp/protocol_3_17"
 )
 
 const lsName = "IATF Language Server"
 
 var version string = "0.1.0"
-var handler protocol.Handler
+var handler protocol317.Handler
 var documentStore = analyzer.NewDocumentStore()
 
+// publishMu orders diagnostics publications computed in the background
+var publishMu sync.Mutex
+
+// Pending debounced diagnostics by document URI
+var (
+	debounceMu     sync.Mutex
+	debounceTimers = map[protocol.DocumentUri]*time.Timer{}
+)
+
+// snippetSupport is true when the client accepts snippet completions
+var snippetSupport bool
+
+// watchedFilesSupport is true when the client lets us register file watchers
+var watchedFilesSupport bool
+
+// codeLensRefreshSupport is true when the client accepts workspace/codeLens/refresh
+var codeLensRefreshSupport bool
+
+// pullDiagnostics is true when the client requests diagnostics with
+// textDocument/diagnostic; they are pushed otherwise
+var pullDiagnostics bool
+
 func main() {
 	commonlog.Configure(1, nil)
 
-	handler = protocol.Handler{
-		Initialize:                 initialize,
-		Initialized:                initialized,
-		Shutdown:                   shutdown,
-		SetTrace:                   setTrace,
-		TextDocumentDidOpen:        textDocumentDidOpen,
-		TextDocumentDidChange:      textDocumentDidChange,
-		TextDocumentDidClose:       textDocumentDidClose,
-		TextDocumentDidSave:        textDocumentDidSave,
-		TextDocumentCompletion:     textDocumentCompletion,
-		TextDocumentHover:          textDocumentHover,
-		TextDocumentDefinition:     textDocumentDefinition,
-		TextDocumentReferences:     textDocumentReferences,
-		TextDocumentDocumentSymbol: textDocumentDocumentSymbol,
+	handler.Handler = &protocol.Handler{
+		Initialize:                    initialize,
+		Initialized:                   initialized,
+		Shutdown:                      shutdown,
+		SetTrace:                      setTrace,
+		TextDocumentDidOpen:           textDocumentDidOpen,
+		TextDocumentDidChange:         textDocumentDidChange,
+		TextDocumentDidClose:          textDocumentDidClose,
+		TextDocumentDidSave:           textDocumentDidSave,
+		TextDocumentCompletion:        textDocumentCompletion,
+		TextDocumentHover:             textDocumentHover,
+		TextDocumentDefinition:        textDocumentDefinition,
+		TextDocumentReferences:        textDocumentReferences,
+		TextDocumentDocumentHighlight: textDocumentDocumentHighlight,
+		TextDocumentDocumentSymbol:    textDocumentDocumentSymbol,
+		TextDocumentCodeAction:        textDocumentCodeAction,
+		TextDocumentFoldingRange:      textDocumentFoldingRange,
+		TextDocumentDocumentLink:      textDocumentDocumentLink,
+		TextDocumentCodeLens:          textDocumentCodeLens,
+		TextDocumentOnTypeFormatting:  textDocumentOnTypeFormatting,
+
+		TextDocumentPrepareCallHierarchy: textDocumentPrepareCallHierarchy,
+		CallHierarchyIncomingCalls:       callHierarchyIncomingCalls,
+		CallHierarchyOutgoingCalls:       callHierarchyOutgoingCalls,
+
+		WorkspaceExecuteCommand:            workspaceExecuteCommand,
+		WorkspaceSymbol:                    workspaceSymbol,
+		WorkspaceDidChangeWorkspaceFolders: workspaceDidChangeWorkspaceFolders,
+		WorkspaceDidChangeConfiguration:    workspaceDidChangeConfiguration,
+		WorkspaceDidChangeWatchedFiles:     workspaceDidChangeWatchedFiles,
 	}
+	handler.TextDocumentInlayHint = textDocumentInlayHint
+	handler.TextDocumentDiagnostic = textDocumentDiagnostic
 
 	s := server.NewServer(&handler, lsName, true)
 	s.RunStdio()
@@ -43,9 +90,30 @@ func initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 	commonlog.NewInfoMessage(0, "Initializing IATF Language Server...")
 
 	capabilities := handler.CreateServerCapabilities()
+	workspace.set(params)
+	applySettings(params.InitializationOptions)
+	if textDocument := params.Capabilities.TextDocument; textDocument != nil && textDocument.Completion != nil && textDocument.Completion.CompletionItem != nil {
+		snippetSupport = textDocument.Completion.CompletionItem.SnippetSupport != nil && *textDocument.Completion.CompletionItem.SnippetSupport
+	}
+	if ws := params.Capabilities.Workspace; ws != nil && ws.DidChangeWatchedFiles != nil {
+		watchedFilesSupport = ws.DidChangeWatchedFiles.DynamicRegistration != nil && *ws.DidChangeWatchedFiles.DynamicRegistration
+	}
+	if ws := params.Capabilities.Workspace; ws != nil && ws.CodeLens != nil {
+		codeLensRefreshSupport = ws.CodeLens.RefreshSupport != nil && *ws.CodeLens.RefreshSupport
+	}
 
-	// Text document sync - full sync mode
-	capabilities.TextDocumentSync = protocol.TextDocumentSyncKindFull
+	// Pull diagnostics when the client supports them; they depend on other files
+	pullDiagnostics = handler.ClientCapabilities.PullDiagnostics()
+	if pullDiagnostics {
+		capabilities.DiagnosticProvider = protocol317.DiagnosticOptions{
+			Identifier:            ptrString("iatf"),
+			InterFileDependencies: true,
+		}
+	}
+
+	// Text document sync - incremental, so edits are applied to the parsed
+	// document instead of re-parsing all of it
+	capabilities.TextDocumentSync = protocol.TextDocumentSyncKindIncremental
 
 	// Completion support
 	capabilities.CompletionProvider = &protocol.CompletionOptions{
@@ -62,10 +130,53 @@ func initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 	// Find references support
 	capabilities.ReferencesProvider = true
 
+	// Highlight a section's tags and references under the cursor
+	capabilities.DocumentHighlightProvider = true
+
+	// Reference hierarchy: sections referencing / referenced by a section
+	capabilities.CallHierarchyProvider = true
+
 	// Document symbol support (outline)
 	capabilities.DocumentSymbolProvider = true
 
-	return protocol.InitializeResult{
+	// Document links: {@id} references are clickable
+	capabilities.DocumentLinkProvider = &protocol.DocumentLinkOptions{
+		ResolveProvider: ptrBool(false),
+	}
+
+	// Workspace symbols search every .iatf file in the workspace folders
+	capabilities.WorkspaceSymbolProvider = true
+	capabilities.Workspace = &protocol.ServerCapabilitiesWorkspace{
+		WorkspaceFolders: &protocol.WorkspaceFoldersServerCapabilities{
+			Supported:           ptrBool(true),
+			ChangeNotifications: &protocol.BoolOrString{Value: true},
+		},
+	}
+
+	// Auto-close sections: Enter after {#id} inserts {/id}
+	capabilities.DocumentOnTypeFormattingProvider = &protocol.DocumentOnTypeFormattingOptions{
+		FirstTriggerCharacter: "\n",
+	}
+
+	// Code lenses: reference and word counts, rebuild index
+	capabilities.CodeLensProvider = &protocol.CodeLensOptions{
+		ResolveProvider: ptrBool(false),
+	}
+
+	// Folding ranges for sections, INDEX and code fences
+	capabilities.FoldingRangeProvider = true
+
+	// Code actions (quick fixes for diagnostics, heading to section)
+	capabilities.CodeActionProvider = &protocol.CodeActionOptions{
+		CodeActionKinds: []protocol.CodeActionKind{protocol.CodeActionKindQuickFix, protocol.CodeActionKindRefactorRewrite},
+	}
+
+	// Server commands (e.g. iatf.rebuildIndex)
+	capabilities.ExecuteCommandProvider = &protocol.ExecuteCommandOptions{
+		Commands: serverCommands,
+	}
+
+	return protocol317.InitializeResult{
 		Capabilities: capabilities,
 		ServerInfo: &protocol.InitializeResultServerInfo{
 			Name:    lsName,
@@ -76,6 +187,16 @@ func initialize(context *glsp.Context, params *protocol.InitializeParams) (any,
 
 func initialized(context *glsp.Context, params *protocol.InitializedParams) error {
 	commonlog.NewInfoMessage(0, "IATF Language Server initialized")
+
+	// Index the workspace in the background; cross-file diagnostics of
+	// documents opened meanwhile are refreshed once it is done
+	go func() {
+		index.rebuild()
+		republishDiagnostics(context)
+	}()
+	if watchedFilesSupport {
+		go registerFileWatchers(context)
+	}
 	return nil
 }
 
@@ -92,19 +213,38 @@ func textDocumentDidOpen(context *glsp.Context, params *protocol.DidOpenTextDocu
 	uri := params.TextDocument.URI
 	content := params.TextDocument.Text
 
+	// Clients may send every document of a shared language (e.g. markdown)
+	if !currentSettings().serves(uri, params.TextDocument.LanguageID) {
+		return nil
+	}
+
 	documentStore.Open(uri, content)
-	publishDiagnostics(context, uri)
+	go publishDiagnostics(context, uri)
 	return nil
 }
 
 func textDocumentDidChange(context *glsp.Context, params *protocol.DidChangeTextDocumentParams) error {
 	uri := params.TextDocument.URI
+	if documentStore.Get(uri) == nil {
+		// Not an IATF document
+		return nil
+	}
 
-	// Full sync mode - take the last content change
-	if len(params.ContentChanges) > 0 {
-		content := params.ContentChanges[len(params.ContentChanges)-1].(protocol.TextDocumentContentChangeEventWhole).Text
-		documentStore.Update(uri, content)
-		publishDiagnostics(context, uri)
+	// Ranged changes are edits; a change without a range replaces the content
+	changes := make([]analyzer.Change, 0, len(params.ContentChanges))
+	for _, change := range params.ContentChanges {
+		switch change := change.(type) {
+		case protocol.TextDocumentContentChangeEvent:
+			changes = append(changes, analyzer.Change{Range: change.Range, Text: change.Text})
+		case protocol.TextDocumentContentChangeEventWhole:
+			changes = append(changes, analyzer.Change{Text: change.Text})
+		}
+	}
+	if len(changes) > 0 {
+		if content, ok := documentStore.Edit(uri, changes); ok {
+			externalRebuilds.reloaded(uri, content)
+			publishDiagnosticsDebounced(context, uri)
+		}
 	}
 	return nil
 }
@@ -112,6 +252,13 @@ func textDocumentDidChange(context *glsp.Context, params *protocol.DidChangeText
 func textDocumentDidClose(context *glsp.Context, params *protocol.DidCloseTextDocumentParams) error {
 	uri := params.TextDocument.URI
 	documentStore.Close(uri)
+	externalRebuilds.forget(uri)
+	forgetDiagnosticsOff(uri)
+
+	// The saved file replaces the editor buffer in the index
+	if path, err := uriToPath(uri); err == nil && currentSettings().hasFileExtension(path) {
+		index.load(path)
+	}
 
 	// Clear diagnostics
 	context.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
@@ -122,25 +269,123 @@ func textDocumentDidClose(context *glsp.Context, params *protocol.DidCloseTextDo
 }
 
 func textDocumentDidSave(context *glsp.Context, params *protocol.DidSaveTextDocumentParams) error {
-	// Re-validate on save
+	// Re-validate on save; with workspace-unique IDs, the saved IDs may
+	// clash with (or no longer clash with) those of other open files
 	uri := params.TextDocument.URI
+	if currentSettings().WorkspaceUniqueIDs {
+		republishDiagnostics(context)
+		return nil
+	}
 	publishDiagnostics(context, uri)
 	return nil
 }
 
 func publishDiagnostics(context *glsp.Context, uri protocol.DocumentUri) {
 	doc := documentStore.Get(uri)
-	if doc == nil {
+	if doc == nil || pullDiagnostics {
 		return
 	}
 
-	diagnostics := doc.GetDiagnostics()
+	generation := doc.Generation()
+	diagnostics := documentDiagnostics(context, doc)
+
+	// Diagnostics may be computed concurrently; drop them if the document
+	// was edited meanwhile, since that edit publishes its own
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	if documentStore.Get(uri) != doc || doc.Generation() != generation {
+		return
+	}
 	context.Notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
 		URI:         uri,
 		Diagnostics: diagnostics,
 	})
 }
 
+// documentDiagnostics returns the validation and cross-file diagnostics of
+// doc, none when it is over the size limits
+func documentDiagnostics(context *glsp.Context, doc *analyzer.Document) []protocol.Diagnostic {
+	if overDiagnosticsLimit(context, doc) {
+		return []protocol.Diagnostic{}
+	}
+	diagnostics := append(doc.GetDiagnostics(), doc.GetCrossFileDiagnostics(resolverFor(doc))...)
+	if currentSettings().WorkspaceUniqueIDs {
+		diagnostics = append(diagnostics, doc.GetWorkspaceIDDiagnostics(workspaceSectionIDs(doc))...)
+	}
+	return withoutIndexIssues(doc, diagnostics)
+}
+
+// republishDiagnostics refreshes every open document, e.g. after files they
+// reference have changed
+func republishDiagnostics(context *glsp.Context) {
+	if pullDiagnostics {
+		if handler.ClientCapabilities.DiagnosticRefresh() {
+			go context.Call(protocol317.ServerWorkspaceDiagnosticRefresh, nil, nil)
+		}
+		return
+	}
+
+	for _, doc := range documentStore.All() {
+		publishDiagnostics(context, doc.URI)
+	}
+}
+
+func textDocumentDiagnostic(context *glsp.Context, params *protocol317.DocumentDiagnosticParams) (any, error) {
+	items := []protocol.Diagnostic{}
+	if doc := documentStore.Get(params.TextDocument.URI); doc != nil {
+		items = documentDiagnostics(context, doc)
+	}
+
+	// The result ID identifies the diagnostics themselves, so a request after
+	// an edit that changed nothing is answered with "unchanged"
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	hash := fnv.New64a()
+	hash.Write(data)
+	resultID := fmt.Sprintf("%x", hash.Sum64())
+
+	if params.PreviousResultID != nil && *params.PreviousResultID == resultID {
+		return protocol317.UnchangedDocumentDiagnosticReport{
+			Kind:     protocol317.DocumentDiagnosticReportKindUnchanged,
+			ResultID: resultID,
+		}, nil
+	}
+	return protocol317.FullDocumentDiagnosticReport{
+		Kind:     protocol317.DocumentDiagnosticReportKindFull,
+		ResultID: &resultID,
+		Items:    items,
+	}, nil
+}
+
+// publishDiagnostics in the background after the configured debounce, so
+// validating a large document does not hold up the requests that follow an
+// edit; a newer edit of the same document restarts the delay
+func publishDiagnosticsDebounced(context *glsp.Context, uri protocol.DocumentUri) {
+	doc := documentStore.Get(uri)
+	if doc == nil {
+		return
+	}
+	delay := currentSettings().diagnosticsDelay(doc.LineCount())
+	if delay <= 0 {
+		go publishDiagnostics(context, uri)
+		return
+	}
+
+	debounceMu.Lock()
+	defer debounceMu.Unlock()
+	if timer, exists := debounceTimers[uri]; exists {
+		timer.Stop()
+	}
+	debounceTimers[uri] = time.AfterFunc(delay, func() {
+		debounceMu.Lock()
+		delete(debounceTimers, uri)
+		debounceMu.Unlock()
+		publishDiagnostics(context, uri)
+	})
+}
+
 func textDocumentCompletion(context *glsp.Context, params *protocol.CompletionParams) (any, error) {
 	uri := params.TextDocument.URI
 	doc := documentStore.Get(uri)
@@ -148,7 +393,7 @@ func textDocumentCompletion(context *glsp.Context, params *protocol.CompletionPa
 		return nil, nil
 	}
 
-	return doc.GetCompletions(params.Position), nil
+	return doc.GetCompletions(params.Position, snippetSupport), nil
 }
 
 func textDocumentHover(context *glsp.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
@@ -168,6 +413,18 @@ func textDocumentDefinition(context *glsp.Context, params *protocol.DefinitionPa
 		return nil, nil
 	}
 
+	// {@file#id} jumps to the section in the other file
+	if ref, ok := doc.CrossReferenceAt(params.Position); ok {
+		target := resolverFor(doc)(ref.File)
+		if target == nil {
+			return nil, nil
+		}
+		if location, exists := target.SectionLocation(ref.TargetID); exists {
+			return location, nil
+		}
+		return nil, nil
+	}
+
 	return doc.GetDefinition(params.Position, uri), nil
 }
 
@@ -178,7 +435,30 @@ func textDocumentReferences(context *glsp.Context, params *protocol.ReferencePar
 		return nil, nil
 	}
 
-	return doc.GetReferences(params.Position, uri), nil
+	// The section is either one of this document's, or the target of a {@file#id}
+	target, id := doc, doc.SectionIDAt(params.Position)
+	if ref, ok := doc.CrossReferenceAt(params.Position); ok {
+		target, id = resolverFor(doc)(ref.File), ref.TargetID
+	}
+	if target == nil || id == "" {
+		return nil, nil
+	}
+
+	locations := target.ReferencesTo(id)
+	for _, other := range allDocuments() {
+		locations = append(locations, other.CrossReferencesTo(resolverFor(other), target, id)...)
+	}
+	return locations, nil
+}
+
+func textDocumentDocumentHighlight(context *glsp.Context, params *protocol.DocumentHighlightParams) ([]protocol.DocumentHighlight, error) {
+	uri := params.TextDocument.URI
+	doc := documentStore.Get(uri)
+	if doc == nil {
+		return nil, nil
+	}
+
+	return doc.GetDocumentHighlights(params.Position), nil
 }
 
 func textDocumentDocumentSymbol(context *glsp.Context, params *protocol.DocumentSymbolParams) (any, error) {
@@ -191,6 +471,74 @@ func textDocumentDocumentSymbol(context *glsp.Context, params *protocol.Document
 	return doc.GetDocumentSymbols(), nil
 }
 
+func textDocumentCodeAction(context *glsp.Context, params *protocol.CodeActionParams) (any, error) {
+	uri := params.TextDocument.URI
+	doc := documentStore.Get(uri)
+	if doc == nil {
+		return nil, nil
+	}
+	// Quick fixes come from validation, which is off for large documents
+	if currentSettings().diagnosticsLimit(doc.LineCount(), doc.Size()) != "" {
+		return []protocol.CodeAction{}, nil
+	}
+
+	return doc.GetCodeActions(params.Range, uri, commandRebuildIndex), nil
+}
+
+func textDocumentFoldingRange(context *glsp.Context, params *protocol.FoldingRangeParams) ([]protocol.FoldingRange, error) {
+	uri := params.TextDocument.URI
+	doc := documentStore.Get(uri)
+	if doc == nil {
+		return nil, nil
+	}
+
+	return doc.GetFoldingRanges(), nil
+}
+
+func textDocumentDocumentLink(context *glsp.Context, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
+	uri := params.TextDocument.URI
+	doc := documentStore.Get(uri)
+	if doc == nil {
+		return nil, nil
+	}
+
+	return append(doc.GetDocumentLinks(uri), doc.GetCrossFileLinks(resolverFor(doc))...), nil
+}
+
+func textDocumentCodeLens(context *glsp.Context, params *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
+	uri := params.TextDocument.URI
+	doc := documentStore.Get(uri)
+	if doc == nil {
+		return nil, nil
+	}
+
+	return doc.GetCodeLenses(commandRebuildIndex), nil
+}
+
+func textDocumentInlayHint(context *glsp.Context, params *protocol317.InlayHintParams) ([]protocol317.InlayHint, error) {
+	uri := params.TextDocument.URI
+	doc := documentStore.Get(uri)
+	if doc == nil {
+		return nil, nil
+	}
+
+	return doc.GetInlayHints(params.Range), nil
+}
+
+func textDocumentOnTypeFormatting(context *glsp.Context, params *protocol.DocumentOnTypeFormattingParams) ([]protocol.TextEdit, error) {
+	uri := params.TextDocument.URI
+	doc := documentStore.Get(uri)
+	if doc == nil || params.Ch != "\n" || !currentSettings().AutoCloseSections {
+		return nil, nil
+	}
+
+	return doc.GetAutoCloseEdits(params.Position), nil
+}
+
 func ptrBool(b bool) *bool {
 	return &b
 }
+
+func ptrString(s string) *string {
+	return &s
+}
@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	protocol316 "github.com/tliron/glsp/protocol_3_16"
+)
+
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/#textDocument_pullDiagnostics
+
+const MethodTextDocumentDiagnostic = protocol316.Method("textDocument/diagnostic")
+
+const ServerWorkspaceDiagnosticRefresh = protocol316.Method("workspace/diagnostic/refresh")
+
+type DiagnosticOptions struct {
+	protocol316.WorkDoneProgressOptions
+
+	/**
+	 * An optional identifier under which the diagnostics are
+	 * managed by the client.
+	 */
+	Identifier *string `json:"identifier,omitempty"`
+
+	/**
+	 * Whether the language has inter file dependencies meaning that
+	 * editing code in one file can result in a different diagnostic
+	 * set in another file.
+	 */
+	InterFileDependencies bool `json:"interFileDependencies"`
+
+	/**
+	 * The server provides support for workspace diagnostics as well.
+	 */
+	WorkspaceDiagnostics bool `json:"workspaceDiagnostics"`
+}
+
+type DocumentDiagnosticParams struct {
+	protocol316.WorkDoneProgressParams
+	protocol316.PartialResultParams
+
+	/**
+	 * The text document.
+	 */
+	TextDocument protocol316.TextDocumentIdentifier `json:"textDocument"`
+
+	/**
+	 * The additional identifier provided during registration.
+	 */
+	Identifier *string `json:"identifier,omitempty"`
+
+	/**
+	 * The result id of a previous response if provided.
+	 */
+	PreviousResultID *string `json:"previousResultId,omitempty"`
+}
+
+type DocumentDiagnosticReportKind string
+
+const (
+	/**
+	 * A diagnostic report with a full
+	 * set of problems.
+	 */
+	DocumentDiagnosticReportKindFull = DocumentDiagnosticReportKind("full")
+
+	/**
+	 * A report indicating that the last
+	 * returned report is still accurate.
+	 */
+	DocumentDiagnosticReportKindUnchanged = DocumentDiagnosticReportKind("unchanged")
+)
+
+type FullDocumentDiagnosticReport struct {
+	/**
+	 * A full document diagnostic report.
+	 */
+	Kind DocumentDiagnosticReportKind `json:"kind"`
+
+	/**
+	 * An optional result id. If provided it will
+	 * be sent on the next diagnostic request for the
+	 * same document.
+	 */
+	ResultID *string `json:"resultId,omitempty"`
+
+	/**
+	 * The actual items.
+	 */
+	Items []protocol316.Diagnostic `json:"items"`
+}
+
+type UnchangedDocumentDiagnosticReport struct {
+	/**
+	 * A document diagnostic report indicating
+	 * no changes to the last result. A server can
+	 * only return `unchanged` if result ids are
+	 * provided.
+	 */
+	Kind DocumentDiagnosticReportKind `json:"kind"`
+
+	/**
+	 * A result id which will be sent on the next
+	 * diagnostic request for the same document.
+	 */
+	ResultID string `json:"resultId"`
+}
+
+// ClientCapabilities holds the 3.17 client capabilities the server reads;
+// glsp's 3.16 InitializeParams drop them
+type ClientCapabilities struct {
+	TextDocument *struct {
+		/**
+		 * Capabilities specific to the diagnostic pull model.
+		 */
+		Diagnostic *struct {
+			DynamicRegistration    *bool `json:"dynamicRegistration,omitempty"`
+			RelatedDocumentSupport *bool `json:"relatedDocumentSupport,omitempty"`
+		} `json:"diagnostic,omitempty"`
+	} `json:"textDocument,omitempty"`
+
+	Workspace *struct {
+		/**
+		 * Client workspace capabilities specific to diagnostics.
+		 */
+		Diagnostics *struct {
+			RefreshSupport *bool `json:"refreshSupport,omitempty"`
+		} `json:"diagnostics,omitempty"`
+	} `json:"workspace,omitempty"`
+}
+
+// PullDiagnostics reports whether the client supports textDocument/diagnostic
+func (self ClientCapabilities) PullDiagnostics() bool {
+	return self.TextDocument != nil && self.TextDocument.Diagnostic != nil
+}
+
+// DiagnosticRefresh reports whether the client supports workspace/diagnostic/refresh
+func (self ClientCapabilities) DiagnosticRefresh() bool {
+	return self.Workspace != nil && self.Workspace.Diagnostics != nil &&
+		self.Workspace.Diagnostics.RefreshSupport != nil && *self.Workspace.Diagnostics.RefreshSupport
+}
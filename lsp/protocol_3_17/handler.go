@@ -0,0 +1,99 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/tliron/glsp"
+	protocol316 "github.com/tliron/glsp/protocol_3_16"
+)
+
+type TextDocumentInlayHintFunc func(context *glsp.Context, params *InlayHintParams) ([]InlayHint, error)
+type TextDocumentDiagnosticFunc func(context *glsp.Context, params *DocumentDiagnosticParams) (any, error)
+
+// Handler dispatches the 3.17 methods it knows and hands everything else to
+// the embedded 3.16 handler
+type Handler struct {
+	*protocol316.Handler
+
+	TextDocumentInlayHint  TextDocumentInlayHintFunc
+	TextDocumentDiagnostic TextDocumentDiagnosticFunc
+
+	// ClientCapabilities are read from initialize before it is handled
+	ClientCapabilities ClientCapabilities
+}
+
+// glsp.Handler interface
+func (self *Handler) Handle(context *glsp.Context) (r any, validMethod bool, validParams bool, err error) {
+	switch context.Method {
+	case protocol316.MethodInitialize:
+		var params struct {
+			Capabilities ClientCapabilities `json:"capabilities"`
+		}
+		if json.Unmarshal(context.Params, &params) == nil {
+			self.ClientCapabilities = params.Capabilities
+		}
+		return self.Handler.Handle(context)
+
+	case MethodTextDocumentInlayHint:
+		if !self.IsInitialized() {
+			return nil, true, true, errors.New("server not initialized")
+		}
+		if self.TextDocumentInlayHint != nil {
+			validMethod = true
+			var params InlayHintParams
+			if err = json.Unmarshal(context.Params, &params); err == nil {
+				validParams = true
+				r, err = self.TextDocumentInlayHint(context, &params)
+			}
+		}
+		return
+
+	case MethodTextDocumentDiagnostic:
+		if !self.IsInitialized() {
+			return nil, true, true, errors.New("server not initialized")
+		}
+		if self.TextDocumentDiagnostic != nil {
+			validMethod = true
+			var params DocumentDiagnosticParams
+			if err = json.Unmarshal(context.Params, &params); err == nil {
+				validParams = true
+				r, err = self.TextDocumentDiagnostic(context, &params)
+			}
+		}
+		return
+
+	default:
+		return self.Handler.Handle(context)
+	}
+}
+
+// ServerCapabilities extends the 3.16 capabilities with 3.17 providers
+type ServerCapabilities struct {
+	protocol316.ServerCapabilities
+
+	/**
+	 * The server provides inlay hints.
+	 */
+	InlayHintProvider any `json:"inlayHintProvider,omitempty"` // nil | bool | InlayHintOptions
+
+	/**
+	 * The server has support for pull model diagnostics.
+	 */
+	DiagnosticProvider any `json:"diagnosticProvider,omitempty"` // nil | DiagnosticOptions
+}
+
+func (self *Handler) CreateServerCapabilities() ServerCapabilities {
+	capabilities := ServerCapabilities{
+		ServerCapabilities: self.Handler.CreateServerCapabilities(),
+	}
+	if self.TextDocumentInlayHint != nil {
+		capabilities.InlayHintProvider = true
+	}
+	return capabilities
+}
+
+type InitializeResult struct {
+	Capabilities ServerCapabilities                      `json:"capabilities"`
+	ServerInfo   *protocol316.InitializeResultServerInfo `json:"serverInfo,omitempty"`
+}
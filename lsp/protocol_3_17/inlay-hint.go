@@ -0,0 +1,72 @@
+// Package protocol adds the LSP 3.17 messages the server uses on top of
+// glsp's protocol_3_16, with the same naming.
+package protocol
+
+import (
+	protocol316 "github.com/tliron/glsp/protocol_3_16"
+)
+
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/#textDocument_inlayHint
+
+const MethodTextDocumentInlayHint = protocol316.Method("textDocument/inlayHint")
+
+type InlayHintParams struct {
+	protocol316.WorkDoneProgressParams
+
+	/**
+	 * The text document.
+	 */
+	TextDocument protocol316.TextDocumentIdentifier `json:"textDocument"`
+
+	/**
+	 * The visible document range for which inlay hints should be computed.
+	 */
+	Range protocol316.Range `json:"range"`
+}
+
+type InlayHintKind protocol316.UInteger
+
+const (
+	/**
+	 * An inlay hint that for a type annotation.
+	 */
+	InlayHintKindType = InlayHintKind(1)
+
+	/**
+	 * An inlay hint that is for a parameter.
+	 */
+	InlayHintKindParameter = InlayHintKind(2)
+)
+
+type InlayHint struct {
+	/**
+	 * The position of this hint.
+	 */
+	Position protocol316.Position `json:"position"`
+
+	/**
+	 * The label of this hint.
+	 */
+	Label string `json:"label"`
+
+	/**
+	 * The kind of this hint. Can be omitted in which case the client
+	 * should fall back to a reasonable default.
+	 */
+	Kind *InlayHintKind `json:"kind,omitempty"`
+
+	/**
+	 * The tooltip text when you hover over this item.
+	 */
+	Tooltip *string `json:"tooltip,omitempty"`
+
+	/**
+	 * Render padding before the hint.
+	 */
+	PaddingLeft *bool `json:"paddingLeft,omitempty"`
+
+	/**
+	 * Render padding after the hint.
+	 */
+	PaddingRight *bool `json:"paddingRight,omitempty"`
+}
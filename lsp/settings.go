@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tliron/commonlog"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+
+	"github.com/Winds-AI/agent-traversal-file/lsp/analyzer"
+)
+
+// serverSettings holds the options a client can send in initializationOptions
+// or workspace/didChangeConfiguration
+type serverSettings struct {
+	// Insert {/id} below the cursor when Enter is pressed after {#id}
+	AutoCloseSections bool `json:"autoCloseSections"`
+
+	// Deepest allowed section nesting
+	MaxNestingDepth int `json:"maxNestingDepth"`
+
+	// Report section IDs also used by another file of the workspace (E021)
+	WorkspaceUniqueIDs bool `json:"workspaceUniqueIds"`
+
+	// Diagnostic code (as in 'iatf explain') -> error, warning, information, hint or off
+	Severity map[string]string `json:"severity"`
+
+	// Extensions of the files searched in the workspace folders and served
+	// when opened, e.g. ".atf" or ".iatf.md"
+	FileExtensions []string `json:"fileExtensions"`
+
+	// Language IDs of opened documents the server handles whatever their extension
+	LanguageIDs []string `json:"languageIds"`
+
+	// Delay before diagnostics are published after an edit, in milliseconds
+	DiagnosticsDebounceMs int `json:"diagnosticsDebounceMs"`
+
+	// Documents with at least this many lines wait at least
+	// LargeDocumentDebounceMs after an edit
+	LargeDocumentLines      int `json:"largeDocumentLines"`
+	LargeDocumentDebounceMs int `json:"largeDocumentDebounceMs"`
+
+	// Documents over either limit get no diagnostics; symbols, navigation
+	// and completion keep working. 0 is no limit.
+	MaxFileSizeMb int `json:"maxFileSizeMb"`
+	MaxFileLines  int `json:"maxFileLines"`
+}
+
+func defaultSettings() serverSettings {
+	return serverSettings{
+		AutoCloseSections:     true,
+		MaxNestingDepth:       2,
+		FileExtensions:        []string{".iatf"},
+		LanguageIDs:           []string{"iatf"},
+		DiagnosticsDebounceMs: 0,
+
+		LargeDocumentLines:      2000,
+		LargeDocumentDebounceMs: 300,
+
+		MaxFileSizeMb: 10,
+		MaxFileLines:  200000,
+	}
+}
+
+var (
+	settingsMu sync.RWMutex
+	settings   = defaultSettings()
+)
+
+// applySettings reads client options; keys that are missing keep their
+// defaults. Editors usually nest their settings under "iatf".
+func applySettings(options any) {
+	if options == nil {
+		return
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		commonlog.NewWarningMessage(0, "Ignoring invalid settings: "+err.Error())
+		return
+	}
+	var nested struct {
+		IATF json.RawMessage `json:"iatf"`
+	}
+	if json.Unmarshal(data, &nested) == nil && len(nested.IATF) > 0 && string(nested.IATF) != "null" {
+		data = nested.IATF
+	}
+
+	updated := defaultSettings()
+	if err := json.Unmarshal(data, &updated); err != nil {
+		commonlog.NewWarningMessage(0, "Ignoring invalid settings: "+err.Error())
+		return
+	}
+	updated.validate()
+
+	settingsMu.Lock()
+	settings = updated
+	settingsMu.Unlock()
+
+	documentStore.SetOptions(updated.analyzerOptions())
+}
+
+// validate replaces out-of-range values with their defaults
+func (s *serverSettings) validate() {
+	defaults := defaultSettings()
+	if s.MaxNestingDepth < 1 {
+		commonlog.NewWarningMessage(0, "maxNestingDepth must be at least 1, using the default")
+		s.MaxNestingDepth = defaults.MaxNestingDepth
+	}
+	if s.DiagnosticsDebounceMs < 0 {
+		s.DiagnosticsDebounceMs = defaults.DiagnosticsDebounceMs
+	}
+	if s.LargeDocumentLines < 1 {
+		s.LargeDocumentLines = defaults.LargeDocumentLines
+	}
+	if s.LargeDocumentDebounceMs < 0 {
+		s.LargeDocumentDebounceMs = defaults.LargeDocumentDebounceMs
+	}
+	if s.MaxFileSizeMb < 0 {
+		s.MaxFileSizeMb = defaults.MaxFileSizeMb
+	}
+	if s.MaxFileLines < 0 {
+		s.MaxFileLines = defaults.MaxFileLines
+	}
+
+	codes := make([]string, 0, len(s.Severity))
+	for code := range s.Severity {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if _, ok := analyzer.ParseSeverity(s.Severity[code]); !ok {
+			commonlog.NewWarningMessage(0, "Ignoring severity "+s.Severity[code]+" for "+code+" (expected error, warning, information, hint or off)")
+			delete(s.Severity, code)
+		}
+	}
+
+	extensions := []string{}
+	for _, extension := range s.FileExtensions {
+		if extension == "" {
+			continue
+		}
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		extensions = append(extensions, extension)
+	}
+	if len(extensions) == 0 {
+		extensions = defaults.FileExtensions
+	}
+	s.FileExtensions = extensions
+
+	languageIDs := []string{}
+	for _, languageID := range s.LanguageIDs {
+		if languageID = strings.TrimSpace(languageID); languageID != "" {
+			languageIDs = append(languageIDs, languageID)
+		}
+	}
+	s.LanguageIDs = languageIDs
+}
+
+func (s serverSettings) analyzerOptions() analyzer.Options {
+	options := analyzer.DefaultOptions()
+	options.MaxNestingDepth = s.MaxNestingDepth
+	options.Severities = s.Severity
+	return options
+}
+
+// diagnosticsLimit returns which limit a document of the given lines and
+// bytes is over, or "" when it gets diagnostics
+func (s serverSettings) diagnosticsLimit(lines int, size int) string {
+	if s.MaxFileLines > 0 && lines > s.MaxFileLines {
+		return fmt.Sprintf("it has more than %d lines (maxFileLines)", s.MaxFileLines)
+	}
+	if s.MaxFileSizeMb > 0 && size > s.MaxFileSizeMb<<20 {
+		return fmt.Sprintf("it is over %d MB (maxFileSizeMb)", s.MaxFileSizeMb)
+	}
+	return ""
+}
+
+// diagnosticsDelay returns how long to wait after an edit of a document with
+// the given number of lines before publishing its diagnostics
+func (s serverSettings) diagnosticsDelay(lines int) time.Duration {
+	delay := s.DiagnosticsDebounceMs
+	if lines >= s.LargeDocumentLines && s.LargeDocumentDebounceMs > delay {
+		delay = s.LargeDocumentDebounceMs
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// hasFileExtension reports whether path ends with one of the configured extensions
+func (s serverSettings) hasFileExtension(path string) bool {
+	for _, extension := range s.FileExtensions {
+		if len(path) >= len(extension) && strings.EqualFold(path[len(path)-len(extension):], extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// serves reports whether an opened document is an IATF file: either the
+// client tagged it with a configured language ID or its path has a
+// configured extension
+func (s serverSettings) serves(uri string, languageID string) bool {
+	for _, id := range s.LanguageIDs {
+		if id == languageID {
+			return true
+		}
+	}
+	if path, err := uriToPath(uri); err == nil {
+		return s.hasFileExtension(path)
+	}
+	parsed, err := url.Parse(uri)
+	return err == nil && s.hasFileExtension(parsed.Path)
+}
+
+// sameFileExtensions reports whether s and other search the same files
+func (s serverSettings) sameFileExtensions(other serverSettings) bool {
+	if len(s.FileExtensions) != len(other.FileExtensions) {
+		return false
+	}
+	for i := range s.FileExtensions {
+		if !strings.EqualFold(s.FileExtensions[i], other.FileExtensions[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func currentSettings() serverSettings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settings
+}
+
+func workspaceDidChangeConfiguration(context *glsp.Context, params *protocol.DidChangeConfigurationParams) error {
+	previous := currentSettings()
+	applySettings(params.Settings)
+
+	// Other extensions select other workspace files
+	if !previous.sameFileExtensions(currentSettings()) {
+		go func() {
+			index.rebuild()
+			republishDiagnostics(context)
+		}()
+		if watchedFilesSupport {
+			go registerFileWatchers(context)
+		}
+		return nil
+	}
+
+	// Severities and nesting depth may have changed every diagnostic
+	republishDiagnostics(context)
+	return nil
+}
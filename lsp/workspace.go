@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/tliron/commonlog"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+
+	"github.com/Winds-AI/agent-traversal-file/iatf"
+	"github.com/Winds-AI/agent-traversal-file/lsp/analyzer"
+)
+
+// workspace tracks the folders opened in the editor
+var workspace = &workspaceFolders{}
+
+type workspaceFolders struct {
+	mu    sync.RWMutex
+	paths []string
+}
+
+// set replaces the folders with those from initialize
+func (w *workspaceFolders) set(params *protocol.InitializeParams) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.paths = nil
+	for _, folder := range params.WorkspaceFolders {
+		if path, err := uriToPath(folder.URI); err == nil {
+			w.paths = append(w.paths, path)
+		}
+	}
+	if len(w.paths) == 0 && params.RootURI != nil {
+		if path, err := uriToPath(*params.RootURI); err == nil {
+			w.paths = append(w.paths, path)
+		}
+	}
+}
+
+// change applies a workspace/didChangeWorkspaceFolders event
+func (w *workspaceFolders) change(event protocol.WorkspaceFoldersChangeEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, folder := range event.Removed {
+		path, err := uriToPath(folder.URI)
+		if err != nil {
+			continue
+		}
+		for i, existing := range w.paths {
+			if existing == path {
+				w.paths = append(w.paths[:i], w.paths[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, folder := range event.Added {
+		if path, err := uriToPath(folder.URI); err == nil {
+			w.paths = append(w.paths, path)
+		}
+	}
+}
+
+func (w *workspaceFolders) list() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return append([]string{}, w.paths...)
+}
+
+// skippedDirs are never searched for .iatf files
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// walkWorkspaceFiles calls fn for every IATF file (by the configured
+// extensions) in the workspace folders
+func walkWorkspaceFiles(fn func(path string)) {
+	current := currentSettings()
+	for _, root := range workspace.list() {
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if entry.IsDir() {
+				if path != root && skippedDirs[entry.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if current.hasFileExtension(path) {
+				fn(path)
+			}
+			return nil
+		})
+	}
+}
+
+// index holds the parsed IATF files of the workspace folders, so features
+// work across files that are not open in the editor
+var index = &workspaceIndex{docs: map[protocol.DocumentUri]*analyzer.Document{}}
+
+type workspaceIndex struct {
+	mu   sync.RWMutex
+	docs map[protocol.DocumentUri]*analyzer.Document
+}
+
+// rebuild re-reads every IATF file in the workspace folders
+func (ix *workspaceIndex) rebuild() {
+	options := documentStore.Options()
+	docs := map[protocol.DocumentUri]*analyzer.Document{}
+	walkWorkspaceFiles(func(path string) {
+		if content, err := os.ReadFile(path); err == nil {
+			uri := pathToURI(path)
+			text, _ := iatf.StripBOM(string(content))
+			docs[uri] = analyzer.NewDocument(uri, text, options)
+		}
+	})
+
+	ix.mu.Lock()
+	ix.docs = docs
+	ix.mu.Unlock()
+	commonlog.NewInfoMessage(0, fmt.Sprintf("Indexed %d IATF files", len(docs)))
+}
+
+// load (re-)reads one file from disk; it returns nil and forgets the file if it cannot be read
+func (ix *workspaceIndex) load(path string) *analyzer.Document {
+	uri := pathToURI(path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		ix.remove(uri)
+		return nil
+	}
+
+	text, _ := iatf.StripBOM(string(content))
+	doc := analyzer.NewDocument(uri, text, documentStore.Options())
+	ix.mu.Lock()
+	ix.docs[uri] = doc
+	ix.mu.Unlock()
+	return doc
+}
+
+func (ix *workspaceIndex) remove(uri protocol.DocumentUri) {
+	ix.mu.Lock()
+	delete(ix.docs, uri)
+	ix.mu.Unlock()
+}
+
+func (ix *workspaceIndex) get(uri protocol.DocumentUri) *analyzer.Document {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.docs[uri]
+}
+
+func (ix *workspaceIndex) all() []*analyzer.Document {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	docs := make([]*analyzer.Document, 0, len(ix.docs))
+	for _, doc := range ix.docs {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// lookupDocument returns a document by URI: the editor buffer if it is open
+// (it may have unsaved changes), else the indexed file, else the file on disk
+func lookupDocument(uri protocol.DocumentUri) *analyzer.Document {
+	if doc := documentStore.Get(uri); doc != nil {
+		return doc
+	}
+	if doc := index.get(uri); doc != nil {
+		return doc
+	}
+	path, err := uriToPath(uri)
+	if err != nil {
+		return nil
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return nil
+	}
+	return index.load(path)
+}
+
+// allDocuments returns the open documents and every other indexed file
+func allDocuments() []*analyzer.Document {
+	docs := documentStore.All()
+	open := map[string]bool{}
+	for _, doc := range docs {
+		open[doc.URI] = true
+	}
+	for _, doc := range index.all() {
+		if !open[doc.URI] {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// resolverFor resolves the {@file#id} references of doc relative to its directory
+func resolverFor(doc *analyzer.Document) analyzer.Resolver {
+	base, err := uriToPath(doc.URI)
+	return func(file string) *analyzer.Document {
+		if err != nil {
+			return nil
+		}
+		path := filepath.FromSlash(file)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(base), path)
+		}
+		return lookupDocument(pathToURI(path))
+	}
+}
+
+func workspaceSymbol(context *glsp.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+	symbols := []protocol.SymbolInformation{}
+	for _, doc := range allDocuments() {
+		symbols = append(symbols, doc.GetSymbolInformation(params.Query, documentName(doc.URI))...)
+	}
+	return symbols, nil
+}
+
+func workspaceDidChangeWorkspaceFolders(context *glsp.Context, params *protocol.DidChangeWorkspaceFoldersParams) error {
+	workspace.change(params.Event)
+	go func() {
+		index.rebuild()
+		republishDiagnostics(context)
+	}()
+	return nil
+}
+
+func workspaceDidChangeWatchedFiles(context *glsp.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	rebuilt := false
+	for _, change := range params.Changes {
+		path, err := uriToPath(change.URI)
+		if err != nil {
+			continue
+		}
+		uri := pathToURI(path)
+		if change.Type == protocol.FileChangeTypeDeleted {
+			index.remove(uri)
+			continue
+		}
+		if !currentSettings().hasFileExtension(path) {
+			continue
+		}
+
+		disk := index.load(path)
+		if open := documentStore.Get(uri); open != nil && disk != nil && isExternalRebuild(open, disk) {
+			externalRebuilds.record(uri, disk.Content, disk.ContentText())
+			commonlog.NewInfoMessage(0, "INDEX of "+documentName(uri)+" was rebuilt outside the editor")
+			rebuilt = true
+		}
+	}
+
+	// Cross-file references into the changed files may now resolve differently
+	republishDiagnostics(context)
+	if rebuilt && codeLensRefreshSupport {
+		go context.Call(protocol.ServerWorkspaceCodeLensRefresh, nil, nil)
+	}
+	return nil
+}
+
+// externalRebuilds remembers open documents whose file on disk got a new
+// INDEX from the daemon or the CLI ('iatf rebuild', 'iatf watch'). Until the
+// editor reloads the file, the buffer's INDEX looks stale; as long as its
+// CONTENT is the one that was indexed, those warnings are not reported.
+var externalRebuilds = &rebuiltDocuments{files: map[protocol.DocumentUri]rebuiltFile{}}
+
+type rebuiltDocuments struct {
+	mu    sync.Mutex
+	files map[protocol.DocumentUri]rebuiltFile
+}
+
+type rebuiltFile struct {
+	disk    string // File content after the rebuild
+	content string // Its CONTENT text, which the INDEX was built from
+}
+
+func (r *rebuiltDocuments) record(uri protocol.DocumentUri, disk string, content string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[uri] = rebuiltFile{disk: disk, content: content}
+}
+
+func (r *rebuiltDocuments) forget(uri protocol.DocumentUri) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.files, uri)
+}
+
+// reloaded forgets a document once the editor has loaded the rebuilt file
+func (r *rebuiltDocuments) reloaded(uri protocol.DocumentUri, content string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if file, exists := r.files[uri]; exists && file.disk == content {
+		delete(r.files, uri)
+	}
+}
+
+// covers reports whether doc's CONTENT is the one indexed on disk
+func (r *rebuiltDocuments) covers(doc *analyzer.Document) bool {
+	r.mu.Lock()
+	file, exists := r.files[doc.URI]
+	r.mu.Unlock()
+	return exists && file.content == doc.ContentText()
+}
+
+// isExternalRebuild reports whether the file on disk differs from the editor
+// buffer only outside CONTENT, i.e. its header or INDEX was regenerated
+func isExternalRebuild(open *analyzer.Document, disk *analyzer.Document) bool {
+	return open.Content != disk.Content && open.ContentText() == disk.ContentText()
+}
+
+// withoutIndexIssues drops the stale INDEX diagnostics of a document whose
+// INDEX was rebuilt on disk
+func withoutIndexIssues(doc *analyzer.Document, diagnostics []protocol.Diagnostic) []protocol.Diagnostic {
+	if !externalRebuilds.covers(doc) {
+		return diagnostics
+	}
+
+	kept := []protocol.Diagnostic{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code != nil {
+			if code, ok := diagnostic.Code.Value.(string); ok && analyzer.IsIndexIssue(code) {
+				continue
+			}
+		}
+		kept = append(kept, diagnostic)
+	}
+	return kept
+}
+
+const watchedFilesRegistrationID = "iatf-watched-files"
+
+var (
+	watchersMu         sync.Mutex
+	watchersRegistered bool
+)
+
+// registerFileWatchers asks the client to report changes to IATF files,
+// replacing the watchers of previously configured extensions
+func registerFileWatchers(context *glsp.Context) {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	if watchersRegistered {
+		context.Call(protocol.ServerClientUnregisterCapability, protocol.UnregistrationParams{
+			Unregisterations: []protocol.Unregistration{{
+				ID:     watchedFilesRegistrationID,
+				Method: string(protocol.MethodWorkspaceDidChangeWatchedFiles),
+			}},
+		}, nil)
+	}
+
+	watchers := []protocol.FileSystemWatcher{}
+	for _, extension := range currentSettings().FileExtensions {
+		watchers = append(watchers, protocol.FileSystemWatcher{GlobPattern: "**/*" + extension})
+	}
+	context.Call(protocol.ServerClientRegisterCapability, protocol.RegistrationParams{
+		Registrations: []protocol.Registration{{
+			ID:              watchedFilesRegistrationID,
+			Method:          string(protocol.MethodWorkspaceDidChangeWatchedFiles),
+			RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{Watchers: watchers},
+		}},
+	}, nil)
+	watchersRegistered = true
+}
+
+// workspaceSectionIDs returns the section IDs of every known IATF file
+// other than doc, by workspace-relative path
+func workspaceSectionIDs(doc *analyzer.Document) map[string][]string {
+	others := map[string][]string{}
+	for _, other := range allDocuments() {
+		if other.URI != doc.URI {
+			others[workspacePath(other.URI)] = other.SectionIDs()
+		}
+	}
+	return others
+}
+
+// workspacePath returns the path of a document URI relative to the
+// workspace folder containing it, for display
+func workspacePath(uri string) string {
+	path, err := uriToPath(uri)
+	if err != nil {
+		return uri
+	}
+	for _, root := range workspace.list() {
+		if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
+
+// documentName returns the file name of a document URI, for display
+func documentName(uri string) string {
+	if path, err := uriToPath(uri); err == nil {
+		return filepath.Base(path)
+	}
+	return uri
+}
+
+// uriToPath converts a file:// document URI to a local path
+func uriToPath(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid document URI %q: %w", uri, err)
+	}
+	if parsed.Scheme != "file" {
+		return "", fmt.Errorf("not a file:// URI: %q", uri)
+	}
+
+	path := parsed.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/docs/a.iatf has the path /C:/docs/a.iatf
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// pathToURI converts a local path to a file:// URI
+func pathToURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// C:/docs/a.iatf becomes file:///C:/docs/a.iatf
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
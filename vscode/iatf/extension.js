@@ -134,7 +134,7 @@ async function startLspClient(context) {
   
   if (!serverPath) {
     console.log('IATF LSP server not found. Language features disabled.');
-    console.log('Install with: go install github.com/Winds-AI/agent-traversal-file/lsp@latest');
+    console.log('Build it with: cd lsp && go install . (from a clone of the repository)');
     return;
   }
 